@@ -0,0 +1,97 @@
+// Package bench measures the core operations of the bindings and compares them to a recorded
+// baseline. The benchmarks run like any other, `go test -bench . ./bench`; the comparison is a
+// test gated by the BISCUIT_BENCH environment variable, see TestBaseline.
+package bench
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Result is the cost of one operation.
+type Result struct {
+	NsPerOp        float64 `json:"ns_per_op"`
+	AllocsPerOp    float64 `json:"allocs_per_op"`
+	WasmCallsPerOp float64 `json:"wasm_calls_per_op"`
+}
+
+// Baseline maps benchmark names to their recorded result.
+type Baseline map[string]Result
+
+// LoadBaseline reads a baseline written by Baseline.Save.
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	return baseline, nil
+}
+
+// Save writes the baseline to path as indented JSON, benchmarks sorted by name.
+func (self Baseline) Save(path string) error {
+	data, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Regression is a metric of a benchmark that got worse than the baseline allows.
+type Regression struct {
+	Benchmark string
+	Metric    string
+	Baseline  float64
+	Current   float64
+}
+
+func (self Regression) String() string {
+	return fmt.Sprintf("%s: %s %.0f, baseline %.0f (%+.0f%%)", self.Benchmark, self.Metric, self.Current,
+		self.Baseline, (self.Current/self.Baseline-1)*100)
+}
+
+// Thresholds are the fractions metrics may exceed their baseline value by. Timings depend on the
+// machine and its load, allocation and call counts barely move.
+type Thresholds struct {
+	Time   float64
+	Counts float64
+}
+
+// DefaultThresholds tolerate the noise of a shared machine, where timings vary by more than half
+// between runs: only a doubling fails.
+var DefaultThresholds = Thresholds{Time: 1, Counts: 0.1}
+
+// Compare returns the metrics of current above their baseline value by more than thresholds
+// allow, sorted by benchmark. Benchmarks missing from either side are not compared.
+func Compare(baseline, current Baseline, thresholds Thresholds) []Regression {
+	var regressions []Regression
+	for name, result := range current {
+		recorded, ok := baseline[name]
+		if !ok {
+			continue
+		}
+		for _, metric := range []struct {
+			name              string
+			recorded, current float64
+			threshold         float64
+		}{
+			{"ns/op", recorded.NsPerOp, result.NsPerOp, thresholds.Time},
+			{"allocs/op", recorded.AllocsPerOp, result.AllocsPerOp, thresholds.Counts},
+			{"wasm-calls/op", recorded.WasmCallsPerOp, result.WasmCallsPerOp, thresholds.Counts},
+		} {
+			if metric.current > metric.recorded*(1+metric.threshold) {
+				regressions = append(regressions, Regression{name, metric.name, metric.recorded, metric.current})
+			}
+		}
+	}
+	slices.SortFunc(regressions, func(a, b Regression) int {
+		return cmp.Or(cmp.Compare(a.Benchmark, b.Benchmark), cmp.Compare(a.Metric, b.Metric))
+	})
+	return regressions
+}
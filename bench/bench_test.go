@@ -0,0 +1,326 @@
+package bench
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// benchmark is a core operation. setup prepares what op needs, op is what is measured.
+type benchmark struct {
+	name  string
+	setup func(tb testing.TB, env wasm.WasmEnv) (op func() error)
+}
+
+var benchmarks = []benchmark{
+	{"KeyPairGenerate", func(tb testing.TB, env wasm.WasmEnv) func() error {
+		return func() error {
+			keyPair := keypair.Invoke(env)
+			if err := keyPair.New(keypair.Ed25519); err != nil {
+				return err
+			}
+			return keyPair.Close()
+		}
+	}},
+	{"PrivateKeyStringRoundTrip", func(tb testing.TB, env wasm.WasmEnv) func() error {
+		privateKey, err := newRoot(tb, env).GetPrivateKey()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { _ = env.FreeObject("privatekey", privateKey.Ptr()) })
+		return func() error {
+			encoded, err := privateKey.ToString()
+			if err != nil {
+				return err
+			}
+			parsed := keypair.InvokePrivateKey(env)
+			if err := parsed.FromString(encoded); err != nil {
+				return err
+			}
+			return env.FreeObject("privatekey", parsed.Ptr())
+		}
+	}},
+	{"Build1Fact", buildFacts(1)},
+	{"Build20Facts", buildFacts(20)},
+	{"ParseVerify", func(tb testing.TB, env wasm.WasmEnv) func() error {
+		root := newRoot(tb, env)
+		public, err := root.GetPublicKey()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { _ = env.FreeObject("publickey", public.Ptr()) })
+		encoded, err := newToken(tb, env, root).ToBase64()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return func() error {
+			token, err := biscuit.FromBase64(env, encoded, public)
+			if err != nil {
+				return err
+			}
+			return token.Close()
+		}
+	}},
+	{"RejectMalformedToken", func(tb testing.TB, env wasm.WasmEnv) func() error {
+		public, err := newRoot(tb, env).GetPublicKey()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { _ = env.FreeObject("publickey", public.Ptr()) })
+		return func() error {
+			if _, err := biscuit.FromBase64(env, "En0KEwoEdXNlcgoFYWxpY2U!", public); err == nil {
+				return fmt.Errorf("malformed token parsed")
+			}
+			return nil
+		}
+	}},
+	{"Attenuate", func(tb testing.TB, env wasm.WasmEnv) func() error {
+		token := newToken(tb, env, newRoot(tb, env))
+		block, err := biscuit.NewBlockBuilder(env)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		tb.Cleanup(func() { _ = block.Close() })
+		if err := block.AddCode(`check if operation("read");`); err != nil {
+			tb.Fatal(err)
+		}
+		return func() error {
+			attenuated, err := token.Append(block)
+			if err != nil {
+				return err
+			}
+			return attenuated.Close()
+		}
+	}},
+	{"AuthorizerAddFact200", addFacts(200, false)},
+	{"AuthorizerAddFacts200", addFacts(200, true)},
+	{"Authorize50Statements", func(tb testing.TB, env wasm.WasmEnv) func() error {
+		token := newToken(tb, env, newRoot(tb, env))
+		policy := authorizerPolicy(50)
+		return func() error {
+			builder, err := biscuit.NewAuthorizerBuilder(env)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = builder.Close() }()
+			if err := builder.AddCode(policy); err != nil {
+				return err
+			}
+			authorizer, err := builder.Build(token)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = authorizer.Close() }()
+			_, err = authorizer.Authorize()
+			return err
+		}
+	}},
+}
+
+func newRoot(tb testing.TB, env wasm.WasmEnv) *keypair.KeyPair {
+	tb.Helper()
+
+	root := keypair.Invoke(env)
+	if err := root.New(keypair.Ed25519); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = root.Close() })
+	return root
+}
+
+// newToken mints a token granting alice the read operation.
+func newToken(tb testing.TB, env wasm.WasmEnv, root *keypair.KeyPair) *biscuit.Biscuit {
+	tb.Helper()
+
+	builder, err := biscuit.NewBuilder(env)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice"); right("read");`); err != nil {
+		tb.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = token.Close() })
+	return token
+}
+
+// buildFacts mints a token of n facts.
+func buildFacts(n int) func(testing.TB, wasm.WasmEnv) func() error {
+	return func(tb testing.TB, env wasm.WasmEnv) func() error {
+		root := newRoot(tb, env)
+		facts := make([]biscuit.Fact, n)
+		for i := range facts {
+			fact, err := biscuit.NewFact("resource", biscuit.StringTerm(fmt.Sprintf("/files/%d", i)))
+			if err != nil {
+				tb.Fatal(err)
+			}
+			facts[i] = fact
+		}
+		return func() error {
+			builder, err := biscuit.NewBuilder(env)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = builder.Close() }()
+			for _, fact := range facts {
+				if err := builder.AddFact(fact); err != nil {
+					return err
+				}
+			}
+			token, err := builder.Build(root)
+			if err != nil {
+				return err
+			}
+			return token.Close()
+		}
+	}
+}
+
+// addFacts adds n request facts to an authorizer builder, one at a time or as a batch.
+func addFacts(n int, batch bool) func(testing.TB, wasm.WasmEnv) func() error {
+	return func(tb testing.TB, env wasm.WasmEnv) func() error {
+		facts := make([]biscuit.Fact, n)
+		for i := range facts {
+			fact, err := biscuit.NewFact("header", biscuit.StringTerm(fmt.Sprintf("x-header-%d", i)), biscuit.IntegerTerm(int64(i)))
+			if err != nil {
+				tb.Fatal(err)
+			}
+			facts[i] = fact
+		}
+		return func() error {
+			builder, err := biscuit.NewAuthorizerBuilder(env)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = builder.Close() }()
+			if batch {
+				return builder.AddFacts(facts)
+			}
+			for _, fact := range facts {
+				if err := builder.AddFact(fact); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+}
+
+// authorizerPolicy returns n statements allowing the tokens of newToken: facts, checks on them
+// and a final allow policy.
+func authorizerPolicy(n int) string {
+	var code strings.Builder
+	checks := n / 10
+	for i := range n - checks - 1 {
+		fmt.Fprintf(&code, "resource(\"/files/%d\");\n", i)
+	}
+	for i := range checks {
+		fmt.Fprintf(&code, "check if resource(\"/files/%d\");\n", i)
+	}
+	code.WriteString(`allow if user("alice"), right("read");` + "\n")
+	return code.String()
+}
+
+// run measures bench, reporting the guest calls an operation costs as wasm-calls/op.
+func run(b *testing.B, bench benchmark) {
+	calls := 0
+	env := wasmtest.Env(b).WithCallHook(func(string) { calls++ })
+	op := bench.setup(b, env)
+
+	calls = 0
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := op(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(calls)/float64(b.N), "wasm-calls/op")
+}
+
+func BenchmarkOperations(b *testing.B) {
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) { run(b, bench) })
+	}
+}
+
+// TestBaseline runs the benchmarks and fails when one is slower, allocates more or calls the guest
+// more than testdata/baseline.json records, beyond DefaultThresholds. It only runs with BISCUIT_BENCH
+// set: to 1 to compare, to update to record the current results as the new baseline.
+// BISCUIT_BENCH_THRESHOLD overrides the time threshold.
+func TestBaseline(t *testing.T) {
+	mode := os.Getenv("BISCUIT_BENCH")
+	if mode == "" {
+		t.Skip("set BISCUIT_BENCH=1 to compare the benchmarks to their baseline")
+	}
+	thresholds := DefaultThresholds
+	if value := os.Getenv("BISCUIT_BENCH_THRESHOLD"); value != "" {
+		var err error
+		if thresholds.Time, err = strconv.ParseFloat(value, 64); err != nil {
+			t.Fatalf("invalid BISCUIT_BENCH_THRESHOLD: %v", err)
+		}
+	}
+	path, err := filepath.Abs(filepath.Join("testdata", "baseline.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wasmtest.Env(t)
+
+	current := Baseline{}
+	for _, bench := range benchmarks {
+		result := testing.Benchmark(func(b *testing.B) { run(b, bench) })
+		if result.N == 0 {
+			t.Fatalf("%s did not run", bench.name)
+		}
+		current[bench.name] = Result{
+			NsPerOp:        float64(result.NsPerOp()),
+			AllocsPerOp:    float64(result.AllocsPerOp()),
+			WasmCallsPerOp: result.Extra["wasm-calls/op"],
+		}
+		t.Logf("%-26s %s", bench.name, result)
+	}
+
+	if mode == "update" {
+		if err := current.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	baseline, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, regression := range Compare(baseline, current, thresholds) {
+		t.Error(regression)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := Baseline{
+		"Fast": {NsPerOp: 100, AllocsPerOp: 10, WasmCallsPerOp: 4},
+		"Slow": {NsPerOp: 100, AllocsPerOp: 10, WasmCallsPerOp: 4},
+		"Gone": {NsPerOp: 100},
+	}
+	current := Baseline{
+		"Fast": {NsPerOp: 190, AllocsPerOp: 8, WasmCallsPerOp: 4},
+		"Slow": {NsPerOp: 210, AllocsPerOp: 10, WasmCallsPerOp: 5},
+		"New":  {NsPerOp: 1000},
+	}
+
+	regressions := Compare(baseline, current, DefaultThresholds)
+	want := []Regression{{"Slow", "ns/op", 100, 210}, {"Slow", "wasm-calls/op", 4, 5}}
+	if !slices.Equal(regressions, want) {
+		t.Errorf("regressions = %v, want %v", regressions, want)
+	}
+}
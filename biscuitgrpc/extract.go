@@ -0,0 +1,69 @@
+package biscuitgrpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Extractor finds the token of a call in its incoming metadata.
+type Extractor interface {
+	// Extract returns the token found in md and whether there is one.
+	Extract(md metadata.MD) (string, bool)
+}
+
+// Metadata reads the token from the first value of the metadata key Key. A value starting with
+// the case-insensitive Scheme and a space has it dropped, other values are the token as is.
+type Metadata struct {
+	Key    string
+	Scheme string
+}
+
+func (self Metadata) Extract(md metadata.MD) (string, bool) {
+	values := md.Get(self.Key)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	token := values[0]
+	if self.Scheme != "" {
+		if scheme, rest, found := strings.Cut(token, " "); found && strings.EqualFold(scheme, self.Scheme) {
+			token = rest
+		}
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Chain tries its extractors in order. The first one finding a token wins: tokens the next ones
+// would have found are ignored, even when they differ.
+type Chain []Extractor
+
+func (self Chain) Extract(md metadata.MD) (string, bool) {
+	for _, extractor := range self {
+		if token, ok := extractor.Extract(md); ok {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// extractToken finds the token of the call with the extractor of cfg.
+func extractToken(ctx context.Context, cfg Config) (string, bool) {
+	extractor := cfg.Extractor
+	if extractor == nil {
+		key := cfg.MetadataKey
+		if key == "" {
+			key = DefaultMetadataKey
+		}
+		extractor = Metadata{Key: key, Scheme: "Bearer"}
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return extractor.Extract(md)
+}
@@ -0,0 +1,34 @@
+package biscuitgrpc
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestExtractors(t *testing.T) {
+	md := metadata.Pairs(
+		"authorization", "Bearer from-authorization",
+		"x-biscuit", "from-custom",
+		"x-biscuit", "second-value",
+	)
+
+	for _, tc := range []struct {
+		name      string
+		extractor Extractor
+		want      string
+	}{
+		{"bearer", Metadata{Key: "authorization", Scheme: "Bearer"}, "from-authorization"},
+		{"no scheme", Metadata{Key: "authorization"}, "Bearer from-authorization"},
+		{"optional scheme", Metadata{Key: "x-biscuit", Scheme: "Bearer"}, "from-custom"},
+		{"missing key", Metadata{Key: "x-missing"}, ""},
+		{"chain first wins", Chain{Metadata{Key: "x-biscuit"}, Metadata{Key: "authorization", Scheme: "Bearer"}}, "from-custom"},
+		{"chain skips missing", Chain{Metadata{Key: "x-missing"}, Metadata{Key: "authorization", Scheme: "Bearer"}}, "from-authorization"},
+		{"empty chain", Chain{}, ""},
+	} {
+		token, ok := tc.extractor.Extract(md)
+		if token != tc.want || ok != (tc.want != "") {
+			t.Errorf("%s: got %q, %t, want %q", tc.name, token, ok, tc.want)
+		}
+	}
+}
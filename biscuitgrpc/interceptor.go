@@ -0,0 +1,188 @@
+package biscuitgrpc
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/wasm"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMetadataKey is the metadata key the token is read from when Config.MetadataKey is empty.
+// Its value may carry a `Bearer ` prefix.
+const DefaultMetadataKey = "authorization"
+
+// Config describes how calls are authorized.
+type Config struct {
+	// Env is the wasm environment tokens are parsed and authorized in. The interceptors serialize
+	// their calls into it with its Locker, other code using it concurrently must hold it too.
+	Env wasm.WasmEnv
+	// RootKey supplies the public key tokens must be signed with.
+	RootKey biscuit.RootKeyProvider
+	// Authorizer is the datalog (facts, rules, checks and policies) evaluated for every call.
+	Authorizer string
+	// MetadataKey is the metadata key holding the token, DefaultMetadataKey when empty. It is
+	// ignored when Extractor is set.
+	MetadataKey string
+	// Extractor finds the token in the call metadata, a Metadata extractor of MetadataKey with an
+	// optional Bearer scheme when nil.
+	Extractor Extractor
+	// Revocations, when set, rejects tokens one of whose blocks was revoked with Unauthenticated
+	// and a "revoked biscuit token" message, before the authorizer runs.
+	Revocations biscuit.RevocationStore
+	// Audit, when set, receives the record of every call carrying a token, those whose token is
+	// invalid or revoked included, identified by the first x-request-id metadata value.
+	Audit biscuit.AuditSink
+	// AuditIncludeToken adds the token itself to the audit records.
+	AuditIncludeToken bool
+	// Verify restricts the algorithms of the tokens and sets the clock skew of the time facts
+	// every call gets, see biscuit.RequestOptions.
+	Verify biscuit.VerifyOptions
+	// Now is the clock the time facts are read from, time.Now when nil.
+	Now func() time.Time
+}
+
+type tokenKey struct{}
+
+// TokenFromContext returns the base64 token verified and authorized for the current call.
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenKey{}).(string)
+	return token, ok
+}
+
+// UnaryServerInterceptor authorizes every unary call with the biscuit token found in its metadata.
+func UnaryServerInterceptor(cfg Config) grpc.UnaryServerInterceptor {
+	authorizer := newAuthorizer(cfg)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := verify(ctx, authorizer, cfg, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authorizes every stream once, when it starts.
+func StreamServerInterceptor(cfg Config) grpc.StreamServerInterceptor {
+	authorizer := newAuthorizer(cfg)
+
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := verify(stream.Context(), authorizer, cfg, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authorizedStream exposes the context carrying the verified token to stream handlers.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (self *authorizedStream) Context() context.Context {
+	return self.ctx
+}
+
+// newAuthorizer parses the authorizer of cfg, nil when it is invalid: every call then fails with
+// Internal.
+func newAuthorizer(cfg Config) *biscuit.RequestAuthorizer {
+	authorizer, err := biscuit.NewRequestAuthorizer(cfg.Env, cfg.Authorizer, biscuit.RequestOptions{
+		RootKey:           cfg.RootKey,
+		Revocations:       cfg.Revocations,
+		Audit:             cfg.Audit,
+		AuditIncludeToken: cfg.AuditIncludeToken,
+		Verify:            cfg.Verify,
+		Now:               cfg.Now,
+	})
+	if err != nil {
+		slog.Error("cannot load authorizer code", slog.Any("err", err))
+		return nil
+	}
+	return authorizer
+}
+
+// verify authorizes the call to fullMethod and returns ctx enriched with its token.
+func verify(ctx context.Context, authorizer *biscuit.RequestAuthorizer, cfg Config, fullMethod string) (context.Context, error) {
+	token, ok := extractToken(ctx, cfg)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing biscuit token")
+	}
+	if authorizer == nil {
+		return nil, status.Error(codes.Internal, "cannot load authorizer code")
+	}
+
+	facts, err := FactsFromCall(ctx, fullMethod)
+	if err != nil {
+		slog.Error("cannot build call facts", slog.Any("err", err))
+		return nil, status.Error(codes.Internal, "cannot build call facts")
+	}
+
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-request-id"); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	err = authorizer.Authorize(ctx, token, facts, requestID)
+	switch {
+	case err == nil:
+		return context.WithValue(ctx, tokenKey{}, token), nil
+	case errors.Is(err, biscuit.ErrInvalidToken):
+		slog.Debug("invalid token", slog.Any("err", err))
+		return nil, status.Error(codes.Unauthenticated, "invalid biscuit token")
+	case errors.Is(err, biscuit.ErrRevoked):
+		slog.Debug("revoked token", slog.Any("err", err))
+		return nil, status.Error(codes.Unauthenticated, "revoked biscuit token")
+	case errors.Is(err, biscuit.ErrNotAuthorized):
+		slog.Debug("call not authorized", slog.Any("err", err))
+		return nil, status.Error(codes.PermissionDenied, "not authorized")
+	default:
+		slog.Error("authorization failed", slog.Any("err", err))
+		return nil, status.Error(codes.Internal, "authorization failed")
+	}
+}
+
+// FactsFromCall describes a call to fullMethod (`/package.Service/Method`) with
+// `service(<package.Service>)`, `method(<Method>)` and, when the peer address is an IP,
+// `remote_ip(<ip>)`.
+func FactsFromCall(ctx context.Context, fullMethod string) ([]biscuit.Fact, error) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+
+	serviceFact, err := biscuit.NewFact("service", biscuit.StringTerm(service))
+	if err != nil {
+		return nil, err
+	}
+	methodFact, err := biscuit.NewFact("method", biscuit.StringTerm(method))
+	if err != nil {
+		return nil, err
+	}
+	facts := []biscuit.Fact{serviceFact, methodFact}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote := p.Addr.String()
+		if h, _, err := net.SplitHostPort(remote); err == nil {
+			remote = h
+		}
+		if ip := net.ParseIP(remote); ip != nil {
+			f, err := biscuit.NewFact("remote_ip", biscuit.StringTerm(ip.String()))
+			if err != nil {
+				return nil, err
+			}
+			facts = append(facts, f)
+		}
+	}
+
+	return facts, nil
+}
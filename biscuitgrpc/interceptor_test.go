@@ -0,0 +1,329 @@
+package biscuitgrpc
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newRoot(t *testing.T, env wasm.WasmEnv) (*keypair.KeyPair, keypair.PublicKey) {
+	t.Helper()
+
+	root := keypair.Invoke(env)
+	if err := root.New(keypair.Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, publicKey
+}
+
+func newToken(t *testing.T, env wasm.WasmEnv, root *keypair.KeyPair, code string) string {
+	t.Helper()
+
+	builder, err := biscuit.NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(code); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+// tokenCheckingHealth fails calls whose context does not carry a verified token.
+type tokenCheckingHealth struct {
+	*health.Server
+}
+
+func (self tokenCheckingHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if _, ok := TokenFromContext(ctx); !ok {
+		return nil, status.Error(codes.Internal, "no token in context")
+	}
+	return self.Server.Check(ctx, req)
+}
+
+func (self tokenCheckingHealth) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if _, ok := TokenFromContext(stream.Context()); !ok {
+		return status.Error(codes.Internal, "no token in context")
+	}
+	return self.Server.Watch(req, stream)
+}
+
+func newClient(t *testing.T, cfg Config) healthpb.HealthClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(cfg)),
+		grpc.StreamInterceptor(StreamServerInterceptor(cfg)),
+	)
+	healthpb.RegisterHealthServer(server, tokenCheckingHealth{health.NewServer()})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func withToken(token string) context.Context {
+	if token == "" {
+		return context.Background()
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), DefaultMetadataKey, "Bearer "+token)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	env := wasmtest.Env(t)
+	root, publicKey := newRoot(t, env)
+	allowed := newToken(t, env, root, `check if service("grpc.health.v1.Health"), method("Check");`)
+	denied := newToken(t, env, root, `check if method("Watch");`)
+
+	client := newClient(t, Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(publicKey),
+		Authorizer: `allow if true;`,
+	})
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{"allowed", allowed, codes.OK},
+		{"failed check", denied, codes.PermissionDenied},
+		{"missing token", "", codes.Unauthenticated},
+		{"invalid token", "not-a-token", codes.Unauthenticated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.Check(withToken(tc.token), &healthpb.HealthCheckRequest{})
+			if got := status.Code(err); got != tc.want {
+				t.Errorf("code = %v, want %v (%v)", got, tc.want, err)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	env := wasmtest.Env(t)
+	root, publicKey := newRoot(t, env)
+	allowed := newToken(t, env, root, `check if method("Watch");`)
+	denied := newToken(t, env, root, `check if method("Check");`)
+
+	client := newClient(t, Config{
+		Env:         env,
+		RootKey:     biscuit.StaticRootKey(publicKey),
+		Authorizer:  `allow if true;`,
+		MetadataKey: "x-biscuit",
+	})
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  codes.Code
+	}{
+		{"allowed", allowed, codes.OK},
+		{"failed check", denied, codes.PermissionDenied},
+		{"missing token", "", codes.Unauthenticated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.token != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-biscuit", tc.token)
+			}
+
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if got := status.Code(err); got != tc.want {
+				t.Errorf("code = %v, want %v (%v)", got, tc.want, err)
+			}
+		})
+	}
+}
+
+// TestInterceptorsShareEnvLock runs unary and stream calls concurrently, the interceptors must
+// serialize them on the lock of the env.
+func TestInterceptorsShareEnvLock(t *testing.T) {
+	env := wasmtest.Env(t)
+	root, publicKey := newRoot(t, env)
+	token := newToken(t, env, root, `user("alice");`)
+
+	client := newClient(t, Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(publicKey),
+		Authorizer: `allow if user("alice");`,
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for range 8 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := client.Check(withToken(token), &healthpb.HealthCheckRequest{})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(withToken(token))
+			defer cancel()
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestUnaryServerInterceptorRevocation(t *testing.T) {
+	env := wasmtest.Env(t)
+	root, publicKey := newRoot(t, env)
+	token := newToken(t, env, root, `user("alice");`)
+
+	parsed, err := biscuit.FromBase64(env, token, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = parsed.Close() }()
+	block, err := biscuit.NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := block.AddCode(`check if method("Check");`); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := parsed.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+	attenuatedToken, err := attenuated.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := attenuated.RevocationIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := biscuit.NewMemoryRevocationStore()
+	if err := store.Revoke(context.Background(), ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newClient(t, Config{
+		Env:         env,
+		RootKey:     biscuit.StaticRootKey(publicKey),
+		Authorizer:  `allow if true;`,
+		Revocations: store,
+	})
+
+	_, err = client.Check(withToken(attenuatedToken), &healthpb.HealthCheckRequest{})
+	if status.Code(err) != codes.Unauthenticated || !strings.Contains(status.Convert(err).Message(), "revoked") {
+		t.Errorf("err = %v, want Unauthenticated reporting the revocation", err)
+	}
+	if _, err := client.Check(withToken(token), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("token before attenuation rejected: %v", err)
+	}
+}
+
+func TestUnaryServerInterceptorAudit(t *testing.T) {
+	env := wasmtest.Env(t)
+	root, publicKey := newRoot(t, env)
+	token := newToken(t, env, root, `user("alice");`)
+
+	sink := make(biscuit.ChannelAuditSink, 4)
+	client := newClient(t, Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(publicKey),
+		Authorizer: `allow if user("alice"), method("Check");`,
+		Audit:      sink,
+	})
+
+	ctx := metadata.AppendToOutgoingContext(withToken(token), "x-request-id", "call-1")
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if record := <-sink; !record.Allowed || record.RequestID != "call-1" || record.Token != "" {
+		t.Errorf("allow record = %+v", record)
+	}
+
+	if _, err := client.Check(withToken(newToken(t, env, root, `user("bob");`)), &healthpb.HealthCheckRequest{}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("err = %v, want PermissionDenied", err)
+	}
+	if record := <-sink; record.Allowed || record.Error == "" || record.Policy != -1 {
+		t.Errorf("deny record = %+v", record)
+	}
+	if len(sink) != 0 {
+		t.Errorf("%d extra records", len(sink))
+	}
+}
+
+func TestUnaryServerInterceptorExtractor(t *testing.T) {
+	env := wasmtest.Env(t)
+	root, publicKey := newRoot(t, env)
+	token := newToken(t, env, root, `user("alice");`)
+
+	client := newClient(t, Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(publicKey),
+		Authorizer: `allow if user("alice");`,
+		Extractor:  Chain{Metadata{Key: "x-biscuit"}, Metadata{Key: DefaultMetadataKey, Scheme: "Bearer"}},
+	})
+
+	ctx := metadata.AppendToOutgoingContext(withToken("not-a-token"), "x-biscuit", token)
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("x-biscuit token rejected: %v", err)
+	}
+	if _, err := client.Check(withToken(token), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("authorization fallback rejected: %v", err)
+	}
+}
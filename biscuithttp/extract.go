@@ -0,0 +1,74 @@
+package biscuithttp
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Extractor finds the token of a request.
+type Extractor interface {
+	// Extract returns the token of r and whether it carries one.
+	Extract(r *http.Request) (string, bool)
+}
+
+// DefaultExtractor reads `Authorization: Bearer <token>`, it is used when Config.Extractor is nil.
+var DefaultExtractor Extractor = HeaderScheme{Header: "Authorization", Scheme: "Bearer"}
+
+// HeaderScheme reads the token from a header. With a Scheme, the value must be the
+// case-insensitive scheme, a space and the token; without, the whole value is the token.
+type HeaderScheme struct {
+	Header string
+	Scheme string
+}
+
+func (self HeaderScheme) Extract(r *http.Request) (string, bool) {
+	token := r.Header.Get(self.Header)
+	if self.Scheme != "" {
+		scheme, rest, found := strings.Cut(token, " ")
+		if !found || !strings.EqualFold(scheme, self.Scheme) {
+			return "", false
+		}
+		token = rest
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// Cookie reads the token from the cookie named Name, e.g. `__biscuit`.
+type Cookie struct {
+	Name string
+}
+
+func (self Cookie) Extract(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(self.Name)
+	if err != nil {
+		return "", false
+	}
+	token := strings.TrimSpace(cookie.Value)
+	return token, token != ""
+}
+
+// Query reads the token from the first query parameter named Name, e.g. `access_token`. Query
+// strings end up in access logs and browser history, prefer a header or a cookie.
+type Query struct {
+	Name string
+}
+
+func (self Query) Extract(r *http.Request) (string, bool) {
+	token := strings.TrimSpace(r.URL.Query().Get(self.Name))
+	return token, token != ""
+}
+
+// Chain tries its extractors in order. The first one finding a token wins: tokens the next ones
+// would have found are ignored, even when they differ.
+type Chain []Extractor
+
+func (self Chain) Extract(r *http.Request) (string, bool) {
+	for _, extractor := range self {
+		if token, ok := extractor.Extract(r); ok {
+			return token, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,65 @@
+package biscuithttp
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExtractors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/files?access_token=from-query", nil)
+	r.Header.Set("Authorization", "bearer from-header")
+	r.Header.Set("X-Internal-Token", " from-custom ")
+	r.AddCookie(&http.Cookie{Name: "__biscuit", Value: "from-cookie"})
+
+	for _, tc := range []struct {
+		name      string
+		extractor Extractor
+		want      string
+	}{
+		{"default", DefaultExtractor, "from-header"},
+		{"custom header", HeaderScheme{Header: "X-Internal-Token"}, "from-custom"},
+		{"wrong scheme", HeaderScheme{Header: "Authorization", Scheme: "Basic"}, ""},
+		{"missing header", HeaderScheme{Header: "X-Missing"}, ""},
+		{"cookie", Cookie{Name: "__biscuit"}, "from-cookie"},
+		{"missing cookie", Cookie{Name: "session"}, ""},
+		{"query", Query{Name: "access_token"}, "from-query"},
+		{"missing query", Query{Name: "token"}, ""},
+		{"chain first wins", Chain{Cookie{Name: "__biscuit"}, Query{Name: "access_token"}, DefaultExtractor}, "from-cookie"},
+		{"chain skips missing", Chain{Cookie{Name: "session"}, Query{Name: "access_token"}}, "from-query"},
+		{"empty chain", Chain{}, ""},
+	} {
+		token, ok := tc.extractor.Extract(r)
+		if token != tc.want || ok != (tc.want != "") {
+			t.Errorf("%s: got %q, %t, want %q", tc.name, token, ok, tc.want)
+		}
+	}
+}
+
+func TestMiddlewareCookieExtractor(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `user("alice");`)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(root),
+		Authorizer: `allow if user("alice");`,
+		Extractor:  Chain{Cookie{Name: "__biscuit"}, DefaultExtractor},
+	})(ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "__biscuit", Value: token})
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want the cookie token to win", rec.Code)
+	}
+
+	if got := serve(handler, "/", token); got != http.StatusOK {
+		t.Errorf("status = %d without cookie, want the header fallback", got)
+	}
+}
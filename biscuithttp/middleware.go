@@ -0,0 +1,157 @@
+package biscuithttp
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Config describes how requests are authorized.
+type Config struct {
+	// Env is the wasm environment tokens are parsed and authorized in. The middlewares serialize
+	// their calls into it with its Locker, other code using it concurrently must hold it too.
+	Env wasm.WasmEnv
+	// RootKey supplies the public key tokens must be signed with.
+	RootKey biscuit.RootKeyProvider
+	// Authorizer is the datalog (facts, rules, checks and policies) evaluated for every request.
+	// It is parsed once, when the middleware is created.
+	Authorizer string
+	// Extractor finds the token of a request, DefaultExtractor when nil.
+	Extractor Extractor
+	// FactsFromRequest contributes facts describing the request on top of the ones from
+	// DefaultFactsFromRequest. A nil hook means only the defaults are added.
+	FactsFromRequest func(*http.Request) ([]biscuit.Fact, error)
+	// Revocations, when set, rejects tokens one of whose blocks was revoked before the authorizer
+	// runs.
+	Revocations biscuit.RevocationStore
+	// Audit, when set, receives the record of every request carrying a token, those whose token
+	// is invalid or revoked included.
+	Audit biscuit.AuditSink
+	// AuditIncludeToken adds the token itself to the audit records.
+	AuditIncludeToken bool
+	// Verify restricts the algorithms of the tokens and sets the clock skew of the time facts
+	// every request gets, see biscuit.RequestOptions.
+	Verify biscuit.VerifyOptions
+	// Now is the clock the time facts are read from, time.Now when nil.
+	Now func() time.Time
+	// RequestID returns the identifier of a request recorded in audit records, the
+	// X-Request-Id header when nil.
+	RequestID func(*http.Request) string
+}
+
+// Middleware authorizes every request with the biscuit token found by the extractor, its
+// `Authorization: Bearer` header by default. Requests without a valid token get 401, requests whose token
+// is not authorized get 403 and failures to describe or evaluate the request get 500. Revoked
+// tokens get 401 with an `invalid_token` challenge describing the revocation.
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	extractor := cfg.Extractor
+	if extractor == nil {
+		extractor = DefaultExtractor
+	}
+
+	authorizer, err := biscuit.NewRequestAuthorizer(cfg.Env, cfg.Authorizer, biscuit.RequestOptions{
+		RootKey:           cfg.RootKey,
+		Revocations:       cfg.Revocations,
+		Audit:             cfg.Audit,
+		AuditIncludeToken: cfg.AuditIncludeToken,
+		Verify:            cfg.Verify,
+		Now:               cfg.Now,
+	})
+	if err != nil {
+		slog.Error("cannot load authorizer code", slog.Any("err", err))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := extractor.Extract(r)
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if authorizer == nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			facts, err := DefaultFactsFromRequest(r)
+			if err == nil && cfg.FactsFromRequest != nil {
+				var extra []biscuit.Fact
+				extra, err = cfg.FactsFromRequest(r)
+				facts = append(facts, extra...)
+			}
+			if err != nil {
+				slog.Error("cannot build request facts", slog.Any("err", err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			requestID := r.Header.Get("X-Request-Id")
+			if cfg.RequestID != nil {
+				requestID = cfg.RequestID(r)
+			}
+			err = authorizer.Authorize(r.Context(), token, facts, requestID)
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r)
+			case errors.Is(err, biscuit.ErrInvalidToken):
+				slog.Debug("invalid token", slog.Any("err", err))
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			case errors.Is(err, biscuit.ErrRevoked):
+				slog.Debug("revoked token", slog.Any("err", err))
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token revoked"`)
+				http.Error(w, "token revoked", http.StatusUnauthorized)
+			case errors.Is(err, biscuit.ErrNotAuthorized):
+				slog.Debug("request not authorized", slog.Any("err", err))
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			default:
+				slog.Error("authorization failed", slog.Any("err", err))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+// DefaultFactsFromRequest describes the request with `operation(<method>)`,
+// `resource(<normalized path>)`, `host(<host without port>)` and, when the peer address is an
+// IP, `remote_ip(<ip>)`.
+func DefaultFactsFromRequest(r *http.Request) ([]biscuit.Fact, error) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	facts := make([]biscuit.Fact, 0, 4)
+	for _, fact := range []struct {
+		name  string
+		value string
+	}{
+		{"operation", r.Method},
+		{"resource", path.Clean("/" + r.URL.Path)},
+		{"host", host},
+	} {
+		f, err := biscuit.NewFact(fact.name, biscuit.StringTerm(fact.value))
+		if err != nil {
+			return nil, err
+		}
+		facts = append(facts, f)
+	}
+
+	remote := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(remote); err == nil {
+		remote = h
+	}
+	if ip := net.ParseIP(remote); ip != nil {
+		f, err := biscuit.NewFact("remote_ip", biscuit.StringTerm(ip.String()))
+		if err != nil {
+			return nil, err
+		}
+		facts = append(facts, f)
+	}
+
+	return facts, nil
+}
@@ -0,0 +1,396 @@
+package biscuithttp
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newToken(t *testing.T, env wasm.WasmEnv, code string) (string, keypair.PublicKey) {
+	t.Helper()
+
+	root := keypair.Invoke(env)
+	if err := root.New(keypair.Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := biscuit.NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(code); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded, publicKey
+}
+
+func serve(handler http.Handler, target string, token string) int {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestMiddleware(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `check if resource($r), $r.starts_with("/files/");`)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(root),
+		Authorizer: `allow if true;`,
+	})(ok)
+
+	for _, tc := range []struct {
+		name   string
+		target string
+		token  string
+		want   int
+	}{
+		{"allowed", "/files/123", token, http.StatusOK},
+		{"failed check", "/admin", token, http.StatusForbidden},
+		{"traversal", "/files/../admin", token, http.StatusForbidden},
+		{"quote injection", `/admin%22),resource(%22/files/x`, token, http.StatusForbidden},
+		{"missing token", "/files/123", "", http.StatusUnauthorized},
+		{"invalid token", "/files/123", "not-a-token", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := serve(handler, tc.target, tc.token); got != tc.want {
+				t.Errorf("status = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestMiddlewaresShareEnvLock serves requests concurrently through two middlewares of the same env,
+// they must serialize them on its lock.
+func TestMiddlewaresShareEnvLock(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `check if resource($r), $r.starts_with("/files/");`)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cfg := Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(root),
+		Authorizer: `allow if true;`,
+	}
+	handlers := []http.Handler{Middleware(cfg)(ok), Middleware(cfg)(ok)}
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, 16)
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- serve(handlers[i%2], "/files/1", token)
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	for status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("status = %d, want %d", status, http.StatusOK)
+		}
+	}
+}
+
+func TestMiddlewareFactsFromRequest(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `check if tenant("acme");`)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cfg := Config{
+		Env:        env,
+		RootKey:    biscuit.StaticRootKey(root),
+		Authorizer: `allow if resource($r);`,
+		FactsFromRequest: func(r *http.Request) ([]biscuit.Fact, error) {
+			fact, err := biscuit.NewFact("tenant", biscuit.StringTerm(r.Header.Get("X-Tenant")))
+			return []biscuit.Fact{fact}, err
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/files/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	Middleware(cfg)(ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	req.Header.Set("X-Tenant", "other")
+	rec = httptest.NewRecorder()
+	Middleware(cfg)(ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	cfg.FactsFromRequest = func(r *http.Request) ([]biscuit.Fact, error) {
+		return nil, errors.New("boom")
+	}
+	if got := serve(Middleware(cfg)(ok), "/files/1", token); got != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", got, http.StatusInternalServerError)
+	}
+}
+
+func TestDefaultFactsFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com:8080/a/../b", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	facts, err := DefaultFactsFromRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`operation("POST")`, `resource("/b")`, `host("example.com")`, `remote_ip("10.0.0.1")`}
+	if len(facts) != len(want) {
+		t.Fatalf("got %d facts, want %d", len(facts), len(want))
+	}
+	for i, fact := range facts {
+		if fact.String() != want[i] {
+			t.Errorf("fact %d = %s, want %s", i, fact, want[i])
+		}
+	}
+}
+
+func TestMiddlewareRevocation(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `user("alice");`)
+
+	parsed, err := biscuit.FromBase64(env, token, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = parsed.Close() }()
+	block, err := biscuit.NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := block.AddCode(`check if resource($r), $r.starts_with("/files/");`); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := parsed.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+	attenuatedToken, err := attenuated.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := attenuated.RevocationIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := biscuit.NewMemoryRevocationStore()
+	if err := store.Revoke(context.Background(), ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(Config{
+		Env:         env,
+		RootKey:     biscuit.StaticRootKey(root),
+		Authorizer:  `allow if true;`,
+		Revocations: store,
+	})(ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/1", nil)
+	req.Header.Set("Authorization", "Bearer "+attenuatedToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "revoked") {
+		t.Errorf("status = %d, body %q, want a 401 reporting the revocation", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Header().Get("WWW-Authenticate"), "invalid_token") {
+		t.Errorf("WWW-Authenticate = %q, want an invalid_token challenge", rec.Header().Get("WWW-Authenticate"))
+	}
+
+	if got := serve(handler, "/files/1", token); got != http.StatusOK {
+		t.Errorf("status = %d for the token before attenuation, want %d", got, http.StatusOK)
+	}
+}
+
+// lockingRootKey and lockingStore take the env lock like a provider or a store using the env
+// would: the middleware must not hold it while calling them.
+type lockingRootKey struct {
+	biscuit.RootKeyProvider
+	lock sync.Locker
+}
+
+func (self lockingRootKey) RootKey(ctx context.Context) (keypair.PublicKey, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.RootKeyProvider.RootKey(ctx)
+}
+
+type lockingStore struct {
+	biscuit.RevocationStore
+	lock sync.Locker
+}
+
+func (self lockingStore) IsRevoked(ctx context.Context, id []byte) (bool, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.RevocationStore.IsRevoked(ctx, id)
+}
+
+func TestMiddlewareLockScope(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `user("alice");`)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(Config{
+		Env:         env,
+		RootKey:     lockingRootKey{biscuit.StaticRootKey(root), env.Locker()},
+		Authorizer:  `allow if user("alice");`,
+		Revocations: lockingStore{biscuit.NewMemoryRevocationStore(), env.Locker()},
+	})(ok)
+
+	done := make(chan int)
+	go func() { done <- serve(handler, "/files/1", token) }()
+	select {
+	case got := <-done:
+		if got != http.StatusOK {
+			t.Errorf("status = %d, want %d", got, http.StatusOK)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the root key or the revocations were looked up under the env lock")
+	}
+}
+
+func TestMiddlewareInvalidAuthorizer(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `user("alice");`)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(Config{Env: env, RootKey: biscuit.StaticRootKey(root), Authorizer: `allow if`})(ok)
+	if got := serve(handler, "/files/1", token); got != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", got, http.StatusInternalServerError)
+	}
+}
+
+func TestMiddlewareAudit(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `user("alice"); check if operation("GET");`)
+
+	sink := make(biscuit.ChannelAuditSink, 4)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(Config{
+		Env:               env,
+		RootKey:           biscuit.StaticRootKey(root),
+		Authorizer:        `allow if user("alice");`,
+		Audit:             sink,
+		AuditIncludeToken: true,
+	})(ok)
+
+	req := httptest.NewRequest(http.MethodGet, "/files/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-Id", "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if record := <-sink; !record.Allowed || record.RequestID != "req-1" || record.Token != token || record.PolicyText != `allow if user("alice")` {
+		t.Errorf("allow record = %+v", record)
+	}
+
+	if got := serve(handler, "/files/1", "not a token"); got != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if record := <-sink; record.Allowed || record.Error == "" || record.Token != "not a token" {
+		t.Errorf("invalid token record = %+v", record)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/files/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	record := <-sink
+	if record.Allowed || len(record.FailedChecks) != 1 || record.FailedChecks[0].Rule != `check if operation("GET")` {
+		t.Errorf("deny record = %+v", record)
+	}
+	if len(sink) != 0 {
+		t.Errorf("%d extra records", len(sink))
+	}
+}
+
+func TestMiddlewareAuditQuotedPath(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, root := newToken(t, env, `user("alice"); check if operation("GET");`)
+
+	sink := make(biscuit.ChannelAuditSink, 1)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	cfg := Config{Env: env, RootKey: biscuit.StaticRootKey(root), Authorizer: `allow if user("alice");`}
+	plain := Middleware(cfg)(ok)
+	cfg.Audit = sink
+	audited := Middleware(cfg)(ok)
+
+	// A path holding a double quote makes the world the guest prints unreadable: the policy text
+	// is lost, not the decision.
+	for _, target := range []string{"/files/a%22b", "/files/x%22);%0A"} {
+		if got := serve(plain, target, token); got != http.StatusOK {
+			t.Fatalf("%s: status = %d without auditing, want %d", target, got, http.StatusOK)
+		}
+		if got := serve(audited, target, token); got != http.StatusOK {
+			t.Errorf("%s: status = %d with auditing, want %d", target, got, http.StatusOK)
+		}
+		if record := <-sink; !record.Allowed || record.Error != "" || record.PolicyText != "" {
+			t.Errorf("%s: record = %+v", target, record)
+		}
+	}
+}
+
+func TestMiddlewareClockSkew(t *testing.T) {
+	env := wasmtest.Env(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expiry, err := biscuit.CheckExpiry(now.Add(-30 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, root := newToken(t, env, expiry.String()+";")
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tc := range []struct {
+		skew time.Duration
+		want int
+	}{
+		{0, http.StatusForbidden},
+		{time.Minute, http.StatusOK},
+	} {
+		handler := Middleware(Config{
+			Env:        env,
+			RootKey:    biscuit.StaticRootKey(root),
+			Authorizer: `allow if true;`,
+			Verify:     biscuit.VerifyOptions{ClockSkew: tc.skew},
+			Now:        func() time.Time { return now },
+		})(ok)
+		if got := serve(handler, "/files/1", token); got != tc.want {
+			t.Errorf("skew %s: status = %d, want %d", tc.skew, got, tc.want)
+		}
+	}
+}
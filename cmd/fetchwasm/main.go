@@ -0,0 +1,71 @@
+// Command fetchwasm downloads a biscuit-wasm-go guest artifact, checks it against the checksums
+// checked in wasm/checksums.txt and the exports the bindings call, then installs it.
+//
+//	go run ./cmd/fetchwasm -tag v0.1.0
+//	go run ./cmd/fetchwasm -url https://example.com/biscuit_wasm_go.wasm -out /tmp/guest.wasm
+package main
+
+import (
+	"biscuit-wasm-go/wasm"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes, one per kind of failure so scripts can tell them apart.
+const (
+	exitError    = 1
+	exitDownload = 2
+	exitChecksum = 3
+	exitManifest = 4
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fetchwasm", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	tag := flags.String("tag", "", "release tag to download")
+	url := flags.String("url", "", "URL to download instead of a release")
+	checksums := flags.String("checksums", "wasm/checksums.txt", "checksums file")
+	out := flags.String("out", "", "install path, the release build output by default")
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if (*tag == "") == (*url == "") {
+		fmt.Fprintln(stderr, "fetchwasm: exactly one of -tag and -url is required")
+		return exitError
+	}
+	source := *tag
+	if source == "" {
+		source = *url
+	}
+
+	sums, err := os.ReadFile(*checksums)
+	if err != nil {
+		fmt.Fprintf(stderr, "fetchwasm: %v\n", err)
+		return exitError
+	}
+
+	sum, err := wasm.FetchArtifact(context.Background(), wasm.FetchOptions{Source: source, Checksums: sums, Dest: *out})
+	if err != nil {
+		fmt.Fprintf(stderr, "fetchwasm: %v\n", err)
+		switch {
+		case errors.Is(err, wasm.ErrDownload):
+			return exitDownload
+		case errors.Is(err, wasm.ErrChecksumMismatch):
+			return exitChecksum
+		case errors.Is(err, wasm.ErrInvalidArtifact):
+			return exitManifest
+		default:
+			return exitError
+		}
+	}
+	fmt.Fprintf(stdout, "installed %s (sha256 %s)\n", source, sum)
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// guestArtifact returns the built guest artifact, skipping the test when it was not built.
+func guestArtifact(t *testing.T) []byte {
+	t.Helper()
+
+	guest, err := os.ReadFile("../../target/wasm32-unknown-unknown/release/biscuit_wasm_go.wasm")
+	if os.IsNotExist(err) {
+		t.Skip("biscuit_wasm_go.wasm not built")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return guest
+}
+
+func TestRun(t *testing.T) {
+	guest := guestArtifact(t)
+	empty := []byte("\x00asm\x01\x00\x00\x00")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/guest.wasm", "/tampered.wasm":
+			_, _ = w.Write(guest)
+		case "/empty.wasm":
+			_, _ = w.Write(empty)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	sum := func(data []byte) string {
+		digest := sha256.Sum256(data)
+		return hex.EncodeToString(digest[:])
+	}
+	checksums := filepath.Join(dir, "checksums.txt")
+	lines := []string{
+		sum(guest) + "  " + server.URL + "/guest.wasm",
+		sum(empty) + "  " + server.URL + "/tampered.wasm",
+		sum(empty) + "  " + server.URL + "/empty.wasm",
+		sum(guest) + "  " + server.URL + "/missing.wasm",
+	}
+	if err := os.WriteFile(checksums, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/guest.wasm", 0},
+		{"/missing.wasm", exitDownload},
+		{"/tampered.wasm", exitChecksum},
+		{"/empty.wasm", exitManifest},
+	} {
+		var stdout, stderr bytes.Buffer
+		out := filepath.Join(dir, "out.wasm")
+		if code := run([]string{"-url", server.URL + tc.path, "-checksums", checksums, "-out", out}, &stdout, &stderr); code != tc.want {
+			t.Errorf("%s: exit code %d, want %d: %s", tc.path, code, tc.want, stderr.String())
+		}
+	}
+
+	if code := run([]string{"-checksums", checksums}, &bytes.Buffer{}, &bytes.Buffer{}); code != exitError {
+		t.Errorf("missing source: exit code %d, want %d", code, exitError)
+	}
+}
@@ -0,0 +1,698 @@
+package main
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	keypairModule "biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// command is a subcommand of the CLI. It reads its flags from args, the token from stdin when no
+// --token is given, and writes its result to out.
+type command func(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error
+
+// selfLoading commands load the guest themselves, doctor must report why it cannot be loaded.
+var selfLoading = map[string]bool{
+	"doctor": true,
+}
+
+var commands = map[string]command{
+	"keygen":    runKeygen,
+	"generate":  runGenerate,
+	"attenuate": runAttenuate,
+	"seal":      runSeal,
+	"inspect":   runInspect,
+	"authorize": runAuthorize,
+	"doctor":    runDoctor,
+	"third-party": func(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+		return runSubcommand(thirdPartyCommands, env, args, stdin, out)
+	},
+}
+
+// thirdPartyCommands implement the two halves of the third-party block protocol: the token holder
+// runs `request`, the third party runs `append` on the request it received, and the holder checks
+// the result with `apply`.
+//
+// The response of `append` is the appended token rather than the serialized block, because the
+// bundled guest cannot deserialize a third-party block (thirdpartyblock_fromBase64 decodes it as a
+// request).
+var thirdPartyCommands = map[string]command{
+	"request": runThirdPartyRequest,
+	"append":  runThirdPartyAppend,
+	"apply":   runThirdPartyApply,
+}
+
+// errReported is returned by a command that already printed why it failed, e.g. a denied
+// authorization, so runCommand only has to set the exit code.
+var errReported = errors.New("reported")
+
+// output is where a command prints its result: the plain text meant to be piped into the next
+// command, or a single JSON document with --json.
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+// print writes text, or value as JSON with --json.
+func (self *output) print(text string, value any) error {
+	if !self.json {
+		_, err := fmt.Fprintln(self.w, text)
+		return err
+	}
+
+	encoder := json.NewEncoder(self.w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+type tokenOutput struct {
+	Token string `json:"token"`
+}
+
+// runCommand runs the subcommand named by the first argument following the global flags and
+// returns the process exit code.
+func runCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	global := flag.NewFlagSet("biscuit-wasm-go", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	jsonOutput := global.Bool("json", false, "print the result, or the error, as a JSON document")
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+	args = global.Args()
+
+	out := &output{w: stdout, json: *jsonOutput}
+	fail := func(code int, name string, err error) int {
+		if out.json {
+			_ = out.print("", struct {
+				Error string `json:"error"`
+			}{err.Error()})
+		} else {
+			fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		}
+		return code
+	}
+
+	if len(args) == 0 {
+		return fail(2, global.Name(), unknownCommand(commands, ""))
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		return fail(2, global.Name(), unknownCommand(commands, args[0]))
+	}
+
+	// Keep stdout for the command output, it is meant to be piped into the next command.
+	slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	var env wasm.WasmEnv
+	if !selfLoading[args[0]] {
+		var err error
+		if env, err = wasm.InitWasm(); err != nil {
+			return fail(1, args[0], err)
+		}
+	}
+
+	if err := run(env, args[1:], stdin, out); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		if errors.Is(err, errReported) {
+			return 1
+		}
+		return fail(1, args[0], err)
+	}
+	return 0
+}
+
+func unknownCommand(known map[string]command, name string) error {
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown command %q, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// runSubcommand runs the command of known named by args[0].
+func runSubcommand(known map[string]command, env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	if len(args) == 0 {
+		return unknownCommand(known, "")
+	}
+	run, ok := known[args[0]]
+	if !ok {
+		return unknownCommand(known, args[0])
+	}
+	return run(env, args[1:], stdin, out)
+}
+
+// runKeygen generates a root key pair.
+func runKeygen(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	algorithmName := flags.String("algorithm", "ed25519", "ed25519 or secp256r1")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var algorithm keypairModule.SignatureAlgorithm
+	switch *algorithmName {
+	case "ed25519":
+		algorithm = keypairModule.Ed25519
+	case "secp256r1":
+		algorithm = keypairModule.Secp256r1
+	default:
+		return fmt.Errorf("unknown algorithm %q, expected ed25519 or secp256r1", *algorithmName)
+	}
+
+	pair := keypairModule.Invoke(env)
+	if err := pair.New(algorithm); err != nil {
+		return err
+	}
+
+	privateKey, err := pair.GetPrivateKey()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("privatekey", privateKey.Ptr()) }()
+	private, err := privateKey.Reveal()
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := pair.GetPublicKey()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", publicKey.Ptr()) }()
+	public, err := publicKey.ToString()
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := keypairModule.Fingerprint(public)
+	if err != nil {
+		return err
+	}
+
+	text := fmt.Sprintf("private key: %s\npublic key: %s\nfingerprint: %s", private, public, fingerprint)
+	return out.print(text, struct {
+		Algorithm   string `json:"algorithm"`
+		PrivateKey  string `json:"private_key"`
+		PublicKey   string `json:"public_key"`
+		Fingerprint string `json:"fingerprint"`
+	}{*algorithmName, private, public, fingerprint})
+}
+
+// runGenerate mints a token whose authority block holds --code, signed with --private-key.
+func runGenerate(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	privateKey := flags.String("private-key", "", "root private key, e.g. ed25519-private/<hex>")
+	code := flags.String("code", "", "datalog of the authority block")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *privateKey == "" {
+		return fmt.Errorf("--private-key is required")
+	}
+
+	root, err := parseKeyPair(env, *privateKey)
+	if err != nil {
+		return err
+	}
+
+	builder, err := biscuit.NewBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = builder.Close() }()
+
+	if err := builder.AddCode(*code); err != nil {
+		return fmt.Errorf("invalid authority block: %w", err)
+	}
+
+	token, err := builder.Build(root)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = token.Close() }()
+
+	return printToken(out, token)
+}
+
+// runAttenuate appends a block holding --code to a token.
+func runAttenuate(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("attenuate", flag.ContinueOnError)
+	token := flags.String("token", "", "base64 token, read from stdin when empty")
+	publicKey := flags.String("public-key", "", "root public key, e.g. ed25519/<hex>")
+	code := flags.String("code", "", "datalog of the appended block")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := parsePublicKey(env, *publicKey)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := readToken(env, *token, root, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = parsed.Close() }()
+
+	block, err := biscuit.NewBlockBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = block.Close() }()
+
+	if err := block.AddCode(*code); err != nil {
+		return fmt.Errorf("invalid block: %w", err)
+	}
+
+	attenuated, err := parsed.Append(block)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = attenuated.Close() }()
+
+	return printToken(out, attenuated)
+}
+
+// runSeal seals a token so it cannot be attenuated anymore.
+func runSeal(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("seal", flag.ContinueOnError)
+	token := flags.String("token", "", "base64 token, read from stdin when empty")
+	publicKey := flags.String("public-key", "", "root public key, e.g. ed25519/<hex>")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := parsePublicKey(env, *publicKey)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := readToken(env, *token, root, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = parsed.Close() }()
+
+	sealed, err := parsed.IsSealed()
+	if err != nil {
+		return err
+	}
+	if sealed {
+		return fmt.Errorf("token is already sealed")
+	}
+
+	result, err := parsed.Seal()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = result.Close() }()
+
+	encoded, err := result.ToBase64()
+	if err != nil {
+		return err
+	}
+
+	// Never print a token the next command of the pipeline could not read.
+	reparsed, err := biscuit.FromBase64(env, encoded, root)
+	if err != nil {
+		return fmt.Errorf("sealed token does not parse back: %w", err)
+	}
+	_ = reparsed.Close()
+
+	return out.print(encoded, tokenOutput{Token: encoded})
+}
+
+// runInspect prints the blocks of a token.
+func runInspect(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	token := flags.String("token", "", "base64 token, read from stdin when empty")
+	publicKey := flags.String("public-key", "", "root public key, e.g. ed25519/<hex>")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := parsePublicKey(env, *publicKey)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := readToken(env, *token, root, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = parsed.Close() }()
+
+	type block struct {
+		Index  int    `json:"index"`
+		Source string `json:"source"`
+	}
+	var result struct {
+		Version    uint32  `json:"version"`
+		Blocks     []block `json:"blocks"`
+		Sealed     bool    `json:"sealed"`
+		ThirdParty bool    `json:"third_party"`
+	}
+
+	if result.Version, err = parsed.Version(); err != nil {
+		return err
+	}
+
+	count, err := parsed.BlockCount()
+	if err != nil {
+		return err
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "version: %d\n", result.Version)
+	for index := range count {
+		source, err := parsed.BlockSource(index)
+		if err != nil {
+			return fmt.Errorf("cannot read block %d: %w", index, err)
+		}
+		result.Blocks = append(result.Blocks, block{Index: index, Source: source})
+		fmt.Fprintf(&text, "block %d:\n%s\n", index, strings.TrimRight(source, "\n"))
+	}
+
+	if result.Sealed, err = parsed.IsSealed(); err != nil {
+		return err
+	}
+	if result.ThirdParty, err = parsed.HasThirdPartyBlocks(); err != nil {
+		return err
+	}
+	fmt.Fprintf(&text, "sealed: %t\nthird party blocks: %t", result.Sealed, result.ThirdParty)
+
+	return out.print(text.String(), result)
+}
+
+// runAuthorize runs the authorizer --code against a token. A denied token is reported on out and
+// exits with a non-zero code.
+func runAuthorize(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("authorize", flag.ContinueOnError)
+	token := flags.String("token", "", "base64 token, read from stdin when empty")
+	publicKey := flags.String("public-key", "", "root public key, e.g. ed25519/<hex>")
+	code := flags.String("code", "", "datalog of the authorizer: facts, checks and policies")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := parsePublicKey(env, *publicKey)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := readToken(env, *token, root, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = parsed.Close() }()
+
+	builder, err := biscuit.NewAuthorizerBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = builder.Close() }()
+
+	if err := builder.AddCode(*code); err != nil {
+		return fmt.Errorf("invalid authorizer: %w", err)
+	}
+
+	authorizer, err := builder.Build(parsed)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	decision, err := authorizer.Decide()
+	var guestErr *wasm.GuestError
+	if err != nil && !errors.As(err, &guestErr) {
+		return err
+	}
+	if err == nil {
+		return out.print(fmt.Sprintf("authorized by policy %d: %s", decision.Policy, decision.PolicyText), struct {
+			Authorized bool   `json:"authorized"`
+			Policy     int    `json:"policy"`
+			PolicyText string `json:"policy_text"`
+		}{true, decision.Policy, decision.PolicyText})
+	}
+
+	type failedCheck struct {
+		Origin string `json:"origin"`
+		Block  *int   `json:"block,omitempty"`
+		Check  int    `json:"check"`
+		Rule   string `json:"rule"`
+	}
+	result := struct {
+		Authorized   bool          `json:"authorized"`
+		Error        string        `json:"error"`
+		FailedChecks []failedCheck `json:"failed_checks"`
+	}{Error: err.Error(), FailedChecks: []failedCheck{}}
+
+	text := "not authorized"
+	for _, check := range biscuit.FailedChecks(err) {
+		failed := failedCheck{Origin: "authorizer", Check: check.Check, Rule: check.Rule}
+		if !check.Authorizer {
+			failed.Origin = "block"
+			failed.Block = &check.Block
+			text += fmt.Sprintf("\nblock %d check %d failed: %s", check.Block, check.Check, check.Rule)
+		} else {
+			text += fmt.Sprintf("\nauthorizer check %d failed: %s", check.Check, check.Rule)
+		}
+		result.FailedChecks = append(result.FailedChecks, failed)
+	}
+
+	if err := out.print(text, result); err != nil {
+		return err
+	}
+	return errReported
+}
+
+// runThirdPartyRequest prints the request a third party needs to sign a block for a token.
+func runThirdPartyRequest(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("third-party request", flag.ContinueOnError)
+	token := flags.String("token", "", "base64 token, read from stdin when empty")
+	publicKey := flags.String("public-key", "", "root public key, e.g. ed25519/<hex>")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	root, err := parsePublicKey(env, *publicKey)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := readToken(env, *token, root, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = parsed.Close() }()
+
+	request, err := parsed.ThirdPartyRequest()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = request.Close() }()
+
+	encoded, err := request.ToBase64()
+	if err != nil {
+		return err
+	}
+	return out.print(encoded, struct {
+		Request string `json:"request"`
+	}{encoded})
+}
+
+// runThirdPartyAppend signs the datalog of --block with --external-private-key for --request and
+// prints the token with that block appended.
+func runThirdPartyAppend(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("third-party append", flag.ContinueOnError)
+	token := flags.String("token", "", "base64 token, read from stdin when empty")
+	publicKey := flags.String("public-key", "", "root public key, e.g. ed25519/<hex>")
+	request := flags.String("request", "", "base64 request produced by `third-party request`")
+	externalPrivateKey := flags.String("external-private-key", "", "private key of the third party")
+	blockFile := flags.String("block", "", "file holding the datalog of the block")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *request == "" || *externalPrivateKey == "" || *blockFile == "" {
+		return fmt.Errorf("--request, --external-private-key and --block are required")
+	}
+
+	code, err := os.ReadFile(*blockFile)
+	if err != nil {
+		return fmt.Errorf("cannot read block: %w", err)
+	}
+
+	root, err := parsePublicKey(env, *publicKey)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := readToken(env, *token, root, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = parsed.Close() }()
+
+	encoded, err := parsed.ToBase64()
+	if err != nil {
+		return err
+	}
+	if err := biscuit.CheckThirdPartyRequest(encoded, strings.TrimSpace(*request)); err != nil {
+		return err
+	}
+
+	signer, err := parseKeyPair(env, *externalPrivateKey)
+	if err != nil {
+		return err
+	}
+
+	thirdPartyRequest, err := biscuit.ThirdPartyRequestFromBase64(env, strings.TrimSpace(*request))
+	if err != nil {
+		return fmt.Errorf("invalid third party request: %w", err)
+	}
+	defer func() { _ = thirdPartyRequest.Close() }()
+
+	block, err := biscuit.NewBlockBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = block.Close() }()
+
+	if err := block.AddCode(string(code)); err != nil {
+		return fmt.Errorf("invalid block: %w", err)
+	}
+
+	signed, err := thirdPartyRequest.CreateBlock(signer, block)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = signed.Close() }()
+
+	externalKey, err := signer.GetPublicKey()
+	if err != nil {
+		return err
+	}
+
+	appended, err := parsed.AppendThirdPartyBlock(externalKey, signed)
+	if err != nil {
+		return fmt.Errorf("%w: %w", biscuit.ErrThirdPartyMismatch, err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	return printToken(out, appended)
+}
+
+// runThirdPartyApply checks that --block-response is the token extended with one third-party block
+// and prints it.
+func runThirdPartyApply(env wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("third-party apply", flag.ContinueOnError)
+	token := flags.String("token", "", "base64 token, read from stdin when empty")
+	publicKey := flags.String("public-key", "", "root public key, e.g. ed25519/<hex>")
+	response := flags.String("block-response", "", "output of `third-party append`")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *response == "" {
+		return fmt.Errorf("--block-response is required")
+	}
+
+	root, err := parsePublicKey(env, *publicKey)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := readToken(env, *token, root, stdin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = parsed.Close() }()
+
+	encoded, err := parsed.ToBase64()
+	if err != nil {
+		return err
+	}
+	if err := biscuit.CheckThirdPartyAppend(encoded, strings.TrimSpace(*response)); err != nil {
+		return err
+	}
+
+	appended, err := biscuit.FromBase64(env, strings.TrimSpace(*response), root)
+	if err != nil {
+		return fmt.Errorf("invalid block response: %w", err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	return printToken(out, appended)
+}
+
+func parseKeyPair(env wasm.WasmEnv, privateKey string) (*keypairModule.KeyPair, error) {
+	key := keypairModule.InvokePrivateKey(env)
+	if err := key.FromString(privateKey); err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	defer func() { _ = env.FreeObject("privatekey", key.Ptr()) }()
+
+	pair := keypairModule.Invoke(env)
+	if err := pair.FromPrivateKey(key); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+func parsePublicKey(env wasm.WasmEnv, publicKey string) (keypairModule.PublicKey, error) {
+	if publicKey == "" {
+		return keypairModule.PublicKey{}, fmt.Errorf("--public-key is required")
+	}
+
+	key := keypairModule.InvokePublicKey(env)
+	if err := key.FromString(publicKey); err != nil {
+		return keypairModule.PublicKey{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	return key, nil
+}
+
+// readToken parses and verifies token, or the first line of stdin when token is empty.
+func readToken(env wasm.WasmEnv, token string, root keypairModule.PublicKey, stdin io.Reader) (*biscuit.Biscuit, error) {
+	if token == "" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read token from stdin: %w", err)
+		}
+		token, _, _ = strings.Cut(strings.TrimSpace(string(data)), "\n")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no token given, use --token or stdin")
+	}
+
+	parsed, err := biscuit.FromBase64(env, token, root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+	return parsed, nil
+}
+
+func printToken(out *output, token *biscuit.Biscuit) error {
+	encoded, err := token.ToBase64()
+	if err != nil {
+		return err
+	}
+	return out.print(encoded, tokenOutput{Token: encoded})
+}
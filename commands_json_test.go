@@ -0,0 +1,130 @@
+package main
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata/json")
+
+// randomFields hold values that change on every run, they are replaced before the comparison.
+var randomFields = []string{"token", "request", "private_key", "public_key", "fingerprint"}
+
+// runJSON runs the CLI with --json and returns its exit code and its stdout, which must be a
+// single JSON document.
+func runJSON(t *testing.T, args ...string) (int, map[string]any) {
+	t.Helper()
+	wasmtest.Env(t)
+
+	var stdout, stderr bytes.Buffer
+	code := runCommand(append([]string{"--json"}, args...), strings.NewReader(""), &stdout, &stderr)
+
+	var document map[string]any
+	decoder := json.NewDecoder(&stdout)
+	if err := decoder.Decode(&document); err != nil {
+		t.Fatalf("stdout is not a JSON document: %v (stderr: %s)", err, stderr.String())
+	}
+	if decoder.More() {
+		t.Fatal("stdout holds more than one JSON document")
+	}
+	return code, document
+}
+
+// assertGolden compares document, without its random fields, with testdata/json/<name>.golden.
+func assertGolden(t *testing.T, name string, document map[string]any) {
+	t.Helper()
+
+	for _, field := range randomFields {
+		if _, ok := document[field]; ok {
+			document[field] = "<" + field + ">"
+		}
+	}
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		t.Fatal(err)
+	}
+	got := buffer.Bytes()
+
+	path := filepath.Join("testdata", "json", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s output mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	code, keys := runJSON(t, "keygen")
+	if code != 0 {
+		t.Fatalf("keygen exited with %d: %v", code, keys)
+	}
+	if !strings.HasPrefix(keys["fingerprint"].(string), "sha256:") {
+		t.Errorf("fingerprint = %v, want a sha256 digest", keys["fingerprint"])
+	}
+	assertGolden(t, "keygen", keys)
+
+	code, generated := runJSON(t, "generate", "--private-key", testPrivateKey, "--code", `user("alice"); check if operation("read");`)
+	if code != 0 {
+		t.Fatalf("generate exited with %d: %v", code, generated)
+	}
+	token := generated["token"].(string)
+	assertGolden(t, "generate", generated)
+
+	code, attenuated := runJSON(t, "attenuate", "--token", token, "--public-key", testPublicKey, "--code", `check if time($t), $t < 2030-01-01T00:00:00Z;`)
+	if code != 0 {
+		t.Fatalf("attenuate exited with %d: %v", code, attenuated)
+	}
+	attenuatedToken := attenuated["token"].(string)
+	assertGolden(t, "attenuate", attenuated)
+
+	code, inspected := runJSON(t, "inspect", "--token", attenuatedToken, "--public-key", testPublicKey)
+	if code != 0 {
+		t.Fatalf("inspect exited with %d: %v", code, inspected)
+	}
+	assertGolden(t, "inspect", inspected)
+
+	code, allowed := runJSON(t, "authorize", "--token", token, "--public-key", testPublicKey, "--code", `operation("read"); allow if user("alice");`)
+	if code != 0 {
+		t.Fatalf("authorize exited with %d: %v", code, allowed)
+	}
+	assertGolden(t, "authorize-allowed", allowed)
+
+	code, denied := runJSON(t, "authorize", "--token", token, "--public-key", testPublicKey, "--code", `operation("write"); check if user("bob"); allow if true;`)
+	if code == 0 {
+		t.Fatal("authorize exited with 0 for a denied token")
+	}
+	delete(denied, "error")
+	assertGolden(t, "authorize-denied", denied)
+
+	code, failed := runJSON(t, "inspect", "--token", token, "--public-key", "ed25519/zz")
+	if code == 0 {
+		t.Fatal("inspect exited with 0 for an invalid public key")
+	}
+	assertGolden(t, "error", failed)
+
+	code, unknown := runJSON(t, "frobnicate")
+	if code != 2 {
+		t.Errorf("unknown command exited with %d, want 2", code)
+	}
+	assertGolden(t, "unknown-command", unknown)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	keypairModule "biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testPrivateKey = "ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb"
+	testPublicKey  = "ed25519/412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59"
+
+	externalPrivateKey = "ed25519-private/5a1d9c0b6e7f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f80911223"
+	externalPublicKey  = "ed25519/de876efe2353eba34ae6e7e3d72d56df27cfe59cae5bdf0db760a607daa9b09d"
+)
+
+// run calls a command, feeding it stdin, and returns what it printed.
+func run(t *testing.T, cmd command, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	err := cmd(wasmtest.Env(t), args, strings.NewReader(stdin), &output{w: &stdout})
+	return strings.TrimSpace(stdout.String()), err
+}
+
+// authorizeToken parses token and reports whether code allows it.
+func authorizeToken(t *testing.T, token string, code string) error {
+	t.Helper()
+	env := wasmtest.Env(t)
+
+	root := keypairModule.InvokePublicKey(env)
+	if err := root.FromString(testPublicKey); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	parsed, err := biscuit.FromBase64(env, token, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = parsed.Close() }()
+
+	builder, err := biscuit.NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(code); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := builder.Build(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	_, err = authorizer.Authorize()
+	return err
+}
+
+func TestGenerateAttenuateSeal(t *testing.T) {
+	token, err := run(t, runGenerate, "", "--private-key", testPrivateKey, "--code", `user("alice"); right("alice", "read");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := run(t, runAttenuate, token, "--public-key", testPublicKey, "--code", `check if operation("read");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := run(t, runSeal, attenuated, "--public-key", testPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := authorizeToken(t, sealed, `operation("read"); allow if user($u), right($u, "read");`); err != nil {
+		t.Errorf("sealed token not authorized: %v", err)
+	}
+
+	if _, err := run(t, runAttenuate, "", "--token", sealed, "--public-key", testPublicKey, "--code", `check if true;`); err == nil {
+		t.Error("sealed token was attenuated")
+	}
+	if _, err := run(t, runSeal, sealed, "--public-key", testPublicKey); err == nil || !strings.Contains(err.Error(), "already sealed") {
+		t.Errorf("err = %v, want the token to be reported as already sealed", err)
+	}
+}
+
+func TestThirdPartyRequestAppendApply(t *testing.T) {
+	token, err := run(t, runGenerate, "", "--private-key", testPrivateKey, "--code", `user("alice");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := run(t, runThirdPartyRequest, token, "--public-key", testPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockFile := filepath.Join(t.TempDir(), "extra.datalog")
+	if err := os.WriteFile(blockFile, []byte(`group("admin");`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	response, err := run(t, runThirdPartyAppend, token, "--public-key", testPublicKey, "--request", request,
+		"--external-private-key", externalPrivateKey, "--block", blockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := run(t, runThirdPartyApply, token, "--public-key", testPublicKey, "--block-response", response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := authorizeToken(t, applied, `allow if group("admin") trusting `+externalPublicKey+`;`); err != nil {
+		t.Errorf("third-party block not trusted: %v", err)
+	}
+	if err := authorizeToken(t, applied, `allow if group("admin");`); err == nil {
+		t.Error("third-party fact visible without trusting its signer")
+	}
+
+	other, err := run(t, runGenerate, "", "--private-key", testPrivateKey, "--code", `user("bob");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(t, runThirdPartyAppend, other, "--public-key", testPublicKey, "--request", request,
+		"--external-private-key", externalPrivateKey, "--block", blockFile); !errors.Is(err, biscuit.ErrThirdPartyMismatch) {
+		t.Errorf("err = %v, want a mismatch for a request made from another token", err)
+	}
+	if _, err := run(t, runThirdPartyApply, other, "--public-key", testPublicKey, "--block-response", response); !errors.Is(err, biscuit.ErrThirdPartyMismatch) {
+		t.Errorf("err = %v, want a mismatch for a response made for another token", err)
+	}
+}
@@ -0,0 +1,156 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"time"
+)
+
+// AuditRecord describes one authorization decision.
+type AuditRecord struct {
+	Time      time.Time
+	RequestID string
+	// TokenHash is the hex sha256 of the serialized token.
+	TokenHash string
+	// RootKey is the fingerprint of the root key the token was verified with, see
+	// keypair.PublicKey.Fingerprint.
+	RootKey string
+	// RevocationIDs are the hex revocation identifiers of the blocks of the token.
+	RevocationIDs []string
+	Allowed       bool
+	// Policy and PolicyText are the ones of Decision.
+	Policy       int
+	PolicyText   string
+	FailedChecks []FailedCheck
+	// Error is the reason the token was not authorized, empty when it was.
+	Error    string
+	Duration time.Duration
+	// Token is the base64 token, only set when AuditOptions.IncludeToken is.
+	Token string
+}
+
+// AuditSink receives the record of every audited authorization. Authorizer.DecideAudited and
+// Authorizer.AuthorizeAudited call it with the env still locked, RequestAuthorizer once it is
+// released.
+type AuditSink interface {
+	Record(ctx context.Context, record AuditRecord)
+}
+
+// AuditOptions describes an audited authorization, see Authorizer.DecideAudited and
+// Authorizer.AuthorizeAudited.
+type AuditOptions struct {
+	Sink      AuditSink
+	RequestID string
+	// Token is the token the authorizer was built with.
+	Token *Biscuit
+	// Root is the key Token was verified with.
+	Root keypair.PublicKey
+	// IncludeToken adds the token itself to the record. Anyone reading the record can then use
+	// the token, so it is left out by default.
+	IncludeToken bool
+}
+
+// DecideAudited runs Decide and hands its record to opts.Sink, exactly once, whether the token is
+// authorized or not. Failing to describe the token leaves the corresponding fields empty, it does
+// not change the decision.
+func (self *Authorizer) DecideAudited(ctx context.Context, opts AuditOptions) (Decision, error) {
+	_, decision, err := self.authorizeAudited(ctx, opts)
+	return decision, err
+}
+
+// AuthorizeAudited runs Authorize and hands the record of DecideAudited to opts.Sink. The outcome
+// is the one of Authorize: the record is filled as far as possible and never changes it.
+func (self *Authorizer) AuthorizeAudited(ctx context.Context, opts AuditOptions) (int, error) {
+	policy, _, err := self.authorizeAudited(ctx, opts)
+	return policy, err
+}
+
+func (self *Authorizer) authorizeAudited(ctx context.Context, opts AuditOptions) (int, Decision, error) {
+	policy, decision, record, err := self.auditedAuthorize(opts)
+	opts.Sink.Record(ctx, record)
+	return policy, decision, err
+}
+
+// auditedAuthorize runs Authorize and returns its record without handing it to opts.Sink, for
+// callers recording it once the env is released.
+func (self *Authorizer) auditedAuthorize(opts AuditOptions) (int, Decision, AuditRecord, error) {
+	start := time.Now()
+	policy, err := self.Authorize()
+	duration := time.Since(start)
+
+	decision := self.decision(policy, err)
+	record := AuditRecord{
+		Time:       start,
+		RequestID:  opts.RequestID,
+		Allowed:    decision.Allowed,
+		Policy:     decision.Policy,
+		PolicyText: decision.PolicyText,
+		Duration:   duration,
+	}
+	if err != nil {
+		record.Error = err.Error()
+		record.FailedChecks = FailedChecks(err)
+	}
+
+	if fingerprint, fingerprintErr := opts.Root.Fingerprint(); fingerprintErr == nil {
+		record.RootKey = fingerprint
+	}
+	if opts.Token != nil {
+		describeToken(&record, opts.Token, opts.IncludeToken)
+	}
+	return policy, decision, record, err
+}
+
+func describeToken(record *AuditRecord, token *Biscuit, includeToken bool) {
+	if encoded, err := token.ToBase64(); err == nil {
+		if data, err := decodeToken(encoded); err == nil {
+			sum := sha256.Sum256(data)
+			record.TokenHash = hex.EncodeToString(sum[:])
+		}
+		if includeToken {
+			record.Token = encoded
+		}
+	}
+
+	if ids, err := token.RevocationIDs(); err == nil {
+		for _, id := range ids {
+			record.RevocationIDs = append(record.RevocationIDs, hex.EncodeToString(id))
+		}
+	}
+}
+
+// SlogAuditSink logs records at info level.
+type SlogAuditSink struct {
+	Logger *slog.Logger
+}
+
+func (self SlogAuditSink) Record(ctx context.Context, record AuditRecord) {
+	attrs := []slog.Attr{
+		slog.String("request_id", record.RequestID),
+		slog.String("token_hash", record.TokenHash),
+		slog.String("root_key", record.RootKey),
+		slog.Any("revocation_ids", record.RevocationIDs),
+		slog.Bool("allowed", record.Allowed),
+		slog.Int("policy", record.Policy),
+		slog.String("policy_text", record.PolicyText),
+		slog.Duration("duration", record.Duration),
+	}
+	if record.Error != "" {
+		attrs = append(attrs, slog.String("error", record.Error), slog.Int("failed_checks", len(record.FailedChecks)))
+	}
+	if record.Token != "" {
+		attrs = append(attrs, slog.String("token", record.Token))
+	}
+	self.Logger.LogAttrs(ctx, slog.LevelInfo, "authorization", attrs...)
+}
+
+// ChannelAuditSink sends records to a channel, blocking until they are received. It is meant for
+// tests.
+type ChannelAuditSink chan AuditRecord
+
+func (self ChannelAuditSink) Record(_ context.Context, record AuditRecord) {
+	self <- record
+}
@@ -0,0 +1,123 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestDecideAudited(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := public.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice"); check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := decodeToken(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	ids, err := token.RevocationIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audit := func(code string, includeToken bool) (Decision, AuditRecord) {
+		t.Helper()
+
+		authorizerBuilder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := authorizerBuilder.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := authorizerBuilder.Build(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+
+		sink := make(ChannelAuditSink, 2)
+		decision, _ := authorizer.DecideAudited(context.Background(), AuditOptions{
+			Sink:         sink,
+			RequestID:    "req-1",
+			Token:        token,
+			Root:         public,
+			IncludeToken: includeToken,
+		})
+		if len(sink) != 1 {
+			t.Fatalf("%d records, want exactly one", len(sink))
+		}
+		return decision, <-sink
+	}
+
+	decision, record := audit(`operation("read"); allow if user("alice");`, false)
+	if !decision.Allowed || !record.Allowed || record.Policy != 0 || record.PolicyText != `allow if user("alice")` {
+		t.Errorf("allow record = %+v", record)
+	}
+	if record.RequestID != "req-1" || record.RootKey != fingerprint || record.TokenHash != hex.EncodeToString(sum[:]) {
+		t.Errorf("record identifies request %q, key %q, token %q", record.RequestID, record.RootKey, record.TokenHash)
+	}
+	if len(record.RevocationIDs) != 1 || record.RevocationIDs[0] != hex.EncodeToString(ids[0]) {
+		t.Errorf("revocation ids = %v", record.RevocationIDs)
+	}
+	if record.Error != "" || record.Token != "" || record.Duration <= 0 || record.Time.IsZero() {
+		t.Errorf("allow record = %+v", record)
+	}
+
+	decision, record = audit(`operation("write"); allow if user("alice");`, true)
+	if decision.Allowed || record.Allowed || record.Error == "" {
+		t.Errorf("deny record = %+v", record)
+	}
+	if len(record.FailedChecks) != 1 || record.FailedChecks[0].Rule != `check if operation("read")` {
+		t.Errorf("failed checks = %+v", record.FailedChecks)
+	}
+	if record.Token != encoded {
+		t.Error("token missing from a record asking for it")
+	}
+}
+
+func TestSlogAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := SlogAuditSink{Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	sink.Record(context.Background(), AuditRecord{RequestID: "req-1", Allowed: true, Policy: 0})
+	if line := buf.String(); !strings.Contains(line, "request_id=req-1") || !strings.Contains(line, "allowed=true") || strings.Contains(line, "token=") {
+		t.Errorf("logged %q", line)
+	}
+
+	buf.Reset()
+	sink.Record(context.Background(), AuditRecord{Error: "denied", FailedChecks: []FailedCheck{{}}, Token: "secret"})
+	if line := buf.String(); !strings.Contains(line, "failed_checks=1") || !strings.Contains(line, "token=secret") {
+		t.Errorf("logged %q", line)
+	}
+}
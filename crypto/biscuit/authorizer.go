@@ -0,0 +1,314 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuthorizerBuilder collects the authorizer side of the datalog world (ambient facts, checks and
+// policies).
+type AuthorizerBuilder struct {
+	env     wasm.WasmEnv
+	ptr     uint64
+	options builderOptions
+	// rejected is the error the guest rejected code with, see ErrBuilderRejected.
+	rejected error
+	// quoted is true once a string holding a double quote was added, see Authorizer.world.
+	quoted bool
+	// facts counts the facts added, see WithMaxFactGrowthRatio.
+	facts factCount
+}
+
+// Authorizer is an AuthorizerBuilder bound to a token, ready to evaluate.
+type Authorizer struct {
+	env wasm.WasmEnv
+	ptr uint64
+	// maxFactGrowth is the ratio of WithMaxFactGrowthRatio, 0 when the guard is off.
+	maxFactGrowth float64
+	// factCount counts the facts the world starts from, nil when the guard is off.
+	factCount *factCount
+	// quoted is true when a string the authorizer was given holds a double quote, see
+	// Authorizer.world.
+	quoted bool
+	// token is the token the authorizer was built with, scanned for such strings only when the
+	// world is read back, see quotedWorld.
+	token *Biscuit
+}
+
+func NewAuthorizerBuilder(env wasm.WasmEnv, options ...BuilderOption) (*AuthorizerBuilder, error) {
+	resolved, err := newBuilderOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := env.GetFunction("authorizerbuilder_new")
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := env.Call(function)
+	if err != nil {
+		return nil, fmt.Errorf("authorizerbuilder_new failed: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no result returned from authorizerbuilder_new")
+	}
+
+	return &AuthorizerBuilder{env: env, ptr: result[0], options: resolved}, nil
+}
+
+func (self *AuthorizerBuilder) usable() error {
+	return builderUsable("authorizer builder", self.ptr, self.rejected)
+}
+
+// reject records err when the guest rejected what was added to the builder, see ErrBuilderRejected.
+func (self *AuthorizerBuilder) reject(err error) error {
+	return rejectBuilder(self.env, "authorizerbuilder", &self.ptr, &self.rejected, err)
+}
+
+// AddCode parses datalog source (facts, rules, checks and policies) into the authorizer. Code the
+// guest rejects makes the builder unusable, see ErrBuilderRejected.
+func (self *AuthorizerBuilder) AddCode(code string) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+
+	if err := checkTrustedKeys(self.env, code); err != nil {
+		return err
+	}
+	self.quoted = self.quoted || hasQuotedString(code)
+	self.facts.addCode(code)
+	if len(self.options.scopes) > 0 {
+		return self.reject(addCodeWithParameters(self.env, "authorizerbuilder_addCodeWithParameters", self.ptr, code, nil, self.options.scopes))
+	}
+
+	return self.reject(self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		return self.env.WithOperation("datalog.parse").CallFallibleVoid("authorizerbuilder_addCode", self.ptr, strPtr, strLen)
+	}))
+}
+
+// ToString returns the datalog held by the builder, one statement per line.
+func (self *AuthorizerBuilder) ToString() (string, error) {
+	if err := self.usable(); err != nil {
+		return "", err
+	}
+	return self.env.CallString("authorizerbuilder_toString", self.ptr)
+}
+
+// AddFact adds an ambient fact, typically describing the request being authorized.
+func (self *AuthorizerBuilder) AddFact(fact Fact) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+	if err := fact.checkGround(); err != nil {
+		return err
+	}
+
+	var code strings.Builder
+	parameters := map[string]any{}
+	fact.render(&code, self.options.largeBytesThreshold, parameters)
+	self.quoted = self.quoted || hasQuotedString(code.String())
+	self.facts.add(fact.name, len(fact.terms), true)
+	if len(parameters) > 0 {
+		// fact_fromString takes no parameters, the fact goes through the code instead, which a
+		// fact the guest rejects would make unusable.
+		if err := fact.validate(); err != nil {
+			return err
+		}
+		code.WriteByte(';')
+		return self.reject(addCodeWithParameters(self.env, "authorizerbuilder_addCodeWithParameters", self.ptr, code.String(), parameters, nil))
+	}
+
+	return self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code.String())
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		factPtr, err := self.env.CallFallible("fact_fromString", strPtr, strLen)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = self.env.FreeObject("fact", factPtr) }()
+
+		return self.reject(self.env.CallFallibleVoid("authorizerbuilder_addFact", self.ptr, factPtr))
+	})
+}
+
+// AddFacts adds facts like AddFact, rendering them into a single datalog document so the batch
+// crosses into the guest once. Either every fact is added or none is: when some are invalid, the
+// error joins a *FactError for each of them.
+func (self *AuthorizerBuilder) AddFacts(facts []Fact) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+	if len(facts) == 0 {
+		return nil
+	}
+
+	code, parameters, err := renderFacts(facts, self.options.largeBytesThreshold)
+	if err != nil {
+		return err
+	}
+	self.quoted = self.quoted || hasQuotedString(code)
+	for _, fact := range facts {
+		self.facts.add(fact.name, len(fact.terms), true)
+	}
+	if len(parameters) > 0 {
+		return self.reject(addCodeWithParameters(self.env, "authorizerbuilder_addCodeWithParameters", self.ptr, code, parameters, nil))
+	}
+
+	return self.reject(self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		return self.env.WithOperation("datalog.parse").CallFallibleVoid("authorizerbuilder_addCode", self.ptr, strPtr, strLen)
+	}))
+}
+
+// AddAudience adds the audience fact naming the service authorizing, matched by the checks of
+// BlockBuilder.Audience.
+func (self *AuthorizerBuilder) AddAudience(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty audience")
+	}
+	fact, err := NewFact("audience", StringTerm(name))
+	if err != nil {
+		return err
+	}
+	return self.AddFact(fact)
+}
+
+// AddTime adds the time fact the checks of CheckExpiry and CheckNotBefore match, time(now), or
+// with a clock skew tolerance the two facts time(now-skew) and time(now+skew). A check passes when
+// one of them satisfies it, so an expiry check passes until skew after the expiry, and a
+// not-before check from skew before its date. A check bounding the time on both sides passes when
+// one of the facts lies within its bounds.
+//
+// The skew only loosens `check if` rules. The rules every time fact must satisfy, or that match
+// on any of them, are tightened by as much: `check all time($t), $t <= X` fails from skew before
+// X, and `deny if time($t), $t > X` or `reject if time($t), $t > X` match from skew before X. Such
+// rules should bound the time with a margin of their own rather than rely on a skew.
+func (self *AuthorizerBuilder) AddTime(now time.Time, skew time.Duration) error {
+	if skew < 0 {
+		return fmt.Errorf("negative clock skew %s", skew)
+	}
+
+	times := []time.Time{now}
+	if skew > 0 {
+		times = []time.Time{now.Add(-skew), now.Add(skew)}
+	}
+	facts := make([]Fact, len(times))
+	for i, t := range times {
+		fact, err := NewFact("time", DateTerm(t))
+		if err != nil {
+			return err
+		}
+		facts[i] = fact
+	}
+	return self.AddFacts(facts)
+}
+
+// Merge adds the facts, rules, checks and policies of other to the builder. other is left as is.
+func (self *AuthorizerBuilder) Merge(other *AuthorizerBuilder) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+	if err := other.usable(); err != nil {
+		return err
+	}
+
+	function, err := self.env.GetFunction("authorizerbuilder_merge")
+	if err != nil {
+		return err
+	}
+
+	if _, err := self.env.Call(function, self.ptr, other.ptr); err != nil {
+		return fmt.Errorf("authorizerbuilder_merge failed: %w", err)
+	}
+	self.quoted = self.quoted || other.quoted
+	self.facts.merge(other.facts)
+	return nil
+}
+
+// Build binds the builder's content to a token whose signatures were verified when it was parsed.
+// The builder is consumed by the guest and cannot be used afterwards, whether Build succeeds or not.
+func (self *AuthorizerBuilder) Build(token *Biscuit) (*Authorizer, error) {
+	if err := self.usable(); err != nil {
+		return nil, err
+	}
+	if token.ptr == 0 {
+		return nil, fmt.Errorf("biscuit not initialized")
+	}
+
+	builderPtr := self.ptr
+	self.ptr = 0
+
+	ptr, err := self.env.WithOperation("authorizer.build").CallFallible("authorizerbuilder_buildAuthenticated", builderPtr, token.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizer := &Authorizer{env: self.env, ptr: ptr, maxFactGrowth: self.options.maxFactGrowth, quoted: self.quoted, token: token}
+	if self.options.maxFactGrowth > 0 {
+		if authorizer.factCount, err = token.factCount(self.facts); err != nil {
+			_ = authorizer.Close()
+			return nil, err
+		}
+	}
+	return authorizer, nil
+}
+
+func (self *AuthorizerBuilder) Close() error {
+	err := self.env.FreeObject("authorizerbuilder", self.ptr)
+	self.ptr = 0
+	return err
+}
+
+// Authorize runs the checks and policies and returns the index of the allow policy that matched.
+// A deny policy, a failed check or no matching policy are reported as a *wasm.GuestError, an
+// allowed evaluation that generated too many facts as ErrFactAmplification, see
+// WithMaxFactGrowthRatio.
+func (self *Authorizer) Authorize() (int, error) {
+	if self.ptr == 0 {
+		return 0, fmt.Errorf("authorizer not initialized")
+	}
+
+	index, err := self.env.WithOperation("authorizer.authorize").CallFallible("authorizer_authorize", self.ptr)
+	if err == nil {
+		err = self.checkFactGrowth()
+	}
+	recordAuthorization(err)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(index), nil
+}
+
+// ToString returns the datalog world of the authorizer: its facts, rules, checks and policies.
+func (self *Authorizer) ToString() (string, error) {
+	if self.ptr == 0 {
+		return "", fmt.Errorf("authorizer not initialized")
+	}
+	return self.env.CallString("authorizer_toString", self.ptr)
+}
+
+func (self *Authorizer) Close() error {
+	err := self.env.FreeObject("authorizer", self.ptr)
+	self.ptr = 0
+	return err
+}
@@ -0,0 +1,111 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// AuthorizerPool hands out per-request authorizer builders holding base datalog (policies,
+// checks, service facts) parsed once per env instead of once per request.
+//
+// The guest can neither reset an authorizer nor clone a builder: Build consumes the builder and an
+// authorizer keeps the facts of its request until it is freed. So a request does not get a reused
+// authorizer but a fresh builder the base is merged into, and Put frees the authorizer. Nothing of
+// a request can reach the next one.
+//
+// Guest objects belong to the instance that created them, so the pool keeps one base per env. Get,
+// Put and Forget must be called by the goroutine having exclusive use of env, typically between
+// wasm.Pool Acquire and the release it returned.
+type AuthorizerPool struct {
+	source string
+
+	mu    sync.Mutex
+	bases map[api.Module]*AuthorizerBuilder
+}
+
+// NewAuthorizerPool validates source in env, which also gets its base parsed.
+func NewAuthorizerPool(env wasm.WasmEnv, source string) (*AuthorizerPool, error) {
+	pool := &AuthorizerPool{source: source, bases: map[api.Module]*AuthorizerBuilder{}}
+	if _, err := pool.base(env); err != nil {
+		return nil, err
+	}
+	return pool, nil
+}
+
+// Get returns a builder holding the base datalog, for the caller to add the facts of a request and
+// bind it to a token. The authorizer it builds is given back with Put.
+func (self *AuthorizerPool) Get(env wasm.WasmEnv) (*AuthorizerBuilder, error) {
+	base, err := self.base(env)
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	if err := builder.Merge(base); err != nil {
+		_ = builder.Close()
+		return nil, err
+	}
+	return builder, nil
+}
+
+// Put gives back an authorizer built from Get. It is freed: the guest has no way to clear its
+// facts and token for reuse.
+func (self *AuthorizerPool) Put(authorizer *Authorizer) error {
+	return authorizer.Close()
+}
+
+// Forget frees the base of env, to be called before the env is torn down.
+func (self *AuthorizerPool) Forget(env wasm.WasmEnv) error {
+	self.mu.Lock()
+	base, ok := self.bases[env.Module]
+	delete(self.bases, env.Module)
+	self.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return base.Close()
+}
+
+// Close frees the bases of every env. No env may be in use.
+func (self *AuthorizerPool) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var errs []error
+	for module, base := range self.bases {
+		errs = append(errs, base.Close())
+		delete(self.bases, module)
+	}
+	return errors.Join(errs...)
+}
+
+func (self *AuthorizerPool) base(env wasm.WasmEnv) (*AuthorizerBuilder, error) {
+	self.mu.Lock()
+	base, ok := self.bases[env.Module]
+	self.mu.Unlock()
+	if ok {
+		return base, nil
+	}
+
+	base, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	if err := base.AddCode(self.source); err != nil {
+		_ = base.Close()
+		return nil, fmt.Errorf("invalid base datalog: %w", err)
+	}
+
+	self.mu.Lock()
+	self.bases[env.Module] = base
+	self.mu.Unlock()
+	return base, nil
+}
@@ -0,0 +1,198 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"strings"
+	"testing"
+)
+
+const poolBase = `
+check if operation($op), ["read", "write"].contains($op);
+allow if user($u), operation("read");
+allow if user("admin");
+`
+
+func poolToken(t testing.TB, env wasm.WasmEnv) *Biscuit {
+	t.Helper()
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(newRoot(t, env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = token.Close() })
+	return token
+}
+
+func operationFact(t testing.TB, operation string) Fact {
+	t.Helper()
+
+	fact, err := NewFact("operation", StringTerm(operation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fact
+}
+
+// poolRequest authorizes token for operation with a builder of pool and returns the facts of
+// the authorizer.
+func poolRequest(t testing.TB, pool *AuthorizerPool, env wasm.WasmEnv, token *Biscuit, operation string) (string, error) {
+	t.Helper()
+
+	builder, err := pool.Get(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operation != "" {
+		if err := builder.AddFact(operationFact(t, operation)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	authorizer, err := builder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Put(authorizer) }()
+
+	_, authorizeErr := authorizer.Authorize()
+	world, err := authorizer.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	facts, _, _ := strings.Cut(world, "// Checks:")
+	return facts, authorizeErr
+}
+
+func TestAuthorizerPoolNoFactLeakage(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+
+	pool, err := NewAuthorizerPool(env, poolBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+
+	world, err := poolRequest(t, pool, env, token, "read")
+	if err != nil {
+		t.Fatalf("first request denied: %v", err)
+	}
+	if !strings.Contains(world, `operation("read")`) {
+		t.Fatalf("first request world misses its fact:\n%s", world)
+	}
+
+	// Same env, same base: the operation of the first request must be gone.
+	world, err = poolRequest(t, pool, env, token, "")
+	if err == nil {
+		t.Error("second request allowed with the fact of the first one")
+	}
+	if strings.Contains(world, `operation("read")`) {
+		t.Errorf("second request world holds the fact of the first one:\n%s", world)
+	}
+
+	// The base checks and policies are still there: write passes the check, no policy allows it.
+	world, err = poolRequest(t, pool, env, token, "write")
+	if failed := FailedChecks(err); err == nil || len(failed) > 0 {
+		t.Errorf("write: err = %v, failed checks %v, want no matching policy", err, failed)
+	}
+	if !strings.Contains(world, `operation("write")`) {
+		t.Errorf("later request world misses its fact:\n%s", world)
+	}
+}
+
+func TestAuthorizerPoolEnvAffinity(t *testing.T) {
+	env := wasmtest.Env(t)
+	other, err := wasm.InitWasm()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := NewAuthorizerPool(env, poolBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+
+	// A builder of other can only be merged with a base parsed in other.
+	if _, err := poolRequest(t, pool, other, poolToken(t, other), "read"); err != nil {
+		t.Errorf("request in a second env denied: %v", err)
+	}
+	if len(pool.bases) != 2 {
+		t.Errorf("%d bases, want one per env", len(pool.bases))
+	}
+
+	if err := pool.Forget(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := poolRequest(t, pool, env, poolToken(t, env), "read"); err != nil {
+		t.Errorf("request denied after forgetting another env: %v", err)
+	}
+
+	if _, err := NewAuthorizerPool(env, "allow if"); err == nil {
+		t.Error("invalid base accepted")
+	}
+}
+
+func BenchmarkAuthorizerPerRequest(b *testing.B) {
+	env := wasmtest.Env(b)
+	token := poolToken(b, env)
+
+	read := operationFact(b, "read")
+
+	b.Run("AddCode", func(b *testing.B) {
+		for b.Loop() {
+			builder, err := NewAuthorizerBuilder(env)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := builder.AddCode(poolBase); err != nil {
+				b.Fatal(err)
+			}
+			if err := builder.AddFact(read); err != nil {
+				b.Fatal(err)
+			}
+			authorizer, err := builder.Build(token)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := authorizer.Authorize(); err != nil {
+				b.Fatal(err)
+			}
+			_ = authorizer.Close()
+		}
+	})
+
+	b.Run("Pool", func(b *testing.B) {
+		pool, err := NewAuthorizerPool(env, poolBase)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer func() { _ = pool.Close() }()
+
+		for b.Loop() {
+			builder, err := pool.Get(env)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := builder.AddFact(read); err != nil {
+				b.Fatal(err)
+			}
+			authorizer, err := builder.Build(token)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := authorizer.Authorize(); err != nil {
+				b.Fatal(err)
+			}
+			_ = pool.Put(authorizer)
+		}
+	})
+}
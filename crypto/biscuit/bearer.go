@@ -0,0 +1,33 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// FromBearer parses the value of an `Authorization` header and verifies the token against root.
+// The `Bearer ` prefix is optional and matched case-insensitively, and the token may use the
+// url-safe or the standard base64 alphabet, padded or not.
+func FromBearer(env wasm.WasmEnv, headerValue string, root keypair.PublicKey) (*Biscuit, error) {
+	const scheme = "Bearer"
+
+	token := strings.TrimSpace(headerValue)
+	if len(token) >= len(scheme) && strings.EqualFold(token[:len(scheme)], scheme) {
+		if rest := token[len(scheme):]; rest == "" || rest[0] == ' ' || rest[0] == '\t' {
+			token = strings.TrimSpace(rest)
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("invalid bearer token: empty token")
+	}
+
+	data, err := decodeToken(strings.NewReplacer("+", "-", "/", "_").Replace(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bearer token: %w", err)
+	}
+
+	return FromBase64(env, base64.URLEncoding.EncodeToString(data), root)
+}
@@ -0,0 +1,62 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestFromBearer(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	publicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard := base64.RawStdEncoding.EncodeToString(data)
+
+	for _, header := range []string{
+		"Bearer " + encoded,
+		"bearer   " + encoded + " ",
+		encoded,
+		"Bearer " + standard,
+	} {
+		parsed, err := FromBearer(env, header, publicKey)
+		if err != nil {
+			t.Errorf("FromBearer(%.20q...) failed: %v", header, err)
+			continue
+		}
+		_ = parsed.Close()
+	}
+
+	for _, header := range []string{"", "Bearer ", "Bearer not*base64", "Basic dXNlcjpwYXNz"} {
+		_, err := FromBearer(env, header, publicKey)
+		if err == nil {
+			t.Errorf("FromBearer(%q) succeeded", header)
+			continue
+		}
+		if strings.HasPrefix(header, "Bearer") && !strings.Contains(err.Error(), "invalid bearer token") {
+			t.Errorf("FromBearer(%q) error = %v, want it to name the bearer token", header, err)
+		}
+	}
+}
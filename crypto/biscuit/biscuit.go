@@ -0,0 +1,300 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Biscuit is a token living in guest memory.
+type Biscuit struct {
+	env wasm.WasmEnv
+	ptr uint64
+	// data is the serialized token, kept from parsing or read once from the guest, see serialized.
+	data []byte
+	// quoted caches quotedStrings once scanned is set.
+	scanned, quoted bool
+}
+
+// FromBase64 parses a base64 (url-safe) token and verifies its signatures against root. A token
+// with a block version outside [MinVersion, MaxVersion] fails with an *UnsupportedVersionError.
+func FromBase64(env wasm.WasmEnv, token string, root keypair.PublicKey) (*Biscuit, error) {
+	parsed, err := fromBase64(env, token, root)
+	recordParse(err)
+	return parsed, err
+}
+
+func fromBase64(env wasm.WasmEnv, token string, root keypair.PublicKey) (*Biscuit, error) {
+	if root.Ptr() == 0 {
+		return nil, fmt.Errorf("root public key not initialized")
+	}
+	if err := checkBase64("biscuit_fromBase64", token, minTokenSize); err != nil {
+		return nil, err
+	}
+	// The guest decodes the token the same way, the bytes are kept for serialized.
+	data, err := decodeToken(token)
+	if err != nil {
+		data = nil
+	} else if err := checkVersion(data); err != nil {
+		return nil, err
+	}
+
+	var ptr uint64
+	err = env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(token)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		ptr, err = env.WithOperation("biscuit.parse").CallFallible("biscuit_fromBase64", strPtr, strLen, root.Ptr())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Biscuit{env: env, ptr: ptr, data: data}, nil
+}
+
+func (self *Biscuit) ToBase64() (string, error) {
+	if self.ptr == 0 {
+		return "", fmt.Errorf("biscuit not initialized")
+	}
+	return self.env.CallFallibleString("biscuit_toBase64", self.ptr)
+}
+
+// FromBytes parses a serialized token and verifies its signatures against root, like FromBase64.
+func FromBytes(env wasm.WasmEnv, data []byte, root keypair.PublicKey) (*Biscuit, error) {
+	parsed, err := fromBytes(env, data, root)
+	recordParse(err)
+	return parsed, err
+}
+
+func fromBytes(env wasm.WasmEnv, data []byte, root keypair.PublicKey) (*Biscuit, error) {
+	if root.Ptr() == 0 {
+		return nil, fmt.Errorf("root public key not initialized")
+	}
+	if err := checkSize("biscuit_fromBytes", len(data), minTokenSize); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(data); err != nil {
+		return nil, err
+	}
+
+	var ptr uint64
+	err := env.WithScope(func(s *wasm.Scope) error {
+		dataPtr, dataLen, err := s.WriteBytes(data)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(dataPtr)
+		ptr, err = env.WithOperation("biscuit.parse").CallFallible("biscuit_fromBytes", dataPtr, dataLen, root.Ptr())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Biscuit{env: env, ptr: ptr, data: slices.Clone(data)}, nil
+}
+
+// ToBytes returns the serialized token, the bytes ToBase64 encodes.
+func (self *Biscuit) ToBytes() ([]byte, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("biscuit not initialized")
+	}
+	return self.env.CallFallibleBytes("biscuit_toBytes", self.ptr)
+}
+
+// serialized returns the serialized token, the bytes it was parsed from or, for a token built or
+// appended to, ToBytes the first time.
+func (self *Biscuit) serialized() ([]byte, error) {
+	if self.data == nil {
+		data, err := self.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+		self.data = data
+	}
+	return self.data, nil
+}
+
+// quotedStrings reports whether a string of the token holds a double quote, see Authorizer.world.
+// The token is scanned once.
+func (self *Biscuit) quotedStrings() (bool, error) {
+	if self.scanned {
+		return self.quoted, nil
+	}
+	data, err := self.serialized()
+	if err != nil {
+		return false, err
+	}
+	quoted, err := quotedSymbols(data)
+	if err != nil {
+		return false, err
+	}
+	self.scanned, self.quoted = true, quoted
+	return quoted, nil
+}
+
+// factCount adds the facts of the token to those of an authorizer, see WithMaxFactGrowthRatio.
+func (self *Biscuit) factCount(authorizer factCount) (*factCount, error) {
+	data, err := self.serialized()
+	if err != nil {
+		return nil, err
+	}
+	count := factCount{}
+	count.merge(authorizer)
+	if err := count.addToken(data); err != nil {
+		return nil, fmt.Errorf("cannot count the facts of the token: %w", err)
+	}
+	return &count, nil
+}
+
+// Seal returns a copy of the token whose last block is signed with its ephemeral private key,
+// so no block can be appended to it anymore.
+func (self *Biscuit) Seal() (*Biscuit, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("biscuit not initialized")
+	}
+
+	ptr, err := self.env.WithOperation("biscuit.seal").CallFallible("biscuit_sealToken", self.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Biscuit{env: self.env, ptr: ptr}, nil
+}
+
+// IsSealed reports whether the token was sealed, see Seal.
+func (self *Biscuit) IsSealed() (bool, error) {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return false, err
+	}
+
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return false, fmt.Errorf("cannot decode token: %w", err)
+	}
+
+	return isSealed(data)
+}
+
+// BlockCount returns the number of blocks of the token, authority block included.
+func (self *Biscuit) BlockCount() (int, error) {
+	if self.ptr == 0 {
+		return 0, fmt.Errorf("biscuit not initialized")
+	}
+
+	function, err := self.env.GetFunction("biscuit_countBlocks")
+	if err != nil {
+		return 0, err
+	}
+
+	results, err := self.env.Call(function, self.ptr)
+	if err != nil {
+		return 0, fmt.Errorf("biscuit_countBlocks failed: %w", err)
+	}
+	return int(uint32(results[0])), nil
+}
+
+// BlockSource returns the datalog of the block at index, 0 being the authority block.
+func (self *Biscuit) BlockSource(index int) (string, error) {
+	if self.ptr == 0 {
+		return "", fmt.Errorf("biscuit not initialized")
+	}
+	return self.env.CallFallibleString("biscuit_getBlockSource", self.ptr, uint64(index))
+}
+
+// BlockProtoBytes returns the block at index, 0 being the authority block, as a serialized Block
+// message of the biscuit protobuf schema, for tools working on the schema directly. Unlike
+// ToBytes, it holds neither the signature nor the key of the block.
+func (self *Biscuit) BlockProtoBytes(index int) ([]byte, error) {
+	data, err := self.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	return blockMessage(data, index)
+}
+
+// RevocationIDs returns the revocation identifier of every block of the token, authority block
+// first. Revoking any of them revokes the token.
+func (self *Biscuit) RevocationIDs() ([][]byte, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("biscuit not initialized")
+	}
+
+	ids, err := self.env.CallStrings("biscuit_getRevocationIdentifiers", self.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	revocationIDs := make([][]byte, len(ids))
+	for i, id := range ids {
+		if revocationIDs[i], err = hex.DecodeString(id); err != nil {
+			return nil, fmt.Errorf("invalid revocation identifier %q: %w", id, err)
+		}
+	}
+	return revocationIDs, nil
+}
+
+// RootContext returns the context of the authority block, the free-form string issuers use to
+// describe the token, and whether it has one.
+func (self *Biscuit) RootContext() (string, bool, error) {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return "", false, err
+	}
+
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot decode token: %w", err)
+	}
+
+	return blockContext(data, 0)
+}
+
+// AuthorityFacts returns the facts of the authority block, in the order they were added, an empty
+// slice when it only holds rules and checks. Facts holding sets, arrays, maps or null are not
+// supported and make it fail.
+func (self *Biscuit) AuthorityFacts() ([]Fact, error) {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode token: %w", err)
+	}
+
+	return authorityFacts(data)
+}
+
+// Metadata decodes the context of the authority block as JSON into v.
+func (self *Biscuit) Metadata(v any) error {
+	context, found, err := self.RootContext()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("token has no authority block context")
+	}
+	if err := json.Unmarshal([]byte(context), v); err != nil {
+		return fmt.Errorf("invalid token metadata: %w", err)
+	}
+	return nil
+}
+
+// Close frees the guest token. The Biscuit must not be used afterwards.
+func (self *Biscuit) Close() error {
+	err := self.env.FreeObject("biscuit", self.ptr)
+	self.ptr = 0
+	return err
+}
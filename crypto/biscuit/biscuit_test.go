@@ -0,0 +1,57 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"testing"
+)
+
+func TestFromBase64(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	root := newRoot(t, env)
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := FromBase64(env, encoded, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = parsed.Close() }()
+	if !authorize(t, env, parsed, `allow if user("alice");`) {
+		t.Error("parsed token not authorized")
+	}
+
+	other, err := newRoot(t, env).GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The signature failure is the error the guest throws.
+	var guestErr *wasm.GuestError
+	if _, err := FromBase64(env, encoded, other); !errors.As(err, &guestErr) {
+		t.Fatalf("token signed by another root = %v, want a *wasm.GuestError", err)
+	}
+	details, _ := guestErr.Details.(map[string]any)
+	if format, _ := details["Format"].(map[string]any); format["Signature"] == nil {
+		t.Errorf("error details = %v, want a signature error", guestErr.Details)
+	}
+}
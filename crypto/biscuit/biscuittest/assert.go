@@ -0,0 +1,73 @@
+package biscuittest
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// AssertAllowed fails t unless authorizer authorizes its token. The failure reports the error,
+// the failed checks and the world of the authorizer.
+func AssertAllowed(t testing.TB, authorizer *biscuit.Authorizer) {
+	t.Helper()
+
+	if _, err := authorizer.Authorize(); err != nil {
+		t.Errorf("token denied, want allowed: %v\n%s", err, describe(authorizer, err))
+	}
+}
+
+// AssertDenied fails t unless authorizer denies its token. With a non-empty expectedFailedCheck,
+// such as `check if right("file1", "read")`, that check must be among the failed ones. The
+// failure reports the failed checks and the world of the authorizer.
+func AssertDenied(t testing.TB, authorizer *biscuit.Authorizer, expectedFailedCheck string) {
+	t.Helper()
+
+	policy, err := authorizer.Authorize()
+	if err == nil {
+		t.Errorf("token allowed by policy %d, want denied\n%s", policy, describe(authorizer, nil))
+		return
+	}
+	if expectedFailedCheck == "" {
+		return
+	}
+
+	expected := normalizeRule(expectedFailedCheck)
+	for _, check := range biscuit.FailedChecks(err) {
+		if normalizeRule(check.Rule) == expected {
+			return
+		}
+	}
+	t.Errorf("token denied without failing %q: %v\n%s", expectedFailedCheck, err, describe(authorizer, err))
+}
+
+// describe lists the checks err reports as failed, then the world of the authorizer.
+func describe(authorizer *biscuit.Authorizer, err error) string {
+	var text strings.Builder
+	if failed := biscuit.FailedChecks(err); len(failed) > 0 {
+		text.WriteString("failed checks:\n")
+		for _, check := range failed {
+			if check.Authorizer {
+				fmt.Fprintf(&text, "  authorizer check %d: %s\n", check.Check, check.Rule)
+			} else {
+				fmt.Fprintf(&text, "  block %d check %d: %s\n", check.Block, check.Check, check.Rule)
+			}
+		}
+	} else if err != nil {
+		text.WriteString("no failed check\n")
+	}
+
+	world, worldErr := authorizer.ToString()
+	if worldErr != nil {
+		fmt.Fprintf(&text, "authorizer world unavailable: %v\n", worldErr)
+	} else {
+		fmt.Fprintf(&text, "authorizer world:\n%s", world)
+	}
+	return text.String()
+}
+
+// normalizeRule drops the final `;` and the surrounding spaces of a check, so that checks can be
+// written like in datalog code.
+func normalizeRule(rule string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rule), ";"))
+}
@@ -0,0 +1,79 @@
+package biscuittest_test
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/crypto/biscuit/biscuittest"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recorder is a testing.TB collecting the failures of an assertion instead of failing the test.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (self *recorder) Helper() {}
+
+func (self *recorder) Errorf(format string, args ...any) {
+	self.failures = append(self.failures, fmt.Sprintf(format, args...))
+}
+
+// newAuthorizer authorizes the fixture token with code.
+func newAuthorizer(t *testing.T, code string) *biscuit.Authorizer {
+	t.Helper()
+
+	env := wasmtest.Env(t)
+	token := biscuittest.Token(t, env)
+
+	authorizerBuilder, err := biscuit.NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizerBuilder.Close() }()
+	if err := authorizerBuilder.AddCode(code); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := authorizerBuilder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = authorizer.Close() })
+	return authorizer
+}
+
+func TestAssertAllowed(t *testing.T) {
+	biscuittest.AssertAllowed(t, newAuthorizer(t, `allow if right("file1", "read");`))
+
+	rec := &recorder{TB: t}
+	biscuittest.AssertAllowed(rec, newAuthorizer(t, `allow if right("file1", "write");`))
+	if len(rec.failures) != 1 || !strings.Contains(rec.failures[0], `allow if right("file1", "write")`) {
+		t.Errorf("failures = %q, want the denial with the authorizer world", rec.failures)
+	}
+}
+
+func TestAssertDenied(t *testing.T) {
+	code := `check if right("file1", "write"); allow if user("alice");`
+	biscuittest.AssertDenied(t, newAuthorizer(t, code), `check if right("file1", "write");`)
+	biscuittest.AssertDenied(t, newAuthorizer(t, code), "")
+
+	// The failure names the check that actually failed, and dumps the world it failed against.
+	rec := &recorder{TB: t}
+	biscuittest.AssertDenied(rec, newAuthorizer(t, code), `check if right("file1", "delete")`)
+	if len(rec.failures) != 1 {
+		t.Fatalf("failures = %q, want one", rec.failures)
+	}
+	for _, want := range []string{`authorizer check 0: check if right("file1", "write")`, `right("file1", "read")`} {
+		if !strings.Contains(rec.failures[0], want) {
+			t.Errorf("failure does not report %s:\n%s", want, rec.failures[0])
+		}
+	}
+
+	rec = &recorder{TB: t}
+	biscuittest.AssertDenied(rec, newAuthorizer(t, `allow if user("alice");`), "")
+	if len(rec.failures) != 1 || !strings.Contains(rec.failures[0], "allowed by policy 0") {
+		t.Errorf("failures = %q, want the token reported allowed", rec.failures)
+	}
+}
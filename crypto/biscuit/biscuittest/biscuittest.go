@@ -0,0 +1,107 @@
+// Package biscuittest provides testing/quick generators of datalog for property tests, and
+// assertions on authorization decisions.
+package biscuittest
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// LongString is the length of the longest strings the generators produce.
+const LongString = 4096
+
+// Edge values of the generated terms, picked one time in four.
+var (
+	edgeStrings  = []string{"", " ", `"`, `\`, "\n", "\t", "a\"b\\c\nd", "é€😀", strings.Repeat("x", LongString)}
+	edgeIntegers = []int64{0, 1, -1, math.MinInt64, math.MaxInt64}
+	edgeDates    = []time.Time{time.Unix(0, 0), time.Unix(1, 0), time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)}
+)
+
+// stringRunes are the runes random strings are made of, escapes and multi-byte runes included.
+var stringRunes = []rune("abcXYZ019 _-/:.\"\\\n\té😀")
+
+// FactSet is a set of facts of random names and arities. Sets grow with the size quick passes:
+// small sizes give few facts of few terms, which keeps failing inputs readable.
+type FactSet []biscuit.Fact
+
+// Generate implements quick.Generator.
+func (FactSet) Generate(rand *rand.Rand, size int) reflect.Value {
+	facts := make(FactSet, rand.Intn(min(size, 8)+1))
+	for i := range facts {
+		facts[i] = Fact(rand, size)
+	}
+	return reflect.ValueOf(facts)
+}
+
+// Code renders the facts as a datalog block.
+func (self FactSet) Code() string {
+	var code strings.Builder
+	for _, fact := range self {
+		code.WriteString(fact.String() + ";\n")
+	}
+	return code.String()
+}
+
+// Fact returns a fact of a random name holding one to four random terms.
+func Fact(rand *rand.Rand, size int) biscuit.Fact {
+	terms := make([]biscuit.Term, 1+rand.Intn(min(size, 3)+1))
+	for i := range terms {
+		terms[i] = Term(rand, size)
+	}
+	fact, err := biscuit.NewFact(Name(rand, size), terms...)
+	if err != nil {
+		panic(err)
+	}
+	return fact
+}
+
+// Name returns a valid predicate name: a letter, then letters, digits, underscores or colons.
+func Name(rand *rand.Rand, size int) string {
+	const first = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	const rest = first + "0123456789_:"
+
+	name := []byte{first[rand.Intn(len(first))]}
+	for range rand.Intn(min(size, 16) + 1) {
+		name = append(name, rest[rand.Intn(len(rest))])
+	}
+	return string(name)
+}
+
+// Term returns a term of any kind.
+func Term(rand *rand.Rand, size int) biscuit.Term {
+	edge := rand.Intn(4) == 0
+	switch rand.Intn(5) {
+	case 0:
+		if edge {
+			return biscuit.StringTerm(edgeStrings[rand.Intn(len(edgeStrings))])
+		}
+		runes := make([]rune, rand.Intn(size+1))
+		for i := range runes {
+			runes[i] = stringRunes[rand.Intn(len(stringRunes))]
+		}
+		return biscuit.StringTerm(string(runes))
+	case 1:
+		if edge {
+			return biscuit.IntegerTerm(edgeIntegers[rand.Intn(len(edgeIntegers))])
+		}
+		return biscuit.IntegerTerm(rand.Int63n(int64(size)+1) - int64(size)/2)
+	case 2:
+		return biscuit.BoolTerm(rand.Intn(2) == 1)
+	case 3:
+		if edge {
+			return biscuit.DateTerm(edgeDates[rand.Intn(len(edgeDates))])
+		}
+		return biscuit.DateTerm(time.Unix(rand.Int63n(1<<32), 0))
+	default:
+		data := make([]byte, 1+rand.Intn(size+1))
+		if edge {
+			data = data[:1]
+		}
+		rand.Read(data)
+		return biscuit.BytesTerm(data)
+	}
+}
@@ -0,0 +1,32 @@
+package biscuittest
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/crypto/keypair/keypairtest"
+	"biscuit-wasm-go/wasm"
+	"testing"
+)
+
+// TokenCode is the authority block of Token.
+const TokenCode = `user("alice"); right("file1", "read");`
+
+// Token returns a token of TokenCode signed by keypairtest.KeyPair, loaded in env and closed when
+// the test ends.
+func Token(t testing.TB, env wasm.WasmEnv) *biscuit.Biscuit {
+	t.Helper()
+
+	builder, err := biscuit.NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(TokenCode); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(keypairtest.KeyPair(t, env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = token.Close() })
+	return token
+}
@@ -0,0 +1,126 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"fmt"
+	"time"
+)
+
+// BlockBuilder assembles a block appended to an existing token.
+type BlockBuilder struct {
+	env wasm.WasmEnv
+	ptr uint64
+	// rejected is the error the guest rejected code with, see ErrBuilderRejected.
+	rejected error
+}
+
+func NewBlockBuilder(env wasm.WasmEnv) (*BlockBuilder, error) {
+	function, err := env.GetFunction("blockbuilder_new")
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := env.Call(function)
+	if err != nil {
+		return nil, fmt.Errorf("blockbuilder_new failed: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no result returned from blockbuilder_new")
+	}
+
+	return &BlockBuilder{env: env, ptr: result[0]}, nil
+}
+
+func (self *BlockBuilder) usable() error {
+	return builderUsable("block builder", self.ptr, self.rejected)
+}
+
+// AddCode parses datalog source (facts, rules and checks) into the block. Code the guest rejects
+// makes the builder unusable, see ErrBuilderRejected.
+func (self *BlockBuilder) AddCode(code string) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+
+	if err := checkTrustedKeys(self.env, code); err != nil {
+		return err
+	}
+
+	err := self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		return self.env.WithOperation("datalog.parse").CallFallibleVoid("blockbuilder_addCode", self.ptr, strPtr, strLen)
+	})
+	return rejectBuilder(self.env, "blockbuilder", &self.ptr, &self.rejected, err)
+}
+
+// RestrictHTTP adds the checks limiting the token to requests using one of methods on a path
+// starting with pathPrefix, matched against the operation and resource facts of the authorizer.
+// An empty pathPrefix leaves the path unrestricted.
+func (self *BlockBuilder) RestrictHTTP(methods []string, pathPrefix string) error {
+	if len(methods) == 0 {
+		return fmt.Errorf("no HTTP method given")
+	}
+
+	for _, method := range methods {
+		if method == "" {
+			return fmt.Errorf("empty HTTP method")
+		}
+	}
+
+	code := CheckOperationIn(methods...).String() + ";\n"
+	if pathPrefix != "" {
+		code += fmt.Sprintf("check if resource($r), $r.starts_with(%s);\n", quoteString(pathPrefix))
+	}
+	return self.AddCode(code)
+}
+
+// NotBefore adds a check rejecting the token before t, so it can be handed out before it becomes
+// valid. A t outside [1970, 9999] fails before the builder is touched.
+func (self *BlockBuilder) NotBefore(t time.Time) error {
+	check, err := CheckNotBefore(t)
+	if err != nil {
+		return err
+	}
+	return self.AddCode(check.String() + ";")
+}
+
+// Audience adds a check limiting the token to the service name, which declares itself with
+// AuthorizerBuilder.AddAudience.
+func (self *BlockBuilder) Audience(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty audience")
+	}
+	return self.AddCode(CheckAudience(name).String() + ";")
+}
+
+// Append returns a new token made of the receiver followed by block, signed with a fresh
+// ephemeral key. The guest only borrows the block builder: it still has to be closed, and can be
+// appended to other tokens meanwhile.
+func (self *Biscuit) Append(block *BlockBuilder) (*Biscuit, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("biscuit not initialized")
+	}
+	if err := block.usable(); err != nil {
+		return nil, err
+	}
+
+	ptr, err := self.env.WithOperation("biscuit.append").CallFallible("biscuit_appendBlock", self.ptr, block.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Biscuit{env: self.env, ptr: ptr}, nil
+}
+
+// Close frees the block builder.
+func (self *BlockBuilder) Close() error {
+	err := self.env.FreeObject("blockbuilder", self.ptr)
+	self.ptr = 0
+	return err
+}
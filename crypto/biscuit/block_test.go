@@ -0,0 +1,196 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBlockBuilderRestrictHTTP(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+
+	if err := block.RestrictHTTP(nil, "/api/"); err == nil {
+		t.Error("no method accepted")
+	}
+	if err := block.RestrictHTTP([]string{"GET"}, "/api/"); err != nil {
+		t.Fatal(err)
+	}
+	restricted, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = restricted.Close() }()
+
+	for _, tc := range []struct {
+		method, path string
+		allowed      bool
+	}{
+		{"GET", "/api/x", true},
+		{"POST", "/api/x", false},
+		{"GET", "/other", false},
+	} {
+		code := `operation("` + tc.method + `"); resource("` + tc.path + `"); allow if user("alice");`
+		if got := authorize(t, env, restricted, code); got != tc.allowed {
+			t.Errorf("%s %s: allowed = %t, want %t", tc.method, tc.path, got, tc.allowed)
+		}
+	}
+}
+
+func TestBlockBuilderAudience(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.Audience(""); err == nil {
+		t.Error("empty audience accepted")
+	}
+	if err := block.Audience("billing"); err != nil {
+		t.Fatal(err)
+	}
+	scoped, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = scoped.Close() }()
+
+	for _, tc := range []struct {
+		audience string
+		allowed  bool
+	}{
+		{"billing", true},
+		{"shipping", false},
+	} {
+		authorizerBuilder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizerBuilder.Close() }()
+		if err := authorizerBuilder.AddAudience(tc.audience); err != nil {
+			t.Fatal(err)
+		}
+		if err := authorizerBuilder.AddCode(`allow if user("alice");`); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := authorizerBuilder.Build(scoped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+
+		_, err = authorizer.Authorize()
+		if tc.allowed {
+			if err != nil {
+				t.Errorf("audience %s: %v", tc.audience, err)
+			}
+			continue
+		}
+		want := []FailedCheck{{Block: 1, Check: 0, Rule: `check if audience("billing")`}}
+		if got := FailedChecks(err); !reflect.DeepEqual(got, want) {
+			t.Errorf("audience %s: failed checks = %+v, want %+v", tc.audience, got, want)
+		}
+	}
+}
+
+func TestBlockProtoBytes(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(`check if resource("file1");`); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+
+	full, err := attenuated.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every block is embedded in the token after the previous one, signatures and keys around it.
+	offset, total := 0, 0
+	for i, symbol := range []string{"alice", "file1"} {
+		proto, err := attenuated.BlockProtoBytes(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(proto, []byte(symbol)) {
+			t.Errorf("block %d does not define the symbol %q: %x", i, symbol, proto)
+		}
+		at := bytes.Index(full[offset:], proto)
+		if at < 0 {
+			t.Fatalf("block %d is not part of the token bytes after offset %d", i, offset)
+		}
+		offset += at + len(proto)
+		total += len(proto)
+	}
+	if total >= len(full) {
+		t.Errorf("blocks take %d bytes of a %d bytes token, want room for signatures", total, len(full))
+	}
+
+	for _, index := range []int{-1, 2} {
+		if _, err := attenuated.BlockProtoBytes(index); err == nil {
+			t.Errorf("block %d of a 2 blocks token returned", index)
+		}
+	}
+}
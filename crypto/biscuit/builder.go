@@ -0,0 +1,279 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// nonceSize is the length of the random value added by AddNonce.
+const nonceSize = 16
+
+// ErrBuilderRejected is returned by the calls made on a builder after the guest rejected code or a
+// fact added to it, which leaves the guest side of the builder unusable. The builder is freed by
+// the rejection, closing it is a no-op.
+var ErrBuilderRejected = errors.New("builder unusable after rejected code")
+
+// Builder assembles the authority block of a new token.
+type Builder struct {
+	env     wasm.WasmEnv
+	ptr     uint64
+	options builderOptions
+	// rejected is the error the guest rejected code with, see ErrBuilderRejected.
+	rejected error
+}
+
+func NewBuilder(env wasm.WasmEnv, options ...BuilderOption) (*Builder, error) {
+	resolved, err := newBuilderOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	function, err := env.GetFunction("biscuitbuilder_new")
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := env.Call(function)
+	if err != nil {
+		return nil, fmt.Errorf("biscuitbuilder_new failed: %w", err)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no result returned from biscuitbuilder_new")
+	}
+
+	return &Builder{env: env, ptr: result[0], options: resolved}, nil
+}
+
+// builderUsable returns the error of the calls made on the builder kind at ptr, nil when it can be
+// called.
+func builderUsable(kind string, ptr uint64, rejected error) error {
+	if rejected != nil {
+		return fmt.Errorf("%w: %v", ErrBuilderRejected, rejected)
+	}
+	if ptr == 0 {
+		return fmt.Errorf("%s not initialized", kind)
+	}
+	return nil
+}
+
+// rejectBuilder frees the builder object at *ptr and records err in *rejected when err is the guest
+// rejecting what was added to it, and returns err.
+func rejectBuilder(env wasm.WasmEnv, object string, ptr *uint64, rejected *error, err error) error {
+	var guestErr *wasm.GuestError
+	if errors.As(err, &guestErr) && *ptr != 0 {
+		_ = env.FreeObject(object, *ptr)
+		*ptr = 0
+		*rejected = err
+	}
+	return err
+}
+
+func (self *Builder) usable() error {
+	return builderUsable("builder", self.ptr, self.rejected)
+}
+
+// reject records err when the guest rejected what was added to the builder, see ErrBuilderRejected.
+func (self *Builder) reject(err error) error {
+	return rejectBuilder(self.env, "biscuitbuilder", &self.ptr, &self.rejected, err)
+}
+
+// AddCode parses datalog source (facts, rules and checks) into the authority block. Code the
+// guest rejects makes the builder unusable, see ErrBuilderRejected.
+func (self *Builder) AddCode(code string) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+
+	if err := checkTrustedKeys(self.env, code); err != nil {
+		return err
+	}
+	if len(self.options.scopes) > 0 {
+		return self.reject(addCodeWithParameters(self.env, "biscuitbuilder_addCodeWithParameters", self.ptr, code, nil, self.options.scopes))
+	}
+
+	return self.reject(self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		return self.env.WithOperation("datalog.parse").CallFallibleVoid("biscuitbuilder_addCode", self.ptr, strPtr, strLen)
+	}))
+}
+
+// AddRule adds a rule, such as `right($r) <- resource($r)`, to the authority block, like AddCode.
+func (self *Builder) AddRule(rule string) error {
+	return self.AddCode(terminated(rule))
+}
+
+// AddCheck adds a check, such as `check if operation("read")`, to the authority block, like
+// AddCode. See AddChecks to add checks without risking the builder on a malformed one.
+func (self *Builder) AddCheck(check string) error {
+	return self.AddCode(terminated(check))
+}
+
+// terminated ends the datalog statement s with a semicolon, unless it has one.
+func terminated(s string) string {
+	return strings.TrimSuffix(strings.TrimSpace(s), ";") + ";"
+}
+
+// AddChecks adds checks, such as `check if operation("read")` or the String of a Check, to the
+// authority block, all of them or none: they are parsed before any is added, so a malformed check
+// leaves the builder as it was, usable.
+func (self *Builder) AddChecks(checks ...string) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+
+	code, err := parseChecks(self.env, self.options, checks)
+	if err != nil {
+		return err
+	}
+	return self.AddCode(code)
+}
+
+// AddFact adds a fact to the authority block.
+func (self *Builder) AddFact(fact Fact) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+	if err := fact.checkGround(); err != nil {
+		return err
+	}
+
+	var code strings.Builder
+	parameters := map[string]any{}
+	fact.render(&code, self.options.largeBytesThreshold, parameters)
+	if len(parameters) > 0 {
+		// fact_fromString takes no parameters, the fact goes through the code instead, which a
+		// fact the guest rejects would make unusable.
+		if err := fact.validate(); err != nil {
+			return err
+		}
+		code.WriteByte(';')
+		return self.reject(addCodeWithParameters(self.env, "biscuitbuilder_addCodeWithParameters", self.ptr, code.String(), parameters, nil))
+	}
+
+	return self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code.String())
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		factPtr, err := self.env.CallFallible("fact_fromString", strPtr, strLen)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = self.env.FreeObject("fact", factPtr) }()
+
+		return self.reject(self.env.CallFallibleVoid("biscuitbuilder_addFact", self.ptr, factPtr))
+	})
+}
+
+// AddFacts adds facts like AddFact, rendering them into a single datalog document so the batch
+// crosses into the guest once. Either every fact is added or none is: when some are invalid, the
+// error joins a *FactError for each of them.
+func (self *Builder) AddFacts(facts []Fact) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+	if len(facts) == 0 {
+		return nil
+	}
+
+	code, parameters, err := renderFacts(facts, self.options.largeBytesThreshold)
+	if err != nil {
+		return err
+	}
+	if len(parameters) > 0 {
+		return self.reject(addCodeWithParameters(self.env, "biscuitbuilder_addCodeWithParameters", self.ptr, code, parameters, nil))
+	}
+
+	return self.reject(self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		return self.env.WithOperation("datalog.parse").CallFallibleVoid("biscuitbuilder_addCode", self.ptr, strPtr, strLen)
+	}))
+}
+
+// AddNonce adds a `nonce(hex:...)` fact holding 16 random bytes drawn from the env entropy source
+// and returns them, so the issuer can record the nonce and servers can reject replays.
+func (self *Builder) AddNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(self.env.Entropy(), nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	fact, err := NewFact("nonce", BytesTerm(nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := self.AddFact(fact); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+// SetRootKeyID records id in the token, for verifiers to pick the root key it was signed with
+// among the ones they trust, see RootKeyID.
+func (self *Builder) SetRootKeyID(id uint32) error {
+	if err := self.usable(); err != nil {
+		return err
+	}
+
+	function, err := self.env.GetFunction("biscuitbuilder_setRootKeyId")
+	if err != nil {
+		return err
+	}
+
+	if _, err := self.env.Call(function, self.ptr, uint64(id)); err != nil {
+		return fmt.Errorf("biscuitbuilder_setRootKeyId failed: %w", err)
+	}
+	return nil
+}
+
+// Build signs the authority block with the private key of root. The builder is consumed
+// by the guest and cannot be used afterwards, whether Build succeeds or not.
+func (self *Builder) Build(root *keypair.KeyPair) (*Biscuit, error) {
+	if err := self.usable(); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := root.GetPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = self.env.FreeObject("privatekey", privateKey.Ptr()) }()
+
+	builderPtr := self.ptr
+	self.ptr = 0
+
+	ptr, err := self.env.WithOperation("biscuit.build").CallFallible("biscuitbuilder_build", builderPtr, privateKey.Ptr())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Biscuit{env: self.env, ptr: ptr}, nil
+}
+
+// Close frees a builder that was not built. It is a no-op after Build.
+func (self *Builder) Close() error {
+	err := self.env.FreeObject("biscuitbuilder", self.ptr)
+	self.ptr = 0
+	return err
+}
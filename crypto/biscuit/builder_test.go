@@ -0,0 +1,326 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newRoot(t testing.TB, env wasm.WasmEnv) *keypair.KeyPair {
+	t.Helper()
+
+	root := keypair.Invoke(env)
+	if err := root.New(keypair.Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// authorize runs code against token and reports whether an allow policy matched.
+func authorize(t *testing.T, env wasm.WasmEnv, token *Biscuit, code string) bool {
+	t.Helper()
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+
+	if err := builder.AddCode(code); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := builder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	_, err = authorizer.Authorize()
+	return err == nil
+}
+
+func TestBuilderAddNonce(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	var nonces [][]byte
+	var tokens []*Biscuit
+	for range 2 {
+		builder, err := NewBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce, err := builder.AddNonce()
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := builder.Build(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = token.Close() }()
+
+		if len(nonce) != nonceSize {
+			t.Fatalf("nonce has %d bytes, want %d", len(nonce), nonceSize)
+		}
+		nonces = append(nonces, nonce)
+		tokens = append(tokens, token)
+	}
+
+	if bytes.Equal(nonces[0], nonces[1]) {
+		t.Fatal("two tokens got the same nonce")
+	}
+
+	for i, token := range tokens {
+		own := Fact{name: "nonce", terms: []Term{BytesTerm(nonces[i])}}
+		other := Fact{name: "nonce", terms: []Term{BytesTerm(nonces[1-i])}}
+
+		if !authorize(t, env, token, "allow if "+own.String()+";") {
+			t.Errorf("token %d does not carry its returned nonce", i)
+		}
+		if authorize(t, env, token, "allow if "+other.String()+";") {
+			t.Errorf("token %d carries the other token's nonce", i)
+		}
+	}
+}
+
+func TestBuilderAddNonceUsesEnvEntropy(t *testing.T) {
+	env := wasmtest.Env(t).WithEntropy(bytes.NewReader(bytes.Repeat([]byte{0xab}, nonceSize)))
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+
+	nonce, err := builder.AddNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(nonce, bytes.Repeat([]byte{0xab}, nonceSize)) {
+		t.Errorf("nonce = %x, want it read from the env entropy source", nonce)
+	}
+
+	if _, err := builder.AddNonce(); err == nil {
+		t.Error("expected an error once the entropy source is exhausted")
+	}
+}
+
+// A token whose authority block holds no fact goes through the whole pipeline.
+func TestBuilderWithoutFacts(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`check if true;`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	facts, err := token.AuthorityFacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if facts == nil || len(facts) != 0 {
+		t.Errorf("authority facts = %#v, want an empty slice", facts)
+	}
+
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := FromBase64(env, encoded, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = verified.Close() }()
+
+	if !authorize(t, env, verified, `allow if true;`) {
+		t.Error("fact-less token not authorized")
+	}
+	if authorize(t, env, verified, `deny if true;`) {
+		t.Error("deny policy ignored")
+	}
+}
+
+func TestBuilderAddChecks(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddChecks(`check if operation("read")`, `check if resource(`, `check if time($t), $t < 2030-01-01T00:00:00Z`); err == nil {
+		t.Fatal("AddChecks accepted a malformed check")
+	}
+	if err := builder.AddChecks(`check if operation("read")`, `user("bob")`); err == nil {
+		t.Fatal("AddChecks accepted a fact")
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	source, err := token.BlockSource(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(source, "check") {
+		t.Errorf("authority block = %q, want no check", source)
+	}
+
+	builder, err = NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddChecks(`check if operation("read");`, CheckAudience("billing").String()); err != nil {
+		t.Fatal(err)
+	}
+	checked, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = checked.Close() }()
+	if source, err = checked.BlockSource(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(source, "check if"); got != 2 {
+		t.Errorf("authority block = %q, want 2 checks", source)
+	}
+}
+
+func TestBuilderAddRule(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`owner("alice", "file1");`); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddRule(`right($f, "read") <- owner("alice", $f)`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	if !authorize(t, env, token, `allow if right("file1", "read");`) {
+		t.Error("the rule did not derive right(\"file1\", \"read\")")
+	}
+}
+
+func TestBuilderAddCheck(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCheck(`check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	if !authorize(t, env, token, `operation("read"); allow if true;`) {
+		t.Error("read denied")
+	}
+	if authorize(t, env, token, `operation("write"); allow if true;`) {
+		t.Error("write allowed")
+	}
+}
+
+func TestBuilderRejectedCode(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+
+	err = builder.AddCode(`check if nope(`)
+	var guestErr *wasm.GuestError
+	if !errors.As(err, &guestErr) {
+		t.Fatalf("AddCode = %v, want a *wasm.GuestError", err)
+	}
+	// The parse error reports where parsing stopped: the end of the input.
+	errs := guestErr.Details.(map[string]any)["Language"].(map[string]any)["ParseError"].(map[string]any)["errors"].([]any)
+	if input := errs[0].(map[string]any)["input"]; input != "" {
+		t.Errorf("parse error input = %#v, want \"\"", input)
+	}
+
+	err = builder.AddCheck(`check if true`)
+	if !errors.Is(err, ErrBuilderRejected) {
+		t.Errorf("AddCheck after rejected code = %v, want ErrBuilderRejected", err)
+	}
+	// Later calls are not denied by the guest, they must not pass for a guest error.
+	if errors.As(err, &guestErr) {
+		t.Errorf("AddCheck after rejected code = %v, a *wasm.GuestError", err)
+	}
+	if _, err := builder.Build(root); !errors.Is(err, ErrBuilderRejected) {
+		t.Errorf("Build after rejected code = %v, want ErrBuilderRejected", err)
+	}
+	if err := builder.Close(); err != nil {
+		t.Errorf("Close after rejected code = %v", err)
+	}
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(`check if nope(`); err == nil {
+		t.Fatal("block AddCode accepted malformed code")
+	}
+	if err := block.AddCode(`check if true;`); !errors.Is(err, ErrBuilderRejected) {
+		t.Errorf("block AddCode after rejected code = %v, want ErrBuilderRejected", err)
+	}
+
+	authorizer, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+	if err := authorizer.AddCode(`allow if nope(`); err == nil {
+		t.Fatal("authorizer AddCode accepted malformed code")
+	}
+	if _, err := authorizer.ToString(); !errors.Is(err, ErrBuilderRejected) {
+		t.Errorf("authorizer ToString after rejected code = %v, want ErrBuilderRejected", err)
+	}
+}
@@ -0,0 +1,48 @@
+package biscuit
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Canonicalize returns the logical content of the token in a normalized form, for caches
+// deduplicating tokens by content: equivalent tokens have the same canonical form.
+//
+// The serialized token itself cannot serve that purpose. Building or appending to a token draws a
+// fresh ephemeral key pair from the guest random source, and the signatures cover it, so building
+// the same token twice never yields the same bytes. Everything else is deterministic: the guest
+// serializes symbols and statements in the order they were added, and the parameters the bindings
+// pass to it are walked in key order.
+//
+// The canonical form is, for each block in order, the serialized Block message followed by the
+// public key of its external signature, or nothing for a block without one, each preceded by its
+// length as a uvarint. It leaves out the keys and signatures of the chain, and the root key id: it
+// identifies what a token says, not who signed it, so it must only be computed from a token that
+// was verified.
+func (self *Biscuit) Canonicalize() ([]byte, error) {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode token: %w", err)
+	}
+	signed, err := signedBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var canonical []byte
+	for i, block := range signed {
+		parsed, err := parseWireBlock(block)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		canonical = binary.AppendUvarint(canonical, uint64(len(parsed.data)))
+		canonical = append(canonical, parsed.data...)
+		canonical = binary.AppendUvarint(canonical, uint64(len(parsed.externalKey)))
+		canonical = append(canonical, parsed.externalKey...)
+	}
+	return canonical, nil
+}
@@ -0,0 +1,92 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// canonicalToken builds, in env, a token of two blocks whose content only depends on code.
+func canonicalToken(t *testing.T, env wasm.WasmEnv, code string) (data, canonical []byte) {
+	t.Helper()
+
+	root := newRoot(t, env)
+	defer func() { _ = root.Close() }()
+	builder, err := NewBuilder(env, WithLargeBytesThreshold(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(code); err != nil {
+		t.Fatal(err)
+	}
+	facts := make([]Fact, 0, 3)
+	for _, terms := range [][]Term{
+		{StringTerm("report.pdf"), IntegerTerm(42)},
+		{BytesTerm(bytes.Repeat([]byte{0xab}, 64)), BoolTerm(true)},
+		{DateTerm(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)), StringTerm("read")},
+	} {
+		fact, err := NewFact("entry", terms...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		facts = append(facts, fact)
+	}
+	if err := builder.AddFacts(facts); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.Audience("billing"); err != nil {
+		t.Fatal(err)
+	}
+	appended, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	if data, err = appended.ToBytes(); err != nil {
+		t.Fatal(err)
+	}
+	if canonical, err = appended.Canonicalize(); err != nil {
+		t.Fatal(err)
+	}
+	return data, canonical
+}
+
+func TestCanonicalize(t *testing.T) {
+	code := `user("alice"); right($file, "read") <- entry($file, $n), $n > 10; check if operation("read");`
+
+	shared := wasmtest.Env(t)
+	fresh, err := wasm.InitWasm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = fresh.Close(context.Background()) }()
+
+	data, canonical := canonicalToken(t, shared, code)
+	freshData, freshCanonical := canonicalToken(t, fresh, code)
+	if bytes.Equal(data, freshData) {
+		t.Error("tokens built twice have identical bytes, their ephemeral keys should differ")
+	}
+	if !bytes.Equal(canonical, freshCanonical) {
+		t.Errorf("canonical forms differ across envs:\n%x\n%x", canonical, freshCanonical)
+	}
+
+	if _, other := canonicalToken(t, shared, `user("bob");`+code[len(`user("alice");`):]); bytes.Equal(canonical, other) {
+		t.Error("tokens of different content have the same canonical form")
+	}
+}
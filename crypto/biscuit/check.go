@@ -0,0 +1,82 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Check is a datalog check rendered from Go values, to be added with AddCode.
+type Check struct {
+	source string
+}
+
+// CheckOperationIn returns a check passing only when the operation fact of the authorizer is one
+// of ops. Each op is quoted, whatever characters it holds.
+func CheckOperationIn(ops ...string) Check {
+	quoted := make([]string, len(ops))
+	for i, op := range ops {
+		quoted[i] = quoteString(op)
+	}
+	return Check{source: "check if operation($op), [" + strings.Join(quoted, ", ") + "].contains($op)"}
+}
+
+// CheckExpiry returns a check passing only until t, against the time fact of the authorizer. It
+// fails, like NewFact, for a t datalog cannot write, outside [1970, 9999].
+func CheckExpiry(t time.Time) (Check, error) {
+	if err := validateDate(t); err != nil {
+		return Check{}, err
+	}
+	return Check{source: "check if time($time), $time <= " + DateTerm(t).String()}, nil
+}
+
+// CheckNotBefore returns a check passing only from t on, against the time fact of the authorizer.
+// With CheckExpiry it bounds the validity of a token issued ahead of time. It fails, like NewFact,
+// for a t datalog cannot write, outside [1970, 9999].
+func CheckNotBefore(t time.Time) (Check, error) {
+	if err := validateDate(t); err != nil {
+		return Check{}, err
+	}
+	return Check{source: "check if time($time), $time >= " + DateTerm(t).String()}, nil
+}
+
+// CheckAudience returns a check passing only when the authorizer declares the audience fact name,
+// see AuthorizerBuilder.AddAudience.
+func CheckAudience(name string) Check {
+	return Check{source: "check if audience(" + quoteString(name) + ")"}
+}
+
+// String renders the check as datalog source, without the trailing semicolon.
+func (self Check) String() string {
+	return self.source
+}
+
+// parseChecks joins checks, with or without their final semicolon, into datalog source, once the
+// source parsed in a throwaway authorizer builder with options: a failed parse would consume the
+// builder the checks are meant for. The source must hold nothing but the checks.
+func parseChecks(env wasm.WasmEnv, options builderOptions, checks []string) (string, error) {
+	var code strings.Builder
+	for _, check := range checks {
+		code.WriteString(terminated(check) + "\n")
+	}
+
+	scratch, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = scratch.Close() }()
+	scratch.options = options
+
+	if err := scratch.AddCode(code.String()); err != nil {
+		return "", fmt.Errorf("invalid checks: %w", err)
+	}
+	printed, err := scratch.ToString()
+	if err != nil {
+		return "", err
+	}
+	if facts, rules, parsed, policies := countStatements(printed); parsed != len(checks) || facts+rules+policies > 0 {
+		return "", fmt.Errorf("invalid checks: %d checks hold %d facts, %d rules, %d checks and %d policies", len(checks), facts, rules, parsed, policies)
+	}
+	return code.String(), nil
+}
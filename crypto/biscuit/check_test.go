@@ -0,0 +1,208 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"testing"
+	"time"
+)
+
+func TestCheckOperationIn(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	check := CheckOperationIn("read", "list", `say "hi"`)
+	if want := `check if operation($op), ["read", "list", "say \"hi\""].contains($op)`; check.String() != want {
+		t.Errorf("check = %s, want %s", check, want)
+	}
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(check.String() + ";"); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+
+	for _, tc := range []struct {
+		operation string
+		allowed   bool
+	}{
+		{"read", true},
+		{"list", true},
+		{"write", false},
+		{`say "hi"`, true},
+		{"say ", false},
+	} {
+		code := "operation(" + quoteString(tc.operation) + `); allow if user("alice");`
+		if got := authorize(t, env, attenuated, code); got != tc.allowed {
+			t.Errorf("%s: allowed = %t, want %t", tc.operation, got, tc.allowed)
+		}
+	}
+}
+
+// mustCheck returns the check of CheckExpiry or CheckNotBefore, panicking on an invalid date.
+func mustCheck(check Check, err error) Check {
+	if err != nil {
+		panic(err)
+	}
+	return check
+}
+
+func TestCheckDateRange(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	for _, date := range []time.Time{time.Unix(-1, 0), time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)} {
+		if _, err := CheckExpiry(date); err == nil {
+			t.Errorf("CheckExpiry(%s) accepted", date)
+		}
+		if _, err := CheckNotBefore(date); err == nil {
+			t.Errorf("CheckNotBefore(%s) accepted", date)
+		}
+	}
+	for _, date := range []time.Time{minDate, maxDate} {
+		if _, err := CheckExpiry(date); err != nil {
+			t.Errorf("CheckExpiry(%s): %v", date, err)
+		}
+	}
+
+	// An invalid date is rejected before the guest sees it: the builder remains usable.
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.NotBefore(time.Unix(-1, 0)); err == nil {
+		t.Error("NotBefore before 1970 accepted")
+	}
+	if err := block.NotBefore(minDate); err != nil {
+		t.Errorf("builder unusable after an invalid date: %v", err)
+	}
+}
+
+func TestNotBefore(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if want := "check if time($time), $time >= 2026-03-01T13:00:00Z"; mustCheck(CheckNotBefore(now.Add(time.Hour))).String() != want {
+		t.Errorf("check = %s, want %s", mustCheck(CheckNotBefore(now.Add(time.Hour))), want)
+	}
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.NotBefore(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.AddCode(mustCheck(CheckExpiry(now.Add(3*time.Hour))).String() + ";"); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+
+	for _, tc := range []struct {
+		at      time.Duration
+		allowed bool
+	}{
+		{0, false},
+		{2 * time.Hour, true},
+		{4 * time.Hour, false},
+	} {
+		code := "time(" + DateTerm(now.Add(tc.at)).String() + `); allow if user("alice");`
+		if got := authorize(t, env, attenuated, code); got != tc.allowed {
+			t.Errorf("now+%s: allowed = %t, want %t", tc.at, got, tc.allowed)
+		}
+	}
+}
+
+func TestAuthorizerAddTimeClockSkew(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		check   Check
+		skew    time.Duration
+		allowed bool
+	}{
+		{"expired", mustCheck(CheckExpiry(now.Add(-30 * time.Second))), 0, false},
+		{"expired within skew", mustCheck(CheckExpiry(now.Add(-30 * time.Second))), 60 * time.Second, true},
+		{"expired past skew", mustCheck(CheckExpiry(now.Add(-30 * time.Second))), 10 * time.Second, false},
+		{"not before within skew", mustCheck(CheckNotBefore(now.Add(30 * time.Second))), 60 * time.Second, true},
+		{"not before past skew", mustCheck(CheckNotBefore(now.Add(30 * time.Second))), 10 * time.Second, false},
+		// Every time fact must satisfy a check all: the skew tightens it.
+		{"check all", Check{"check all time($t), $t <= " + DateTerm(now.Add(30*time.Second)).String()}, 0, true},
+		{"check all within skew", Check{"check all time($t), $t <= " + DateTerm(now.Add(30*time.Second)).String()}, 60 * time.Second, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			block, err := NewBlockBuilder(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = block.Close() }()
+			if err := block.AddCode(tc.check.String() + ";"); err != nil {
+				t.Fatal(err)
+			}
+			attenuated, err := token.Append(block)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = attenuated.Close() }()
+
+			builder, err := NewAuthorizerBuilder(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = builder.Close() }()
+			if err := builder.AddTime(now, tc.skew); err != nil {
+				t.Fatal(err)
+			}
+			if err := builder.AddCode(`allow if user("alice");`); err != nil {
+				t.Fatal(err)
+			}
+			authorizer, err := builder.Build(attenuated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = authorizer.Close() }()
+			if _, err := authorizer.Authorize(); (err == nil) != tc.allowed {
+				t.Errorf("err = %v, want allowed %t", err, tc.allowed)
+			}
+		})
+	}
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddTime(now, -time.Second); err == nil {
+		t.Error("AddTime accepted a negative skew")
+	}
+}
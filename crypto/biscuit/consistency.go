@@ -0,0 +1,281 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrInconsistent is wrapped by the errors of CheckInternalConsistency.
+var ErrInconsistent = errors.New("inconsistent token")
+
+// Protobuf field numbers of the signature chain, see unverified.go for the others.
+const (
+	signedBlockVersionField         protowire.Number = 5
+	externalSignatureSignatureField protowire.Number = 1
+	publicKeyKeyField               protowire.Number = 2
+	proofNextSecretField            protowire.Number = 1
+)
+
+// wireBlock is the part of a SignedBlock the signature chain is made of.
+type wireBlock struct {
+	data              []byte
+	nextAlgorithm     keypair.SignatureAlgorithm
+	nextKey           []byte
+	signature         []byte
+	externalSignature []byte
+	// externalKey is the serialized PublicKey message of the external signature, if any.
+	externalKey []byte
+	version     uint64
+}
+
+// CheckInternalConsistency verifies that every block after the authority block is signed by the
+// key the previous block declares, and that the proof closes the chain. It tells a corrupted token
+// from one signed by an untrusted root, it does not make the token trusted: the authority block
+// signature needs the root key and is not checked.
+func (self *Biscuit) CheckInternalConsistency() error {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return err
+	}
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return fmt.Errorf("cannot decode token: %w", err)
+	}
+	return checkSignatureChain(data)
+}
+
+// TrustChainStrings returns the key signing each block in the `<algorithm>/<hex>` form, for audit
+// logs: root, which the token does not hold and must be the key it was verified with, for the
+// authority block, then the next key each block declares for the block after it.
+func (self *Biscuit) TrustChainStrings(root keypair.PublicKey) ([]string, error) {
+	rootString, err := root.ToString()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode token: %w", err)
+	}
+	signed, err := signedBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []string{rootString}
+	for i, block := range signed[:len(signed)-1] {
+		parsed, err := parseWireBlock(block)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		chain = append(chain, parsed.nextAlgorithm.String()+"/"+hex.EncodeToString(parsed.nextKey))
+	}
+	return chain, nil
+}
+
+func checkSignatureChain(data []byte) error {
+	signed, err := signedBlocks(data)
+	if err != nil {
+		return err
+	}
+	blocks := make([]wireBlock, len(signed))
+	for i, block := range signed {
+		if blocks[i], err = parseWireBlock(block); err != nil {
+			return fmt.Errorf("%w: block %d: %v", ErrInconsistent, i, err)
+		}
+	}
+
+	for i := 1; i < len(blocks); i++ {
+		previous, block := blocks[i-1], blocks[i]
+		var payload []byte
+		switch block.version {
+		case 0:
+			payload = signaturePayloadV0(block)
+		case 1:
+			payload = signaturePayloadV1(block, previous.signature)
+		default:
+			return fmt.Errorf("%w: block %d: unknown signature version %d", ErrInconsistent, i, block.version)
+		}
+		if !verifySignature(previous.nextAlgorithm, previous.nextKey, payload, block.signature) {
+			return fmt.Errorf("%w: block %d is not signed by the key of block %d", ErrInconsistent, i, i-1)
+		}
+	}
+
+	return checkProof(data, blocks[len(blocks)-1])
+}
+
+// checkProof verifies that the proof of a token is either the private key matching the next key
+// of the last block, or its final signature by that key.
+func checkProof(data []byte, last wireBlock) error {
+	proof, err := bytesField(data, biscuitProofField)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInconsistent, err)
+	}
+
+	var secret, final []byte
+	err = walkFields(proof, func(num protowire.Number, typ protowire.Type, value []byte) {
+		switch {
+		case num == proofNextSecretField && typ == protowire.BytesType:
+			secret = value
+		case num == proofFinalSignatureField && typ == protowire.BytesType:
+			final = value
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case final != nil:
+		payload := append(signaturePayloadV0(wireBlock{data: last.data, nextAlgorithm: last.nextAlgorithm, nextKey: last.nextKey}), last.signature...)
+		if !verifySignature(last.nextAlgorithm, last.nextKey, payload, final) {
+			return fmt.Errorf("%w: final signature is not made by the key of the last block", ErrInconsistent)
+		}
+	case secret != nil:
+		if !secretMatches(last.nextAlgorithm, secret, last.nextKey) {
+			return fmt.Errorf("%w: proof does not match the key of the last block", ErrInconsistent)
+		}
+	default:
+		return fmt.Errorf("%w: empty proof", ErrInconsistent)
+	}
+	return nil
+}
+
+func parseWireBlock(signed []byte) (wireBlock, error) {
+	var block wireBlock
+	var nextKey, external []byte
+	err := walkFields(signed, func(num protowire.Number, typ protowire.Type, value []byte) {
+		switch {
+		case num == signedBlockBlockField && typ == protowire.BytesType:
+			block.data = value
+		case num == signedBlockNextKeyField && typ == protowire.BytesType:
+			nextKey = value
+		case num == signedBlockSignatureField && typ == protowire.BytesType:
+			block.signature = value
+		case num == signedBlockExternalSignatureField && typ == protowire.BytesType:
+			external = value
+		case num == signedBlockVersionField && typ == protowire.VarintType:
+			block.version, _ = protowire.ConsumeVarint(value)
+		}
+	})
+	if err != nil {
+		return block, err
+	}
+	if block.data == nil || nextKey == nil || block.signature == nil {
+		return block, fmt.Errorf("missing block, next key or signature")
+	}
+
+	if block.nextAlgorithm, block.nextKey, err = parsePublicKeyMessage(nextKey); err != nil {
+		return block, err
+	}
+
+	if external != nil {
+		if block.externalSignature, err = bytesField(external, externalSignatureSignatureField); err != nil {
+			return block, err
+		}
+		if block.externalKey, err = bytesField(external, externalSignaturePublicKeyField); err != nil {
+			return block, err
+		}
+	}
+	return block, nil
+}
+
+// parsePublicKeyMessage returns the algorithm and the raw key of a serialized PublicKey message.
+func parsePublicKeyMessage(message []byte) (keypair.SignatureAlgorithm, []byte, error) {
+	var algorithm keypair.SignatureAlgorithm
+	var key []byte
+	err := walkFields(message, func(num protowire.Number, typ protowire.Type, value []byte) {
+		switch {
+		case num == publicKeyAlgorithmField && typ == protowire.VarintType:
+			value, _ := protowire.ConsumeVarint(value)
+			algorithm = keypair.SignatureAlgorithm(value)
+		case num == publicKeyKeyField && typ == protowire.BytesType:
+			key = value
+		}
+	})
+	return algorithm, key, err
+}
+
+// signaturePayloadV0 is what the first signature scheme of biscuit signs: the block, its external
+// signature if any, and the next key.
+func signaturePayloadV0(block wireBlock) []byte {
+	var payload bytes.Buffer
+	payload.Write(block.data)
+	payload.Write(block.externalSignature)
+	_ = binary.Write(&payload, binary.LittleEndian, int32(block.nextAlgorithm))
+	payload.Write(block.nextKey)
+	return payload.Bytes()
+}
+
+// signaturePayloadV1 is what the second signature scheme signs, which also chains the previous
+// signature.
+func signaturePayloadV1(block wireBlock, previousSignature []byte) []byte {
+	var payload bytes.Buffer
+	payload.WriteString("\x00BLOCK\x00\x00VERSION\x00")
+	_ = binary.Write(&payload, binary.LittleEndian, uint32(1))
+	payload.WriteString("\x00PAYLOAD\x00")
+	payload.Write(block.data)
+	payload.WriteString("\x00ALGORITHM\x00")
+	_ = binary.Write(&payload, binary.LittleEndian, int32(block.nextAlgorithm))
+	payload.WriteString("\x00NEXTKEY\x00")
+	payload.Write(block.nextKey)
+	payload.WriteString("\x00PREVSIG\x00")
+	payload.Write(previousSignature)
+	if block.externalSignature != nil {
+		payload.WriteString("\x00EXTERNALSIG\x00")
+		payload.Write(block.externalSignature)
+	}
+	return payload.Bytes()
+}
+
+func verifySignature(algorithm keypair.SignatureAlgorithm, key, message, signature []byte) bool {
+	switch algorithm {
+	case keypair.Ed25519:
+		return len(key) == ed25519.PublicKeySize && ed25519.Verify(key, message, signature)
+	case keypair.Secp256r1:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), key)
+		if x == nil {
+			return false
+		}
+		digest := sha256.Sum256(message)
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if len(signature) == 64 {
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			return ecdsa.Verify(public, digest[:], r, s)
+		}
+		return ecdsa.VerifyASN1(public, digest[:], signature)
+	default:
+		return false
+	}
+}
+
+// secretMatches reports whether secret is the private key of public.
+func secretMatches(algorithm keypair.SignatureAlgorithm, secret, public []byte) bool {
+	switch algorithm {
+	case keypair.Ed25519:
+		if len(secret) != ed25519.SeedSize {
+			return false
+		}
+		derived := ed25519.NewKeyFromSeed(secret).Public().(ed25519.PublicKey)
+		return bytes.Equal(derived, public)
+	case keypair.Secp256r1:
+		x, y := elliptic.P256().ScalarBaseMult(secret)
+		return bytes.Equal(elliptic.MarshalCompressed(elliptic.P256(), x, y), public)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,161 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCheckInternalConsistency(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(`check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	appended, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	request, err := appended.ThirdPartyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = request.Close() }()
+	thirdPartyBlock, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = thirdPartyBlock.Close() }()
+	if err := thirdPartyBlock.AddCode(`group("admin");`); err != nil {
+		t.Fatal(err)
+	}
+	external := newRoot(t, env)
+	defer func() { _ = external.Close() }()
+	signed, err := request.CreateBlock(external, thirdPartyBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = signed.Close() }()
+	externalKey, err := external.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", externalKey.Ptr()) }()
+	thirdParty, err := appended.AppendThirdPartyBlock(externalKey, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = thirdParty.Close() }()
+
+	sealed, err := thirdParty.Seal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sealed.Close() }()
+
+	for name, pristine := range map[string]*Biscuit{"authority only": token, "appended": appended, "third party": thirdParty, "sealed": sealed} {
+		if err := pristine.CheckInternalConsistency(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	encoded, err := appended.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := decodeToken(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := bytesField(blocks[1], signedBlockBlockField)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip the last byte of the datalog of the appended block.
+	corrupted := append([]byte(nil), data...)
+	corrupted[bytes.Index(data, payload)+len(payload)-1] ^= 0x01
+	if err := checkSignatureChain(corrupted); !errors.Is(err, ErrInconsistent) {
+		t.Errorf("err = %v for a flipped byte, want ErrInconsistent", err)
+	}
+}
+
+func TestTrustChainStrings(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+	rootString, err := public.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	chain, err := token.TrustChainStrings(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || chain[0] != rootString {
+		t.Fatalf("chain = %q, want [%s]", chain, rootString)
+	}
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(`check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	appended, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	chain, err = appended.TrustChainStrings(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 2 || chain[0] != rootString {
+		t.Fatalf("chain = %q, want the root key then the key of the appended block", chain)
+	}
+	next := keypair.InvokePublicKey(env)
+	if err := next.FromString(chain[1]); err != nil {
+		t.Fatalf("key of the appended block %q: %v", chain[1], err)
+	}
+	defer func() { _ = env.FreeObject("publickey", next.Ptr()) }()
+	if chain[1] == rootString {
+		t.Error("appended block reported as signed by the root key")
+	}
+}
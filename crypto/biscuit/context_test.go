@@ -0,0 +1,56 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestBlockContext(t *testing.T) {
+	// The bundled guest cannot set a context, build the wire format by hand.
+	var block []byte
+	block = protowire.AppendTag(block, blockContextField, protowire.BytesType)
+	block = protowire.AppendString(block, `{"iss":"svc"}`)
+	var signedBlock []byte
+	signedBlock = protowire.AppendTag(signedBlock, signedBlockBlockField, protowire.BytesType)
+	signedBlock = protowire.AppendBytes(signedBlock, block)
+	var token []byte
+	token = protowire.AppendTag(token, biscuitAuthorityField, protowire.BytesType)
+	token = protowire.AppendBytes(token, signedBlock)
+
+	context, found, err := blockContext(token, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || context != `{"iss":"svc"}` {
+		t.Errorf("context = %q (found %t), want the authority block context", context, found)
+	}
+	if _, _, err := blockContext(token, 1); err == nil {
+		t.Error("context of a missing block returned")
+	}
+}
+
+func TestRootContextWithoutContext(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	if _, found, err := token.RootContext(); err != nil || found {
+		t.Errorf("found = %t, err = %v, want no context", found, err)
+	}
+	var claims map[string]any
+	if err := token.Metadata(&claims); err == nil {
+		t.Error("metadata decoded from a token without context")
+	}
+}
@@ -0,0 +1,158 @@
+package biscuit
+
+import (
+	"strings"
+)
+
+// Decision is the outcome of Authorizer.Decide.
+type Decision struct {
+	// Allowed is true when an allow policy matched and every check passed.
+	Allowed bool
+	// Policy is the index of the policy that matched, in the order the policies were added, or -1
+	// when none did.
+	Policy int
+	// PolicyText is the datalog of the matched policy, e.g. `allow if user($u)`, or empty when it
+	// cannot be read back from the authorizer.
+	PolicyText string
+	// ShortCircuited is true when evaluation stopped at the matched policy: the policies after
+	// Policy were not tried.
+	ShortCircuited bool
+	// NoMatch is true when evaluation tried every policy and none matched. When neither flag is
+	// set, evaluation failed before reaching a decision, e.g. on a limit.
+	NoMatch bool
+}
+
+// Decide runs Authorize and reports which policy matched. A token that is not authorized yields
+// the error of Authorize along with the decision, whose Policy is the matched deny policy, or the
+// allow policy that matched while checks failed.
+func (self *Authorizer) Decide() (Decision, error) {
+	policy, err := self.Authorize()
+	return self.decision(policy, err), err
+}
+
+// decision describes the outcome of Authorize, policy and authorizeErr being what it returned.
+func (self *Authorizer) decision(policy int, authorizeErr error) Decision {
+	decision := Decision{Policy: -1}
+	if authorizeErr == nil {
+		decision.Allowed = true
+		decision.Policy = policy
+	} else if matched, ok := matchedPolicy(authorizeErr); ok {
+		decision.Policy = matched
+	} else {
+		_, decision.NoMatch = failedLogic(authorizeErr)["NoMatchingPolicy"]
+		return decision
+	}
+	decision.ShortCircuited = true
+
+	// The text is read back from the world the guest prints, which is not always possible (see
+	// Authorizer.world): it is left empty then rather than failing a decision already made.
+	if policies, err := self.Policies(); err == nil && decision.Policy < len(policies) {
+		decision.PolicyText = policies[decision.Policy]
+	}
+	return decision
+}
+
+// Policies returns the policies of the authorizer, in evaluation order and without their final
+// `;`.
+func (self *Authorizer) Policies() ([]string, error) {
+	sections, err := self.world()
+	if err != nil {
+		return nil, err
+	}
+	return sections["Policies"], nil
+}
+
+// matchedPolicy returns the policy reported by an Unauthorized error of Authorize.
+func matchedPolicy(err error) (int, bool) {
+	logic := failedLogic(err)
+	if logic == nil {
+		return 0, false
+	}
+	unauthorized, ok := logic["Unauthorized"].(map[string]any)
+	if !ok {
+		return 0, false
+	}
+	policy, ok := unauthorized["policy"].(map[string]any)
+	if !ok {
+		return 0, false
+	}
+	for _, kind := range []string{"Allow", "Deny"} {
+		if index, ok := policy[kind]; ok {
+			return toInt(index), true
+		}
+	}
+	return 0, false
+}
+
+// ReasonNotSatisfied is the Reason of a PolicyExplanation whose conditions did not hold.
+const ReasonNotSatisfied = "condition not satisfied"
+
+// PolicyExplanation is the evaluation of a policy on its own, see Authorizer.ExplainPolicies.
+type PolicyExplanation struct {
+	// Policy is the index of the policy, in the order the policies were added.
+	Policy int
+	// Text is the datalog of the policy, e.g. `allow if user($u)`.
+	Text string
+	// Held is true when the conditions of the policy held: it would match if it was tried.
+	Held bool
+	// Reason tells why the conditions did not hold, ReasonNotSatisfied or the error evaluating
+	// them, e.g. on a limit. It is empty when they held.
+	Reason string
+}
+
+// ExplainPolicies evaluates the conditions of every policy of the authorizer, in evaluation order,
+// to tell why none matched. Each alternative of a policy is queried on its own against the
+// authorizer, without the checks, with the trusting scope of the policy: facts of blocks the policy
+// does not trust do not make it hold.
+func (self *Authorizer) ExplainPolicies() ([]PolicyExplanation, error) {
+	policies, err := self.Policies()
+	if err != nil {
+		return nil, err
+	}
+
+	explanations := make([]PolicyExplanation, len(policies))
+	for i, policy := range policies {
+		explanations[i] = PolicyExplanation{Policy: i, Text: policy, Reason: self.explainPolicy(policy)}
+		explanations[i].Held = explanations[i].Reason == ""
+	}
+	return explanations, nil
+}
+
+// explainPolicy returns why the conditions of policy did not hold, or an empty string when they
+// did.
+func (self *Authorizer) explainPolicy(policy string) string {
+	_, conditions, _ := strings.Cut(policy, " if ")
+	var reason string
+	for _, alternative := range policyAlternatives(conditions) {
+		held, err := self.query("biscuit.explain_policy", "explain(true) <- "+alternative, nil)
+		if err == nil && held > 0 {
+			return ""
+		}
+		if err != nil && reason == "" {
+			reason = err.Error()
+		}
+	}
+	if reason == "" {
+		reason = ReasonNotSatisfied
+	}
+	return reason
+}
+
+// policyAlternatives splits the conditions of a policy on its `or` keywords, outside strings.
+func policyAlternatives(conditions string) []string {
+	var alternatives []string
+	start, inString := 0, false
+	for i := 0; i < len(conditions); i++ {
+		switch {
+		case inString && conditions[i] == '\\':
+			i++
+		case conditions[i] == '"':
+			inString = !inString
+		case !inString && strings.HasPrefix(conditions[i:], " or "):
+			alternatives = append(alternatives, conditions[start:i])
+			start = i + len(" or ")
+			i = start - 1
+		}
+	}
+	return append(alternatives, conditions[start:])
+}
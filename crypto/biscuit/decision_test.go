@@ -0,0 +1,229 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"slices"
+	"testing"
+)
+
+func TestAuthorizerDecide(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	policies := `allow if user("bob"); deny if user("mallory"); allow if user($u), operation("read");`
+	for _, tc := range []struct {
+		name      string
+		operation string
+		want      Decision
+	}{
+		{"allowed", "read", Decision{Allowed: true, Policy: 2, PolicyText: `allow if user($u), operation("read")`, ShortCircuited: true}},
+		{"no match", "write", Decision{Policy: -1, NoMatch: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			authorizerBuilder, err := NewAuthorizerBuilder(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = authorizerBuilder.Close() }()
+			if err := authorizerBuilder.AddCode(`operation("` + tc.operation + `"); ` + policies); err != nil {
+				t.Fatal(err)
+			}
+			authorizer, err := authorizerBuilder.Build(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = authorizer.Close() }()
+
+			decision, err := authorizer.Decide()
+			if (err == nil) != tc.want.Allowed {
+				t.Errorf("err = %v, want allowed %t", err, tc.want.Allowed)
+			}
+			if decision != tc.want {
+				t.Errorf("decision = %+v, want %+v", decision, tc.want)
+			}
+		})
+	}
+
+	// A string ending a line with `");` cuts the printed policy short: its text cannot be read
+	// back, the decision stands.
+	unreadable, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = unreadable.Close() }()
+	if err := unreadable.AddCode(`resource("x\");\n"); allow if resource("x\");\n");`); err != nil {
+		t.Fatal(err)
+	}
+	unreadableAuthorizer, err := unreadable.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = unreadableAuthorizer.Close() }()
+	if _, err := unreadableAuthorizer.Policies(); err == nil {
+		t.Fatal("policies read back, the case needs another one")
+	}
+	if decision, err := unreadableAuthorizer.Decide(); err != nil || decision != (Decision{Allowed: true, Policy: 0, ShortCircuited: true}) {
+		t.Errorf("decision = %+v, %v, want allowed without a policy text", decision, err)
+	}
+
+	authorizerBuilder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizerBuilder.Close() }()
+	if err := authorizerBuilder.AddCode(`deny if user("alice"); allow if true;`); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := authorizerBuilder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+	decision, err := authorizer.Decide()
+	if err == nil || decision != (Decision{Policy: 0, PolicyText: `deny if user("alice")`, ShortCircuited: true}) {
+		t.Errorf("decision = %+v, err = %v, want the deny policy", decision, err)
+	}
+}
+
+func TestAuthorizerExplainPolicies(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice"); check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	explain := func(code string) []PolicyExplanation {
+		t.Helper()
+		authorizerBuilder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizerBuilder.Close() }()
+		if err := authorizerBuilder.AddCode(`operation("write"); right($u) <- user($u); ` + code); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := authorizerBuilder.Build(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+		if _, err := authorizer.Authorize(); err == nil {
+			t.Fatal("Authorize succeeded despite the failing check")
+		}
+		explanations, err := authorizer.ExplainPolicies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return explanations
+	}
+
+	explanations := explain(`allow if user("bob"); allow if right($u), operation("read");`)
+	want := []PolicyExplanation{
+		{Policy: 0, Text: `allow if user("bob")`, Reason: ReasonNotSatisfied},
+		{Policy: 1, Text: `allow if right($u), operation("read")`, Reason: ReasonNotSatisfied},
+	}
+	if !slices.Equal(explanations, want) {
+		t.Errorf("explanations = %+v, want %+v", explanations, want)
+	}
+
+	// The failing check of the token does not keep the conditions of a policy from holding, and
+	// rules are evaluated.
+	explanations = explain(`deny if right("alice"); allow if true;`)
+	want = []PolicyExplanation{
+		{Policy: 0, Text: `deny if right("alice")`, Held: true},
+		{Policy: 1, Text: `allow if true`, Held: true},
+	}
+	if !slices.Equal(explanations, want) {
+		t.Errorf("explanations = %+v, want %+v", explanations, want)
+	}
+}
+
+func TestAuthorizerExplainPoliciesScope(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(`operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`note("a or b");
+allow if operation("read");
+allow if user("bob") or note("a or b");
+allow if user("alice") trusting previous;
+allow if operation("read") or user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := builder.Build(attenuated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	// Policies trust the authority block, not the attenuation one: its facts make none hold.
+	explanations, err := authorizer.ExplainPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PolicyExplanation{
+		{Policy: 0, Text: `allow if operation("read")`, Reason: ReasonNotSatisfied},
+		{Policy: 1, Text: `allow if user("bob") or note("a or b")`, Held: true},
+		{Policy: 2, Text: `allow if user("alice") trusting previous`, Reason: ReasonNotSatisfied},
+		{Policy: 3, Text: `allow if operation("read") or user("alice")`, Held: true},
+	}
+	if !slices.Equal(explanations, want) {
+		t.Errorf("explanations = %+v, want %+v", explanations, want)
+	}
+}
+
+func TestPolicyAlternatives(t *testing.T) {
+	for conditions, want := range map[string][]string{
+		`true`:                          {`true`},
+		`user("a") or user("b")`:        {`user("a")`, `user("b")`},
+		`note("a or b"), $x || $y`:      {`note("a or b"), $x || $y`},
+		`note("a\" or b") or note("c")`: {`note("a\" or b")`, `note("c")`},
+	} {
+		if got := policyAlternatives(conditions); !slices.Equal(got, want) {
+			t.Errorf("%s: alternatives = %q, want %q", conditions, got, want)
+		}
+	}
+}
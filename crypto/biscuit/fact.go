@@ -0,0 +1,172 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"cmp"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// minDate and maxDate bound the dates datalog can write: dates are unsigned seconds since the
+// epoch, written in RFC 3339, whose years have four digits.
+var (
+	minDate = time.Unix(0, 0).UTC()
+	maxDate = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// validateDate rejects the dates datalog cannot write, outside [minDate, maxDate].
+func validateDate(t time.Time) error {
+	if t.Before(minDate) || t.After(maxDate) {
+		return fmt.Errorf("date %s is outside [%s, %s]", t, minDate, maxDate)
+	}
+	return nil
+}
+
+// Fact is a ground datalog fact such as `resource("/files/123")`, built from typed terms. With
+// variable terms, see VarTerm, it is a predicate such as `user($u)` for the head or body of a Rule,
+// which AddFact rejects.
+type Fact struct {
+	name  string
+	terms []Term
+}
+
+// NewFact builds a fact from a predicate name and its terms. The name must be a valid
+// datalog identifier, and datalog has neither facts without terms, empty byte strings nor dates
+// outside [1970, 9999]; the terms are quoted when the fact is rendered.
+func NewFact(name string, terms ...Term) (Fact, error) {
+	fact := Fact{name: name, terms: append([]Term(nil), terms...)}
+	if err := fact.validate(); err != nil {
+		return Fact{}, err
+	}
+	return fact, nil
+}
+
+// validate checks the fact is one NewFact builds, which renders into valid datalog.
+func (self Fact) validate() error {
+	if !isIdentifier(self.name) {
+		return fmt.Errorf("invalid fact name %q", self.name)
+	}
+	if len(self.terms) == 0 {
+		return fmt.Errorf("fact %s has no terms", self.name)
+	}
+	for i, term := range self.terms {
+		switch {
+		case term.kind == TermBytes && len(term.bytes) == 0:
+			return fmt.Errorf("fact %s: term %d is an empty byte string", self.name, i)
+		case term.kind == TermDate && validateDate(term.date) != nil:
+			return fmt.Errorf("fact %s: %w", self.name, validateDate(term.date))
+		case term.kind == TermVariable && !isVariableName(term.str):
+			return fmt.Errorf("fact %s: invalid variable name %q", self.name, term.str)
+		}
+	}
+	return nil
+}
+
+// Name returns the predicate name of the fact.
+func (self Fact) Name() string {
+	return self.name
+}
+
+// Arity returns the number of terms of the fact.
+func (self Fact) Arity() int {
+	return len(self.terms)
+}
+
+// Term returns the term at index i, which must be lower than Arity.
+func (self Fact) Term(i int) Term {
+	return self.terms[i]
+}
+
+// String renders the fact as datalog source, without the trailing semicolon.
+func (self Fact) String() string {
+	var code strings.Builder
+	self.render(&code, 0, nil)
+	return code.String()
+}
+
+// render writes the fact as datalog source to code. Byte terms of at least threshold bytes, when
+// it is positive, are written as {bytesN} parameters whose values are added to parameters.
+func (self Fact) render(code *strings.Builder, threshold int, parameters map[string]any) {
+	code.WriteString(self.name)
+	code.WriteByte('(')
+	for i, term := range self.terms {
+		if i > 0 {
+			code.WriteString(", ")
+		}
+		if term.kind == TermBytes && threshold > 0 && len(term.bytes) >= threshold {
+			name := fmt.Sprintf("bytes%d", len(parameters))
+			parameters[name] = map[string]any{"bytes": wasm.HexBytes(term.bytes)}
+			code.WriteString("{" + name + "}")
+			continue
+		}
+		code.WriteString(term.String())
+	}
+	code.WriteByte(')')
+}
+
+// checkGround rejects a fact holding variables, which datalog only accepts in rules.
+func (self Fact) checkGround() error {
+	for _, term := range self.terms {
+		if term.kind == TermVariable {
+			return fmt.Errorf("fact %s holds the variable $%s, only rules can", self.name, term.str)
+		}
+	}
+	return nil
+}
+
+// FactError locates an invalid fact of a batch given to AddFacts.
+type FactError struct {
+	// Index is the position of the fact in the batch.
+	Index int
+	Fact  string
+	Err   error
+}
+
+func (self *FactError) Error() string {
+	return fmt.Sprintf("fact %d %s: %v", self.Index, self.Fact, self.Err)
+}
+
+func (self *FactError) Unwrap() error {
+	return self.Err
+}
+
+// renderFacts renders facts as a single datalog document, one statement per line, with the byte
+// terms of at least threshold bytes as parameters, see Fact.render. It returns a *FactError for
+// each fact NewFact would not have built or holding variables, joined, rather than letting the
+// guest reject the document: a builder the guest rejected code for cannot be used anymore.
+func renderFacts(facts []Fact, threshold int) (string, map[string]any, error) {
+	var errs []error
+	var code strings.Builder
+	parameters := map[string]any{}
+	for i, fact := range facts {
+		if err := cmp.Or(fact.validate(), fact.checkGround()); err != nil {
+			errs = append(errs, &FactError{Index: i, Fact: fact.String(), Err: err})
+			continue
+		}
+		fact.render(&code, threshold, parameters)
+		code.WriteString(";\n")
+	}
+	if len(errs) > 0 {
+		return "", nil, errors.Join(errs...)
+	}
+	return code.String(), parameters, nil
+}
+
+// isIdentifier reports whether name is usable as a datalog predicate name: a letter followed
+// by letters, digits, underscores or colons.
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '_' || r == ':'):
+		default:
+			return false
+		}
+	}
+	return true
+}
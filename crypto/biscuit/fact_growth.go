@@ -0,0 +1,283 @@
+package biscuit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrFactAmplification is returned by Authorizer.Authorize when the rules generated more facts
+// than WithMaxFactGrowthRatio allows.
+var ErrFactAmplification = errors.New("fact amplification")
+
+// WithMaxFactGrowthRatio makes the authorizers of an AuthorizerBuilder reject, with
+// ErrFactAmplification, the evaluations ending with more than ratio times the facts they started
+// from, those of every block of the token and of the authorizer. It catches rules crafted to blow
+// up the world within the run limits, e.g. a cross product of two fact sets in an appended block.
+// The check runs once the guest allowed the token, so the evaluation itself is bounded by the run
+// limits of the guest only. The facts the authorizer trusts are counted with a query per
+// predicate; the facts of attenuation blocks, which no query sees, are counted in the world the
+// guest prints. That world cannot be read when a string holds a double quote, so the authorizers
+// of attenuated tokens holding one fail with ErrWorldSyntax. A ratio of 0 or less disables the
+// guard, the default.
+func WithMaxFactGrowthRatio(ratio float64) BuilderOption {
+	return func(options *builderOptions) {
+		options.maxFactGrowth = ratio
+	}
+}
+
+// predicate is a predicate name and its number of terms, what facts are queried by.
+type predicate struct {
+	name  string
+	arity int
+}
+
+// factCount is the number of facts a world starts from, along with the predicates of the facts
+// and rule heads the authorizer trusts, which hold every fact of the world queries see once
+// evaluated, see checkFactGrowth.
+type factCount struct {
+	facts      int
+	predicates map[predicate]struct{}
+	// attenuated is set when the token has blocks past the authority block, whose facts are
+	// counted in the printed world.
+	attenuated bool
+}
+
+// add records a fact, or the head of a rule when fact is false.
+func (self *factCount) add(name string, arity int, fact bool) {
+	if fact {
+		self.facts++
+	}
+	if self.predicates == nil {
+		self.predicates = map[predicate]struct{}{}
+	}
+	self.predicates[predicate{name, arity}] = struct{}{}
+}
+
+// merge adds the facts and predicates of other.
+func (self *factCount) merge(other factCount) {
+	self.facts += other.facts
+	for predicate := range other.predicates {
+		self.add(predicate.name, predicate.arity, false)
+	}
+}
+
+// addCode records the facts and rule heads of datalog source code.
+func (self *factCount) addCode(code string) {
+	for _, statement := range codeStatements(code) {
+		keyword, _, _ := strings.Cut(statement, " ")
+		if keyword == "check" || keyword == "allow" || keyword == "deny" || keyword == "reject" {
+			continue
+		}
+		head, _, isRule := cutOutsideStrings(statement, "<-")
+		if name, arity, ok := statementPredicate(head); ok {
+			self.add(name, arity, !isRule)
+		}
+	}
+}
+
+// addToken records the facts of every block of a serialized token, and the predicates of the
+// facts and rule heads of its authority block.
+func (self *factCount) addToken(data []byte) error {
+	symbol, facts, rules, err := authorityBlock(data)
+	if err != nil {
+		return err
+	}
+	for i, encoded := range append(facts, rules...) {
+		name, terms, err := decodePredicate(encoded)
+		if err != nil {
+			return err
+		}
+		predicateName, ok := symbol(name)
+		if !ok {
+			return fmt.Errorf("unknown symbol %d", name)
+		}
+		self.add(predicateName, len(terms), i < len(facts))
+	}
+
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		return err
+	}
+	for _, signedBlock := range blocks[1:] {
+		block, err := bytesField(signedBlock, signedBlockBlockField)
+		if err != nil {
+			return err
+		}
+		err = walkFields(block, func(num protowire.Number, typ protowire.Type, _ []byte) {
+			if num == blockFactsField && typ == protowire.BytesType {
+				self.facts++
+			}
+		})
+		if err != nil {
+			return err
+		}
+		self.attenuated = true
+	}
+	return nil
+}
+
+// checkFactGrowth returns ErrFactAmplification when the world of an evaluated authorizer grew
+// past its ratio from the facts it started from. Facts that cannot be counted fail the
+// authorization: the guard does not turn itself off.
+func (self *Authorizer) checkFactGrowth() error {
+	if self.factCount == nil {
+		return nil
+	}
+
+	after := 0
+	for predicate := range self.factCount.predicates {
+		if predicate.arity == 0 {
+			continue
+		}
+		variables := make([]string, predicate.arity)
+		for i := range variables {
+			variables[i] = fmt.Sprintf("$%d", i)
+		}
+		atom := predicate.name + "(" + strings.Join(variables, ", ") + ")"
+		facts, err := self.query("authorizer.fact_growth", atom+" <- "+atom, nil)
+		if err != nil {
+			return err
+		}
+		after += facts
+	}
+
+	if self.factCount.attenuated {
+		if self.quotedWorld() {
+			return fmt.Errorf("%w: a string holds a double quote", ErrWorldSyntax)
+		}
+		world, err := self.ToString()
+		if err != nil {
+			return err
+		}
+		facts, err := attenuationFacts(world)
+		if err != nil {
+			return err
+		}
+		after += facts
+	}
+
+	before := self.factCount.facts
+	if float64(after) > self.maxFactGrowth*float64(max(before, 1)) {
+		return fmt.Errorf("%w: %d facts generated from %d, over a ratio of %g", ErrFactAmplification, after, before, self.maxFactGrowth)
+	}
+	return nil
+}
+
+// attenuationFacts counts the facts of a world printed by the guest whose origin holds an
+// attenuation block, those no authorizer query sees. Facts are grouped under an origin comment
+// listing block indexes, 0 being the authority block, and "authorizer"; a world holding a string
+// with a double quote must not be counted, see parseWorld.
+func attenuationFacts(world string) (int, error) {
+	facts, section, attenuation := 0, "", false
+	for i := 0; i < len(world); {
+		switch {
+		case world[i] == '\n' || world[i] == ' ' || world[i] == '\t':
+			i++
+		case strings.HasPrefix(world[i:], "//"):
+			end := strings.IndexByte(world[i:]+"\n", '\n')
+			comment := world[i : i+end]
+			if name, ok := strings.CutPrefix(comment, "// "); ok && slices.Contains(worldSections, strings.TrimSuffix(name, ":")) {
+				section, attenuation = strings.TrimSuffix(name, ":"), false
+			}
+			if origin, ok := strings.CutPrefix(comment, "// origin: "); ok {
+				attenuation = slices.ContainsFunc(strings.Split(origin, ", "), func(block string) bool {
+					return block != "0" && block != "authorizer"
+				})
+			}
+			i += end
+		default:
+			_, end, ok := scanStatement(world, i)
+			if !ok {
+				return 0, fmt.Errorf("%w: offset %d", ErrWorldSyntax, i)
+			}
+			if section == "Facts" && attenuation {
+				facts++
+			}
+			i = end + 1
+		}
+	}
+	return facts, nil
+}
+
+// codeStatements splits datalog source code into its statements, without their final `;` and
+// with the comments dropped.
+func codeStatements(code string) []string {
+	var statements []string
+	var statement strings.Builder
+	for i := 0; i < len(code); i++ {
+		switch {
+		case code[i] == '"':
+			end := stringEnd(code, i)
+			if end < 0 {
+				end = len(code)
+			}
+			statement.WriteString(code[i:end])
+			i = end - 1
+		case strings.HasPrefix(code[i:], "//"):
+			i += strings.IndexByte(code[i:]+"\n", '\n')
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				i = len(code)
+				continue
+			}
+			i += end + 3
+		case code[i] == ';':
+			statements = append(statements, strings.Join(strings.Fields(statement.String()), " "))
+			statement.Reset()
+		default:
+			statement.WriteByte(code[i])
+		}
+	}
+	return statements
+}
+
+// statementPredicate returns the name and the number of terms of a fact, or of a rule head,
+// written in datalog source code.
+func statementPredicate(code string) (string, int, bool) {
+	name, terms, ok := strings.Cut(strings.TrimSpace(code), "(")
+	if !ok || name == "" {
+		return "", 0, false
+	}
+	if strings.HasPrefix(strings.TrimSpace(terms), ")") {
+		return strings.TrimSpace(name), 0, true
+	}
+
+	arity, depth := 1, 0
+	for i := 0; i < len(terms); i++ {
+		switch terms[i] {
+		case '"':
+			if i = stringEnd(terms, i) - 1; i < 0 {
+				return "", 0, false
+			}
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				arity++
+			}
+		}
+	}
+	return strings.TrimSpace(name), arity, true
+}
+
+// cutOutsideStrings is strings.Cut for a separator written outside the string literals of
+// datalog source code.
+func cutOutsideStrings(code, sep string) (string, string, bool) {
+	for i := 0; i < len(code); i++ {
+		if code[i] == '"' {
+			if i = stringEnd(code, i) - 1; i < 0 {
+				break
+			}
+		} else if strings.HasPrefix(code[i:], sep) {
+			return code[:i], code[i+len(sep):], true
+		}
+	}
+	return code, "", false
+}
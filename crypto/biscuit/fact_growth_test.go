@@ -0,0 +1,164 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaxFactGrowthRatio(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	defer func() { _ = root.Close() }()
+
+	newToken := func(code string) *Biscuit {
+		t.Helper()
+		builder, err := NewBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = builder.Close() }()
+		if err := builder.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+		token, err := builder.Build(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = token.Close() })
+		return token
+	}
+	authorizeWithRatio := func(token *Biscuit, ratio float64, code ...string) error {
+		t.Helper()
+		builder, err := NewAuthorizerBuilder(env, WithMaxFactGrowthRatio(ratio))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = builder.Close() }()
+		if err := builder.AddCode(strings.Join(append(code, `allow if true;`), "\n")); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := builder.Build(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+		_, err = authorizer.Authorize()
+		return err
+	}
+
+	// 20 left and 20 right facts joined into 400 pairs, ten times the facts of the token.
+	var code strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&code, "left(%d);\nright(%d);\n", i, i)
+	}
+	code.WriteString("pair($x, $y) <- left($x), right($y);\n")
+	crossProduct := newToken(code.String())
+	benign := newToken(`user("alice"); admin($user) <- user($user);`)
+
+	err := authorizeWithRatio(crossProduct, 5)
+	if !errors.Is(err, ErrFactAmplification) {
+		t.Fatalf("cross product: err = %v, want ErrFactAmplification", err)
+	}
+	if status := HTTPStatus(err); status != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", status, http.StatusBadRequest)
+	}
+	if err := authorizeWithRatio(benign, 5); err != nil {
+		t.Fatalf("benign token rejected: %v", err)
+	}
+	// The guard is off by default.
+	if err := authorizeWithRatio(crossProduct, 0); err != nil {
+		t.Fatalf("cross product rejected without a ratio: %v", err)
+	}
+
+	// Rules of the authorizer count like those of the token.
+	err = authorizeWithRatio(benign, 5, code.String())
+	if !errors.Is(err, ErrFactAmplification) {
+		t.Fatalf("authorizer cross product: err = %v, want ErrFactAmplification", err)
+	}
+	// The world of a token without attenuation block is not read back: a string holding a quote
+	// does not get in the way.
+	quoted := newToken(`user("say \"hi\""); admin($user) <- user($user);`)
+	if err := authorizeWithRatio(quoted, 5); err != nil {
+		t.Fatalf("quoted token rejected: %v", err)
+	}
+
+	// A cross product in an appended block counts like one in the authority block.
+	appendBlock := func(token *Biscuit, code string) *Biscuit {
+		t.Helper()
+		block, err := NewBlockBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = block.Close() }()
+		if err := block.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+		attenuated, err := token.Append(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = attenuated.Close() })
+		return attenuated
+	}
+	err = authorizeWithRatio(appendBlock(benign, code.String()), 5)
+	if !errors.Is(err, ErrFactAmplification) {
+		t.Fatalf("appended cross product: err = %v, want ErrFactAmplification", err)
+	}
+	if err := authorizeWithRatio(appendBlock(benign, `resource("file1"); owner($r) <- resource($r);`), 5); err != nil {
+		t.Fatalf("benign attenuated token rejected: %v", err)
+	}
+	// The facts of an attenuation block holding a quote cannot be counted.
+	err = authorizeWithRatio(appendBlock(quoted, `resource("file1");`), 5)
+	if !errors.Is(err, ErrWorldSyntax) {
+		t.Fatalf("quoted attenuated token: err = %v, want ErrWorldSyntax", err)
+	}
+	// The decision of the guest stands.
+	if err := authorizeWithRatio(crossProduct, 5, `deny if left(0);`); err == nil || errors.Is(err, ErrFactAmplification) {
+		t.Fatalf("denied cross product: err = %v, want the deny policy", err)
+	}
+}
+
+func TestAttenuationFacts(t *testing.T) {
+	world := `// Facts:
+// origin: 0
+user("alice");
+// origin: 0, 1
+r("alice", "multi
+line;");
+// origin: 0, authorizer
+r2("x", "alice");
+// origin: 1
+b(1);
+b(2);
+// origin: authorizer
+note("x");
+
+// Rules:
+// origin: 1
+r($x, $y) <- user($x), b($y);
+`
+	facts, err := attenuationFacts(world)
+	if err != nil || facts != 3 {
+		t.Errorf("attenuationFacts = %d, %v, want 3", facts, err)
+	}
+	if _, err := attenuationFacts("// Facts:\n// origin: 1\nb(\"1);\n"); !errors.Is(err, ErrWorldSyntax) {
+		t.Errorf("unterminated string: err = %v, want ErrWorldSyntax", err)
+	}
+}
+
+func TestFactCountAddCode(t *testing.T) {
+	var count factCount
+	count.addCode(`user("a;b"); // not(1);
+		pair($x, [$y, $z]) <- left($x), right($y, $z); /* f(1); */
+		check if user("<-"); allow if true; deny if pair(1, [2]);
+		note("x", {"k": "v"}, (1, 2)); flag(true)`)
+	want := map[predicate]struct{}{{"user", 1}: {}, {"pair", 2}: {}, {"note", 3}: {}}
+	if count.facts != 2 || !maps.Equal(count.predicates, want) {
+		t.Errorf("count = %d facts, predicates %v, want 2 facts, %v", count.facts, count.predicates, want)
+	}
+}
@@ -0,0 +1,171 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// requestFacts returns n facts of the kinds authorizers derive from requests.
+func requestFacts(t *testing.T, n int) []Fact {
+	t.Helper()
+
+	facts := make([]Fact, n)
+	for i := range facts {
+		var err error
+		switch i % 3 {
+		case 0:
+			facts[i], err = NewFact("resource", StringTerm(fmt.Sprintf("/files/%d \"q\"", i)))
+		case 1:
+			facts[i], err = NewFact("header", StringTerm("x-request"), IntegerTerm(int64(i)), BoolTerm(i%2 == 0))
+		default:
+			facts[i], err = NewFact("time", DateTerm(time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC)))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return facts
+}
+
+// authorizerWorld builds an authorizer for token whose builder got its facts through add.
+func authorizerWorld(t *testing.T, token *Biscuit, add func(*AuthorizerBuilder) error) string {
+	t.Helper()
+
+	builder, err := NewAuthorizerBuilder(token.env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := add(builder); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := builder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+	world, err := authorizer.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return world
+}
+
+func TestAuthorizerBuilderAddFacts(t *testing.T) {
+	env := wasmtest.Env(t)
+	facts := requestFacts(t, 200)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(newRoot(t, env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	batched := authorizerWorld(t, token, func(builder *AuthorizerBuilder) error {
+		return builder.AddFacts(facts)
+	})
+	oneByOne := authorizerWorld(t, token, func(builder *AuthorizerBuilder) error {
+		for _, fact := range facts {
+			if err := builder.AddFact(fact); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if batched != oneByOne {
+		t.Errorf("world with AddFacts:\n%s\nwant the world with AddFact:\n%s", batched, oneByOne)
+	}
+}
+
+func TestBuilderAddFacts(t *testing.T) {
+	env := wasmtest.Env(t)
+	facts := requestFacts(t, 30)
+
+	authorityFacts := func(add func(*Builder) error) []string {
+		builder, err := NewBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = builder.Close() }()
+		if err := add(builder); err != nil {
+			t.Fatal(err)
+		}
+		token, err := builder.Build(newRoot(t, env))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = token.Close() }()
+		facts, err := token.AuthorityFacts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rendered := make([]string, len(facts))
+		for i, fact := range facts {
+			rendered[i] = fact.String()
+		}
+		return rendered
+	}
+
+	batched := authorityFacts(func(builder *Builder) error { return builder.AddFacts(facts) })
+	oneByOne := authorityFacts(func(builder *Builder) error {
+		for _, fact := range facts {
+			if err := builder.AddFact(fact); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if !slices.Equal(batched, oneByOne) {
+		t.Errorf("authority facts with AddFacts = %q, want %q", batched, oneByOne)
+	}
+}
+
+func TestAddFactsReportsInvalidFacts(t *testing.T) {
+	env := wasmtest.Env(t)
+	facts := requestFacts(t, 5)
+	facts[1] = Fact{}
+	facts[3] = Fact{name: "resource"}
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+
+	err = builder.AddFacts(facts)
+	if err == nil {
+		t.Fatal("batch holding invalid facts added")
+	}
+	var indexes []int
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var factErr *FactError
+		if !errors.As(err, &factErr) {
+			t.Fatalf("error %v is not a *FactError", err)
+		}
+		indexes = append(indexes, factErr.Index)
+	}
+	if !slices.Equal(indexes, []int{1, 3}) {
+		t.Errorf("invalid facts at %v, want [1 3]: %v", indexes, err)
+	}
+
+	// The batch is all or nothing: the valid facts were not added either.
+	code, err := builder.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "" {
+		t.Errorf("builder holds %q after a rejected batch", code)
+	}
+}
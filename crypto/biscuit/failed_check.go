@@ -0,0 +1,89 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+)
+
+// FailedCheck is a check that did not pass during authorization.
+type FailedCheck struct {
+	// Authorizer is true for a check of the authorizer, Block is meaningless then.
+	Authorizer bool
+	Block      int
+	Check      int
+	Rule       string
+}
+
+// FailedChecks returns the checks reported by an error of Authorizer.Authorize, or nil when err
+// is not a failed authorization.
+func FailedChecks(err error) []FailedCheck {
+	logic := failedLogic(err)
+	if logic == nil {
+		return nil
+	}
+
+	var checks []any
+	for _, outcome := range []string{"Unauthorized", "NoMatchingPolicy"} {
+		if details, ok := logic[outcome].(map[string]any); ok {
+			checks, _ = details["checks"].([]any)
+		}
+	}
+
+	var failed []FailedCheck
+	for _, check := range checks {
+		entry, ok := check.(map[string]any)
+		if !ok {
+			continue
+		}
+		if details, ok := entry["Block"].(map[string]any); ok {
+			failed = append(failed, FailedCheck{
+				Block: toInt(details["block_id"]),
+				Check: toInt(details["check_id"]),
+				Rule:  toString(details["rule"]),
+			})
+		}
+		if details, ok := entry["Authorizer"].(map[string]any); ok {
+			failed = append(failed, FailedCheck{
+				Authorizer: true,
+				Check:      toInt(details["check_id"]),
+				Rule:       toString(details["rule"]),
+			})
+		}
+	}
+	return failed
+}
+
+// failedLogic returns the FailedLogic variant of a guest error.
+func failedLogic(err error) map[string]any {
+	var guestErr *wasm.GuestError
+	if !errors.As(err, &guestErr) {
+		return nil
+	}
+	details, ok := guestErr.Details.(map[string]any)
+	if !ok {
+		return nil
+	}
+	logic, _ := details["FailedLogic"].(map[string]any)
+	return logic
+}
+
+func toInt(value any) int {
+	switch number := value.(type) {
+	case int:
+		return number
+	case int64:
+		return int(number)
+	case uint32:
+		return int(number)
+	case uint64:
+		return int(number)
+	case float64:
+		return int(number)
+	}
+	return 0
+}
+
+func toString(value any) string {
+	text, _ := value.(string)
+	return text
+}
@@ -0,0 +1,57 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"reflect"
+	"testing"
+)
+
+func TestFailedChecks(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice"); check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	authorizerBuilder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizerBuilder.Close() }()
+	if err := authorizerBuilder.AddCode(`check if user("bob"); allow if true;`); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := authorizerBuilder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	_, err = authorizer.Authorize()
+	if err == nil {
+		t.Fatal("token authorized despite failing checks")
+	}
+
+	want := []FailedCheck{
+		{Authorizer: true, Check: 0, Rule: `check if user("bob")`},
+		{Block: 0, Check: 0, Rule: `check if operation("read")`},
+	}
+	if got := FailedChecks(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("FailedChecks = %+v, want %+v", got, want)
+	}
+
+	if got := FailedChecks(nil); got != nil {
+		t.Errorf("FailedChecks(nil) = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,60 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// FrameVersion is the version byte ToFramed writes and FromFramed expects.
+const FrameVersion = 1
+
+// ErrInvalidFrame is returned by FromFramed for a frame that is truncated, carries trailing bytes
+// or another version, before the token is parsed.
+var ErrInvalidFrame = errors.New("invalid token frame")
+
+// ToFramed returns the serialized token framed for length-delimited streams: the FrameVersion
+// byte, the length of the token as a uvarint, then the bytes of ToBytes.
+func (self *Biscuit) ToFramed() ([]byte, error) {
+	data, err := self.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 0, 1+binary.MaxVarintLen64+len(data))
+	frame = append(frame, FrameVersion)
+	frame = binary.AppendUvarint(frame, uint64(len(data)))
+	return append(frame, data...), nil
+}
+
+// FromFramed strips the frame ToFramed adds and parses the token with FromBytes. A frame whose
+// declared length is not the length of what follows fails with ErrInvalidFrame.
+func FromFramed(env wasm.WasmEnv, frame []byte, root keypair.PublicKey) (*Biscuit, error) {
+	data, err := unframe(frame)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(env, data, root)
+}
+
+// unframe returns the token a frame holds.
+func unframe(frame []byte) ([]byte, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("%w: empty frame", ErrInvalidFrame)
+	}
+	if frame[0] != FrameVersion {
+		return nil, fmt.Errorf("%w: version %d, want %d", ErrInvalidFrame, frame[0], FrameVersion)
+	}
+
+	length, n := binary.Uvarint(frame[1:])
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: truncated length", ErrInvalidFrame)
+	}
+	data := frame[1+n:]
+	if length != uint64(len(data)) {
+		return nil, fmt.Errorf("%w: declared length %d, got %d bytes", ErrInvalidFrame, length, len(data))
+	}
+	return data, nil
+}
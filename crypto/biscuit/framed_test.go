@@ -0,0 +1,81 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestFramedRoundTrip(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	publicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", publicKey.Ptr()) }()
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	data, err := token.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := token.ToFramed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame[0] != FrameVersion {
+		t.Errorf("version byte = %d, want %d", frame[0], FrameVersion)
+	}
+	if length, n := binary.Uvarint(frame[1:]); length != uint64(len(data)) || !bytes.Equal(frame[1+n:], data) {
+		t.Fatalf("frame %x does not hold the %d bytes of the token", frame, len(data))
+	}
+
+	decoded, err := FromFramed(env, frame, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = decoded.Close() }()
+	if !authorize(t, env, decoded, `allow if user("alice");`) {
+		t.Error("decoded token lost its authority facts")
+	}
+}
+
+func TestFromFramedRejectsInvalidFrames(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	publicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", publicKey.Ptr()) }()
+
+	frame := binary.AppendUvarint([]byte{FrameVersion}, 300)
+	frame = append(frame, make([]byte, 300)...)
+	for name, invalid := range map[string][]byte{
+		"empty":            nil,
+		"version":          append([]byte{FrameVersion + 1}, frame[1:]...),
+		"truncated length": frame[:2],
+		"truncated token":  frame[:len(frame)-1],
+		"trailing bytes":   append(bytes.Clone(frame), 0),
+	} {
+		if _, err := FromFramed(env, invalid, publicKey); !errors.Is(err, ErrInvalidFrame) {
+			t.Errorf("%s: err = %v, want ErrInvalidFrame", name, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// maxFuzzMemory bounds the guest memory of a fuzzed env: inputs are a few KiB, so growing past it
+// means something allocates from a length read in the input.
+const maxFuzzMemory = 256 << 20
+
+// checkFuzzResult fails when err is a guest trap rather than an error returned by the guest or the
+// host side validation, and when the guest memory grew past maxFuzzMemory.
+func checkFuzzResult(t *testing.T, env wasm.WasmEnv, input string, err error) {
+	t.Helper()
+
+	var guestErr *wasm.GuestError
+	if err != nil && !errors.As(err, &guestErr) && strings.Contains(err.Error(), "wasm error") {
+		t.Fatalf("input %q trapped: %v", input, err)
+	}
+	if size := env.MemoryStats().Size; size > maxFuzzMemory {
+		t.Fatalf("input %q grew the guest memory to %d bytes", input, size)
+	}
+}
+
+// fuzzTokens returns the fixtures of testdata and tokens built by the tests, the valid seeds of
+// the token fuzz targets.
+func fuzzTokens(f *testing.F, env wasm.WasmEnv) []string {
+	f.Helper()
+
+	var tokens []string
+	for _, name := range []string{"token_v2.txt", "token_v3.txt", "token_v7.txt"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			f.Fatal(err)
+		}
+		tokens = append(tokens, strings.TrimSpace(string(data)))
+	}
+
+	token := poolToken(f, env)
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		f.Fatal(err)
+	}
+	if err := block.AddCode(`check if operation("read");`); err != nil {
+		f.Fatal(err)
+	}
+	appended, err := token.Append(block)
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer func() { _ = appended.Close() }()
+	sealed, err := appended.Seal()
+	if err != nil {
+		f.Fatal(err)
+	}
+	defer func() { _ = sealed.Close() }()
+	for _, biscuit := range []*Biscuit{token, appended, sealed} {
+		encoded, err := biscuit.ToBase64()
+		if err != nil {
+			f.Fatal(err)
+		}
+		tokens = append(tokens, encoded)
+	}
+	return tokens
+}
+
+// addMutations seeds f with input and known tricky variants of it.
+func addMutations(f *testing.F, input string) {
+	f.Add(input)
+	f.Add(input[:len(input)/2])
+	f.Add(input + "=")
+	f.Add(strings.ReplaceAll(input, "-", "+"))
+	f.Add(" " + input + "\n")
+}
+
+func FuzzFromBase64(f *testing.F) {
+	env := wasmtest.Env(f)
+	root := keypair.InvokePublicKey(env)
+	if err := root.FromString(testRootPublicKey); err != nil {
+		f.Fatal(err)
+	}
+
+	for _, token := range fuzzTokens(f, env) {
+		addMutations(f, token)
+	}
+	f.Add("")
+	f.Add("////")
+	f.Add("EgA=")
+
+	f.Fuzz(func(t *testing.T, token string) {
+		parsed, err := FromBase64(env, token, root)
+		checkFuzzResult(t, env, token, err)
+		if err == nil {
+			_ = parsed.Close()
+		}
+
+		// The unverified readers never reach the guest.
+		_, _ = TokenVersion(token)
+		_, _, _ = RootKeyID(token)
+		if data, err := decodeToken(token); err == nil {
+			_ = checkSignatureChain(data)
+			_, _ = authorityFacts(data)
+			_, _ = blockKeyAlgorithms(data)
+		}
+	})
+}
+
+func FuzzThirdPartyRequestFromBase64(f *testing.F) {
+	env := wasmtest.Env(f)
+	token := poolToken(f, env)
+	request, err := token.ThirdPartyRequest()
+	if err != nil {
+		f.Fatal(err)
+	}
+	encoded, err := request.ToBase64()
+	_ = request.Close()
+	if err != nil {
+		f.Fatal(err)
+	}
+	addMutations(f, encoded)
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, encoded string) {
+		request, err := ThirdPartyRequestFromBase64(env, encoded)
+		checkFuzzResult(t, env, encoded, err)
+		if err == nil {
+			_ = request.Close()
+		}
+	})
+}
+
+func FuzzAuthorizerAddCode(f *testing.F) {
+	env := wasmtest.Env(f)
+	for _, code := range []string{
+		poolBase,
+		`operation("read"); reader($u) <- user($u), operation("read");`,
+		`check if time($t), $t <= 2026-01-01T00:00:00Z; deny if true;`,
+		`allowed({1, 2}); a([1, "x"]); m({"k": null}); b(hex:00ff);`,
+		`check all operation($op), $op.matches("^re(ad|load)$");`,
+		`allow if "a\"b".length() == 3 && 1 + 2 * 3 == 7;`,
+		`rule($x) <- fact($x) trusting ed25519/412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59;`,
+		`// comment only`,
+		`fact(`,
+		`"unterminated`,
+		`check if 9223372036854775807 + 1 > 0;`,
+		"\x00\xff",
+	} {
+		f.Add(code)
+	}
+
+	f.Fuzz(func(t *testing.T, code string) {
+		builder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = builder.Close() }()
+		err = builder.AddCode(code)
+		checkFuzzResult(t, env, code, err)
+	})
+}
@@ -0,0 +1,63 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"net/http"
+)
+
+// HTTPStatus returns the status a handler answers a request with when verifying or authorizing
+// its token failed with err:
+//
+//   - 200 for a nil error;
+//   - 401 when the token cannot be trusted: malformed, signed with an unknown or a wrong key, of
+//     an unsupported version, revoked, or inconsistent (guest Format errors, ErrInvalidFrame,
+//     ErrUnknownKeyID, ErrUnknownIssuer, ErrDisallowedAlgorithm, ErrUnsupportedVersion,
+//     ErrRevoked, ErrInconsistent, ErrInvalidToken);
+//   - 403 when the token is valid but not authorized: a deny policy matched, no policy matched,
+//     a check failed, or an expression failed to evaluate (guest FailedLogic and Execution
+//     errors, ErrNotAuthorized);
+//   - 400 when authorization exceeded the run limits, on too many facts or iterations or on a
+//     timeout (guest RunLimit errors), or generated too many facts (ErrFactAmplification);
+//   - 503 when the env or pool cannot serve the request now (wasm.ErrBusy,
+//     wasm.ErrMemoryBudgetExceeded);
+//   - 500 for anything else, e.g. a guest trap or a bug in the authorizer code.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if errors.Is(err, ErrInvalidToken) {
+		return http.StatusUnauthorized
+	}
+	if errors.Is(err, ErrNotAuthorized) {
+		return http.StatusForbidden
+	}
+
+	var guestErr *wasm.GuestError
+	if errors.As(err, &guestErr) {
+		if details, ok := guestErr.Details.(map[string]any); ok {
+			switch {
+			case details["Format"] != nil:
+				return http.StatusUnauthorized
+			case details["FailedLogic"] != nil, details["Execution"] != nil:
+				return http.StatusForbidden
+			case details["RunLimit"] != nil:
+				return http.StatusBadRequest
+			}
+		}
+		return http.StatusInternalServerError
+	}
+
+	for _, target := range []error{ErrInvalidFrame, ErrUnknownKeyID, ErrUnknownIssuer, ErrDisallowedAlgorithm, ErrUnsupportedVersion, ErrRevoked, ErrInconsistent} {
+		if errors.Is(err, target) {
+			return http.StatusUnauthorized
+		}
+	}
+	if errors.Is(err, ErrFactAmplification) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, wasm.ErrBusy) || errors.Is(err, wasm.ErrMemoryBudgetExceeded) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
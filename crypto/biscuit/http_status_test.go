@@ -0,0 +1,89 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	other := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := other.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", otherKey.Ptr()) }()
+	_, wrongRoot := FromBase64(env, encoded, otherKey)
+
+	authorize := func(code string) error {
+		t.Helper()
+		authorizerBuilder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizerBuilder.Close() }()
+		if err := authorizerBuilder.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := authorizerBuilder.Build(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+		_, err = authorizer.Authorize()
+		return err
+	}
+
+	for name, tc := range map[string]struct {
+		err  error
+		want int
+	}{
+		"nil":               {nil, http.StatusOK},
+		"invalid signature": {wrongRoot, http.StatusUnauthorized},
+		"malformed":         {wasm.NewGuestError("biscuit_fromBase64", map[string]any{"Format": map[string]any{"DeserializationError": "deserialization error"}}), http.StatusUnauthorized},
+		"revoked":           {fmt.Errorf("%w: id 1", ErrRevoked), http.StatusUnauthorized},
+		"unknown key id":    {fmt.Errorf("%w 7", ErrUnknownKeyID), http.StatusUnauthorized},
+		"denied":            {authorize(`deny if user("alice");`), http.StatusForbidden},
+		"no match":          {authorize(`allow if user("bob");`), http.StatusForbidden},
+		"execution":         {authorize(`allow if 1 / 0 == 1;`), http.StatusForbidden},
+		"too many facts":    {wasm.NewGuestError("authorizer_authorize", map[string]any{"RunLimit": "TooManyFacts"}), http.StatusBadRequest},
+		"timeout":           {wasm.NewGuestError("authorizer_authorize", map[string]any{"RunLimit": "Timeout"}), http.StatusBadRequest},
+		"invalid token":     {fmt.Errorf("%w: %w", ErrInvalidToken, errors.New("bad frame")), http.StatusUnauthorized},
+		"not authorized":    {fmt.Errorf("%w: %w", ErrNotAuthorized, errors.New("no policy matched")), http.StatusForbidden},
+		"busy":              {wasm.ErrBusy, http.StatusServiceUnavailable},
+		"trap":              {fmt.Errorf("%w: unreachable", wasm.ErrThrown), http.StatusInternalServerError},
+		"unknown":           {errors.New("something else"), http.StatusInternalServerError},
+	} {
+		if name != "nil" && tc.err == nil {
+			t.Errorf("%s: no error to classify", name)
+			continue
+		}
+		if got := HTTPStatus(tc.err); got != tc.want {
+			t.Errorf("%s: HTTPStatus(%v) = %d, want %d", name, tc.err, got, tc.want)
+		}
+	}
+}
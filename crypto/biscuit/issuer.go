@@ -0,0 +1,157 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnknownIssuer is returned by VerifyByIssuer when the issuer claimed by a token has no registered key.
+var ErrUnknownIssuer = errors.New("unknown token issuer")
+
+// ErrDisallowedAlgorithm is returned by VerifyByIssuer when the root key or a key carried by the
+// token uses an algorithm outside VerifyOptions.AllowedAlgorithms.
+var ErrDisallowedAlgorithm = errors.New("disallowed signature algorithm")
+
+// ErrInvalidRootKey is returned by VerifyTokenWithRootString when the root key string does not
+// parse, as opposed to the token failing verification.
+var ErrInvalidRootKey = errors.New("invalid root public key")
+
+// VerifyOptions tunes VerifyByIssuer and VerifyTokenWithRootString. The zero value stands for the
+// defaults set with SetDefaultVerifyOptions.
+type VerifyOptions struct {
+	// IssuerPredicate is the name of the authority fact carrying the issuer, "issuer" when empty.
+	// VerifyTokenWithRootString ignores it.
+	IssuerPredicate string
+	// AllowedAlgorithms restricts the algorithms of the root key and of the keys the blocks are
+	// signed with. Empty allows every supported algorithm.
+	AllowedAlgorithms []keypair.SignatureAlgorithm
+	// ClockSkew is the clock skew tolerated by the time facts AddTime adds to the authorizers of
+	// the verified tokens, and RequestAuthorizer to those of every request: an expiry check
+	// passes until ClockSkew after the expiry, a not-before check from ClockSkew before its date.
+	// `check all` and deny rules on the time are tightened by as much instead, see
+	// AuthorizerBuilder.AddTime. Zero adds the exact time, a negative skew is an error.
+	ClockSkew time.Duration
+}
+
+// defaultVerifyOptions holds the options of SetDefaultVerifyOptions, nil until it is called.
+var defaultVerifyOptions atomic.Pointer[VerifyOptions]
+
+// SetDefaultVerifyOptions sets the options VerifyByIssuer and VerifyTokenWithRootString use when
+// called with zero-value options, so a service states its verification policy once. Options
+// passed to a call replace the defaults as a whole. It is safe to call while tokens are verified.
+func SetDefaultVerifyOptions(opts VerifyOptions) {
+	opts.AllowedAlgorithms = slices.Clone(opts.AllowedAlgorithms)
+	defaultVerifyOptions.Store(&opts)
+}
+
+// orDefaults returns the default options when self is the zero value, self otherwise.
+func (self VerifyOptions) orDefaults() VerifyOptions {
+	if self.IssuerPredicate != "" || len(self.AllowedAlgorithms) > 0 || self.ClockSkew != 0 {
+		return self
+	}
+	if defaults := defaultVerifyOptions.Load(); defaults != nil {
+		return *defaults
+	}
+	return self
+}
+
+// AddTime adds to builder, which authorizes a token verified with these options, the time facts
+// of now with the ClockSkew tolerance of the options, or of the defaults for the zero value.
+func (self VerifyOptions) AddTime(builder *AuthorizerBuilder, now time.Time) error {
+	return builder.AddTime(now, self.orDefaults().ClockSkew)
+}
+
+// VerifyByIssuer parses a base64 token whose authority block names its issuer with an
+// `issuer("name")` fact and verifies it against the root key registered for that issuer.
+// Disallowed algorithms are rejected before the signatures are checked.
+//
+// The issuer is read before the signatures are checked, it only selects the key: a token
+// claiming an issuer it was not signed by fails verification.
+func VerifyByIssuer(env wasm.WasmEnv, token string, issuers map[string]*keypair.PublicKey, opts VerifyOptions) (*Biscuit, error) {
+	opts = opts.orDefaults()
+	predicate := opts.IssuerPredicate
+	if predicate == "" {
+		predicate = "issuer"
+	}
+
+	data, err := decodeToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode token: %w", err)
+	}
+
+	claimed, err := authorityStringFacts(data, predicate)
+	if err != nil {
+		return nil, err
+	}
+	if len(claimed) != 1 {
+		return nil, fmt.Errorf("token must name exactly one issuer, found %d", len(claimed))
+	}
+
+	root, ok := issuers[claimed[0]]
+	if !ok || root == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownIssuer, claimed[0])
+	}
+
+	if len(opts.AllowedAlgorithms) > 0 {
+		if err := checkAlgorithms(data, *root, opts.AllowedAlgorithms); err != nil {
+			return nil, err
+		}
+	}
+
+	return FromBase64(env, token, *root)
+}
+
+// VerifyTokenWithRootString parses a base64 token and verifies it against the root key written
+// in its `<algorithm>/<hex>` form, e.g. `ed25519/412e...`, the way configurations hold it. A root
+// key that does not parse fails with ErrInvalidRootKey.
+func VerifyTokenWithRootString(env wasm.WasmEnv, token string, rootKeyString string, opts VerifyOptions) (*Biscuit, error) {
+	root := keypair.InvokePublicKey(env)
+	if err := root.FromString(rootKeyString); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRootKey, err)
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	return verifyWithRoot(env, token, root, opts)
+}
+
+// verifyWithRoot parses a base64 token and verifies it against root, once the algorithms of the
+// token are checked against opts.
+func verifyWithRoot(env wasm.WasmEnv, token string, root keypair.PublicKey, opts VerifyOptions) (*Biscuit, error) {
+	opts = opts.orDefaults()
+	if len(opts.AllowedAlgorithms) > 0 {
+		data, err := decodeToken(token)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode token: %w", err)
+		}
+		if err := checkAlgorithms(data, root, opts.AllowedAlgorithms); err != nil {
+			return nil, err
+		}
+	}
+
+	return FromBase64(env, token, root)
+}
+
+// checkAlgorithms rejects a token whose root key or block keys use an algorithm outside allowed,
+// before its signatures are verified.
+func checkAlgorithms(data []byte, root keypair.PublicKey, allowed []keypair.SignatureAlgorithm) error {
+	rootAlgorithm, err := root.Algorithm()
+	if err != nil {
+		return err
+	}
+	algorithms, err := blockKeyAlgorithms(data)
+	if err != nil {
+		return err
+	}
+
+	for _, algorithm := range append([]keypair.SignatureAlgorithm{rootAlgorithm}, algorithms...) {
+		if !slices.Contains(allowed, algorithm) {
+			return fmt.Errorf("%w %s", ErrDisallowedAlgorithm, algorithm)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyByIssuer(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	rootA := newRoot(t, env)
+	rootB := newRoot(t, env)
+	publicA, err := rootA.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicB, err := rootB.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuers := map[string]*keypair.PublicKey{"tenant-a": &publicA, "tenant-b": &publicB}
+
+	mint := func(root *keypair.KeyPair, code string) string {
+		t.Helper()
+
+		builder, err := NewBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+		token, err := builder.Build(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = token.Close() }()
+
+		encoded, err := token.ToBase64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+
+	tokenA := mint(rootA, `issuer("tenant-a"); user("alice");`)
+
+	verified, err := VerifyByIssuer(env, tokenA, issuers, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("token from tenant A rejected: %v", err)
+	}
+	_ = verified.Close()
+
+	swapped := map[string]*keypair.PublicKey{"tenant-a": &publicB, "tenant-b": &publicA}
+	if _, err := VerifyByIssuer(env, tokenA, swapped, VerifyOptions{}); err == nil {
+		t.Error("token from tenant A verified with tenant B's key")
+	}
+
+	forged := mint(rootB, `issuer("tenant-a");`)
+	if _, err := VerifyByIssuer(env, forged, issuers, VerifyOptions{}); err == nil {
+		t.Error("token signed by tenant B accepted as tenant A")
+	}
+
+	unknown := mint(rootA, `issuer("tenant-c");`)
+	if _, err := VerifyByIssuer(env, unknown, issuers, VerifyOptions{}); !errors.Is(err, ErrUnknownIssuer) {
+		t.Errorf("err = %v, want ErrUnknownIssuer", err)
+	}
+
+	if _, err := VerifyByIssuer(env, mint(rootA, `user("alice");`), issuers, VerifyOptions{}); err == nil {
+		t.Error("token without issuer accepted")
+	}
+
+	custom := mint(rootB, `tenant("tenant-b");`)
+	verified, err = VerifyByIssuer(env, custom, issuers, VerifyOptions{IssuerPredicate: "tenant"})
+	if err != nil {
+		t.Fatalf("token naming its issuer with a default symbol rejected: %v", err)
+	}
+	_ = verified.Close()
+}
+
+func TestVerifyByIssuerAllowedAlgorithms(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	mint := func(algorithm keypair.SignatureAlgorithm) (string, keypair.PublicKey) {
+		t.Helper()
+
+		root := keypair.Invoke(env)
+		if err := root.New(algorithm); err != nil {
+			t.Fatal(err)
+		}
+		public, err := root.GetPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder, err := NewBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.AddCode(`issuer("tenant");`); err != nil {
+			t.Fatal(err)
+		}
+		token, err := builder.Build(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = token.Close() }()
+		encoded, err := token.ToBase64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded, public
+	}
+
+	ed25519Only := VerifyOptions{AllowedAlgorithms: []keypair.SignatureAlgorithm{keypair.Ed25519}}
+	p256Token, p256Key := mint(keypair.Secp256r1)
+	edToken, edKey := mint(keypair.Ed25519)
+
+	if _, err := VerifyByIssuer(env, p256Token, map[string]*keypair.PublicKey{"tenant": &p256Key}, ed25519Only); !errors.Is(err, ErrDisallowedAlgorithm) {
+		t.Errorf("err = %v, want ErrDisallowedAlgorithm", err)
+	}
+	// Registered with a key it was not signed by, the token is still rejected for its algorithm:
+	// the check runs before the signatures are verified.
+	_, otherP256Key := mint(keypair.Secp256r1)
+	if _, err := VerifyByIssuer(env, p256Token, map[string]*keypair.PublicKey{"tenant": &otherP256Key}, ed25519Only); !errors.Is(err, ErrDisallowedAlgorithm) {
+		t.Errorf("err = %v, want ErrDisallowedAlgorithm", err)
+	}
+
+	verified, err := VerifyByIssuer(env, edToken, map[string]*keypair.PublicKey{"tenant": &edKey}, ed25519Only)
+	if err != nil {
+		t.Fatalf("Ed25519 token rejected: %v", err)
+	}
+	_ = verified.Close()
+
+	verified, err = VerifyByIssuer(env, p256Token, map[string]*keypair.PublicKey{"tenant": &p256Key}, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("P-256 token rejected by default: %v", err)
+	}
+	_ = verified.Close()
+}
+
+func TestVerifyTokenWithRootString(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	root := newRoot(t, env)
+	defer func() { _ = root.Close() }()
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootString, err := public.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(rootString, "ed25519/") {
+		t.Fatalf("root key string %q, want the ed25519/<hex> form", rootString)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verified, err := VerifyTokenWithRootString(env, encoded, rootString, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("token rejected: %v", err)
+	}
+	_ = verified.Close()
+
+	p256Only := VerifyOptions{AllowedAlgorithms: []keypair.SignatureAlgorithm{keypair.Secp256r1}}
+	if _, err := VerifyTokenWithRootString(env, encoded, rootString, p256Only); !errors.Is(err, ErrDisallowedAlgorithm) {
+		t.Errorf("err = %v, want ErrDisallowedAlgorithm", err)
+	}
+
+	otherString, err := newPublicKeyString(t, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyTokenWithRootString(env, encoded, otherString, VerifyOptions{}); err == nil || errors.Is(err, ErrInvalidRootKey) {
+		t.Errorf("err = %v, want a verification error", err)
+	}
+
+	for _, malformed := range []string{"", strings.TrimPrefix(rootString, "ed25519/"), "ed25519/zz", "rsa/" + strings.TrimPrefix(rootString, "ed25519/")} {
+		if _, err := VerifyTokenWithRootString(env, encoded, malformed, VerifyOptions{}); !errors.Is(err, ErrInvalidRootKey) {
+			t.Errorf("root %q: err = %v, want ErrInvalidRootKey", malformed, err)
+		}
+	}
+}
+
+func TestDefaultVerifyOptions(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	root := newRoot(t, env)
+	defer func() { _ = root.Close() }()
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+	rootString, err := public.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`tenant("acme");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := []keypair.SignatureAlgorithm{keypair.Secp256r1}
+	SetDefaultVerifyOptions(VerifyOptions{IssuerPredicate: "tenant", AllowedAlgorithms: allowed})
+	t.Cleanup(func() { SetDefaultVerifyOptions(VerifyOptions{}) })
+	// The defaults are a copy, changing the slice afterwards does not loosen them.
+	allowed[0] = keypair.Ed25519
+
+	if _, err := VerifyTokenWithRootString(env, encoded, rootString, VerifyOptions{}); !errors.Is(err, ErrDisallowedAlgorithm) {
+		t.Errorf("zero options: err = %v, want the default ErrDisallowedAlgorithm", err)
+	}
+	issuers := map[string]*keypair.PublicKey{"acme": &public}
+	if _, err := VerifyByIssuer(env, encoded, issuers, VerifyOptions{}); !errors.Is(err, ErrDisallowedAlgorithm) {
+		t.Errorf("zero options: err = %v, want the issuer read from the default predicate, then ErrDisallowedAlgorithm", err)
+	}
+
+	ed25519Only := VerifyOptions{AllowedAlgorithms: []keypair.SignatureAlgorithm{keypair.Ed25519}}
+	verified, err := VerifyTokenWithRootString(env, encoded, rootString, ed25519Only)
+	if err != nil {
+		t.Fatalf("options of the call did not override the defaults: %v", err)
+	}
+	_ = verified.Close()
+
+	SetDefaultVerifyOptions(VerifyOptions{})
+	verified, err = VerifyTokenWithRootString(env, encoded, rootString, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("token rejected once the defaults are reset: %v", err)
+	}
+	_ = verified.Close()
+}
+
+func TestVerifyOptionsClockSkew(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+	rootString, err := public.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The token expired 30s ago.
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice"); ` + mustCheck(CheckExpiry(now.Add(-30*time.Second))).String() + ";"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func(opts VerifyOptions) error {
+		t.Helper()
+		verified, err := VerifyTokenWithRootString(env, encoded, rootString, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = verified.Close() }()
+
+		builder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = builder.Close() }()
+		if err := opts.AddTime(builder, now); err != nil {
+			return err
+		}
+		if err := builder.AddCode(`allow if user("alice");`); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := builder.Build(verified)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+		_, err = authorizer.Authorize()
+		return err
+	}
+
+	t.Run("60s", func(t *testing.T) {
+		if err := authorize(VerifyOptions{ClockSkew: 60 * time.Second}); err != nil {
+			t.Errorf("token rejected within the clock skew: %v", err)
+		}
+	})
+	t.Run("10s", func(t *testing.T) {
+		if err := authorize(VerifyOptions{ClockSkew: 10 * time.Second}); err == nil {
+			t.Error("token accepted 20s past the clock skew")
+		}
+	})
+	t.Run("negative", func(t *testing.T) {
+		if err := authorize(VerifyOptions{ClockSkew: -time.Second}); err == nil {
+			t.Error("negative clock skew accepted")
+		}
+	})
+	t.Run("defaults", func(t *testing.T) {
+		SetDefaultVerifyOptions(VerifyOptions{ClockSkew: 60 * time.Second})
+		t.Cleanup(func() { SetDefaultVerifyOptions(VerifyOptions{}) })
+		if err := authorize(VerifyOptions{}); err != nil {
+			t.Errorf("zero options: token rejected within the default clock skew: %v", err)
+		}
+		// Options passed to a call replace the defaults, their skew included.
+		ed25519Only := VerifyOptions{AllowedAlgorithms: []keypair.SignatureAlgorithm{keypair.Ed25519}}
+		if err := authorize(ed25519Only); err == nil {
+			t.Error("token accepted with the default skew despite options of the call")
+		}
+	})
+}
+
+// newPublicKeyString returns the string form of the public key of a new root.
+func newPublicKeyString(t *testing.T, env wasm.WasmEnv) (string, error) {
+	root := newRoot(t, env)
+	defer func() { _ = root.Close() }()
+	public, err := root.GetPublicKey()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+	return public.ToString()
+}
+
+func TestBlockKeyAlgorithms(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := decodeToken(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	algorithms, err := blockKeyAlgorithms(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(algorithms) != 1 || algorithms[0] != keypair.Ed25519 {
+		t.Errorf("algorithms = %v, want the Ed25519 next key of the authority block", algorithms)
+	}
+}
@@ -0,0 +1,129 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrUnknownKeyID is returned by FromBase64WithProvider when a token carries no root key id, or
+// one its KeyProvider has no key for.
+var ErrUnknownKeyID = errors.New("unknown root key id")
+
+// KeyProvider supplies the root public keys tokens are verified against by the root key id they
+// carry, see Builder.SetRootKeyID, so that root keys can rotate.
+type KeyProvider interface {
+	// PublicKey returns the key of id parsed in env, which the caller frees, or an error wrapping
+	// ErrUnknownKeyID when there is none.
+	PublicKey(env wasm.WasmEnv, id uint32) (keypair.PublicKey, error)
+}
+
+// FromBase64WithProvider parses a base64 token and verifies it against the root key provider
+// holds for the root key id of the token. The id is read before the signatures are checked, it
+// only selects the key: a token claiming an id it was not signed under fails verification.
+func FromBase64WithProvider(env wasm.WasmEnv, token string, provider KeyProvider) (*Biscuit, error) {
+	id, found, err := RootKeyID(token)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: token carries none", ErrUnknownKeyID)
+	}
+
+	root, err := provider.PublicKey(env, id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = env.FreeObject("publickey", root.Ptr()) }()
+
+	return FromBase64(env, token, root)
+}
+
+// JSONKeySet is a KeyProvider over a JSON document mapping root key ids, in decimal, to public
+// keys in their `<algorithm>/<hex>` form:
+//
+//	{"1": "ed25519/412e...", "2": "ed25519/9b3c..."}
+//
+// Every key is validated when the document is loaded. The set holds them as strings and parses
+// the key a token needs in the env verifying it, so it can serve any number of envs.
+type JSONKeySet struct {
+	env  wasm.WasmEnv
+	load func() ([]byte, error)
+
+	refresh sync.Mutex
+	current atomic.Pointer[map[uint32]string]
+}
+
+// LoadJSONKeys loads and validates the document load returns, e.g. the content of a file read
+// with os.ReadFile. env is only used to validate the keys, here and in Refresh, which must not
+// run concurrently with other users of env.
+func LoadJSONKeys(env wasm.WasmEnv, load func() ([]byte, error)) (*JSONKeySet, error) {
+	set := &JSONKeySet{env: env, load: load}
+	if err := set.Refresh(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Refresh loads the document again and makes its keys the current ones. On error the previous
+// keys stay current.
+func (self *JSONKeySet) Refresh() error {
+	self.refresh.Lock()
+	defer self.refresh.Unlock()
+
+	data, err := self.load()
+	if err != nil {
+		return fmt.Errorf("cannot load root keys: %w", err)
+	}
+	keys, err := parseJSONKeys(self.env, data)
+	if err != nil {
+		return err
+	}
+	self.current.Store(&keys)
+	return nil
+}
+
+// PublicKey parses the current key of id in env.
+func (self *JSONKeySet) PublicKey(env wasm.WasmEnv, id uint32) (keypair.PublicKey, error) {
+	text, ok := (*self.current.Load())[id]
+	if !ok {
+		return keypair.PublicKey{}, fmt.Errorf("%w %d", ErrUnknownKeyID, id)
+	}
+
+	key := keypair.InvokePublicKey(env)
+	if err := key.FromString(text); err != nil {
+		return keypair.PublicKey{}, fmt.Errorf("root key %d: %w", id, err)
+	}
+	return key, nil
+}
+
+// parseJSONKeys decodes a key set document and parses each key in env.
+func parseJSONKeys(env wasm.WasmEnv, data []byte) (map[uint32]string, error) {
+	var document map[string]string
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid root key document: %w", err)
+	}
+	if len(document) == 0 {
+		return nil, fmt.Errorf("invalid root key document: no key")
+	}
+
+	keys := make(map[uint32]string, len(document))
+	for name, text := range document {
+		id, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid root key id %q: %w", name, err)
+		}
+		key := keypair.InvokePublicKey(env)
+		if err := key.FromString(text); err != nil {
+			return nil, fmt.Errorf("root key %d: %w", id, err)
+		}
+		_ = env.FreeObject("publickey", key.Ptr())
+		keys[uint32(id)] = text
+	}
+	return keys, nil
+}
@@ -0,0 +1,105 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// keyIDToken returns a token signed by root and carrying the root key id id.
+func keyIDToken(t *testing.T, env wasm.WasmEnv, root *keypair.KeyPair, id uint32) string {
+	t.Helper()
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.SetRootKeyID(id); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestJSONKeySet(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	roots := map[uint32]*keypair.KeyPair{1: newRoot(t, env), 2: newRoot(t, env)}
+	document := map[string]string{}
+	tokens := map[uint32]string{}
+	for id, root := range roots {
+		defer func() { _ = root.Close() }()
+		public, err := root.GetPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := public.ToString()
+		_ = env.FreeObject("publickey", public.Ptr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		document[strconv.Itoa(int(id))] = text
+		tokens[id] = keyIDToken(t, env, root, id)
+	}
+
+	load := func() ([]byte, error) { return json.Marshal(document) }
+	keys, err := LoadJSONKeys(env, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, token := range tokens {
+		verified, err := FromBase64WithProvider(env, token, keys)
+		if err != nil {
+			t.Fatalf("token of key %d: %v", id, err)
+		}
+		_ = verified.Close()
+	}
+
+	if _, err := FromBase64WithProvider(env, keyIDToken(t, env, roots[1], 3), keys); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("unknown key id: err = %v, want ErrUnknownKeyID", err)
+	}
+	if _, err := FromBase64WithProvider(env, keyIDToken(t, env, roots[1], 2), keys); err == nil {
+		t.Error("token claiming the key id of another root accepted")
+	}
+
+	// A refresh dropping a key retires its tokens, an invalid document leaves the keys as they are.
+	delete(document, "1")
+	if err := keys.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromBase64WithProvider(env, tokens[1], keys); !errors.Is(err, ErrUnknownKeyID) {
+		t.Errorf("retired key id: err = %v, want ErrUnknownKeyID", err)
+	}
+	document["3"] = "ed25519/zz"
+	if err := keys.Refresh(); err == nil {
+		t.Error("invalid key accepted")
+	}
+	verified, err := FromBase64WithProvider(env, tokens[2], keys)
+	if err != nil {
+		t.Fatalf("keys lost on a failed refresh: %v", err)
+	}
+	_ = verified.Close()
+
+	for _, invalid := range []string{`[]`, `{}`, `{"x": "ed25519/00"}`} {
+		if _, err := LoadJSONKeys(env, func() ([]byte, error) { return []byte(invalid), nil }); err == nil {
+			t.Errorf("document %s accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+)
+
+// DefaultLargeBytesThreshold is the size from which AddFact and AddFacts pass byte terms to the
+// guest as parameters, see WithLargeBytesThreshold.
+const DefaultLargeBytesThreshold = 64 << 10
+
+// BuilderOption configures a Builder or an AuthorizerBuilder.
+type BuilderOption func(*builderOptions)
+
+type builderOptions struct {
+	largeBytesThreshold int
+	scopeKeys           map[string]keypair.PublicKey
+	// scopes holds scopeKeys in the form the guest reads them, see WithScopeKeys.
+	scopes map[string]any
+	// maxFactGrowth is the ratio of WithMaxFactGrowthRatio, the authorizers of the builder get it.
+	maxFactGrowth float64
+}
+
+// newBuilderOptions applies options and renders the scope keys, before the builder exists.
+func newBuilderOptions(options []BuilderOption) (builderOptions, error) {
+	result := builderOptions{largeBytesThreshold: DefaultLargeBytesThreshold}
+	for _, option := range options {
+		option(&result)
+	}
+	scopes, err := scopeParameters(result.scopeKeys)
+	if err != nil {
+		return builderOptions{}, err
+	}
+	result.scopes = scopes
+	return result, nil
+}
+
+// WithLargeBytesThreshold sets the size from which AddFact and AddFacts pass byte terms to the
+// guest as parameters of the datalog source instead of inside it. The hex encoding of such a term
+// is then written straight into the guest allocation the term is parsed from, in chunks, rather
+// than rendered into the source on the host and copied along with it. A threshold of 0 or less
+// always renders byte terms into the source.
+func WithLargeBytesThreshold(size int) BuilderOption {
+	return func(options *builderOptions) {
+		options.largeBytesThreshold = size
+	}
+}
+
+// addCodeWithParameters calls function, the addCodeWithParameters export of a builder, on code,
+// the values of its {name} parameters and the keys of its `trusting {name}` scopes.
+func addCodeWithParameters(env wasm.WasmEnv, function string, builder uint64, code string, parameters, scopes map[string]any) error {
+	return env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(code)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		return env.WithOperation("datalog.parse").CallFallibleVoid(function, builder, strPtr, strLen, s.NewObject(parameters), s.NewObject(scopes))
+	})
+}
@@ -0,0 +1,117 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+)
+
+func TestLargeBytesTerm(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	payload := bytes.Repeat([]byte{0xa5, 0x5a, 0x01, 0xff}, 1<<18)
+	manifest, err := NewFact("manifest", StringTerm("v1"), BytesTerm(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddFact(manifest); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	facts, err := token.AuthorityFacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facts) != 1 || facts[0].String() != manifest.String() {
+		t.Fatalf("authority facts = %d facts, want the manifest", len(facts))
+	}
+
+	// Through parameters or the source, the authorizer holds the same fact.
+	externrefs := env.Stats().Externrefs
+	var printed []string
+	for _, threshold := range []int{DefaultLargeBytesThreshold, 0} {
+		builder, err := NewAuthorizerBuilder(env, WithLargeBytesThreshold(threshold))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.AddFacts([]Fact{manifest}); err != nil {
+			t.Fatal(err)
+		}
+		code, err := builder.ToString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		printed = append(printed, code)
+		_ = builder.Close()
+	}
+	if printed[0] != printed[1] {
+		t.Error("fact added through parameters differs from the one added through the source")
+	}
+	if live := env.Stats().Externrefs; live != externrefs {
+		t.Errorf("%d externrefs live after adding the facts, want %d", live, externrefs)
+	}
+}
+
+// The host only encodes chunks of a large byte term: the allocations of AddFact stay far below
+// the size of the term, where rendering it into the source allocates several times its size.
+func TestLargeBytesTermHostAllocations(t *testing.T) {
+	wasmtest.Env(t)
+	payload := bytes.Repeat([]byte{0xa5, 0x5a, 0x01, 0xff}, 1<<18)
+	manifest, err := NewFact("manifest", BytesTerm(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh instance, its memory grown beforehand so that wazero does not reallocate it during
+	// the measure.
+	env, err := wasm.InitWasm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Close(context.Background()) }()
+	ptr, err := env.Malloc(32 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Free(ptr, 32<<20); err != nil {
+		t.Fatal(err)
+	}
+
+	allocated := map[int]uint64{}
+	for _, threshold := range []int{0, DefaultLargeBytesThreshold} {
+		builder, err := NewAuthorizerBuilder(env, WithLargeBytesThreshold(threshold))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if err := builder.AddFact(manifest); err != nil {
+			t.Fatal(err)
+		}
+		runtime.ReadMemStats(&after)
+		allocated[threshold] = after.TotalAlloc - before.TotalAlloc
+		_ = builder.Close()
+	}
+
+	if got := allocated[DefaultLargeBytesThreshold]; got > uint64(len(payload))/4 {
+		t.Errorf("AddFact of a %d bytes term allocated %d bytes on the host", len(payload), got)
+	}
+	if got := allocated[0]; got < 2*uint64(len(payload)) {
+		t.Errorf("AddFact rendering a %d bytes term into the source allocated %d bytes, want the encoding copies", len(payload), got)
+	}
+	t.Logf("host allocations: %d bytes through the source, %d through parameters", allocated[0], allocated[DefaultLargeBytesThreshold])
+}
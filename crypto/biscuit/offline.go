@@ -0,0 +1,26 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"fmt"
+)
+
+// OfflineVerifier checks the signatures of tokens against a root key and nothing else, for
+// services that authorize requests elsewhere. It runs no datalog: checks and policies of the
+// tokens it returns are not evaluated.
+type OfflineVerifier struct {
+	root keypair.PublicKey
+}
+
+// NewOfflineVerifier returns a verifier of the tokens signed by root, in the env root lives in.
+func NewOfflineVerifier(root *keypair.PublicKey) (*OfflineVerifier, error) {
+	if root == nil || root.Ptr() == 0 {
+		return nil, fmt.Errorf("root public key not initialized")
+	}
+	return &OfflineVerifier{root: *root}, nil
+}
+
+// Verify parses a base64 token and verifies its signatures, see FromBase64.
+func (self *OfflineVerifier) Verify(token string) (*Biscuit, error) {
+	return FromBase64(self.root.Env(), token, self.root)
+}
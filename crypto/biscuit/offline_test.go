@@ -0,0 +1,69 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestOfflineVerifier(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewOfflineVerifier(&public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(`user("alice"); check if time($t), $t < 2000-01-01T00:00:00Z;`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The expired check is not evaluated.
+	verified, err := verifier.Verify(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = verified.Close()
+
+	data, err := decodeToken(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := bytesField(blocks[0], signedBlockBlockField)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Flip the last byte of the datalog of the authority block.
+	tampered := append([]byte(nil), data...)
+	tampered[bytes.Index(data, payload)+len(payload)-1] ^= 0x01
+	if _, err := verifier.Verify(base64.URLEncoding.EncodeToString(tampered)); err == nil {
+		t.Error("tampered token verified")
+	}
+
+	if _, err := NewOfflineVerifier(nil); err == nil {
+		t.Error("NewOfflineVerifier(nil) succeeded")
+	}
+}
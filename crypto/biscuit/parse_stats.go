@@ -0,0 +1,70 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"fmt"
+	"strings"
+)
+
+// ParseStats parses source in a throwaway authorizer builder and counts its statements by kind.
+// Nothing is evaluated, reject if checks are counted as checks and deny policies as policies.
+func ParseStats(env wasm.WasmEnv, source string) (facts, rules, checks, policies int, err error) {
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	defer func() { _ = builder.Close() }()
+
+	if err := builder.AddCode(source); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("invalid datalog: %w", err)
+	}
+
+	printed, err := builder.ToString()
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	facts, rules, checks, policies = countStatements(printed)
+	return facts, rules, checks, policies, nil
+}
+
+// countStatements counts the statements of the output of AuthorizerBuilder.ToString by kind.
+func countStatements(printed string) (facts, rules, checks, policies int) {
+	// The builder prints one statement per line.
+	for _, line := range strings.Split(printed, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "check ") || strings.HasPrefix(line, "reject "):
+			checks++
+		case strings.HasPrefix(line, "allow ") || strings.HasPrefix(line, "deny "):
+			policies++
+		case strings.Contains(withoutStrings(line), "<-"):
+			rules++
+		default:
+			facts++
+		}
+	}
+	return facts, rules, checks, policies
+}
+
+// withoutStrings returns statement with the content of its string literals removed, so a `<-`
+// inside a string is not taken for a rule arrow.
+func withoutStrings(statement string) string {
+	var builder strings.Builder
+	inString, escaped := false, false
+	for _, r := range statement {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+			builder.WriteRune(r)
+		case !inString:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
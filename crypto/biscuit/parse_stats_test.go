@@ -0,0 +1,33 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"testing"
+)
+
+func TestParseStats(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	source := `
+user("alice");
+link("a <- b");
+time(2024-01-01T00:00:00Z);
+right($u, "read") <- user($u);
+check if user("alice") or user("bob");
+check all operation($o), ["read"].contains($o);
+reject if user("mallory");
+allow if right("alice", "read");
+deny if true;
+`
+	facts, rules, checks, policies, err := ParseStats(env, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if facts != 3 || rules != 1 || checks != 3 || policies != 2 {
+		t.Errorf("got %d facts, %d rules, %d checks, %d policies, want 3, 1, 3, 2", facts, rules, checks, policies)
+	}
+
+	if _, _, _, _, err := ParseStats(env, `allow if`); err == nil {
+		t.Error("invalid datalog accepted")
+	}
+}
@@ -0,0 +1,268 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// PolicyError locates an invalid statement of a policy file.
+type PolicyError struct {
+	File string
+	// Line is the line the invalid statement starts on, 1-based, or 0 when the file could not be
+	// read.
+	Line int
+	Err  error
+}
+
+func (self *PolicyError) Error() string {
+	if self.Line == 0 {
+		return fmt.Sprintf("%s: %v", self.File, self.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", self.File, self.Line, self.Err)
+}
+
+func (self *PolicyError) Unwrap() error {
+	return self.Err
+}
+
+// PolicySet is the authorizer datalog of the .datalog files of a directory, validated when loaded.
+// Files are concatenated in name order, which is the order policies are tried in.
+//
+// The set is parsed once per env and version: builders get the parsed base merged into them, like
+// with AuthorizerPool, instead of parsing the files for every request.
+type PolicySet struct {
+	env wasm.WasmEnv
+	dir string
+
+	reload  sync.Mutex
+	current atomic.Pointer[string]
+
+	mu    sync.Mutex
+	bases map[api.Module]policyBase
+}
+
+// policyBase is a version of the set parsed in one env.
+type policyBase struct {
+	source  *string
+	builder *AuthorizerBuilder
+}
+
+// LoadPolicyDir loads and validates every .datalog file of dir. env is only used to validate the
+// files, here and in Reload, which must not run concurrently with other users of env.
+func LoadPolicyDir(env wasm.WasmEnv, dir string) (*PolicySet, error) {
+	set := &PolicySet{env: env, dir: dir, bases: map[api.Module]policyBase{}}
+	if err := set.Reload(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Source returns the datalog of the current set.
+func (self *PolicySet) Source() string {
+	return *self.current.Load()
+}
+
+// NewAuthorizerBuilder returns a builder holding the current set, for the caller to add the facts
+// of a request and bind it to a token. env may differ from the one the set was loaded with, and
+// must be in exclusive use of the caller. The first builder of a version in env parses it, the
+// next ones get a copy of that parse, or parse it again when the guest cannot merge builders.
+func (self *PolicySet) NewAuthorizerBuilder(env wasm.WasmEnv) (*AuthorizerBuilder, error) {
+	source := self.current.Load()
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := env.GetFunction("authorizerbuilder_merge"); err != nil {
+		if err := builder.AddCode(*source); err != nil {
+			_ = builder.Close()
+			return nil, err
+		}
+		return builder, nil
+	}
+
+	base, err := self.base(env, source)
+	if err == nil {
+		err = builder.Merge(base)
+	}
+	if err != nil {
+		_ = builder.Close()
+		return nil, err
+	}
+	return builder, nil
+}
+
+// Forget frees the parsed set of env, to be called before the env is torn down.
+func (self *PolicySet) Forget(env wasm.WasmEnv) error {
+	self.mu.Lock()
+	base, ok := self.bases[env.Module]
+	delete(self.bases, env.Module)
+	self.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return base.builder.Close()
+}
+
+// base returns the version source of the set parsed in env, replacing the parse of a previous
+// version.
+func (self *PolicySet) base(env wasm.WasmEnv, source *string) (*AuthorizerBuilder, error) {
+	self.mu.Lock()
+	base, ok := self.bases[env.Module]
+	self.mu.Unlock()
+	if ok && base.source == source {
+		return base.builder, nil
+	}
+	if ok {
+		// The caller has exclusive use of env, nobody else can be merging the stale base.
+		_ = base.builder.Close()
+	}
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	if err := builder.AddCode(*source); err != nil {
+		_ = builder.Close()
+		return nil, err
+	}
+
+	self.mu.Lock()
+	self.bases[env.Module] = policyBase{source: source, builder: builder}
+	self.mu.Unlock()
+	return builder, nil
+}
+
+// Reload reads the directory again and swaps the new set in only when every file is valid. On
+// failure the previous set stays in use and every invalid file is reported as a *PolicyError.
+// Builders already stamped keep the set they were created with.
+func (self *PolicySet) Reload() error {
+	self.reload.Lock()
+	defer self.reload.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(self.dir, "*.datalog"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	var sources []string
+	var errs []error
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, &PolicyError{File: path, Err: err})
+			continue
+		}
+		if err := self.validate(path, string(data)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sources = append(sources, string(data))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	source := strings.Join(sources, "\n")
+	self.current.Store(&source)
+	return nil
+}
+
+// validate parses source, and when it is invalid, parses it statement by statement to report the
+// line of the first invalid one.
+func (self *PolicySet) validate(path string, source string) error {
+	err := self.parse(source)
+	if err == nil {
+		return nil
+	}
+
+	for _, statement := range splitStatements(source) {
+		if statementErr := self.parse(statement.text); statementErr != nil {
+			return &PolicyError{File: path, Line: statement.line, Err: statementErr}
+		}
+	}
+	return &PolicyError{File: path, Err: err}
+}
+
+func (self *PolicySet) parse(source string) error {
+	builder, err := NewAuthorizerBuilder(self.env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = builder.Close() }()
+
+	return builder.AddCode(source)
+}
+
+type statement struct {
+	text string
+	line int
+}
+
+// splitStatements cuts datalog source on the `;` ending each statement, ignoring the ones in
+// strings and `//` comments. A trailing statement without `;` is kept.
+func splitStatements(source string) []statement {
+	var statements []statement
+	var current strings.Builder
+	line, start := 1, 0
+	inString, escaped, inComment := false, false, false
+
+	for _, r := range source {
+		switch {
+		case inComment:
+			if r == '\n' {
+				inComment = false
+			}
+		case escaped:
+			escaped = false
+		case inString && r == '\\':
+			escaped = true
+		case r == '"':
+			inString = !inString
+		case !inString && r == '/' && strings.HasSuffix(current.String(), "/"):
+			inComment = true
+			trimmed := strings.TrimSuffix(current.String(), "/")
+			current.Reset()
+			current.WriteString(trimmed)
+			if strings.TrimSpace(trimmed) == "" {
+				start = 0
+			}
+			continue
+		}
+
+		if !inComment {
+			if start == 0 && !isSpace(r) {
+				start = line
+			}
+			current.WriteRune(r)
+		}
+		if r == '\n' {
+			line++
+		}
+
+		if !inString && !inComment && r == ';' {
+			statements = append(statements, statement{text: current.String(), line: start})
+			current.Reset()
+			start = 0
+		}
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		statements = append(statements, statement{text: current.String(), line: start})
+	}
+	return statements
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
@@ -0,0 +1,266 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writePolicy(t *testing.T, dir, name, source string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	source := "// header; not a statement\nuser(\"a;b\");\n\n  allow if\n    user($u); // trailing\ncheck if true"
+	statements := splitStatements(source)
+
+	want := []int{2, 4, 6}
+	if len(statements) != len(want) {
+		t.Fatalf("got %d statements %q, want %d", len(statements), statements, len(want))
+	}
+	for i, statement := range statements {
+		if statement.line != want[i] {
+			t.Errorf("statement %q starts on line %d, want %d", statement.text, statement.line, want[i])
+		}
+	}
+}
+
+func TestPolicySetReload(t *testing.T) {
+	env := wasmtest.Env(t)
+	dir := t.TempDir()
+	writePolicy(t, dir, "10-checks.datalog", "check if operation($o);\n")
+	writePolicy(t, dir, "20-policies.datalog", "allow if user(\"alice\");\n")
+	writePolicy(t, dir, "notes.txt", "not datalog")
+
+	set, err := LoadPolicyDir(env, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := set.Source()
+
+	// One valid change and one typo: nothing is swapped in.
+	writePolicy(t, dir, "10-checks.datalog", "check if operation(\"read\");\n")
+	writePolicy(t, dir, "20-policies.datalog", "// policies\nallow if user(\"alice\");\n\ndeny if user(\"bob\"\n")
+	err = set.Reload()
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("err = %v, want a *PolicyError", err)
+	}
+	if policyErr.File != filepath.Join(dir, "20-policies.datalog") || policyErr.Line != 4 {
+		t.Errorf("error at %s:%d, want 20-policies.datalog:4", policyErr.File, policyErr.Line)
+	}
+	if set.Source() != before {
+		t.Error("partially valid reload swapped in")
+	}
+
+	writePolicy(t, dir, "20-policies.datalog", "allow if user(\"alice\");\n")
+	if err := set.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if set.Source() == before {
+		t.Error("valid reload not swapped in")
+	}
+
+	if _, err := LoadPolicyDir(env, t.TempDir()+"/missing"); err != nil {
+		t.Errorf("empty directory rejected: %v", err)
+	}
+}
+
+func TestPolicySetConcurrentReload(t *testing.T) {
+	env := wasmtest.Env(t)
+	dir := t.TempDir()
+	writePolicy(t, dir, "policies.datalog", "allow if user(\"alice\");\n")
+
+	// Reload validates in its own env, the requests share the test env.
+	reloadEnv, err := wasm.InitWasm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := LoadPolicyDir(reloadEnv, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := newRoot(t, env)
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 10 {
+			source := "allow if user(\"alice\");\n"
+			if i%2 == 0 {
+				source = "allow if user(\"alice\"), true;\n"
+			}
+			if err := os.WriteFile(filepath.Join(dir, "policies.datalog"), []byte(source), 0o644); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := set.Reload(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	for range 20 {
+		authorizerBuilder, err := set.NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := authorizerBuilder.Build(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := authorizer.Authorize(); err != nil {
+			t.Errorf("request denied during a reload: %v", err)
+		}
+		_ = authorizer.Close()
+	}
+	wg.Wait()
+}
+
+// policySetRequest authorizes token for operation with a builder of set and returns the facts of
+// the authorizer.
+func policySetRequest(t testing.TB, set *PolicySet, env wasm.WasmEnv, token *Biscuit, operation string) (string, error) {
+	t.Helper()
+
+	builder, err := set.NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if operation != "" {
+		if err := builder.AddFact(operationFact(t, operation)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	authorizer, err := builder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	_, authorizeErr := authorizer.Authorize()
+	world, err := authorizer.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	facts, _, _ := strings.Cut(world, "// Checks:")
+	return facts, authorizeErr
+}
+
+func TestPolicySetIndependentBuilders(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+	dir := t.TempDir()
+	writePolicy(t, dir, "policies.datalog", poolBase)
+
+	set, err := LoadPolicyDir(env, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = set.Forget(env) }()
+
+	// Two builders alive at once share the parsed set, not their facts.
+	first, err := set.NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = first.Close() }()
+	if err := first.AddFact(operationFact(t, "read")); err != nil {
+		t.Fatal(err)
+	}
+	world, err := policySetRequest(t, set, env, token, "")
+	if err == nil || strings.Contains(world, `operation("read")`) {
+		t.Errorf("request sees the fact of another builder: err = %v\n%s", err, world)
+	}
+
+	if _, err := policySetRequest(t, set, env, token, "read"); err != nil {
+		t.Errorf("read denied: %v", err)
+	}
+	world, err = policySetRequest(t, set, env, token, "write")
+	if err == nil || strings.Contains(world, `operation("read")`) {
+		t.Errorf("write request: err = %v\n%s", err, world)
+	}
+
+	// A reload replaces the parsed set of env.
+	writePolicy(t, dir, "policies.datalog", "allow if true;\n")
+	if err := set.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := policySetRequest(t, set, env, token, "write"); err != nil {
+		t.Errorf("write denied after the reload: %v", err)
+	}
+}
+
+func BenchmarkPolicySetBuilder(b *testing.B) {
+	env := wasmtest.Env(b)
+	token := poolToken(b, env)
+	dir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "policies.datalog"), []byte(poolBase), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	set, err := LoadPolicyDir(env, dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = set.Forget(env) }()
+	read := operationFact(b, "read")
+
+	authorize := func(b *testing.B, builder *AuthorizerBuilder) {
+		if err := builder.AddFact(read); err != nil {
+			b.Fatal(err)
+		}
+		authorizer, err := builder.Build(token)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := authorizer.Authorize(); err != nil {
+			b.Fatal(err)
+		}
+		_ = authorizer.Close()
+	}
+
+	b.Run("Parse", func(b *testing.B) {
+		for b.Loop() {
+			builder, err := NewAuthorizerBuilder(env)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := builder.AddCode(set.Source()); err != nil {
+				b.Fatal(err)
+			}
+			authorize(b, builder)
+		}
+	})
+
+	b.Run("Merge", func(b *testing.B) {
+		for b.Loop() {
+			builder, err := set.NewAuthorizerBuilder(env)
+			if err != nil {
+				b.Fatal(err)
+			}
+			authorize(b, builder)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"fmt"
+)
+
+// MaxTokenSize is the size in bytes of the largest serialized token FromBase64 and FromBytes
+// parse. Larger inputs are rejected before reaching the guest.
+const MaxTokenSize = 1 << 20
+
+// minTokenSize is the size of the smallest serialized token: every token carries at least the
+// 64 bytes of an Ed25519 signature, and ECDSA signatures are longer.
+const minTokenSize = 64
+
+// checkBase64 rejects, without calling the guest, an input of the export function that is not
+// URL-safe base64 or that decodes to more than MaxTokenSize bytes, or to less than minSize. The
+// error is the one the guest would have thrown, with better messages for the sizes.
+func checkBase64(function string, input string, minSize int) error {
+	for i := 0; i < len(input); i++ {
+		if !isBase64URLByte(input[i]) {
+			return wasm.NewGuestError(function, map[string]any{
+				"Base64": map[string]any{"InvalidByte": []any{float64(i), float64(input[i])}},
+			})
+		}
+	}
+	return checkSize(function, len(input)*3/4, minSize)
+}
+
+// checkSize rejects a serialized input of size bytes outside [minSize, MaxTokenSize], like the
+// guest rejects an input it cannot deserialize.
+func checkSize(function string, size int, minSize int) error {
+	var problem string
+	switch {
+	case size == 0:
+		problem = "empty input"
+	case size < minSize:
+		problem = fmt.Sprintf("%d bytes, shorter than any token (%d bytes)", size, minSize)
+	case size > MaxTokenSize:
+		problem = fmt.Sprintf("%d bytes, more than MaxTokenSize (%d bytes)", size, MaxTokenSize)
+	default:
+		return nil
+	}
+	return wasm.NewGuestError(function, map[string]any{
+		"Format": map[string]any{"DeserializationError": "deserialization error: " + problem},
+	})
+}
+
+// isBase64URLByte reports whether c belongs to the URL-safe base64 alphabet or is padding.
+func isBase64URLByte(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '='
+}
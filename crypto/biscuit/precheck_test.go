@@ -0,0 +1,114 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMalformedTokensSkipGuest(t *testing.T) {
+	calls := 0
+	env := wasmtest.Env(t).WithCallHook(func(string) { calls++ })
+	root := newRoot(t, env)
+	defer func() { _ = root.Close() }()
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+
+	base64Error := func(offset, c int) any {
+		return map[string]any{"Base64": map[string]any{"InvalidByte": []any{float64(offset), float64(c)}}}
+	}
+	for _, tc := range []struct {
+		name string
+		err  func() error
+		// kind is the key of the guest error details, details the details when they are those
+		// the guest throws.
+		kind    string
+		details any
+	}{
+		{"base64 empty", func() error { return errorOf(FromBase64(env, "", public)) }, "Format", nil},
+		{"base64 charset", func() error { return errorOf(FromBase64(env, "!!!", public)) }, "Base64", base64Error(0, '!')},
+		{"base64 standard alphabet", func() error { return errorOf(FromBase64(env, "En0+", public)) }, "Base64", base64Error(3, '+')},
+		{"base64 whitespace", func() error { return errorOf(FromBase64(env, " En0K", public)) }, "Base64", base64Error(0, ' ')},
+		{"base64 short", func() error { return errorOf(FromBase64(env, "En0KEwoEdXNlcgoFYWxpY2U", public)) }, "Format", nil},
+		{"base64 large", func() error {
+			return errorOf(FromBase64(env, strings.Repeat("A", MaxTokenSize/3*4+8), public))
+		}, "Format", nil},
+		{"bytes empty", func() error { return errorOf(FromBytes(env, nil, public)) }, "Format", nil},
+		{"bytes short", func() error { return errorOf(FromBytes(env, []byte("garbage-data"), public)) }, "Format", nil},
+		{"bytes large", func() error { return errorOf(FromBytes(env, make([]byte, MaxTokenSize+1), public)) }, "Format", nil},
+		{"third party charset", func() error { return errorOf(ThirdPartyRequestFromBase64(env, "a.b")) }, "Base64", base64Error(1, '.')},
+	} {
+		calls = 0
+		err := tc.err()
+		var guestErr *wasm.GuestError
+		if !errors.As(err, &guestErr) {
+			t.Errorf("%s: err = %v, want a *wasm.GuestError", tc.name, err)
+			continue
+		}
+		details, _ := guestErr.Details.(map[string]any)
+		if _, ok := details[tc.kind]; !ok {
+			t.Errorf("%s: details = %v, want a %s error", tc.name, guestErr.Details, tc.kind)
+		}
+		if tc.details != nil && !reflect.DeepEqual(guestErr.Details, tc.details) {
+			t.Errorf("%s: details = %v, want %v", tc.name, guestErr.Details, tc.details)
+		}
+		if calls != 0 {
+			t.Errorf("%s: %d guest calls, want none", tc.name, calls)
+		}
+	}
+}
+
+func TestValidTokensPassPrecheck(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	defer func() { _ = root.Close() }()
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := token.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, parse := range map[string]func() (*Biscuit, error){
+		"FromBase64": func() (*Biscuit, error) { return FromBase64(env, encoded, public) },
+		"FromBytes":  func() (*Biscuit, error) { return FromBytes(env, data, public) },
+	} {
+		parsed, err := parse()
+		if err != nil {
+			t.Errorf("%s rejected a valid token: %v", name, err)
+			continue
+		}
+		_ = parsed.Close()
+	}
+}
+
+func errorOf[T any](_ T, err error) error {
+	return err
+}
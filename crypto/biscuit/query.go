@@ -0,0 +1,78 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+)
+
+// Query returns the facts rule generates from the facts of the authorizer, without their final
+// `;`, e.g. `data($r) <- resource($r)`. The guest runs the rules of the authorizer first, the facts
+// they generate are queried too, before Authorize ran or not. The facts are read back from the
+// guest like the world: with a string holding a double quote, in the world or in rule, Query fails
+// with ErrWorldSyntax, see Authorizer.world.
+func (self *Authorizer) Query(rule string) ([]string, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("authorizer not initialized")
+	}
+	if self.quotedWorld() || hasQuotedString(rule) {
+		return nil, fmt.Errorf("%w: a string holds a double quote", ErrWorldSyntax)
+	}
+
+	facts := []string{}
+	_, err := self.query("biscuit.query", rule, func(ptr uint64) (err error) {
+		facts, err = self.appendFact(facts, ptr)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+// query runs rule on the authorizer, calling fact, when not nil, with each fact it generates until
+// one fails, and returns how many facts rule generated.
+func (self *Authorizer) query(operation, rule string, fact func(ptr uint64) error) (int, error) {
+	var rulePtr uint64
+	err := self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(rule)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		rulePtr, err = self.env.CallFallible("rule_fromString", strPtr, strLen)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("invalid rule: %w", err)
+	}
+	defer func() { _ = self.env.FreeObject("rule", rulePtr) }()
+
+	objects, err := self.env.WithOperation(operation).CallFallibleObjects("authorizer_query", self.ptr, rulePtr)
+	if err != nil {
+		return 0, err
+	}
+
+	var factsErr error
+	for _, object := range objects {
+		if factsErr == nil && fact != nil {
+			factsErr = fact(object.Ptr)
+		}
+		factsErr = errors.Join(factsErr, self.env.FreeObject(object.Class, object.Ptr))
+	}
+	return len(objects), factsErr
+}
+
+// appendFact appends the guest fact at ptr to facts as datalog.
+func (self *Authorizer) appendFact(facts []string, ptr uint64) ([]string, error) {
+	printed, err := self.env.CallString("fact_toString", ptr)
+	if err != nil {
+		return facts, err
+	}
+	fact, err := parseStatement(printed)
+	if err != nil {
+		return facts, err
+	}
+	return append(facts, fact), nil
+}
@@ -0,0 +1,55 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestAuthorizerQuery(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`resource("a\\b"); resource("c"); reader($u) <- user($u); allow if true;`); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := builder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	facts, err := authorizer.Query(`data($r, $u) <- resource($r), user($u)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(facts)
+	if want := []string{`data("a\\b", "alice")`, `data("c", "alice")`}; !slices.Equal(facts, want) {
+		t.Errorf("facts = %q, want %q", facts, want)
+	}
+
+	// The rules of the authorizer run before the query.
+	if facts, err := authorizer.Query(`found($u) <- reader($u)`); err != nil || !slices.Equal(facts, []string{`found("alice")`}) {
+		t.Errorf("generated facts = %q, %v", facts, err)
+	}
+
+	// Facts holding a double quote cannot be read back.
+	if facts, err := authorizer.Query(`data("a\"b") <- resource($r)`); !errors.Is(err, ErrWorldSyntax) {
+		t.Errorf("quoted facts = %q, %v, want ErrWorldSyntax", facts, err)
+	}
+
+	var guestErr *wasm.GuestError
+	if _, err := authorizer.Query(`data($r) <-`); !errors.As(err, &guestErr) {
+		t.Errorf("invalid rule = %v, want a *wasm.GuestError", err)
+	}
+	if _, err := (&Authorizer{env: env}).Query(`data($r) <- resource($r)`); err == nil {
+		t.Error("uninitialized authorizer queried")
+	}
+}
@@ -0,0 +1,182 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidToken is returned by RequestAuthorizer.Authorize for a token that cannot be parsed or
+// whose signature does not verify with the root key.
+var ErrInvalidToken = errors.New("invalid token")
+
+// ErrNotAuthorized is returned by RequestAuthorizer.Authorize for a valid token the authorizer
+// rejects: a deny policy matched, no policy matched or a check failed. It wraps the guest error.
+var ErrNotAuthorized = errors.New("not authorized")
+
+// RequestOptions are the settings of a RequestAuthorizer.
+type RequestOptions struct {
+	// RootKey supplies the public key tokens must be signed with.
+	RootKey RootKeyProvider
+	// Revocations, when set, rejects tokens one of whose blocks was revoked with ErrRevoked,
+	// before the authorizer runs.
+	Revocations RevocationStore
+	// Audit, when set, receives the record of every request, those whose token is rejected
+	// before the authorizer runs included.
+	Audit AuditSink
+	// AuditIncludeToken adds the token itself to the audit records.
+	AuditIncludeToken bool
+	// Verify restricts the algorithms of the tokens and sets the clock skew of the time facts
+	// every request gets, see VerifyOptions.AddTime. The zero value stands for the defaults of
+	// SetDefaultVerifyOptions.
+	Verify VerifyOptions
+	// Now is the clock the time facts are read from, time.Now when nil.
+	Now func() time.Time
+}
+
+// RequestAuthorizer authorizes the requests of a service with the token each one carries: it
+// verifies the token, rejects revoked ones, then runs the datalog of the service with the time
+// facts and the facts describing the request. It is the flow of the biscuithttp middleware and of the biscuitgrpc
+// interceptors.
+//
+// Requests are serialized on the Locker of the env, which is only held for guest calls: the root
+// key and the revocations are looked up without it, so a slow provider or store does not hold up
+// the requests of other goroutines.
+type RequestAuthorizer struct {
+	env         wasm.WasmEnv
+	authorizers *AuthorizerPool
+	options     RequestOptions
+}
+
+// NewRequestAuthorizer parses code, the facts, rules, checks and policies evaluated for every
+// request, once in env.
+func NewRequestAuthorizer(env wasm.WasmEnv, code string, options RequestOptions) (*RequestAuthorizer, error) {
+	lock := env.Locker()
+	lock.Lock()
+	defer lock.Unlock()
+
+	if options.Verify.ClockSkew < 0 {
+		return nil, fmt.Errorf("negative clock skew %s", options.Verify.ClockSkew)
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+
+	authorizers, err := NewAuthorizerPool(env, code)
+	if err != nil {
+		return nil, err
+	}
+	return &RequestAuthorizer{env: env, authorizers: authorizers, options: options}, nil
+}
+
+// Authorize authorizes a request carrying token and described by facts, identified by requestID
+// in audit records. It fails with ErrInvalidToken, ErrRevoked or ErrNotAuthorized when the request
+// must be rejected, and with any other error when it could not be authorized. With an audit sink,
+// every request is recorded, rejected tokens included, once the env is released.
+func (self *RequestAuthorizer) Authorize(ctx context.Context, token string, facts []Fact, requestID string) error {
+	record := AuditRecord{Time: time.Now(), RequestID: requestID}
+	err := self.authorize(ctx, token, facts, &record)
+	if self.options.Audit == nil {
+		return err
+	}
+
+	if record.Duration == 0 {
+		record.Duration = time.Since(record.Time)
+	}
+	if record.TokenHash == "" {
+		if data, decodeErr := decodeToken(token); decodeErr == nil {
+			sum := sha256.Sum256(data)
+			record.TokenHash = hex.EncodeToString(sum[:])
+		}
+		if self.options.AuditIncludeToken {
+			record.Token = token
+		}
+	}
+	if err != nil && record.Error == "" {
+		record.Error = err.Error()
+	}
+	self.options.Audit.Record(ctx, record)
+	return err
+}
+
+// authorize is Authorize, filling record as far as the request went.
+func (self *RequestAuthorizer) authorize(ctx context.Context, token string, facts []Fact, record *AuditRecord) error {
+	root, err := self.options.RootKey.RootKey(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get root key: %w", err)
+	}
+
+	lock := self.env.Locker()
+	lock.Lock()
+	if self.options.Audit != nil {
+		if fingerprint, fingerprintErr := root.Fingerprint(); fingerprintErr == nil {
+			record.RootKey = fingerprint
+		}
+	}
+	parsed, err := verifyWithRoot(self.env, token, root, self.options.Verify)
+	var ids [][]byte
+	if err == nil && self.options.Revocations != nil {
+		if ids, err = parsed.RevocationIDs(); err != nil {
+			_ = parsed.Close()
+			lock.Unlock()
+			return fmt.Errorf("cannot get revocation identifiers: %w", err)
+		}
+	}
+	lock.Unlock()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if self.options.Revocations != nil {
+		if err := CheckRevocationIDs(ctx, self.options.Revocations, ids); err != nil {
+			lock.Lock()
+			_ = parsed.Close()
+			lock.Unlock()
+			for _, id := range ids {
+				record.RevocationIDs = append(record.RevocationIDs, hex.EncodeToString(id))
+			}
+			return err
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	defer func() { _ = parsed.Close() }()
+
+	builder, err := self.authorizers.Get(self.env)
+	if err != nil {
+		return fmt.Errorf("cannot create authorizer: %w", err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := self.options.Verify.AddTime(builder, self.options.Now()); err != nil {
+		return fmt.Errorf("cannot add time facts: %w", err)
+	}
+	if err := builder.AddFacts(facts); err != nil {
+		return fmt.Errorf("cannot add request facts: %w", err)
+	}
+	authorizer, err := builder.Build(parsed)
+	if err != nil {
+		return fmt.Errorf("cannot build authorizer: %w", err)
+	}
+	defer func() { _ = self.authorizers.Put(authorizer) }()
+
+	if self.options.Audit == nil {
+		_, err = authorizer.Authorize()
+	} else {
+		_, _, *record, err = authorizer.auditedAuthorize(AuditOptions{
+			RequestID:    record.RequestID,
+			Token:        parsed,
+			Root:         root,
+			IncludeToken: self.options.AuditIncludeToken,
+		})
+	}
+	var guestErr *wasm.GuestError
+	if errors.As(err, &guestErr) {
+		return fmt.Errorf("%w: %w", ErrNotAuthorized, err)
+	}
+	return err
+}
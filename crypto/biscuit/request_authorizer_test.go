@@ -0,0 +1,170 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRequestAuthorizer(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := token.RevocationIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", key.Ptr()) }()
+	revocations := NewMemoryRevocationStore()
+	authorizer, err := NewRequestAuthorizer(env, `allow if user("alice"), operation("read");`, RequestOptions{
+		RootKey:     StaticRootKey(key),
+		Revocations: revocations,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := authorizer.Authorize(ctx, encoded, []Fact{operationFact(t, "read")}, ""); err != nil {
+		t.Errorf("allowed request: %v", err)
+	}
+	if err := authorizer.Authorize(ctx, encoded, []Fact{operationFact(t, "write")}, ""); !errors.Is(err, ErrNotAuthorized) {
+		t.Errorf("denied request: got %v, want ErrNotAuthorized", err)
+	}
+	if err := authorizer.Authorize(ctx, "not a token", nil, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("malformed token: got %v, want ErrInvalidToken", err)
+	}
+
+	if err := revocations.Revoke(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorizer.Authorize(ctx, encoded, []Fact{operationFact(t, "read")}, ""); !errors.Is(err, ErrRevoked) {
+		t.Errorf("revoked token: got %v, want ErrRevoked", err)
+	}
+
+	if _, err := NewRequestAuthorizer(env, `allow if`, RequestOptions{RootKey: StaticRootKey(key)}); err == nil {
+		t.Error("invalid authorizer code accepted")
+	}
+
+	restricted, err := NewRequestAuthorizer(env, `allow if true;`, RequestOptions{
+		RootKey: StaticRootKey(key),
+		Verify:  VerifyOptions{AllowedAlgorithms: []keypair.SignatureAlgorithm{keypair.Secp256r1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restricted.Authorize(ctx, encoded, nil, ""); !errors.Is(err, ErrInvalidToken) || !errors.Is(err, ErrDisallowedAlgorithm) {
+		t.Errorf("disallowed algorithm: got %v, want ErrInvalidToken and ErrDisallowedAlgorithm", err)
+	}
+}
+
+// lockingSink locks the env before recording, as a sink using the env would: it deadlocks when
+// called with the env locked.
+type lockingSink struct {
+	env     wasm.WasmEnv
+	records ChannelAuditSink
+}
+
+func (self lockingSink) Record(ctx context.Context, record AuditRecord) {
+	lock := self.env.Locker()
+	lock.Lock()
+	defer lock.Unlock()
+	self.records.Record(ctx, record)
+}
+
+func TestRequestAuthorizerAudit(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := token.RevocationIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", key.Ptr()) }()
+	revocations := NewMemoryRevocationStore()
+	sink := lockingSink{env: env, records: make(ChannelAuditSink, 1)}
+	authorizer, err := NewRequestAuthorizer(env, `allow if user("alice");`, RequestOptions{
+		RootKey:     StaticRootKey(key),
+		Revocations: revocations,
+		Audit:       sink,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorize := func(token string) (AuditRecord, error) {
+		t.Helper()
+		done := make(chan error, 1)
+		go func() { done <- authorizer.Authorize(context.Background(), token, nil, "req") }()
+		select {
+		case err := <-done:
+			return <-sink.records, err
+		case <-time.After(10 * time.Second):
+			t.Fatal("audit sink called with the env locked")
+			return AuditRecord{}, nil
+		}
+	}
+
+	if record, err := authorize(encoded); err != nil || !record.Allowed || record.RequestID != "req" || record.TokenHash == "" {
+		t.Errorf("allowed token: err = %v, record = %+v", err, record)
+	}
+	if record, err := authorize("not a token"); !errors.Is(err, ErrInvalidToken) || record.Allowed || record.Error == "" || record.RootKey == "" {
+		t.Errorf("malformed token: err = %v, record = %+v", err, record)
+	}
+
+	if err := revocations.Revoke(context.Background(), ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	record, err := authorize(encoded)
+	if !errors.Is(err, ErrRevoked) || record.Allowed || record.Error == "" || record.TokenHash == "" || len(record.RevocationIDs) != 1 {
+		t.Errorf("revoked token: err = %v, record = %+v", err, record)
+	}
+}
@@ -0,0 +1,165 @@
+package biscuit
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrRevoked is returned by CheckRevocation when one of the blocks of a token was revoked.
+var ErrRevoked = errors.New("token revoked")
+
+// RevocationStore records the revocation identifiers of revoked blocks, see Biscuit.RevocationIDs.
+type RevocationStore interface {
+	IsRevoked(ctx context.Context, id []byte) (bool, error)
+	Revoke(ctx context.Context, id []byte) error
+}
+
+// CheckRevocation returns ErrRevoked when the identifier of any block of token, not only the
+// authority block, is in store.
+func CheckRevocation(ctx context.Context, store RevocationStore, token *Biscuit) error {
+	ids, err := token.RevocationIDs()
+	if err != nil {
+		return fmt.Errorf("cannot get revocation identifiers: %w", err)
+	}
+	return CheckRevocationIDs(ctx, store, ids)
+}
+
+// CheckRevocationIDs is CheckRevocation for the identifiers Biscuit.RevocationIDs returned. It
+// makes no guest call, so the store can be queried without holding the env of the token.
+func CheckRevocationIDs(ctx context.Context, store RevocationStore, ids [][]byte) error {
+	for i, id := range ids {
+		revoked, err := store.IsRevoked(ctx, id)
+		if err != nil {
+			return fmt.Errorf("cannot check revocation of block %d: %w", i, err)
+		}
+		if revoked {
+			return fmt.Errorf("%w: block %d (%s)", ErrRevoked, i, hex.EncodeToString(id))
+		}
+	}
+	return nil
+}
+
+// MemoryRevocationStore is a RevocationStore kept in memory, safe for concurrent use.
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	revoked map[string]struct{}
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{revoked: map[string]struct{}{}}
+}
+
+func (self *MemoryRevocationStore) IsRevoked(_ context.Context, id []byte) (bool, error) {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+
+	_, revoked := self.revoked[string(id)]
+	return revoked, nil
+}
+
+func (self *MemoryRevocationStore) Revoke(_ context.Context, id []byte) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.revoked[string(id)] = struct{}{}
+	return nil
+}
+
+// CachingRevocationStore remembers the answers of a slower store for a while. A revocation made
+// through another instance is only seen once the cached answer expired. Concurrent lookups of an
+// identifier missing from the cache share a single lookup in the slower store.
+type CachingRevocationStore struct {
+	store      RevocationStore
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]cachedRevocation
+	order    []string
+	inflight map[string]*revocationLookup
+}
+
+type cachedRevocation struct {
+	revoked bool
+	expires time.Time
+}
+
+// revocationLookup is a lookup in the slower store, its result is set once done is closed.
+type revocationLookup struct {
+	done    chan struct{}
+	revoked bool
+	err     error
+}
+
+// NewCachingRevocationStore caches the answers of store for ttl, keeping at most maxEntries of
+// them, zero meaning no bound. The oldest answers are forgotten first.
+func NewCachingRevocationStore(store RevocationStore, ttl time.Duration, maxEntries int) *CachingRevocationStore {
+	return &CachingRevocationStore{
+		store:      store,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]cachedRevocation{},
+		inflight:   map[string]*revocationLookup{},
+	}
+}
+
+func (self *CachingRevocationStore) IsRevoked(ctx context.Context, id []byte) (bool, error) {
+	key := string(id)
+	self.mu.Lock()
+	if entry, ok := self.entries[key]; ok && self.now().Before(entry.expires) {
+		self.mu.Unlock()
+		return entry.revoked, nil
+	}
+	if lookup, ok := self.inflight[key]; ok {
+		self.mu.Unlock()
+		select {
+		case <-lookup.done:
+			return lookup.revoked, lookup.err
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	lookup := &revocationLookup{done: make(chan struct{})}
+	self.inflight[key] = lookup
+	self.mu.Unlock()
+
+	lookup.revoked, lookup.err = self.store.IsRevoked(ctx, id)
+	if lookup.err == nil {
+		self.remember(id, lookup.revoked)
+	}
+	self.mu.Lock()
+	delete(self.inflight, key)
+	self.mu.Unlock()
+	close(lookup.done)
+	return lookup.revoked, lookup.err
+}
+
+// Revoke revokes id in the underlying store, this instance sees it immediately.
+func (self *CachingRevocationStore) Revoke(ctx context.Context, id []byte) error {
+	if err := self.store.Revoke(ctx, id); err != nil {
+		return err
+	}
+	self.remember(id, true)
+	return nil
+}
+
+func (self *CachingRevocationStore) remember(id []byte, revoked bool) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	key := string(id)
+	if _, known := self.entries[key]; !known {
+		for self.maxEntries > 0 && len(self.order) >= self.maxEntries {
+			delete(self.entries, self.order[0])
+			self.order = self.order[1:]
+		}
+		self.order = append(self.order, key)
+	}
+	self.entries[key] = cachedRevocation{revoked: revoked, expires: self.now().Add(self.ttl)}
+}
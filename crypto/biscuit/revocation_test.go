@@ -0,0 +1,160 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckRevocationAppendedBlock(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := block.AddCode(`check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+
+	ids, err := attenuated.RevocationIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Fatalf("got %d revocation identifiers, want one per block", len(ids))
+	}
+
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	if err := CheckRevocation(ctx, store, attenuated); err != nil {
+		t.Fatalf("token reported revoked before any revocation: %v", err)
+	}
+
+	if err := store.Revoke(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckRevocation(ctx, store, attenuated); !errors.Is(err, ErrRevoked) {
+		t.Errorf("err = %v, want ErrRevoked", err)
+	}
+	if err := CheckRevocation(ctx, store, token); err != nil {
+		t.Errorf("token without the revoked block rejected: %v", err)
+	}
+}
+
+func TestCachingRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryRevocationStore()
+	cache := NewCachingRevocationStore(backend, time.Minute, 2)
+	now := time.Unix(0, 0)
+	cache.now = func() time.Time { return now }
+
+	id := []byte("block")
+	if revoked, _ := cache.IsRevoked(ctx, id); revoked {
+		t.Fatal("unknown id reported revoked")
+	}
+
+	// Revoked elsewhere: the cached answer is served until it expires.
+	if err := backend.Revoke(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := cache.IsRevoked(ctx, id); revoked {
+		t.Error("cached answer not used")
+	}
+	now = now.Add(2 * time.Minute)
+	if revoked, _ := cache.IsRevoked(ctx, id); !revoked {
+		t.Error("expired answer still used")
+	}
+
+	// Revoked through the cache: seen immediately.
+	other := []byte("other")
+	_, _ = cache.IsRevoked(ctx, other)
+	if err := cache.Revoke(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := cache.IsRevoked(ctx, other); !revoked {
+		t.Error("revocation through the cache not seen")
+	}
+
+	_, _ = cache.IsRevoked(ctx, []byte("third"))
+	if len(cache.entries) > 2 {
+		t.Errorf("cache holds %d entries, want at most 2", len(cache.entries))
+	}
+}
+
+// blockingStore counts its lookups, each waits for release to be closed.
+type blockingStore struct {
+	RevocationStore
+	lookups atomic.Int32
+	release chan struct{}
+}
+
+func (self *blockingStore) IsRevoked(ctx context.Context, id []byte) (bool, error) {
+	self.lookups.Add(1)
+	<-self.release
+	return self.RevocationStore.IsRevoked(ctx, id)
+}
+
+func TestCachingRevocationStoreSharedLookup(t *testing.T) {
+	ctx := context.Background()
+	backend := &blockingStore{RevocationStore: NewMemoryRevocationStore(), release: make(chan struct{})}
+	if err := backend.Revoke(ctx, []byte("block")); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewCachingRevocationStore(backend, time.Minute, 0)
+
+	const callers = 8
+	var wg sync.WaitGroup
+	results := make(chan bool, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			revoked, err := cache.IsRevoked(ctx, []byte("block"))
+			if err != nil {
+				t.Error(err)
+			}
+			results <- revoked
+		}()
+	}
+	for backend.lookups.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+	close(results)
+
+	if lookups := backend.lookups.Load(); lookups != 1 {
+		t.Errorf("%d lookups in the backing store, want 1", lookups)
+	}
+	for revoked := range results {
+		if !revoked {
+			t.Error("caller sharing the lookup got an unrevoked answer")
+		}
+	}
+}
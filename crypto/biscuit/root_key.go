@@ -0,0 +1,24 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"context"
+)
+
+// RootKeyProvider supplies the root public key tokens are verified against.
+type RootKeyProvider interface {
+	RootKey(ctx context.Context) (keypair.PublicKey, error)
+}
+
+type staticRootKey struct {
+	key keypair.PublicKey
+}
+
+// StaticRootKey returns a RootKeyProvider that always hands out key.
+func StaticRootKey(key keypair.PublicKey) RootKeyProvider {
+	return staticRootKey{key: key}
+}
+
+func (self staticRootKey) RootKey(ctx context.Context) (keypair.PublicKey, error) {
+	return self.key, nil
+}
@@ -0,0 +1,93 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// RootKeyCache keeps the root public keys parsed from their `<algorithm>/<hex>` form, so that a
+// verifier checking every token against the same configured root parses it once per env instead
+// of once per token. Keys are kept until Forget or Close: the cache is meant for the few roots of
+// a configuration, not for key strings coming with requests.
+//
+// Guest objects belong to the instance that created them, so the cache keeps the keys of each
+// env apart. Its methods are safe for concurrent use by goroutines having exclusive use of
+// different envs.
+type RootKeyCache struct {
+	mu   sync.Mutex
+	keys map[rootKeyEntry]keypair.PublicKey
+}
+
+type rootKeyEntry struct {
+	module api.Module
+	text   string
+}
+
+// NewRootKeyCache returns an empty cache.
+func NewRootKeyCache() *RootKeyCache {
+	return &RootKeyCache{keys: map[rootKeyEntry]keypair.PublicKey{}}
+}
+
+// PublicKey returns the key text parses to in env, parsed on first use. The key is shared: the
+// caller must not free it, the cache does in Forget and Close.
+func (self *RootKeyCache) PublicKey(env wasm.WasmEnv, text string) (keypair.PublicKey, error) {
+	entry := rootKeyEntry{module: env.Module, text: text}
+	self.mu.Lock()
+	key, ok := self.keys[entry]
+	self.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key = keypair.InvokePublicKey(env)
+	if err := key.FromString(text); err != nil {
+		return keypair.PublicKey{}, fmt.Errorf("%w: %w", ErrInvalidRootKey, err)
+	}
+
+	self.mu.Lock()
+	self.keys[entry] = key
+	self.mu.Unlock()
+	return key, nil
+}
+
+// Verify is VerifyTokenWithRootString with the root key taken from the cache.
+func (self *RootKeyCache) Verify(env wasm.WasmEnv, token string, rootKeyString string, opts VerifyOptions) (*Biscuit, error) {
+	root, err := self.PublicKey(env, rootKeyString)
+	if err != nil {
+		return nil, err
+	}
+	return verifyWithRoot(env, token, root, opts)
+}
+
+// Forget frees the keys of env, to be called before the env is torn down.
+func (self *RootKeyCache) Forget(env wasm.WasmEnv) error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var errs []error
+	for entry, key := range self.keys {
+		if entry.module == env.Module {
+			errs = append(errs, env.FreeObject("publickey", key.Ptr()))
+			delete(self.keys, entry)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close frees the keys of every env. No env may be in use.
+func (self *RootKeyCache) Close() error {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	var errs []error
+	for entry, key := range self.keys {
+		errs = append(errs, key.Env().FreeObject("publickey", key.Ptr()))
+		delete(self.keys, entry)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,109 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"testing"
+)
+
+// rootStringToken returns a token signed by a new root and the string form of the root.
+func rootStringToken(t testing.TB, env wasm.WasmEnv) (token string, rootString string) {
+	t.Helper()
+
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+	if rootString, err = public.ToString(); err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	built, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = built.Close() }()
+	if token, err = built.ToBase64(); err != nil {
+		t.Fatal(err)
+	}
+	return token, rootString
+}
+
+func TestRootKeyCache(t *testing.T) {
+	env := wasmtest.Env(t)
+	token, rootString := rootStringToken(t, env)
+
+	cache := NewRootKeyCache()
+	defer func() { _ = cache.Close() }()
+
+	first, err := cache.PublicKey(env, rootString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cache.PublicKey(env, rootString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Ptr() == 0 || first.Ptr() != second.Ptr() {
+		t.Errorf("pointers %d and %d, want the same key", first.Ptr(), second.Ptr())
+	}
+
+	for i := 0; i < 2; i++ {
+		verified, err := cache.Verify(env, token, rootString, VerifyOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = verified.Close()
+	}
+	if _, err := cache.PublicKey(env, "ed25519/zz"); !errors.Is(err, ErrInvalidRootKey) {
+		t.Errorf("malformed key: err = %v, want ErrInvalidRootKey", err)
+	}
+
+	if err := cache.Forget(env); err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := cache.PublicKey(env, rootString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := renewed.ToString(); err != nil || text != rootString {
+		t.Errorf("key parsed again = %q, %v, want %q", text, err, rootString)
+	}
+}
+
+func BenchmarkVerifyTokenWithRootString(b *testing.B) {
+	env := wasmtest.Env(b)
+	token, rootString := rootStringToken(b, env)
+
+	b.Run("uncached", func(b *testing.B) {
+		for b.Loop() {
+			verified, err := VerifyTokenWithRootString(env, token, rootString, VerifyOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = verified.Close()
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		cache := NewRootKeyCache()
+		defer func() { _ = cache.Close() }()
+		for b.Loop() {
+			verified, err := cache.Verify(env, token, rootString, VerifyOptions{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = verified.Close()
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package biscuit_test
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	"biscuit-wasm-go/crypto/biscuit/biscuittest"
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"slices"
+	"testing"
+	"testing/quick"
+)
+
+// issue builds a token holding authority in its authority block and, when not empty, a second
+// block holding attenuation.
+func issue(env wasm.WasmEnv, root *keypair.KeyPair, authority, attenuation biscuittest.FactSet) (*biscuit.Biscuit, error) {
+	builder, err := biscuit.NewBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	for _, fact := range authority {
+		if err := builder.AddFact(fact); err != nil {
+			_ = builder.Close()
+			return nil, err
+		}
+	}
+	token, err := builder.Build(root)
+	if err != nil || len(attenuation) == 0 {
+		return token, err
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := biscuit.NewBlockBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(attenuation.Code()); err != nil {
+		return nil, err
+	}
+	return token.Append(block)
+}
+
+// sameToken reports whether both tokens have the same block count, block sources and revocation
+// IDs.
+func sameToken(t *testing.T, token, decoded *biscuit.Biscuit) bool {
+	t.Helper()
+
+	count, err := token.BlockCount()
+	if err != nil {
+		t.Log(err)
+		return false
+	}
+	decodedCount, err := decoded.BlockCount()
+	if err != nil {
+		t.Log(err)
+		return false
+	}
+	if decodedCount != count {
+		t.Logf("%d blocks, want %d", decodedCount, count)
+		return false
+	}
+
+	ids, err := token.RevocationIDs()
+	if err != nil {
+		t.Log(err)
+		return false
+	}
+	decodedIDs, err := decoded.RevocationIDs()
+	if err != nil {
+		t.Log(err)
+		return false
+	}
+	if !slices.EqualFunc(ids, decodedIDs, bytes.Equal) {
+		t.Logf("revocation IDs %x, want %x", decodedIDs, ids)
+		return false
+	}
+
+	for i := range ids {
+		source, err := token.BlockSource(i)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		decodedSource, err := decoded.BlockSource(i)
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if decodedSource != source {
+			t.Logf("block %d is %q, want %q", i, decodedSource, source)
+			return false
+		}
+	}
+	return true
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	root := keypair.Invoke(env)
+	if err := root.New(keypair.Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forms := map[string]func(token *biscuit.Biscuit) (*biscuit.Biscuit, error){
+		"base64": func(token *biscuit.Biscuit) (*biscuit.Biscuit, error) {
+			encoded, err := token.ToBase64()
+			if err != nil {
+				return nil, err
+			}
+			return biscuit.FromBase64(env, encoded, public)
+		},
+		"bytes": func(token *biscuit.Biscuit) (*biscuit.Biscuit, error) {
+			data, err := token.ToBytes()
+			if err != nil {
+				return nil, err
+			}
+			return biscuit.FromBytes(env, data, public)
+		},
+	}
+
+	for form, roundTrip := range forms {
+		t.Run(form, func(t *testing.T) {
+			property := func(authority, attenuation biscuittest.FactSet) bool {
+				token, err := issue(env, root, authority, attenuation)
+				if err != nil {
+					t.Logf("%q then %q: %v", authority.Code(), attenuation.Code(), err)
+					return false
+				}
+				defer func() { _ = token.Close() }()
+
+				decoded, err := roundTrip(token)
+				if err != nil {
+					t.Log(err)
+					return false
+				}
+				defer func() { _ = decoded.Close() }()
+				return sameToken(t, token, decoded)
+			}
+			if err := quick.Check(property, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
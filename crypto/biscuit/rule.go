@@ -0,0 +1,49 @@
+package biscuit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule is a datalog rule rendered from Go values, such as `right($u, "read") <- user($u)`, to be
+// added with AddCode.
+type Rule struct {
+	source string
+}
+
+// NewRule builds the rule deriving head from the facts of body. Heads and bodies reference
+// variables with VarTerm; every variable of head must appear in body, which datalog requires.
+func NewRule(head Fact, body ...Fact) (Rule, error) {
+	if err := head.validate(); err != nil {
+		return Rule{}, fmt.Errorf("invalid rule head: %w", err)
+	}
+	if len(body) == 0 {
+		return Rule{}, fmt.Errorf("rule %s has no body", head.name)
+	}
+
+	bound := map[string]bool{}
+	rendered := make([]string, len(body))
+	for i, predicate := range body {
+		if err := predicate.validate(); err != nil {
+			return Rule{}, fmt.Errorf("invalid rule body: %w", err)
+		}
+		for _, term := range predicate.terms {
+			if term.kind == TermVariable {
+				bound[term.str] = true
+			}
+		}
+		rendered[i] = predicate.String()
+	}
+	for _, term := range head.terms {
+		if term.kind == TermVariable && !bound[term.str] {
+			return Rule{}, fmt.Errorf("rule %s: head variable $%s does not appear in the body", head.name, term.str)
+		}
+	}
+
+	return Rule{source: head.String() + " <- " + strings.Join(rendered, ", ")}, nil
+}
+
+// String renders the rule as datalog source, without the trailing semicolon.
+func (self Rule) String() string {
+	return self.source
+}
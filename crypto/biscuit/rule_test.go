@@ -0,0 +1,100 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"testing"
+)
+
+func TestNewRule(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	head, err := NewFact("right", VarTerm("u"), StringTerm("read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := NewFact("user", VarTerm("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := NewRule(head, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `right($u, "read") <- user($u)`; rule.String() != want {
+		t.Errorf("rule = %s, want %s", rule, want)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	// The rule parses, and derives the right the policy asks for.
+	if !authorize(t, env, token, rule.String()+`; allow if right("alice", "read");`) {
+		t.Error("rule did not derive right(\"alice\", \"read\")")
+	}
+	if authorize(t, env, token, rule.String()+`; allow if right("bob", "read");`) {
+		t.Error("rule derived a right for a user the token does not hold")
+	}
+}
+
+func TestNewRuleRejectsInvalidRules(t *testing.T) {
+	userU, err := NewFact("user", VarTerm("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rightV, err := NewFact("right", VarTerm("v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRule(rightV, userU); err == nil {
+		t.Error("rule with an unbound head variable built")
+	}
+	if _, err := NewRule(userU); err == nil {
+		t.Error("rule without body built")
+	}
+	if _, err := NewRule(Fact{}, userU); err == nil {
+		t.Error("rule with an invalid head built")
+	}
+
+	for _, name := range []string{"", "u-1", "u v", "$u", `u")`} {
+		if _, err := NewFact("user", VarTerm(name)); err == nil {
+			t.Errorf("variable %q accepted", name)
+		}
+	}
+}
+
+func TestAddFactRejectsVariables(t *testing.T) {
+	env := wasmtest.Env(t)
+	userU, err := NewFact("user", VarTerm("u"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddFact(userU); err == nil {
+		t.Error("fact holding a variable added")
+	}
+	if err := builder.AddFacts([]Fact{userU}); err == nil {
+		t.Error("batch holding a variable added")
+	}
+
+	// Rejected before reaching the guest, the builder is still usable.
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+}
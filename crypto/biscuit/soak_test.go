@@ -0,0 +1,176 @@
+//go:build soak
+
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"flag"
+	"fmt"
+	"testing"
+)
+
+// The soak test runs with `go test -tags soak -run Soak ./crypto/biscuit`, flags after the
+// package, e.g. `-soak.iterations 20000`.
+var (
+	soakIterations = flag.Int("soak.iterations", 2000, "iterations of the soak workload")
+	soakSamples    = flag.Int("soak.samples", 20, "number of resource samples taken during the soak")
+	soakPageRate   = flag.Int("soak.pagerate", 300, "guest memory pages per 1000 iterations the soak tolerates growing by after warm-up")
+)
+
+// Guest memory grows by about 240 pages per 1000 iterations even though every guest allocation of
+// the workload is freed: wee_alloc, the allocator of the guest, fragments and never shrinks the
+// memory. A pool built with wasm.WithTotalMemoryLimit recycles instances to bound it, the soak only
+// catches a rate higher than the fragmentation explains.
+
+// soakMetric is one of the resources sampled by the soak test, with the growth tolerated once the
+// workload warmed up.
+type soakMetric struct {
+	name      string
+	value     func(wasm.Stats) int
+	tolerance int
+}
+
+var soakMetrics = []soakMetric{
+	{"memory pages", func(s wasm.Stats) int { return int(s.MemoryPages) }, 0},
+	{"outstanding allocations", func(s wasm.Stats) int { return s.Allocations }, 0},
+	{"live externrefs", func(s wasm.Stats) int { return int(s.Externrefs) }, 0},
+	{"externref table", func(s wasm.Stats) int { return int(s.ExternrefTable) }, 0},
+}
+
+func TestSoak(t *testing.T) {
+	wasmtest.Env(t)
+	fresh, err := wasm.InitWasm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := fresh.WithAllocationTracking()
+
+	every := max(*soakIterations / *soakSamples, 1)
+	var samples []wasm.Stats
+	for i := range *soakIterations {
+		if err := soakIteration(env, i); err != nil {
+			t.Fatalf("iteration %d: %v", i, err)
+		}
+		if i%every == every-1 {
+			samples = append(samples, env.Stats())
+		}
+	}
+	if len(samples) < 4 {
+		t.Fatalf("%d samples, run more iterations", len(samples))
+	}
+
+	// The first quarter of the run warms the allocator and the caches up.
+	warm := samples[len(samples)/4]
+	soakMetrics[0].tolerance = *soakPageRate * (len(samples) - 1 - len(samples)/4) * every / 1000
+	last := samples[len(samples)-1]
+	for _, metric := range soakMetrics {
+		peak := 0
+		for _, sample := range samples {
+			peak = max(peak, metric.value(sample))
+		}
+		growth := metric.value(last) - metric.value(warm)
+		t.Logf("%-24s first %6d  warm %6d  last %6d  peak %6d  growth %+d (tolerance %d)", metric.name,
+			metric.value(samples[0]), metric.value(warm), metric.value(last), peak, growth, metric.tolerance)
+		if growth > metric.tolerance {
+			t.Errorf("%s grew by %d after warm-up, tolerance %d", metric.name, growth, metric.tolerance)
+		}
+	}
+}
+
+// soakIteration runs the life of a token: a root key is generated, a token minted, serialized,
+// parsed back, attenuated and authorized, and the authorizer world read. Every other iteration is
+// denied, so that error paths are soaked too.
+func soakIteration(env wasm.WasmEnv, i int) error {
+	root := keypair.Invoke(env)
+	if err := root.New(keypair.Ed25519); err != nil {
+		return err
+	}
+	defer func() { _ = root.Close() }()
+	public, err := root.GetPublicKey()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = env.FreeObject("publickey", public.Ptr()) }()
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = builder.Close() }()
+	user, err := NewFact("user", StringTerm(fmt.Sprintf("user-%d", i)))
+	if err != nil {
+		return err
+	}
+	if err := builder.AddFact(user); err != nil {
+		return err
+	}
+	if err := builder.AddCode(`right("file1", "read"); check if operation($op), ["read", "write"].contains($op);`); err != nil {
+		return err
+	}
+	minted, err := builder.Build(root)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = minted.Close() }()
+
+	encoded, err := minted.ToBase64()
+	if err != nil {
+		return err
+	}
+	token, err := FromBase64(env, encoded, public)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = block.Close() }()
+	if err := block.AddCode(`check if resource("file1");`); err != nil {
+		return err
+	}
+	attenuated, err := token.Append(block)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = attenuated.Close() }()
+	if _, err := attenuated.RevocationIDs(); err != nil {
+		return err
+	}
+
+	authorizerBuilder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = authorizerBuilder.Close() }()
+	operation := "read"
+	if i%2 == 1 {
+		operation = "delete"
+	}
+	fact, err := NewFact("operation", StringTerm(operation))
+	if err != nil {
+		return err
+	}
+	if err := authorizerBuilder.AddFact(fact); err != nil {
+		return err
+	}
+	if err := authorizerBuilder.AddCode(`resource("file1"); allow if right($r, $op), resource($r), operation($op);`); err != nil {
+		return err
+	}
+	authorizer, err := authorizerBuilder.Build(attenuated)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	decision, err := authorizer.Decide()
+	if decision.Allowed != (i%2 == 0) {
+		return fmt.Errorf("decision %+v for %s: %v", decision, operation, err)
+	}
+	_, err = authorizer.Facts()
+	return err
+}
@@ -0,0 +1,84 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"sync/atomic"
+)
+
+// OutcomeStats counts the outcomes of token verifications since the process started. Operators
+// poll Stats and export the counters to their metrics system.
+type OutcomeStats struct {
+	// TokensParsed counts the tokens FromBase64 and FromBytes parsed and verified.
+	TokensParsed uint64
+	// SignatureFailures counts the tokens rejected because a signature does not verify, against
+	// the root key or within the token.
+	SignatureFailures uint64
+	// Allows counts the authorizations where an allow policy matched and every check passed.
+	Allows uint64
+	// Denies counts the authorizations that matched a deny policy, failed a check or matched no
+	// policy.
+	Denies uint64
+	// Errors counts the parsings and authorizations that failed otherwise, e.g. on a malformed
+	// token or a run limit.
+	Errors uint64
+}
+
+// outcomes holds the counters behind Stats, updated with atomics so recording an outcome never
+// takes a lock.
+var outcomes struct {
+	tokensParsed      atomic.Uint64
+	signatureFailures atomic.Uint64
+	allows            atomic.Uint64
+	denies            atomic.Uint64
+	errors            atomic.Uint64
+}
+
+// Stats returns a snapshot of the outcome counters. Counters are read one by one: a snapshot taken
+// while tokens are verified may count an outcome in one field and not yet in another.
+func Stats() OutcomeStats {
+	return OutcomeStats{
+		TokensParsed:      outcomes.tokensParsed.Load(),
+		SignatureFailures: outcomes.signatureFailures.Load(),
+		Allows:            outcomes.allows.Load(),
+		Denies:            outcomes.denies.Load(),
+		Errors:            outcomes.errors.Load(),
+	}
+}
+
+// recordParse counts the outcome of parsing a token.
+func recordParse(err error) {
+	switch {
+	case err == nil:
+		outcomes.tokensParsed.Add(1)
+	case isSignatureError(err):
+		outcomes.signatureFailures.Add(1)
+	default:
+		outcomes.errors.Add(1)
+	}
+}
+
+// recordAuthorization counts the outcome of Authorize.
+func recordAuthorization(err error) {
+	switch {
+	case err == nil:
+		outcomes.allows.Add(1)
+	case failedLogic(err) != nil:
+		outcomes.denies.Add(1)
+	default:
+		outcomes.errors.Add(1)
+	}
+}
+
+// isSignatureError reports whether err is the guest rejecting a signature, a `Format.Signature`
+// error.
+func isSignatureError(err error) bool {
+	var guestErr *wasm.GuestError
+	if !errors.As(err, &guestErr) {
+		return false
+	}
+	details, _ := guestErr.Details.(map[string]any)
+	format, _ := details["Format"].(map[string]any)
+	_, ok := format["Signature"]
+	return ok
+}
@@ -0,0 +1,73 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"testing"
+)
+
+func TestStatsCountsOutcomes(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newRoot(t, env)
+	otherPublic, err := other.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(code string) string {
+		t.Helper()
+		builder, err := NewBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+		token, err := builder.Build(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = token.Close() }()
+		encoded, err := token.ToBase64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	alice, bob := encode(`user("alice");`), encode(`user("bob");`)
+
+	before := Stats()
+
+	for _, encoded := range []string{alice, alice, bob} {
+		token, err := FromBase64(env, encoded, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		authorize(t, env, token, `allow if user("alice");`)
+		_ = token.Close()
+	}
+	if _, err := FromBase64(env, alice, otherPublic); err == nil {
+		t.Fatal("token verified against another root")
+	}
+	if _, err := FromBase64(env, "not a token", public); err == nil {
+		t.Fatal("malformed token parsed")
+	}
+
+	after := Stats()
+	got := OutcomeStats{
+		TokensParsed:      after.TokensParsed - before.TokensParsed,
+		SignatureFailures: after.SignatureFailures - before.SignatureFailures,
+		Allows:            after.Allows - before.Allows,
+		Denies:            after.Denies - before.Denies,
+		Errors:            after.Errors - before.Errors,
+	}
+	want := OutcomeStats{TokensParsed: 3, SignatureFailures: 1, Allows: 2, Denies: 1, Errors: 1}
+	if got != want {
+		t.Errorf("Stats() moved by %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,136 @@
+package biscuit
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TermKind int
+
+const (
+	TermString TermKind = iota
+	TermInteger
+	TermBool
+	TermDate
+	TermBytes
+	// TermVariable is a variable such as `$user`, for the heads and bodies of rules.
+	TermVariable
+)
+
+// Term is a single datalog value. Terms render themselves into datalog source with the
+// quoting biscuit expects, so values coming from untrusted input (paths, headers, user names)
+// can never change the shape of the statement they end up in.
+type Term struct {
+	kind    TermKind
+	str     string
+	integer int64
+	boolean bool
+	date    time.Time
+	bytes   []byte
+}
+
+func StringTerm(value string) Term {
+	return Term{kind: TermString, str: value}
+}
+
+func IntegerTerm(value int64) Term {
+	return Term{kind: TermInteger, integer: value}
+}
+
+func BoolTerm(value bool) Term {
+	return Term{kind: TermBool, boolean: value}
+}
+
+// DateTerm keeps second precision, the resolution of biscuit dates.
+func DateTerm(value time.Time) Term {
+	return Term{kind: TermDate, date: value.UTC().Truncate(time.Second)}
+}
+
+func BytesTerm(value []byte) Term {
+	return Term{kind: TermBytes, bytes: append([]byte(nil), value...)}
+}
+
+// VarTerm returns the variable `$name`, rendered unquoted. Facts holding variables are patterns
+// for rules, see NewRule, they cannot be added as facts. The name must be made of letters, digits,
+// underscores or colons, which NewFact checks.
+func VarTerm(name string) Term {
+	return Term{kind: TermVariable, str: name}
+}
+
+func (self Term) Kind() TermKind {
+	return self.kind
+}
+
+// AsTime returns the value of a date term, or the zero time for any other kind.
+func (self Term) AsTime() time.Time {
+	if self.kind != TermDate {
+		return time.Time{}
+	}
+	return self.date
+}
+
+// AsUnix returns the value of a date term as Unix seconds, or 0 for any other kind.
+func (self Term) AsUnix() int64 {
+	if self.kind != TermDate {
+		return 0
+	}
+	return self.date.Unix()
+}
+
+// String renders the term as datalog source.
+func (self Term) String() string {
+	switch self.kind {
+	case TermInteger:
+		return strconv.FormatInt(self.integer, 10)
+	case TermBool:
+		return strconv.FormatBool(self.boolean)
+	case TermDate:
+		return self.date.Format(time.RFC3339)
+	case TermBytes:
+		return "hex:" + hex.EncodeToString(self.bytes)
+	case TermVariable:
+		return "$" + self.str
+	default:
+		return quoteString(self.str)
+	}
+}
+
+// isVariableName reports whether name is usable as a datalog variable name: letters, digits,
+// underscores or colons.
+func isVariableName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// quoteString renders a datalog string literal. It is the only place strings are escaped: biscuit
+// reads `\"`, `\\` and `\n` as escapes and every other character, tabs and unicode included, as
+// itself, so only quotes, backslashes and newlines are escaped.
+func quoteString(value string) string {
+	var builder strings.Builder
+	builder.Grow(len(value) + 2)
+	builder.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"', '\\':
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case '\n':
+			builder.WriteString(`\n`)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
@@ -0,0 +1,212 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateTermAsTimeAndUnix(t *testing.T) {
+	at := time.Date(2024, time.March, 1, 12, 30, 45, 999_000_000, time.FixedZone("CET", 3600))
+	term := DateTerm(at)
+
+	want := time.Date(2024, time.March, 1, 11, 30, 45, 0, time.UTC)
+	if got := term.AsTime(); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("AsTime() = %v, want %v", got, want)
+	}
+	if got := term.AsUnix(); got != want.Unix() {
+		t.Errorf("AsUnix() = %d, want %d", got, want.Unix())
+	}
+	if term.AsTime().Unix() != term.AsUnix() {
+		t.Error("AsTime() and AsUnix() disagree")
+	}
+	if got := term.String(); got != "2024-03-01T11:30:45Z" {
+		t.Errorf("String() = %s", got)
+	}
+
+	if got := IntegerTerm(42).AsUnix(); got != 0 {
+		t.Errorf("AsUnix() on an integer term = %d, want 0", got)
+	}
+	if got := StringTerm("x").AsTime(); !got.IsZero() {
+		t.Errorf("AsTime() on a string term = %v, want zero", got)
+	}
+}
+
+func TestAuthorityFacts(t *testing.T) {
+	env := wasmtest.Env(t)
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	code := `role("alice", "admin"); role("bob", "ops", 3); user("alice");
+		limits(-3, true, 2026-01-01T00:00:00Z, hex:00ff); role("carol", "say \"hi\"");`
+	if err := builder.AddCode(code); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(newRoot(t, env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	facts, err := token.AuthorityFacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roles []string
+	arities := map[string]int{}
+	for _, fact := range facts {
+		if fact.Name() == "role" {
+			roles = append(roles, fact.Term(0).String())
+			arities[fact.Term(0).String()] = fact.Arity()
+		}
+	}
+	if want := []string{`"alice"`, `"bob"`, `"carol"`}; strings.Join(roles, " ") != strings.Join(want, " ") {
+		t.Errorf("roles = %v, want %v", roles, want)
+	}
+	if arities[`"alice"`] != 2 || arities[`"bob"`] != 3 || arities[`"carol"`] != 2 {
+		t.Errorf("arities = %v", arities)
+	}
+
+	rendered := make([]string, len(facts))
+	for i, fact := range facts {
+		rendered[i] = fact.String()
+	}
+	want := []string{
+		`role("alice", "admin")`, `role("bob", "ops", 3)`, `user("alice")`,
+		`limits(-3, true, 2026-01-01T00:00:00Z, hex:00ff)`, `role("carol", "say \"hi\"")`,
+	}
+	if strings.Join(rendered, "\n") != strings.Join(want, "\n") {
+		t.Errorf("facts =\n%s\nwant\n%s", strings.Join(rendered, "\n"), strings.Join(want, "\n"))
+	}
+
+	setBuilder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = setBuilder.Close() }()
+	if err := setBuilder.AddCode(`allowed({1, 2});`); err != nil {
+		t.Fatal(err)
+	}
+	withSet, err := setBuilder.Build(newRoot(t, env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = withSet.Close() }()
+	if _, err := withSet.AuthorityFacts(); err == nil {
+		t.Error("fact holding a set decoded")
+	}
+}
+
+func TestStringTermRoundTrip(t *testing.T) {
+	env := wasmtest.Env(t)
+	values := []string{"line1\nline2", "a\tb", "smile 😀", `back\slash`, `\n`, "trailing\n"}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	var want []string
+	for _, value := range values {
+		fact, err := NewFact("user", StringTerm(value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.AddFact(fact); err != nil {
+			t.Fatalf("%q: %v", value, err)
+		}
+		want = append(want, fact.String())
+	}
+	root := newRoot(t, env)
+	built, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = built.Close() }()
+
+	encoded, err := built.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootPublicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := FromBase64(env, encoded, rootPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	facts, err := token.AuthorityFacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, fact := range facts {
+		if fact.Term(0).str != values[i] {
+			t.Errorf("decoded %q, want %q", fact.Term(0).str, values[i])
+		}
+	}
+
+	// Each value matches itself as written in a check, and nothing else.
+	var checks strings.Builder
+	for _, value := range values {
+		checks.WriteString("check if user(" + StringTerm(value).String() + ");\n")
+	}
+	checks.WriteString("allow if true;")
+	if !authorize(t, env, token, checks.String()) {
+		t.Error("checks on the decoded values failed")
+	}
+	if authorize(t, env, token, `check if user("line1\\nline2"); allow if true;`) {
+		t.Error("escaped backslash matched a newline")
+	}
+
+	// The world printed by the guest reads back into the same facts.
+	authorizerBuilder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := authorizerBuilder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+	exported, err := authorizer.ExportCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportCode(env, exported)
+	if err != nil {
+		t.Fatalf("exported world does not parse: %v\n%s", err, exported)
+	}
+	defer func() { _ = imported.Close() }()
+	got, err := imported.Facts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(want)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("facts after export and import:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNewFactRejectsUnwritableTerms(t *testing.T) {
+	for name, terms := range map[string][]Term{
+		"no terms":          nil,
+		"empty bytes":       {BytesTerm(nil)},
+		"date before epoch": {DateTerm(time.Unix(-1, 0))},
+		"five digit year":   {DateTerm(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC))},
+	} {
+		if _, err := NewFact("fact", terms...); err == nil {
+			t.Errorf("%s: NewFact succeeded", name)
+		}
+	}
+
+	if _, err := NewFact("fact", DateTerm(time.Unix(0, 0)), DateTerm(time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC))); err != nil {
+		t.Errorf("bounds: %v", err)
+	}
+}
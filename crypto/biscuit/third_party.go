@@ -0,0 +1,285 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrThirdPartyMismatch is returned when a third-party request or the token it produced does not
+// belong to the token it is used with.
+var ErrThirdPartyMismatch = errors.New("third party exchange does not match the token")
+
+// ThirdPartyRequest is what a token holder sends to a third party so it can sign a block for
+// that token.
+type ThirdPartyRequest struct {
+	env wasm.WasmEnv
+	ptr uint64
+}
+
+// ThirdPartyBlock is a block signed by a third party, ready to be appended to the token it was
+// requested for.
+type ThirdPartyBlock struct {
+	env wasm.WasmEnv
+	ptr uint64
+}
+
+// ThirdPartyRequest creates a request for a block signed by a third party.
+func (self *Biscuit) ThirdPartyRequest() (*ThirdPartyRequest, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("biscuit not initialized")
+	}
+
+	ptr, err := self.env.CallFallible("biscuit_getThirdPartyRequest", self.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThirdPartyRequest{env: self.env, ptr: ptr}, nil
+}
+
+// ThirdPartyRequestFromBase64 parses a request produced by ThirdPartyRequest.ToBase64.
+func ThirdPartyRequestFromBase64(env wasm.WasmEnv, request string) (*ThirdPartyRequest, error) {
+	if err := checkBase64("thirdpartyrequest_fromBase64", request, 1); err != nil {
+		return nil, err
+	}
+
+	var ptr uint64
+	err := env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(request)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		ptr, err = env.CallFallible("thirdpartyrequest_fromBase64", strPtr, strLen)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThirdPartyRequest{env: env, ptr: ptr}, nil
+}
+
+func (self *ThirdPartyRequest) ToBase64() (string, error) {
+	if self.ptr == 0 {
+		return "", fmt.Errorf("third party request not initialized")
+	}
+	return self.env.CallFallibleString("thirdpartyrequest_toBase64", self.ptr)
+}
+
+// CreateBlock signs block with the private key of signer. The request is consumed by the guest
+// and cannot be used afterwards, whether CreateBlock succeeds or not; the block builder is only
+// borrowed and still has to be closed.
+func (self *ThirdPartyRequest) CreateBlock(signer *keypair.KeyPair, block *BlockBuilder) (*ThirdPartyBlock, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("third party request not initialized")
+	}
+	if err := block.usable(); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := signer.GetPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = self.env.FreeObject("privatekey", privateKey.Ptr()) }()
+
+	requestPtr := self.ptr
+	self.ptr = 0
+
+	ptr, err := self.env.CallFallible("thirdpartyrequest_createBlock", requestPtr, privateKey.Ptr(), block.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThirdPartyBlock{env: self.env, ptr: ptr}, nil
+}
+
+// Close frees a request that was not consumed.
+func (self *ThirdPartyRequest) Close() error {
+	err := self.env.FreeObject("thirdpartyrequest", self.ptr)
+	self.ptr = 0
+	return err
+}
+
+// AppendThirdPartyBlock returns a new token made of the receiver followed by block, which must
+// have been signed by the private key matching externalKey. The guest only borrows block and
+// externalKey: the block still has to be closed.
+func (self *Biscuit) AppendThirdPartyBlock(externalKey keypair.PublicKey, block *ThirdPartyBlock) (*Biscuit, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("biscuit not initialized")
+	}
+	if externalKey.Ptr() == 0 {
+		return nil, fmt.Errorf("external public key not initialized")
+	}
+	if block.ptr == 0 {
+		return nil, fmt.Errorf("third party block not initialized")
+	}
+
+	ptr, err := self.env.CallFallible("biscuit_appendThirdPartyBlock", self.ptr, externalKey.Ptr(), block.ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Biscuit{env: self.env, ptr: ptr}, nil
+}
+
+// Close frees the block.
+func (self *ThirdPartyBlock) Close() error {
+	err := self.env.FreeObject("thirdpartyblock", self.ptr)
+	self.ptr = 0
+	return err
+}
+
+// HasThirdPartyBlocks reports whether any block of the token was signed by a third party, in
+// which case the authorizer needs to trust the public key of that party.
+func (self *Biscuit) HasThirdPartyBlocks() (bool, error) {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return false, err
+	}
+
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return false, fmt.Errorf("cannot decode token: %w", err)
+	}
+
+	signatures, err := externalSignatures(data)
+	if err != nil {
+		return false, err
+	}
+	for _, signature := range signatures {
+		if signature != nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ThirdPartyInfo describes a block of a token signed by a third party.
+type ThirdPartyInfo struct {
+	// Block is the index of the block, 0 being the authority block.
+	Block int
+	// Signer is the public key of the third party, which the caller frees.
+	Signer keypair.PublicKey
+}
+
+// ThirdPartyBlocks returns the blocks of the token signed by a third party, in order, with the
+// key of their signer. Unlike TrustChainStrings, it leaves out the keys the blocks are chained with.
+func (self *Biscuit) ThirdPartyBlocks() ([]ThirdPartyInfo, error) {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return nil, err
+	}
+	data, err := decodeToken(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode token: %w", err)
+	}
+	signed, err := signedBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []ThirdPartyInfo
+	free := func() {
+		for _, info := range infos {
+			_ = self.env.FreeObject("publickey", info.Signer.Ptr())
+		}
+	}
+	for i, block := range signed {
+		parsed, err := parseWireBlock(block)
+		if err != nil {
+			free()
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		if parsed.externalKey == nil {
+			continue
+		}
+
+		algorithm, raw, err := parsePublicKeyMessage(parsed.externalKey)
+		if err != nil {
+			free()
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		signer := keypair.InvokePublicKey(self.env)
+		if err := signer.FromBytes(algorithm, raw); err != nil {
+			free()
+			return nil, fmt.Errorf("block %d: signer key: %w", i, err)
+		}
+		infos = append(infos, ThirdPartyInfo{Block: i, Signer: signer})
+	}
+	return infos, nil
+}
+
+// CheckThirdPartyRequest verifies that request, a base64 ThirdPartyRequest, was created from
+// token, a base64 token: a block signed for another token would be rejected when appended.
+// Signatures are NOT verified.
+func CheckThirdPartyRequest(token string, request string) error {
+	data, err := decodeToken(token)
+	if err != nil {
+		return fmt.Errorf("cannot decode token: %w", err)
+	}
+	requestData, err := decodeToken(request)
+	if err != nil {
+		return fmt.Errorf("cannot decode third party request: %w", err)
+	}
+
+	expected, err := lastBlockSignature(data)
+	if err != nil {
+		return err
+	}
+	previous, err := bytesField(requestData, requestPreviousSignatureField)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(previous, expected) {
+		return fmt.Errorf("%w: the request was created from another token", ErrThirdPartyMismatch)
+	}
+	return nil
+}
+
+// CheckThirdPartyAppend verifies that appended, a base64 token, is token followed by exactly one
+// block signed by a third party. Signatures are NOT verified, appended must still be parsed with
+// FromBase64.
+func CheckThirdPartyAppend(token string, appended string) error {
+	data, err := decodeToken(token)
+	if err != nil {
+		return fmt.Errorf("cannot decode token: %w", err)
+	}
+	appendedData, err := decodeToken(appended)
+	if err != nil {
+		return fmt.Errorf("cannot decode appended token: %w", err)
+	}
+
+	base, err := signedBlocks(data)
+	if err != nil {
+		return err
+	}
+	extended, err := signedBlocks(appendedData)
+	if err != nil {
+		return err
+	}
+
+	if len(extended) != len(base)+1 {
+		return fmt.Errorf("%w: expected %d blocks, found %d", ErrThirdPartyMismatch, len(base)+1, len(extended))
+	}
+	for i := range base {
+		if !bytes.Equal(base[i], extended[i]) {
+			return fmt.Errorf("%w: block %d differs", ErrThirdPartyMismatch, i)
+		}
+	}
+
+	signatures, err := externalSignatures(appendedData)
+	if err != nil {
+		return err
+	}
+	if signatures[len(signatures)-1] == nil {
+		return fmt.Errorf("%w: the last block is not signed by a third party", ErrThirdPartyMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"testing"
+)
+
+func TestHasThirdPartyBlocks(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	if has, err := token.HasThirdPartyBlocks(); err != nil || has {
+		t.Fatalf("HasThirdPartyBlocks() = %v, %v on a root-signed token", has, err)
+	}
+
+	request, err := token.ThirdPartyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := block.AddCode(`group("admin");`); err != nil {
+		t.Fatal(err)
+	}
+
+	external := newRoot(t, env)
+	signed, err := request.CreateBlock(external, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	externalKey, err := external.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	appended, err := token.AppendThirdPartyBlock(externalKey, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	if has, err := appended.HasThirdPartyBlocks(); err != nil || !has {
+		t.Fatalf("HasThirdPartyBlocks() = %v, %v after appending a third-party block", has, err)
+	}
+}
+
+func TestWithScopeKeys(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	request, err := token.ThirdPartyRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = request.Close() }()
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = block.Close() }()
+	// The rule of the third-party block derives its fact from the authority block, which rules of
+	// third-party blocks only trust when told to.
+	if err := block.AddCode(`admin($user) <- user($user) trusting authority;`); err != nil {
+		t.Fatal(err)
+	}
+	external := newRoot(t, env)
+	signed, err := request.CreateBlock(external, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	externalKey, err := external.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", externalKey.Ptr()) }()
+	appended, err := token.AppendThirdPartyBlock(externalKey, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	otherKey, err := newRoot(t, env).GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", otherKey.Ptr()) }()
+
+	for _, tc := range []struct {
+		name    string
+		signer  keypair.PublicKey
+		allowed bool
+	}{
+		{"signer trusted", externalKey, true},
+		{"other key trusted", otherKey, false},
+	} {
+		authorizerBuilder, err := NewAuthorizerBuilder(env, WithScopeKeys(map[string]keypair.PublicKey{"signer": tc.signer}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizerBuilder.Close() }()
+		// The derived fact comes from both blocks, the policy has to trust both.
+		if err := authorizerBuilder.AddCode(`allow if admin("alice") trusting authority, {signer};`); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := authorizerBuilder.Build(appended)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+
+		if _, err := authorizer.Authorize(); (err == nil) != tc.allowed {
+			t.Errorf("%s: err = %v, want allowed %t", tc.name, err, tc.allowed)
+		}
+	}
+
+	// Without a scope, the authorizer does not trust the third-party block at all.
+	if authorize(t, env, appended, `allow if admin("alice");`) {
+		t.Error("fact of the third-party block trusted by default")
+	}
+
+	if _, err := NewAuthorizerBuilder(env, WithScopeKeys(map[string]keypair.PublicKey{"not a name": externalKey})); err == nil {
+		t.Error("invalid scope name accepted")
+	}
+}
+
+func TestThirdPartyBlocks(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(`user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	current := token
+	var want []string
+	for _, code := range []string{`group("admin");`, `group("billing");`} {
+		request, err := current.ThirdPartyRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := NewBlockBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = block.Close() }()
+		if err := block.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+
+		external := newRoot(t, env)
+		signed, err := request.CreateBlock(external, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = signed.Close() }()
+		externalKey, err := external.GetPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = env.FreeObject("publickey", externalKey.Ptr()) }()
+		text, err := externalKey.ToString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, text)
+
+		appended, err := current.AppendThirdPartyBlock(externalKey, signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = appended.Close() }()
+		current = appended
+	}
+
+	infos, err := current.ThirdPartyBlocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("ThirdPartyBlocks returned %d blocks, want 2", len(infos))
+	}
+	for i, info := range infos {
+		defer func() { _ = env.FreeObject("publickey", info.Signer.Ptr()) }()
+		signer, err := info.Signer.ToString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Block != i+1 || signer != want[i] {
+			t.Errorf("third-party block %d = block %d signed by %s, want block %d signed by %s", i, info.Block, signer, i+1, want[i])
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrTokenTooLarge is returned by Issuer.Issue when a token is longer than IssuerConfig.MaxSize.
+var ErrTokenTooLarge = errors.New("token too large")
+
+// IssuerConfig configures an Issuer.
+type IssuerConfig struct {
+	// Root signs the tokens. It must belong to the env given to NewIssuer.
+	Root *keypair.KeyPair
+	// Template is the datalog of the authority block. `{name}` outside strings and comments is a
+	// parameter, replaced by the value Issue is given for it.
+	Template string
+	// TTL is the lifetime of the tokens, enforced by a `time` check. Zero means no expiry.
+	TTL time.Duration
+	// Now is the clock expirations are computed from, time.Now when nil.
+	Now func() time.Time
+	// MaxSize is the maximum length of a base64 token. Zero means no limit.
+	MaxSize int
+	// RootKeyID is recorded in the tokens when not nil, see Builder.SetRootKeyID.
+	RootKeyID *uint32
+}
+
+// Issuer mints tokens from a template, for services issuing the same kind of token to many users.
+// It is safe for concurrent use: Issue locks the Locker of its env, so it must not be called with
+// the env locked.
+type Issuer struct {
+	env        wasm.WasmEnv
+	config     IssuerConfig
+	parameters map[string]bool
+}
+
+// NewIssuer validates the template of config in env.
+func NewIssuer(env wasm.WasmEnv, config IssuerConfig) (*Issuer, error) {
+	if config.Root == nil {
+		return nil, fmt.Errorf("issuer has no root key")
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	issuer := &Issuer{env: env, config: config, parameters: map[string]bool{}}
+	placeholder := StringTerm("").String()
+	code, err := expandTemplate(config.Template, func(name string) (string, error) {
+		issuer.parameters[name] = true
+		return placeholder, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(code); err != nil {
+		return nil, fmt.Errorf("invalid token template: %w", err)
+	}
+	return issuer, nil
+}
+
+// Issue mints a base64 token from the template filled with params, which must give a value to
+// every parameter and only to them, and extraFacts. Values are Terms or Go values with a Term
+// counterpart: string, int, int64, bool, time.Time and []byte.
+func (self *Issuer) Issue(ctx context.Context, params map[string]any, extraFacts ...Fact) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	for name := range params {
+		if !self.parameters[name] {
+			return "", fmt.Errorf("unknown template parameter %q", name)
+		}
+	}
+
+	code, err := expandTemplate(self.config.Template, func(name string) (string, error) {
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("missing template parameter %q", name)
+		}
+		term, err := termOf(value)
+		if err != nil {
+			return "", fmt.Errorf("template parameter %q: %w", name, err)
+		}
+		return term.String(), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	lock := self.env.Locker()
+	lock.Lock()
+	defer lock.Unlock()
+
+	token, err := self.build(code, extraFacts)
+	if err != nil {
+		return "", err
+	}
+	if self.config.MaxSize > 0 && len(token) > self.config.MaxSize {
+		return "", fmt.Errorf("%w: %d bytes, at most %d", ErrTokenTooLarge, len(token), self.config.MaxSize)
+	}
+	return token, nil
+}
+
+func (self *Issuer) build(code string, extraFacts []Fact) (string, error) {
+	builder, err := NewBuilder(self.env)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = builder.Close() }()
+
+	if err := builder.AddCode(code); err != nil {
+		return "", err
+	}
+	if err := builder.AddFacts(extraFacts); err != nil {
+		return "", err
+	}
+	if self.config.TTL > 0 {
+		check, err := CheckExpiry(self.config.Now().Add(self.config.TTL))
+		if err != nil {
+			return "", err
+		}
+		if err := builder.AddCode(check.String() + ";"); err != nil {
+			return "", err
+		}
+	}
+	if self.config.RootKeyID != nil {
+		if err := builder.SetRootKeyID(*self.config.RootKeyID); err != nil {
+			return "", err
+		}
+	}
+
+	token, err := builder.Build(self.config.Root)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = token.Close() }()
+
+	return token.ToBase64()
+}
+
+// termOf converts a template parameter value to a Term.
+func termOf(value any) (Term, error) {
+	switch value := value.(type) {
+	case Term:
+		return value, nil
+	case string:
+		return StringTerm(value), nil
+	case int:
+		return IntegerTerm(int64(value)), nil
+	case int64:
+		return IntegerTerm(value), nil
+	case bool:
+		return BoolTerm(value), nil
+	case time.Time:
+		return DateTerm(value), nil
+	case []byte:
+		return BytesTerm(value), nil
+	default:
+		return Term{}, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// expandTemplate replaces every `{name}` parameter of template, outside strings and `//`
+// comments, with the datalog returned by value.
+func expandTemplate(template string, value func(name string) (string, error)) (string, error) {
+	var expanded strings.Builder
+	inString, escaped, inComment := false, false, false
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case inComment:
+			inComment = c != '\n'
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case !inString && c == '/' && strings.HasPrefix(template[i:], "//"):
+			inComment = true
+		case !inString && c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 || !isIdentifier(template[i+1:i+end]) {
+				break
+			}
+			text, err := value(template[i+1 : i+end])
+			if err != nil {
+				return "", err
+			}
+			expanded.WriteString(text)
+			i += end
+			continue
+		}
+		expanded.WriteByte(c)
+	}
+	return expanded.String(), nil
+}
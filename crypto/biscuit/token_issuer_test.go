@@ -0,0 +1,178 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	template := "user({user}); // {comment}\nright(\"{literal}\", {op});\ncheck if [\"a\"].contains({ })"
+	expanded, err := expandTemplate(template, func(name string) (string, error) {
+		return "<" + name + ">", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "user(<user>); // {comment}\nright(\"{literal}\", <op>);\ncheck if [\"a\"].contains({ })"
+	if expanded != want {
+		t.Errorf("expanded = %q, want %q", expanded, want)
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	keyID := uint32(7)
+	issuer, err := NewIssuer(env, IssuerConfig{
+		Root:      root,
+		Template:  `user({user}); right({user}, "read"); check if operation("read");`,
+		TTL:       time.Hour,
+		Now:       func() time.Time { return now },
+		RootKeyID: &keyID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authority := func(token string) string {
+		t.Helper()
+
+		parsed, err := FromBase64(env, token, public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = parsed.Close() }()
+		source, err := parsed.BlockSource(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return source
+	}
+
+	alice, err := issuer.Issue(context.Background(), map[string]any{"user": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Minute)
+	team, err := NewFact("team", StringTerm("ops"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := issuer.Issue(context.Background(), map[string]any{"user": "bob"}, team)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceSource, bobSource := authority(alice), authority(bob)
+	for _, want := range []string{`user("alice")`, `right("alice", "read")`, "2026-03-01T13:00:00Z"} {
+		if !strings.Contains(aliceSource, want) {
+			t.Errorf("alice's token misses %s:\n%s", want, aliceSource)
+		}
+	}
+	for _, want := range []string{`user("bob")`, `team("ops")`, "2026-03-01T13:30:00Z"} {
+		if !strings.Contains(bobSource, want) {
+			t.Errorf("bob's token misses %s:\n%s", want, bobSource)
+		}
+	}
+	if strings.Contains(bobSource, "alice") || strings.Contains(aliceSource, "team") {
+		t.Error("a token holds facts of the other one")
+	}
+
+	if id, ok, err := RootKeyID(alice); err != nil || !ok || id != keyID {
+		t.Errorf("RootKeyID = %d, %v, %v, want %d", id, ok, err, keyID)
+	}
+
+	if _, err := issuer.Issue(context.Background(), map[string]any{}); err == nil {
+		t.Error("missing parameter accepted")
+	}
+	if _, err := issuer.Issue(context.Background(), map[string]any{"user": "carol", "role": "admin"}); err == nil {
+		t.Error("unknown parameter accepted")
+	}
+	if _, err := issuer.Issue(context.Background(), map[string]any{"user": 1.5}); err == nil {
+		t.Error("float parameter accepted")
+	}
+	// The value is quoted: it cannot add statements to the block.
+	injected, err := issuer.Issue(context.Background(), map[string]any{"user": `x"); admin("yes`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := FromBase64(env, injected, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = parsed.Close() }()
+	if authorize(t, env, parsed, `operation("read"); allow if admin("yes");`) {
+		t.Error("parameter injected a fact")
+	}
+}
+
+func TestIssuerLimits(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+
+	if _, err := NewIssuer(env, IssuerConfig{Root: root, Template: `user({user}`}); err == nil {
+		t.Error("invalid template accepted")
+	}
+
+	issuer, err := NewIssuer(env, IssuerConfig{Root: root, Template: `user({user});`, MaxSize: 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := issuer.Issue(context.Background(), map[string]any{"user": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = issuer.Issue(context.Background(), map[string]any{"user": strings.Repeat("a", 400)})
+	if !errors.Is(err, ErrTokenTooLarge) {
+		t.Errorf("err = %v, want ErrTokenTooLarge", err)
+	}
+
+	if id, ok, err := RootKeyID(mustIssue(t, issuer)); err != nil || ok {
+		t.Errorf("RootKeyID = %d, %v, %v, want none", id, ok, err)
+	}
+}
+
+func mustIssue(t *testing.T, issuer *Issuer) string {
+	t.Helper()
+
+	token, err := issuer.Issue(context.Background(), map[string]any{"user": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestIssuerEnvLock(t *testing.T) {
+	env := wasmtest.Env(t)
+	issuer, err := NewIssuer(env, IssuerConfig{Root: newRoot(t, env), Template: `user({user});`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Issue waits for other users of the env.
+	lock := env.Locker()
+	lock.Lock()
+	done := make(chan error)
+	go func() {
+		_, err := issuer.Issue(context.Background(), map[string]any{"user": "alice"})
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("token issued with the env locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	lock.Unlock()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
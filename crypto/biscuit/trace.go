@@ -0,0 +1,135 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"context"
+)
+
+// Tracer starts the spans of the Context variants of the token operations. Its shape follows
+// OpenTelemetry's so an adapter over a trace.Tracer is a few lines, without this module depending
+// on the OpenTelemetry SDK.
+type Tracer interface {
+	// Start starts a span named name, child of the span of ctx if any, and returns the context
+	// carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a started span. Attributes are set before End.
+type Span interface {
+	SetAttribute(key string, value any)
+	// End ends the span, marking it as failed when err is not nil.
+	End(err error)
+}
+
+type tracerKey struct{}
+
+// ContextWithTracer returns a copy of ctx whose token operations are traced with tracer.
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// startSpan starts a span with the tracer of ctx. Without a tracer it returns a nil span and
+// costs a context lookup.
+func startSpan(ctx context.Context, name string) (context.Context, Span) {
+	tracer, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		return ctx, nil
+	}
+	return tracer.Start(ctx, name)
+}
+
+// tracedEnv returns a copy of env making its guest calls under ctx, the context of a span, and
+// counting them into calls. It is only used once a span started: untraced operations keep env.
+func tracedEnv(ctx context.Context, env wasm.WasmEnv, calls *int) wasm.WasmEnv {
+	return env.WithCallContext(ctx).WithCallCounter(calls)
+}
+
+// endSpan ends span with the number of guest calls the operation made.
+func endSpan(span Span, calls int, err error) {
+	span.SetAttribute("biscuit.wasm_calls", calls)
+	span.End(err)
+}
+
+// FromBase64Context is FromBase64 traced as "biscuit.ParseToken", with the block count. Traced
+// operations make their guest calls under the context of their span, and record their number as
+// biscuit.wasm_calls; the objects they return keep the env they were given.
+func FromBase64Context(ctx context.Context, env wasm.WasmEnv, token string, root keypair.PublicKey) (*Biscuit, error) {
+	ctx, span := startSpan(ctx, "biscuit.ParseToken")
+	if span == nil {
+		return FromBase64(env, token, root)
+	}
+
+	calls := 0
+	parsed, err := FromBase64(tracedEnv(ctx, env, &calls), token, root)
+	if err == nil {
+		parsed.env = env
+		setBlockCount(span, parsed)
+	}
+	endSpan(span, calls, err)
+	return parsed, err
+}
+
+// AppendContext is Append traced as "biscuit.Append", with the block count of the new token.
+func (self *Biscuit) AppendContext(ctx context.Context, block *BlockBuilder) (*Biscuit, error) {
+	ctx, span := startSpan(ctx, "biscuit.Append")
+	if span == nil {
+		return self.Append(block)
+	}
+
+	calls := 0
+	traced := *self
+	traced.env = tracedEnv(ctx, self.env, &calls)
+	appended, err := traced.Append(block)
+	if err == nil {
+		appended.env = self.env
+		setBlockCount(span, appended)
+	}
+	endSpan(span, calls, err)
+	return appended, err
+}
+
+// AuthorizeContext is Authorize traced as "biscuit.Authorize", with the index of the matched
+// policy or the number of failed checks.
+func (self *Authorizer) AuthorizeContext(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "biscuit.Authorize")
+	if span == nil {
+		return self.Authorize()
+	}
+
+	calls := 0
+	traced := *self
+	traced.env = tracedEnv(ctx, self.env, &calls)
+	policy, err := traced.Authorize()
+	if err == nil {
+		span.SetAttribute("biscuit.policy", policy)
+	} else {
+		span.SetAttribute("biscuit.failed_checks", len(FailedChecks(err)))
+	}
+	endSpan(span, calls, err)
+	return policy, err
+}
+
+// QueryContext is Query traced as "biscuit.Query", with the number of facts found.
+func (self *Authorizer) QueryContext(ctx context.Context, rule string) ([]string, error) {
+	ctx, span := startSpan(ctx, "biscuit.Query")
+	if span == nil {
+		return self.Query(rule)
+	}
+
+	calls := 0
+	traced := *self
+	traced.env = tracedEnv(ctx, self.env, &calls)
+	facts, err := traced.Query(rule)
+	if err == nil {
+		span.SetAttribute("biscuit.facts", len(facts))
+	}
+	endSpan(span, calls, err)
+	return facts, err
+}
+
+func setBlockCount(span Span, token *Biscuit) {
+	if count, err := token.BlockCount(); err == nil {
+		span.SetAttribute("biscuit.blocks", count)
+	}
+}
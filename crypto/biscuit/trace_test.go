@@ -0,0 +1,198 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// recordedSpan is a span kept by recordingTracer.
+type recordedSpan struct {
+	name       string
+	parent     *recordedSpan
+	attributes map[string]any
+	err        error
+	ended      bool
+}
+
+func (self *recordedSpan) SetAttribute(key string, value any) {
+	self.attributes[key] = value
+}
+
+func (self *recordedSpan) End(err error) {
+	self.err, self.ended = err, true
+}
+
+type spanKey struct{}
+
+// recordingTracer keeps every span it starts, in the spirit of an in-memory exporter.
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+func (self *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attributes: map[string]any{}}
+	self.spans = append(self.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestTracing(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	publicKey, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice"); check if operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	minted, err := builder.Build(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = minted.Close() }()
+	encoded, err := minted.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := &recordingTracer{}
+	ctx, request := tracer.Start(ContextWithTracer(context.Background(), tracer), "request")
+
+	token, err := FromBase64Context(ctx, env, encoded, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = token.Close() }()
+
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := block.AddCode(`check if time($t);`); err != nil {
+		t.Fatal(err)
+	}
+	attenuated, err := token.AppendContext(ctx, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = attenuated.Close() }()
+
+	authorizeWith := func(code string) error {
+		authorizerBuilder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizerBuilder.Close() }()
+		if err := authorizerBuilder.AddCode(code); err != nil {
+			t.Fatal(err)
+		}
+		authorizer, err := authorizerBuilder.Build(attenuated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = authorizer.Close() }()
+		_, err = authorizer.AuthorizeContext(ctx)
+		return err
+	}
+	if err := authorizeWith(`operation("read"); time(2024-01-01T00:00:00Z); allow if true;`); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorizeWith(`operation("write"); allow if true;`); err == nil {
+		t.Fatal("token authorized despite failing checks")
+	}
+
+	authorizerBuilder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizerBuilder.Close() }()
+	authorizer, err := authorizerBuilder.Build(attenuated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+	if facts, err := authorizer.QueryContext(ctx, `data($u) <- user($u)`); err != nil || !slices.Equal(facts, []string{`data("alice")`}) {
+		t.Fatalf("query = %q, %v", facts, err)
+	}
+	request.End(nil)
+
+	want := []struct {
+		name       string
+		attributes map[string]any
+		failed     bool
+	}{
+		{"request", map[string]any{}, false},
+		{"biscuit.ParseToken", map[string]any{"biscuit.blocks": 1}, false},
+		{"biscuit.Append", map[string]any{"biscuit.blocks": 2}, false},
+		{"biscuit.Authorize", map[string]any{"biscuit.policy": 0}, false},
+		{"biscuit.Authorize", map[string]any{"biscuit.failed_checks": 2}, true},
+		{"biscuit.Query", map[string]any{"biscuit.facts": 1}, false},
+	}
+	if len(tracer.spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(tracer.spans), len(want))
+	}
+	for i, span := range tracer.spans {
+		if span.name != want[i].name || !span.ended || (span.err != nil) != want[i].failed {
+			t.Errorf("span %d = %s (ended %t, err %v), want %s", i, span.name, span.ended, span.err, want[i].name)
+		}
+		if i > 0 && span.parent != tracer.spans[0] {
+			t.Errorf("span %s is not a child of the request span", span.name)
+		}
+		if calls, _ := span.attributes["biscuit.wasm_calls"].(int); i > 0 && calls == 0 {
+			t.Errorf("span %s: biscuit.wasm_calls = %v, want the guest calls", span.name, span.attributes["biscuit.wasm_calls"])
+		}
+		for key, value := range want[i].attributes {
+			if span.attributes[key] != value {
+				t.Errorf("span %s: %s = %v, want %v", span.name, key, span.attributes[key], value)
+			}
+		}
+	}
+}
+
+// cancelingTracer starts spans whose context is already canceled.
+type cancelingTracer struct{}
+
+func (cancelingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	return ctx, &recordedSpan{name: name, attributes: map[string]any{}}
+}
+
+func TestTracingCallContext(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+	encoded, err := token.ToBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := newRoot(t, env).GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The guest calls of a traced operation run under the context of its span.
+	ctx := ContextWithTracer(context.Background(), cancelingTracer{})
+	if _, err := FromBase64Context(ctx, env, encoded, public); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the cancellation of the span context", err)
+	}
+}
+
+func TestTracingWithoutTracer(t *testing.T) {
+	ctx := context.Background()
+	if got, span := startSpan(ctx, "biscuit.ParseToken"); got != ctx || span != nil {
+		t.Error("span started without a tracer")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { startSpan(ctx, "biscuit.ParseToken") }); allocs != 0 {
+		t.Errorf("startSpan allocates %v times without a tracer", allocs)
+	}
+}
@@ -0,0 +1,103 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"fmt"
+	"strings"
+)
+
+// trustedKeyPrefixes start the public keys datalog scopes trust, e.g. `trusting ed25519/412e...`.
+var trustedKeyPrefixes = []string{"ed25519/", "secp256r1/"}
+
+// checkTrustedKeys parses the public keys written in code, outside strings and comments, before the
+// guest parser does: it traps on a key of the wrong size or off the curve, which leaves the env
+// unusable, where parsing the key alone reports an error.
+func checkTrustedKeys(env wasm.WasmEnv, code string) error {
+	inString, escaped := false, false
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case strings.HasPrefix(code[i:], "//"):
+			end := strings.IndexByte(code[i:], '\n')
+			if end < 0 {
+				return nil
+			}
+			i += end
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				return nil
+			}
+			i += end + 3
+		default:
+			key, ok := trustedKeyAt(code[i:])
+			if !ok {
+				continue
+			}
+			publicKey := keypair.InvokePublicKey(env)
+			if err := publicKey.FromString(key); err != nil {
+				return fmt.Errorf("invalid public key %s: %w", key, err)
+			}
+			_ = env.FreeObject("publickey", publicKey.Ptr())
+			i += len(key) - 1
+		}
+	}
+	return nil
+}
+
+// trustedKeyAt returns the public key code starts with, if any.
+func trustedKeyAt(code string) (string, bool) {
+	for _, prefix := range trustedKeyPrefixes {
+		if !strings.HasPrefix(code, prefix) {
+			continue
+		}
+		end := len(prefix)
+		for end < len(code) && isHexByte(code[end]) {
+			end++
+		}
+		return code[:end], true
+	}
+	return "", false
+}
+
+func isHexByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// WithScopeKeys names public keys for the `trusting {name}` scopes of the code given to AddCode,
+// e.g. `allow if group("admin") trusting {signer}`. The checks, rules and policies of that code
+// then see the facts of the third-party blocks signed by those keys, and only those, without the
+// keys being written into the source. Naming a scope the code does not use is not an error.
+func WithScopeKeys(keys map[string]keypair.PublicKey) BuilderOption {
+	return func(options *builderOptions) {
+		options.scopeKeys = keys
+	}
+}
+
+// scopeParameters renders keys in the `<algorithm>/<hex>` form the guest reads scope parameters
+// in, nil when there are none.
+func scopeParameters(keys map[string]keypair.PublicKey) (map[string]any, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	scopes := make(map[string]any, len(keys))
+	for name, key := range keys {
+		if !isIdentifier(name) {
+			return nil, fmt.Errorf("invalid scope name %q", name)
+		}
+		text, err := key.ToString()
+		if err != nil {
+			return nil, fmt.Errorf("scope %s: %w", name, err)
+		}
+		scopes[name] = text
+	}
+	return scopes, nil
+}
@@ -0,0 +1,58 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckTrustedKeys(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	valid := "ed25519/" + strings.Repeat("ff", 32)
+	for _, code := range []string{
+		`check if right("read") trusting ` + valid + ";",
+		`check if right("ed25519/00") trusting authority;`,
+		"// trusting ed25519/00\ncheck if true;",
+		"/* trusting secp256r1/05 */ check if true;",
+		`check if key("x") trusting previous;`,
+	} {
+		builder, err := NewAuthorizerBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.AddCode(code); err != nil {
+			t.Errorf("%s: %v", code, err)
+		}
+		_ = builder.Close()
+	}
+
+	for _, code := range []string{
+		`check if right("read") trusting ed25519/00;`,
+		`r($x) <- f($x) trusting ed25519/` + strings.Repeat("12", 32) + ";",
+		`check if f(1) trusting secp256r1/02` + strings.Repeat("ff", 32) + ";",
+	} {
+		block, err := NewBlockBuilder(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = block.AddCode(code)
+		var guestErr *wasm.GuestError
+		if !errors.As(err, &guestErr) {
+			t.Errorf("%s: err = %v, want the key parsing error", code, err)
+		}
+		_ = block.Close()
+	}
+
+	// The env is still usable.
+	builder, err := NewBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("alice"); check if true trusting ` + valid + ";"); err != nil {
+		t.Fatal(err)
+	}
+}
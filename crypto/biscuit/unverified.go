@@ -0,0 +1,513 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// symbolOffset is the index of the first symbol defined by a block, lower indexes refer to
+// defaultSymbols.
+const symbolOffset = 1024
+
+// defaultSymbols is the symbol table shared by every biscuit, see the biscuit specification.
+var defaultSymbols = []string{
+	"read", "write", "resource", "operation", "right", "time", "role", "owner", "tenant",
+	"namespace", "user", "team", "service", "admin", "email", "group", "member", "ip_address",
+	"client", "client_ip", "domain", "path", "version", "cluster", "node", "hostname", "nonce",
+	"query",
+}
+
+// Protobuf field numbers of the biscuit wire format (schema.proto) read by this file.
+const (
+	biscuitRootKeyIDField             protowire.Number = 1
+	biscuitAuthorityField             protowire.Number = 2
+	biscuitBlocksField                protowire.Number = 3
+	biscuitProofField                 protowire.Number = 4
+	proofFinalSignatureField          protowire.Number = 2
+	signedBlockBlockField             protowire.Number = 1
+	signedBlockNextKeyField           protowire.Number = 2
+	signedBlockSignatureField         protowire.Number = 3
+	signedBlockExternalSignatureField protowire.Number = 4
+	externalSignaturePublicKeyField   protowire.Number = 2
+	publicKeyAlgorithmField           protowire.Number = 1
+	blockSymbolsField                 protowire.Number = 1
+	blockContextField                 protowire.Number = 2
+	blockVersionField                 protowire.Number = 3
+	blockFactsField                   protowire.Number = 4
+	blockRulesField                   protowire.Number = 5
+	factPredicateField                protowire.Number = 1
+	predicateNameField                protowire.Number = 1
+	predicateTermsField               protowire.Number = 2
+	termIntegerField                  protowire.Number = 2
+	termStringField                   protowire.Number = 3
+	termDateField                     protowire.Number = 4
+	termBytesField                    protowire.Number = 5
+	termBoolField                     protowire.Number = 6
+	requestPreviousSignatureField     protowire.Number = 3
+)
+
+// decodeToken decodes a base64 token, accepting both padded and unpadded url-safe encodings.
+func decodeToken(token string) ([]byte, error) {
+	token = strings.TrimSpace(token)
+	if data, err := base64.URLEncoding.DecodeString(token); err == nil {
+		return data, nil
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(token, "="))
+}
+
+// authorityStringFacts returns the single string term of every authority block fact named
+// predicate. The token signatures are NOT verified: the result must only be used to select the
+// key the token is then verified with.
+func authorityStringFacts(data []byte, predicate string) ([]string, error) {
+	symbol, facts, _, err := authorityBlock(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for _, fact := range facts {
+		name, terms, err := decodePredicate(fact)
+		if err != nil {
+			return nil, err
+		}
+
+		if factName, ok := symbol(name); !ok || factName != predicate || len(terms) != 1 {
+			continue
+		}
+
+		var value string
+		var found bool
+		err = walkFields(terms[0], func(num protowire.Number, typ protowire.Type, raw []byte) {
+			if num != termStringField || typ != protowire.VarintType {
+				return
+			}
+			idx, _ := protowire.ConsumeVarint(raw)
+			value, found = symbol(idx)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			values = append(values, value)
+		}
+	}
+
+	return values, nil
+}
+
+// authorityFacts decodes every fact of the authority block. Facts holding sets, arrays, maps or
+// null have no Fact counterpart and are reported as an error.
+func authorityFacts(data []byte) ([]Fact, error) {
+	symbol, facts, _, err := authorityBlock(data)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := make([]Fact, 0, len(facts))
+	for _, fact := range facts {
+		name, terms, err := decodePredicate(fact)
+		if err != nil {
+			return nil, err
+		}
+		factName, ok := symbol(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown symbol %d", name)
+		}
+
+		decodedFact := Fact{name: factName, terms: make([]Term, len(terms))}
+		for i, term := range terms {
+			if decodedFact.terms[i], err = decodeTerm(term, symbol); err != nil {
+				return nil, fmt.Errorf("fact %s: term %d: %w", factName, i, err)
+			}
+		}
+		decoded = append(decoded, decodedFact)
+	}
+	return decoded, nil
+}
+
+// authorityBlock returns the symbol table, the encoded facts and the encoded rules of the
+// authority block.
+func authorityBlock(data []byte) (func(uint64) (string, bool), [][]byte, [][]byte, error) {
+	signedBlock, err := bytesField(data, biscuitAuthorityField)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	block, err := bytesField(signedBlock, signedBlockBlockField)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var symbols []string
+	var facts, rules [][]byte
+	err = walkFields(block, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if typ != protowire.BytesType {
+			return
+		}
+		switch num {
+		case blockSymbolsField:
+			symbols = append(symbols, string(value))
+		case blockFactsField:
+			facts = append(facts, value)
+		case blockRulesField:
+			rules = append(rules, value)
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	symbol := func(idx uint64) (string, bool) {
+		if idx < symbolOffset {
+			if idx < uint64(len(defaultSymbols)) {
+				return defaultSymbols[idx], true
+			}
+			return "", false
+		}
+		if idx-symbolOffset < uint64(len(symbols)) {
+			return symbols[idx-symbolOffset], true
+		}
+		return "", false
+	}
+	return symbol, facts, rules, nil
+}
+
+// decodePredicate returns the name symbol and the encoded terms of a fact, or of the head of a
+// rule, encoded in the same field.
+func decodePredicate(fact []byte) (uint64, [][]byte, error) {
+	pred, err := bytesField(fact, factPredicateField)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var name uint64
+	var terms [][]byte
+	err = walkFields(pred, func(num protowire.Number, typ protowire.Type, value []byte) {
+		switch {
+		case num == predicateNameField && typ == protowire.VarintType:
+			name, _ = protowire.ConsumeVarint(value)
+		case num == predicateTermsField && typ == protowire.BytesType:
+			terms = append(terms, value)
+		}
+	})
+	return name, terms, err
+}
+
+// decodeTerm decodes a term of the kinds Term supports.
+func decodeTerm(term []byte, symbol func(uint64) (string, bool)) (Term, error) {
+	var decoded Term
+	var found bool
+	var decodeErr error
+	err := walkFields(term, func(num protowire.Number, typ protowire.Type, value []byte) {
+		var varint uint64
+		if typ == protowire.VarintType {
+			varint, _ = protowire.ConsumeVarint(value)
+		}
+		switch {
+		case num == termIntegerField && typ == protowire.VarintType:
+			decoded = IntegerTerm(int64(varint))
+		case num == termStringField && typ == protowire.VarintType:
+			str, ok := symbol(varint)
+			if !ok {
+				decodeErr = fmt.Errorf("unknown symbol %d", varint)
+			}
+			decoded = StringTerm(str)
+		case num == termDateField && typ == protowire.VarintType:
+			decoded = DateTerm(time.Unix(int64(varint), 0))
+		case num == termBytesField && typ == protowire.BytesType:
+			decoded = BytesTerm(value)
+		case num == termBoolField && typ == protowire.VarintType:
+			decoded = BoolTerm(varint != 0)
+		default:
+			decodeErr = fmt.Errorf("unsupported term field %d", num)
+		}
+		found = true
+	})
+	if err != nil {
+		return Term{}, err
+	}
+	if decodeErr != nil {
+		return Term{}, decodeErr
+	}
+	if !found {
+		return Term{}, fmt.Errorf("empty term")
+	}
+	return decoded, nil
+}
+
+// RootKeyID returns the root key identifier a base64 token was issued with, see
+// Builder.SetRootKeyID, and whether it has one. The token signatures are NOT verified: the
+// identifier must only be used to select the key the token is then verified with.
+func RootKeyID(token string) (uint32, bool, error) {
+	data, err := decodeToken(token)
+	if err != nil {
+		return 0, false, fmt.Errorf("cannot decode token: %w", err)
+	}
+
+	var id uint64
+	var found bool
+	err = walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if num == biscuitRootKeyIDField && typ == protowire.VarintType {
+			id, _ = protowire.ConsumeVarint(value)
+			found = true
+		}
+	})
+	return uint32(id), found, err
+}
+
+// signedBlocks returns the authority block followed by the other blocks of a token, as serialized
+// SignedBlock messages.
+func signedBlocks(data []byte) ([][]byte, error) {
+	authority, err := bytesField(data, biscuitAuthorityField)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := [][]byte{authority}
+	err = walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if num == biscuitBlocksField && typ == protowire.BytesType {
+			blocks = append(blocks, value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// quotedSymbols reports whether a string of a serialized token holds a double quote. Every string
+// of a block is in its symbol table, third-party blocks included.
+func quotedSymbols(data []byte) (bool, error) {
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		return false, err
+	}
+
+	quoted := false
+	for _, signedBlock := range blocks {
+		block, err := bytesField(signedBlock, signedBlockBlockField)
+		if err != nil {
+			return false, err
+		}
+		err = walkFields(block, func(num protowire.Number, typ protowire.Type, value []byte) {
+			if num == blockSymbolsField && typ == protowire.BytesType && bytes.IndexByte(value, '"') >= 0 {
+				quoted = true
+			}
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	return quoted, nil
+}
+
+// blockMessage returns the serialized Block message of the block at index, 0 being the authority
+// block.
+func blockMessage(data []byte, index int) ([]byte, error) {
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(blocks) {
+		return nil, fmt.Errorf("no block %d in a token of %d blocks", index, len(blocks))
+	}
+	return bytesField(blocks[index], signedBlockBlockField)
+}
+
+// blockContext returns the context field of the block at index, 0 being the authority block,
+// and whether the block has one.
+func blockContext(data []byte, index int) (string, bool, error) {
+	block, err := blockMessage(data, index)
+	if err != nil {
+		return "", false, err
+	}
+
+	var context string
+	var found bool
+	err = walkFields(block, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if num == blockContextField && typ == protowire.BytesType {
+			context, found = string(value), true
+		}
+	})
+	return context, found, err
+}
+
+// blockKeyAlgorithms returns the algorithms of the keys a token carries: the next key of every
+// block, whose private part signs the following block, and the keys of third-party signatures.
+func blockKeyAlgorithms(data []byte) ([]keypair.SignatureAlgorithm, error) {
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var algorithms []keypair.SignatureAlgorithm
+	addAlgorithm := func(key []byte) error {
+		return walkFields(key, func(num protowire.Number, typ protowire.Type, value []byte) {
+			if num == publicKeyAlgorithmField && typ == protowire.VarintType {
+				algorithm, _ := protowire.ConsumeVarint(value)
+				algorithms = append(algorithms, keypair.SignatureAlgorithm(algorithm))
+			}
+		})
+	}
+
+	for _, block := range blocks {
+		var keys [][]byte
+		err := walkFields(block, func(num protowire.Number, typ protowire.Type, value []byte) {
+			if typ != protowire.BytesType {
+				return
+			}
+			switch num {
+			case signedBlockNextKeyField:
+				keys = append(keys, value)
+			case signedBlockExternalSignatureField:
+				if key, err := bytesField(value, externalSignaturePublicKeyField); err == nil {
+					keys = append(keys, key)
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if err := addAlgorithm(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return algorithms, nil
+}
+
+// blockVersions returns the schema version of every block of a token, 0 for a block without one.
+func blockVersions(data []byte) ([]uint32, error) {
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]uint32, len(blocks))
+	for i, signedBlock := range blocks {
+		block, err := bytesField(signedBlock, signedBlockBlockField)
+		if err != nil {
+			return nil, err
+		}
+		err = walkFields(block, func(num protowire.Number, typ protowire.Type, value []byte) {
+			if num == blockVersionField && typ == protowire.VarintType {
+				version, _ := protowire.ConsumeVarint(value)
+				versions[i] = uint32(version)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return versions, nil
+}
+
+// lastBlockSignature returns the signature of the last block of a token, which the next block
+// signature is chained to.
+func lastBlockSignature(data []byte) ([]byte, error) {
+	blocks, err := signedBlocks(data)
+	if err != nil {
+		return nil, err
+	}
+	return bytesField(blocks[len(blocks)-1], signedBlockSignatureField)
+}
+
+// externalSignatures returns, for every block appended after the authority block, its external
+// signature message or nil when the block was not signed by a third party.
+func externalSignatures(data []byte) ([][]byte, error) {
+	var blocks [][]byte
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if num == biscuitBlocksField && typ == protowire.BytesType {
+			blocks = append(blocks, value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		err := walkFields(block, func(num protowire.Number, typ protowire.Type, value []byte) {
+			if num == signedBlockExternalSignatureField && typ == protowire.BytesType {
+				signatures[i] = value
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return signatures, nil
+}
+
+// isSealed reports whether the proof of a token is a final signature rather than the private key
+// of the next block.
+func isSealed(data []byte) (bool, error) {
+	proof, err := bytesField(data, biscuitProofField)
+	if err != nil {
+		return false, err
+	}
+
+	var sealed bool
+	err = walkFields(proof, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if num == proofFinalSignatureField && typ == protowire.BytesType {
+			sealed = true
+		}
+	})
+	return sealed, err
+}
+
+// bytesField returns the first length-delimited field num of a protobuf message.
+func bytesField(message []byte, num protowire.Number) ([]byte, error) {
+	var field []byte
+	var found bool
+	err := walkFields(message, func(n protowire.Number, typ protowire.Type, value []byte) {
+		if !found && n == num && typ == protowire.BytesType {
+			field, found = value, true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("cannot read unverified token: missing field %d", num)
+	}
+	return field, nil
+}
+
+// walkFields calls visit for every field of a protobuf message. Varint fields are passed in
+// their encoded form, length-delimited ones without their length prefix.
+func walkFields(message []byte, visit func(protowire.Number, protowire.Type, []byte)) error {
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return fmt.Errorf("cannot read unverified token: %w", protowire.ParseError(n))
+		}
+		message = message[n:]
+
+		var value []byte
+		switch typ {
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(message)
+			if m < 0 {
+				return fmt.Errorf("cannot read unverified token: %w", protowire.ParseError(m))
+			}
+			value, n = v, m
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, message)
+			if n < 0 {
+				return fmt.Errorf("cannot read unverified token: %w", protowire.ParseError(n))
+			}
+			value = message[:n]
+		}
+
+		visit(num, typ, value)
+		message = message[n:]
+	}
+	return nil
+}
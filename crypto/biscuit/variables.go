@@ -0,0 +1,66 @@
+package biscuit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtractVariables returns the names of the variables source uses, without their `$`, each once
+// and in order of first use. source is a datalog statement such as a rule, check or policy; it is
+// tokenized on the host, without the guest, so only its strings, comments and variables are
+// checked: a statement ExtractVariables accepts may still be rejected by AddCode.
+func ExtractVariables(source string) ([]string, error) {
+	var variables []string
+	seen := map[string]bool{}
+	for i := 0; i < len(source); {
+		switch {
+		case source[i] == '"':
+			end := stringEnd(source, i)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			i = end
+		case source[i] == '/' && i+1 < len(source) && source[i+1] == '/':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case source[i] == '/' && i+1 < len(source) && source[i+1] == '*':
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment at offset %d", i)
+			}
+			i += 2 + end + 2
+		case source[i] == '$':
+			end := i + 1
+			for end < len(source) && isVariableName(source[end:end+1]) {
+				end++
+			}
+			name := source[i+1 : end]
+			if name == "" {
+				return nil, fmt.Errorf("variable without a name at offset %d", i)
+			}
+			if !seen[name] {
+				seen[name] = true
+				variables = append(variables, name)
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	return variables, nil
+}
+
+// stringEnd returns the offset just past the string literal opening at start, or -1 when it is
+// not terminated.
+func stringEnd(source string, start int) int {
+	for i := start + 1; i < len(source); i++ {
+		switch source[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,35 @@
+package biscuit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractVariables(t *testing.T) {
+	for _, tc := range []struct {
+		source string
+		want   []string
+	}{
+		{`check if user($u), right($u, $r)`, []string{"u", "r"}},
+		{`right($u, "read") <- user($u), resource($res), $res.starts_with("/")`, []string{"u", "res"}},
+		{`allow if user("$admin"), role($role) // $comment`, []string{"role"}},
+		{`check if /* $skipped */ time($t), $t <= 2026-01-01T00:00:00Z`, []string{"t"}},
+		{`check if user("a \" $quoted")`, nil},
+		{`user("alice")`, nil},
+	} {
+		got, err := ExtractVariables(tc.source)
+		if err != nil {
+			t.Errorf("%s: %v", tc.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: variables = %q, want %q", tc.source, got, tc.want)
+		}
+	}
+
+	for _, source := range []string{`check if user("alice)`, `check if user($)`, `check if /* user($u)`} {
+		if _, err := ExtractVariables(source); err == nil {
+			t.Errorf("%s: extracted, want an error", source)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package biscuit
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Block schema versions the bundled guest reads. Tokens from the v2 era carry older versions.
+const (
+	MinVersion uint32 = 3
+	MaxVersion uint32 = 6
+)
+
+// ErrUnsupportedVersion is matched by the *UnsupportedVersionError FromBase64 returns for a token
+// with a block version outside [MinVersion, MaxVersion].
+var ErrUnsupportedVersion = errors.New("unsupported token version")
+
+// UnsupportedVersionError reports the version found and the supported range.
+type UnsupportedVersionError struct {
+	Version  uint32
+	Min, Max uint32
+}
+
+func (self *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("%v %d, supported versions are %d to %d", ErrUnsupportedVersion, self.Version, self.Min, self.Max)
+}
+
+func (self *UnsupportedVersionError) Is(target error) bool {
+	return target == ErrUnsupportedVersion
+}
+
+// Version returns the schema version of the token, the highest version of its blocks.
+func (self *Biscuit) Version() (uint32, error) {
+	encoded, err := self.ToBase64()
+	if err != nil {
+		return 0, err
+	}
+	return TokenVersion(encoded)
+}
+
+// TokenVersion returns the schema version of a base64 token without verifying it, e.g. to tell
+// an old token from a corrupted one.
+func TokenVersion(token string) (uint32, error) {
+	data, err := decodeToken(token)
+	if err != nil {
+		return 0, fmt.Errorf("cannot decode token: %w", err)
+	}
+	versions, err := blockVersions(data)
+	if err != nil {
+		return 0, err
+	}
+	return slices.Max(versions), nil
+}
+
+// checkVersion returns an *UnsupportedVersionError when a block of the unverified token is outside
+// the supported versions. The guest only reports them once the blocks are read, after parsing.
+func checkVersion(data []byte) error {
+	versions, err := blockVersions(data)
+	if err != nil {
+		return nil
+	}
+	for _, version := range versions {
+		if version < MinVersion || version > MaxVersion {
+			return &UnsupportedVersionError{Version: version, Min: MinVersion, Max: MaxVersion}
+		}
+	}
+	return nil
+}
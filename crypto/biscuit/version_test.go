@@ -0,0 +1,70 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRootPublicKey verifies the fixtures of testdata: `user("alice");` with the authority block
+// version rewritten, then signed again with the matching private key.
+const testRootPublicKey = "ed25519/412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59"
+
+func TestTokenVersion(t *testing.T) {
+	fixture := func(name string) string {
+		t.Helper()
+
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	env := wasmtest.Env(t)
+	root := keypair.InvokePublicKey(env)
+	if err := root.FromString(testRootPublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	current := fixture("token_v3.txt")
+	parsed, err := FromBase64(env, current, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = parsed.Close() }()
+	if version, err := parsed.Version(); err != nil || version != 3 {
+		t.Errorf("Version = %d, %v, want 3", version, err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		version uint32
+	}{
+		{"token_v2.txt", 2},
+		{"token_v7.txt", 7},
+	} {
+		token := fixture(tc.name)
+		if version, err := TokenVersion(token); err != nil || version != tc.version {
+			t.Errorf("%s: TokenVersion = %d, %v, want %d", tc.name, version, err, tc.version)
+		}
+
+		_, err := FromBase64(env, token, root)
+		var versionErr *UnsupportedVersionError
+		if !errors.Is(err, ErrUnsupportedVersion) || !errors.As(err, &versionErr) {
+			t.Fatalf("%s: err = %v, want ErrUnsupportedVersion", tc.name, err)
+		}
+		if versionErr.Version != tc.version || versionErr.Min != MinVersion || versionErr.Max != MaxVersion {
+			t.Errorf("%s: error reports %+v", tc.name, versionErr)
+		}
+	}
+
+	// Corruption is still told apart from an old version.
+	if _, err := FromBase64(env, current[:len(current)-8], root); errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("truncated token reported as an unsupported version: %v", err)
+	}
+}
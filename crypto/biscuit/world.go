@@ -0,0 +1,203 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// worldSections are the sections of the authorizer world, in the order ToString prints them.
+var worldSections = []string{"Facts", "Rules", "Checks", "Policies"}
+
+// ErrWorldSyntax is returned when the world printed by the guest cannot be split into statements.
+var ErrWorldSyntax = errors.New("cannot parse authorizer world")
+
+// parseWorld splits the output of Authorizer.ToString into its sections, statements without their
+// final `;` and with the origin comments dropped.
+//
+// The guest prints strings as they are, newlines included, so they are escaped again for
+// statements to be valid datalog. A string ends at the next quote: a string holding one is printed
+// like several strings, so a world holding one must not be parsed, see Authorizer.world.
+func parseWorld(world string) (map[string][]string, error) {
+	sections := map[string][]string{}
+	section := ""
+	line := 1
+	for i := 0; i < len(world); {
+		switch {
+		case world[i] == '\n':
+			line++
+			i++
+		case world[i] == ' ' || world[i] == '\t':
+			i++
+		case strings.HasPrefix(world[i:], "//"):
+			end := strings.IndexByte(world[i:], '\n')
+			if end < 0 {
+				end = len(world) - i
+			}
+			if name, ok := strings.CutPrefix(world[i:i+end], "// "); ok && slices.Contains(worldSections, strings.TrimSuffix(name, ":")) {
+				section = strings.TrimSuffix(name, ":")
+			}
+			i += end
+		default:
+			statement, end, ok := scanStatement(world, i)
+			if !ok || section == "" {
+				return nil, fmt.Errorf("%w: line %d", ErrWorldSyntax, line)
+			}
+			sections[section] = append(sections[section], statement)
+			line += strings.Count(world[i:end], "\n")
+			i = end + 1
+		}
+	}
+	return sections, nil
+}
+
+// parseStatement turns one statement printed by the guest, without its final `;`, into datalog,
+// see parseWorld.
+func parseStatement(printed string) (string, error) {
+	statement, end, ok := scanStatement(printed+";", 0)
+	if !ok || end != len(printed) {
+		return "", fmt.Errorf("%w: %q", ErrWorldSyntax, printed)
+	}
+	return statement, nil
+}
+
+// scanStatement reads the statement printed at start, up to its final `;` whose index it returns,
+// with its strings escaped. A statement is printed on one line, but for the newlines of its
+// strings.
+func scanStatement(printed string, start int) (string, int, bool) {
+	var statement strings.Builder
+	for i := start; i < len(printed); i++ {
+		switch printed[i] {
+		case '"':
+			end := strings.IndexByte(printed[i+1:], '"')
+			if end < 0 {
+				return "", 0, false
+			}
+			statement.WriteString(quoteString(printed[i+1 : i+1+end]))
+			i += end + 1
+		case '\n':
+			return "", 0, false
+		case ';':
+			return strings.TrimRight(statement.String(), " \t"), i, true
+		default:
+			statement.WriteByte(printed[i])
+		}
+	}
+	return "", 0, false
+}
+
+// world returns the sections of the world of the authorizer, see parseWorld. The guest prints
+// strings unescaped, so a string holding a double quote cannot be told from the end of a string:
+// `user("a\", \"b")` prints like `user("a", "b")`. A world holding one fails with ErrWorldSyntax
+// rather than reading back as other statements, see hasQuotedString.
+func (self *Authorizer) world() (map[string][]string, error) {
+	if self.quotedWorld() {
+		return nil, fmt.Errorf("%w: a string holds a double quote", ErrWorldSyntax)
+	}
+	world, err := self.ToString()
+	if err != nil {
+		return nil, err
+	}
+	return parseWorld(world)
+}
+
+// quotedWorld reports whether a string of the world holds a double quote. A token that cannot be
+// read, e.g. closed before it was serialized, is taken as quoted: its world is not read back rather
+// than read wrong.
+func (self *Authorizer) quotedWorld() bool {
+	if self.quoted || self.token == nil {
+		return self.quoted
+	}
+	quoted, err := self.token.quotedStrings()
+	return quoted || err != nil
+}
+
+// Facts returns the facts of the authorizer, token facts included, without their final `;`. Facts
+// generated by rules are only there once Authorize ran.
+func (self *Authorizer) Facts() ([]string, error) {
+	sections, err := self.world()
+	if err != nil {
+		return nil, err
+	}
+	return sections["Facts"], nil
+}
+
+// ExportCode returns the world of the authorizer as a datalog document ImportCode reads back:
+// facts sorted and deduplicated, then rules, checks and policies in evaluation order. Statements
+// of the token lose their block: once imported they belong to the authorizer, so the scope of
+// token rules and checks is not kept. A world holding a string with a double quote cannot be
+// exported and fails with ErrWorldSyntax, see Authorizer.world.
+func (self *Authorizer) ExportCode() (string, error) {
+	sections, err := self.world()
+	if err != nil {
+		return "", err
+	}
+
+	facts := slices.Clone(sections["Facts"])
+	slices.Sort(facts)
+	sections["Facts"] = slices.Compact(facts)
+
+	var code strings.Builder
+	for _, name := range worldSections {
+		if len(sections[name]) == 0 {
+			continue
+		}
+		if code.Len() > 0 {
+			code.WriteString("\n")
+		}
+		fmt.Fprintf(&code, "// %s:\n", name)
+		for _, statement := range sections[name] {
+			code.WriteString(statement + ";\n")
+		}
+	}
+	return code.String(), nil
+}
+
+// hasQuotedString reports whether a string literal of the datalog source code holds a double
+// quote, written `\"`. Source is escaped, unlike the world the guest prints, so it is read
+// unambiguously; comments are skipped.
+func hasQuotedString(code string) bool {
+	for i := 0; i < len(code); i++ {
+		switch {
+		case code[i] == '"':
+			for i++; i < len(code) && code[i] != '"'; i++ {
+				if code[i] == '\\' {
+					if i++; i < len(code) && code[i] == '"' {
+						return true
+					}
+				}
+			}
+		case strings.HasPrefix(code[i:], "//"):
+			i += strings.IndexByte(code[i:]+"\n", '\n')
+		case strings.HasPrefix(code[i:], "/*"):
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		}
+	}
+	return false
+}
+
+// ImportCode builds an authorizer without a token from src, typically the output of ExportCode.
+func ImportCode(env wasm.WasmEnv, src string) (*Authorizer, error) {
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		return nil, err
+	}
+	if err := builder.AddCode(src); err != nil {
+		_ = builder.Close()
+		return nil, fmt.Errorf("invalid authorizer code: %w", err)
+	}
+
+	builderPtr := builder.ptr
+	builder.ptr = 0
+	ptr, err := env.CallFallible("authorizerbuilder_buildUnauthenticated", builderPtr)
+	if err != nil {
+		return nil, err
+	}
+	return &Authorizer{env: env, ptr: ptr, quoted: builder.quoted}, nil
+}
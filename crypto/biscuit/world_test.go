@@ -0,0 +1,324 @@
+package biscuit
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExportImportCode(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+	block, err := NewBlockBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := block.AddCode(`group("ops"); check if operation($op);`); err != nil {
+		t.Fatal(err)
+	}
+	appended, err := token.Append(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = appended.Close() }()
+
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.AddCode(poolBase + `operation("read"); reader($u) <- user($u), operation("read");`); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := builder.Build(appended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	code, err := authorizer.ExportCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := authorizer.ExportCode(); err != nil || again != code {
+		t.Errorf("second export differs:\n%s\n%v", again, err)
+	}
+	for _, want := range []string{`group("ops");`, `reader($u) <- user($u), operation("read");`, "check if operation($op);", `allow if user("admin");`} {
+		if !strings.Contains(code, want) {
+			t.Errorf("export misses %s:\n%s", want, code)
+		}
+	}
+
+	imported, err := ImportCode(env, code)
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, code)
+	}
+	defer func() { _ = imported.Close() }()
+
+	policy, err := authorizer.Authorize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	importedPolicy, err := imported.Authorize()
+	if err != nil || importedPolicy != policy {
+		t.Errorf("imported authorizer matched %d, %v, want %d", importedPolicy, err, policy)
+	}
+
+	facts, err := authorizer.Facts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	importedFacts, err := imported.Facts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(facts)
+	slices.Sort(importedFacts)
+	if !slices.Equal(slices.Compact(facts), slices.Compact(importedFacts)) {
+		t.Errorf("facts = %v, imported %v", facts, importedFacts)
+	}
+	if !slices.Contains(facts, `reader("alice")`) {
+		t.Errorf("generated fact missing from %v", facts)
+	}
+
+	if _, err := ImportCode(env, "allow if"); err == nil {
+		t.Error("invalid code imported")
+	}
+}
+
+func TestParseWorld(t *testing.T) {
+	// Strings as the guest prints them: unescaped, newlines included.
+	world := `// Facts:
+// origin: 0
+user("a\b", "x
+y;", 12, [1, "s"], {"k": "v"});
+note("
+// Rules:
+");
+// origin: authorizer
+resource("a) b; // c");
+
+// Rules:
+// origin: 0
+right($x) <- user($x, $y), $x.starts_with("a\"), $y != "z" || $x == "a) b";
+
+// Checks:
+// origin: 0
+check if resource($r), $r == "/*" trusting previous;
+
+// Policies:
+allow if user($u), $u == "a";
+deny if true;
+`
+	want := map[string][]string{
+		"Facts": {
+			`user("a\\b", "x\ny;", 12, [1, "s"], {"k": "v"})`,
+			`note("\n// Rules:\n")`,
+			`resource("a) b; // c")`,
+		},
+		"Rules":    {`right($x) <- user($x, $y), $x.starts_with("a\\"), $y != "z" || $x == "a) b"`},
+		"Checks":   {`check if resource($r), $r == "/*" trusting previous`},
+		"Policies": {`allow if user($u), $u == "a"`, "deny if true"},
+	}
+
+	sections, err := parseWorld(world)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range worldSections {
+		if !slices.Equal(sections[name], want[name]) {
+			t.Errorf("%s = %q, want %q", name, sections[name], want[name])
+		}
+	}
+
+	for _, broken := range []string{"// Facts:\nuser(\"a);\n", "// Facts:\nuser(\"a\"\n", "// Policies:\nallow if true\n", "user(\"a\");\n"} {
+		if sections, err := parseWorld(broken); !errors.Is(err, ErrWorldSyntax) {
+			t.Errorf("%q parsed as %q, %v, want ErrWorldSyntax", broken, sections, err)
+		}
+	}
+}
+
+func TestExportImportCodeQuoted(t *testing.T) {
+	env := wasmtest.Env(t)
+	token := poolToken(t, env)
+
+	// Strings are printed unescaped: newlines, backslashes and tabs still read back.
+	builder, err := NewAuthorizerBuilder(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`resource("a\\b"); note("say\nbye;\n// Rules:\n");
+tagged($r) <- resource($r), $r.starts_with("a\\");
+check if tagged("a\\b");
+deny if note("none");
+allow if resource("a\\b"), user("alice");`); err != nil {
+		t.Fatal(err)
+	}
+	authorizer, err := builder.Build(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	code, err := authorizer.ExportCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`resource("a\\b");`, `note("say\nbye;\n// Rules:\n");`, `$r.starts_with("a\\")`, `check if tagged("a\\b");`} {
+		if !strings.Contains(code, want) {
+			t.Errorf("export misses %s:\n%s", want, code)
+		}
+	}
+	imported, err := ImportCode(env, code)
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, code)
+	}
+	defer func() { _ = imported.Close() }()
+	if again, err := imported.ExportCode(); err != nil || again != code {
+		t.Errorf("imported export = %q, %v, want %q", again, err, code)
+	}
+	if policy, err := imported.Authorize(); err != nil || policy != 1 {
+		t.Errorf("imported authorizer matched %d, %v, want the allow policy", policy, err)
+	}
+
+	// `user("a\", \"b")` prints like `user("a", "b")`: exported, the authorizer denying the
+	// second would allow it.
+	fact, err := NewFact("user", StringTerm(`a", "b`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, add := range map[string]func(*AuthorizerBuilder) error{
+		"code":  func(builder *AuthorizerBuilder) error { return builder.AddCode(`user("a\", \"b");`) },
+		"fact":  func(builder *AuthorizerBuilder) error { return builder.AddFact(fact) },
+		"facts": func(builder *AuthorizerBuilder) error { return builder.AddFacts([]Fact{fact}) },
+		"merge": func(builder *AuthorizerBuilder) error {
+			other, err := NewAuthorizerBuilder(env)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = other.Close() }()
+			if err := other.AddFact(fact); err != nil {
+				return err
+			}
+			return builder.Merge(other)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			builder, err := NewAuthorizerBuilder(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = builder.Close() }()
+			if err := add(builder); err != nil {
+				t.Fatal(err)
+			}
+			if err := builder.AddCode(`allow if user("a", "b");`); err != nil {
+				t.Fatal(err)
+			}
+			authorizer, err := builder.Build(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = authorizer.Close() }()
+
+			if _, err := authorizer.Authorize(); err == nil {
+				t.Fatal("authorized without user(\"a\", \"b\")")
+			}
+			if code, err := authorizer.ExportCode(); !errors.Is(err, ErrWorldSyntax) {
+				t.Errorf("export = %q, %v, want ErrWorldSyntax", code, err)
+			}
+			if facts, err := authorizer.Facts(); !errors.Is(err, ErrWorldSyntax) {
+				t.Errorf("facts = %q, %v, want ErrWorldSyntax", facts, err)
+			}
+			if policies, err := authorizer.Policies(); !errors.Is(err, ErrWorldSyntax) {
+				t.Errorf("policies = %q, %v, want ErrWorldSyntax", policies, err)
+			}
+		})
+	}
+}
+
+func TestExportCodeQuotedToken(t *testing.T) {
+	env := wasmtest.Env(t)
+	root := newRoot(t, env)
+	public, err := root.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, code := range map[string]string{
+		"authority": `user("a\", \"b");`,
+		"rule":      `user("alice"); admin($u) <- user($u), $u != "a\"";`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			builder, err := NewBuilder(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = builder.Close() }()
+			if err := builder.AddCode(code); err != nil {
+				t.Fatal(err)
+			}
+			built, err := builder.Build(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = built.Close() }()
+			encoded, err := built.ToBase64()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := FromBase64(env, encoded, public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = parsed.Close() }()
+
+			// Built tokens are read from the guest, parsed ones from the bytes they came from.
+			for _, token := range []*Biscuit{built, parsed} {
+				authorizerBuilder, err := NewAuthorizerBuilder(env)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := authorizerBuilder.AddCode(`allow if true;`); err != nil {
+					t.Fatal(err)
+				}
+				authorizer, err := authorizerBuilder.Build(token)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The token is only scanned for quoted strings when the world is read back.
+				if _, err := authorizer.Authorize(); err != nil {
+					t.Fatal(err)
+				}
+				if token.scanned {
+					t.Error("token scanned before its world was read")
+				}
+				if code, err := authorizer.ExportCode(); !errors.Is(err, ErrWorldSyntax) {
+					t.Errorf("export = %q, %v, want ErrWorldSyntax", code, err)
+				}
+				if !token.scanned || !token.quoted {
+					t.Error("scan of the token not cached")
+				}
+				_ = authorizer.Close()
+			}
+		})
+	}
+}
+
+func TestHasQuotedString(t *testing.T) {
+	for code, want := range map[string]bool{
+		`user("a\"b");`:                    true,
+		`user("a\\"); note("\"");`:         true,
+		`user("a\\"); note("b");`:          false,
+		`user("a'b"); // say "hi\"`:        false,
+		"/* \"\\\"\" */ user(\"a\");":      false,
+		`/* */ user("\"");`:                true,
+		`allow if user($u), $u == "\\\"";`: true,
+	} {
+		if got := hasQuotedString(code); got != want {
+			t.Errorf("hasQuotedString(%s) = %t, want %t", code, got, want)
+		}
+	}
+}
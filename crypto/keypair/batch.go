@@ -0,0 +1,129 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// GenerateBatch generates n keypairs of algorithm in env, one after the other. On error the
+// keypairs already generated are freed.
+func GenerateBatch(env wasm.WasmEnv, algorithm SignatureAlgorithm, n int) ([]*KeyPair, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid batch size %d", n)
+	}
+
+	keyPairs := make([]*KeyPair, 0, n)
+	for i := range n {
+		keyPair := Invoke(env)
+		if err := keyPair.New(algorithm); err != nil {
+			closeAll(keyPairs)
+			return nil, fmt.Errorf("keypair %d: %w", i, err)
+		}
+		keyPairs = append(keyPairs, keyPair)
+	}
+	return keyPairs, nil
+}
+
+// GenerateBatchParallel generates n keypairs of algorithm with one worker per instance of pool,
+// since an instance serializes calls. Keypairs are returned in generation order, each one living
+// in the instance that generated it: the instances stay checked out of the pool until release is
+// called, which frees the keypairs and gives the instances back. The first error stops the workers,
+// frees the keypairs already generated and releases the instances.
+func GenerateBatchParallel(pool *wasm.Pool, algorithm SignatureAlgorithm, n int) ([]*KeyPair, func(), error) {
+	if n < 0 {
+		return nil, nil, fmt.Errorf("invalid batch size %d", n)
+	}
+	if n == 0 {
+		return []*KeyPair{}, func() {}, nil
+	}
+
+	// ctx is cancelled on the first error, or once every keypair is generated so that workers
+	// still waiting for an instance give up.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keyPairs := make([]*KeyPair, n)
+	var next, completed atomic.Int64
+	var mu sync.Mutex
+	var releases []func()
+	var firstErr, acquireErr error
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range min(pool.Size(), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			env, releaseEnv, err := pool.Acquire(ctx)
+			mu.Lock()
+			if err != nil {
+				if ctx.Err() == nil {
+					acquireErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			releases = append(releases, releaseEnv)
+			mu.Unlock()
+
+			for ctx.Err() == nil {
+				i := int(next.Add(1)) - 1
+				if i >= n {
+					return
+				}
+				keyPair := Invoke(*env)
+				if err := keyPair.New(algorithm); err != nil {
+					fail(fmt.Errorf("keypair %d: %w", i, err))
+					return
+				}
+				keyPairs[i] = keyPair
+				if completed.Add(1) == int64(n) {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			for _, keyPair := range keyPairs {
+				if keyPair != nil {
+					_ = keyPair.Close()
+				}
+			}
+			for _, releaseEnv := range releases {
+				releaseEnv()
+			}
+		})
+	}
+
+	// A worker that could not get an instance only fails the batch when its share was left
+	// undone.
+	if firstErr == nil && completed.Load() < int64(n) {
+		firstErr = fmt.Errorf("cannot acquire instance: %w", acquireErr)
+	}
+	if firstErr != nil {
+		release()
+		return nil, nil, firstErr
+	}
+	return keyPairs, release, nil
+}
+
+func closeAll(keyPairs []*KeyPair) {
+	for _, keyPair := range keyPairs {
+		_ = keyPair.Close()
+	}
+}
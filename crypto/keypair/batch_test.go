@@ -0,0 +1,154 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func newTestPool(t testing.TB, size int) *wasm.Pool {
+	t.Helper()
+
+	pool, err := wasm.NewPool(context.Background(), size, wasm.WithCompiledModule(wasmtest.Module(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = pool.Close() })
+	return pool
+}
+
+func TestGenerateBatchParallel(t *testing.T) {
+	pool := newTestPool(t, 4)
+
+	const n = 25
+	keyPairs, release, err := GenerateBatchParallel(pool, Ed25519, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if len(keyPairs) != n {
+		t.Fatalf("got %d keypairs, want %d", len(keyPairs), n)
+	}
+
+	seen := map[string]bool{}
+	for i, keyPair := range keyPairs {
+		publicKey, err := keyPair.GetPublicKey()
+		if err != nil {
+			t.Fatalf("keypair %d: %v", i, err)
+		}
+		key, err := publicKey.ToString()
+		if err != nil {
+			t.Fatalf("keypair %d: %v", i, err)
+		}
+		if seen[key] {
+			t.Errorf("keypair %d: duplicate key %s", i, key)
+		}
+		seen[key] = true
+	}
+
+	if keyPairs, release, err := GenerateBatchParallel(pool, Ed25519, 0); err != nil || len(keyPairs) != 0 {
+		t.Errorf("empty batch = %d keypairs, %v", len(keyPairs), err)
+	} else {
+		release()
+	}
+}
+
+func TestGenerateBatchParallelHoldsInstances(t *testing.T) {
+	pool := newTestPool(t, 1)
+
+	keyPairs, release, err := GenerateBatchParallel(pool, Ed25519, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyPairs[0].GetPublicKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, releaseEnv, err := pool.Acquire(ctx); err == nil {
+		releaseEnv()
+		t.Fatal("instance acquired while the batch holds it")
+	}
+
+	release()
+	// A second call is a no-op.
+	release()
+	_, releaseEnv, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaseEnv()
+}
+
+func TestGenerateBatchParallelClosedPool(t *testing.T) {
+	pool := newTestPool(t, 2)
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := GenerateBatchParallel(pool, Ed25519, 4); err == nil {
+		t.Fatal("batch generated from a closed pool")
+	}
+}
+
+func BenchmarkGenerateBatch(b *testing.B) {
+	const n = 64
+
+	b.Run("Serial", func(b *testing.B) {
+		env := wasmtest.Env(b)
+		for b.Loop() {
+			keyPairs, err := GenerateBatch(env, Ed25519, n)
+			if err != nil {
+				b.Fatal(err)
+			}
+			closeAll(keyPairs)
+		}
+	})
+
+	b.Run("Parallel", func(b *testing.B) {
+		pool := newTestPool(b, runtime.GOMAXPROCS(0))
+		// Instantiate the instances of the pool outside of the measure.
+		_, release, err := GenerateBatchParallel(pool, Ed25519, n)
+		if err != nil {
+			b.Fatal(err)
+		}
+		release()
+		for b.Loop() {
+			_, release, err := GenerateBatchParallel(pool, Ed25519, n)
+			if err != nil {
+				b.Fatal(err)
+			}
+			release()
+		}
+	})
+}
+
+// BenchmarkPoolSize generates keypairs from concurrent callers sharing a pool of one instance,
+// which serializes them, or of eight.
+func BenchmarkPoolSize(b *testing.B) {
+	for _, size := range []int{1, 8} {
+		b.Run(fmt.Sprintf("Instances%d", size), func(b *testing.B) {
+			pool := newTestPool(b, size)
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					env, release, err := pool.Acquire(context.Background())
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					keyPair := Invoke(*env)
+					if err := keyPair.New(Ed25519); err != nil {
+						b.Error(err)
+					}
+					_ = keyPair.Close()
+					release()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// The raw forms of the keys are the ones of their string form: the 32 byte seed of an ed25519 key
+// and the 32 byte scalar of a secp256r1 key, the 32 byte ed25519 point and the 33 byte compressed
+// secp256r1 point. PEM uses PKCS#8 and PKIX, JWK the OKP and EC key types of RFC 8037 and 7518.
+
+// jwk holds the members of a JSON Web Key used by biscuit keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+}
+
+// parseAlgorithm returns the algorithm named by the prefix of a key string.
+func parseAlgorithm(name string) (SignatureAlgorithm, error) {
+	for _, algorithm := range []SignatureAlgorithm{Ed25519, Secp256r1} {
+		if name == algorithm.String() {
+			return algorithm, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown algorithm %q", name)
+}
+
+// keyError returns the error the guest export function throws for a key whose hex part is
+// encoded, when it would reject it for its length or characters: checked before writing the key to
+// guest memory, with the message of the guest hex decoder. It returns nil for the other keys.
+func keyError(function string, encoded string, wrap func(message string) map[string]any) error {
+	if encoded == "" {
+		return wasm.NewGuestError(function, map[string]any{"InvalidKeySize": float64(0)})
+	}
+	if len(encoded)%2 != 0 {
+		return wasm.NewGuestError(function, wrap("Odd number of digits"))
+	}
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return wasm.NewGuestError(function, wrap(fmt.Sprintf("Invalid character %q at position %d", rune(c), i)))
+		}
+	}
+	return nil
+}
+
+// Algorithm returns the signature algorithm of the key.
+func (self PrivateKey) Algorithm() (SignatureAlgorithm, error) {
+	text, err := self.ToString()
+	if err != nil {
+		return 0, err
+	}
+	prefix, _, _ := strings.Cut(text, "-private/")
+	return parseAlgorithm(prefix)
+}
+
+// ToBytes returns the raw private key.
+func (self PrivateKey) ToBytes() ([]byte, error) {
+	if self.ptr == 0 {
+		return nil, fmt.Errorf("private key not initialized")
+	}
+	return keyToBytes(self.env, "privatekey_toBytes", self.ptr, 32)
+}
+
+// FromBytes loads a raw private key of algorithm.
+func (self *PrivateKey) FromBytes(algorithm SignatureAlgorithm, data []byte) error {
+	if _, err := parseAlgorithm(algorithm.String()); err != nil {
+		return err
+	}
+	if len(data) != 32 {
+		return fmt.Errorf("invalid %s private key: %d bytes, want 32", algorithm, len(data))
+	}
+	ptr, err := keyFromBytes(self.env, "privatekey_fromBytes", algorithm, data)
+	if err != nil {
+		return err
+	}
+	self.ptr = ptr
+	return nil
+}
+
+// ToHex returns the raw private key in hex.
+func (self PrivateKey) ToHex() (string, error) {
+	data, err := self.ToBytes()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// FromHex loads a raw private key of algorithm from hex.
+func (self *PrivateKey) FromHex(algorithm SignatureAlgorithm, encoded string) error {
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid private key hex: %w", err)
+	}
+	return self.FromBytes(algorithm, data)
+}
+
+// ToPEM returns the key as a PKCS#8 `PRIVATE KEY` PEM block.
+func (self PrivateKey) ToPEM() (string, error) {
+	algorithm, err := self.Algorithm()
+	if err != nil {
+		return "", err
+	}
+	data, err := self.ToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	var key any
+	switch algorithm {
+	case Ed25519:
+		key = ed25519.NewKeyFromSeed(data)
+	default:
+		if key, err = ecdh.P256().NewPrivateKey(data); err != nil {
+			return "", err
+		}
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// FromPEM loads an ed25519 or P-256 key from a PKCS#8 `PRIVATE KEY` PEM block.
+func (self *PrivateKey) FromPEM(data string) error {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return fmt.Errorf("no PRIVATE KEY PEM block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return self.FromBytes(Ed25519, key.Seed())
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+		}
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return err
+		}
+		return self.FromBytes(Secp256r1, ecdhKey.Bytes())
+	default:
+		return fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// ToJWK returns the key as a private JSON Web Key, its public part included.
+func (self PrivateKey) ToJWK() ([]byte, error) {
+	algorithm, err := self.Algorithm()
+	if err != nil {
+		return nil, err
+	}
+	data, err := self.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var public []byte
+	switch algorithm {
+	case Ed25519:
+		public = ed25519.NewKeyFromSeed(data).Public().(ed25519.PublicKey)
+	default:
+		key, err := ecdh.P256().NewPrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		public = compressP256(key.PublicKey().Bytes())
+	}
+	key, err := publicJWK(algorithm, public)
+	if err != nil {
+		return nil, err
+	}
+	key.D = base64.RawURLEncoding.EncodeToString(data)
+	return json.Marshal(key)
+}
+
+// FromJWK loads a private JSON Web Key, whose public part must match the private one.
+func (self *PrivateKey) FromJWK(data []byte) error {
+	var key jwk
+	if err := json.Unmarshal(data, &key); err != nil {
+		return fmt.Errorf("invalid JWK: %w", err)
+	}
+	algorithm, public, err := parsePublicJWK(key)
+	if err != nil {
+		return err
+	}
+	private, err := base64.RawURLEncoding.DecodeString(key.D)
+	if err != nil || len(private) == 0 {
+		return fmt.Errorf("invalid JWK: missing or invalid private key")
+	}
+
+	candidate := InvokePrivateKey(self.env)
+	if err := candidate.FromBytes(algorithm, private); err != nil {
+		return err
+	}
+	derived, err := candidate.ToJWK()
+	if err != nil {
+		return err
+	}
+	var derivedKey jwk
+	if err := json.Unmarshal(derived, &derivedKey); err != nil {
+		return err
+	}
+	if _, derivedPublic, err := parsePublicJWK(derivedKey); err != nil || subtle.ConstantTimeCompare(derivedPublic, public) != 1 {
+		_ = self.env.FreeObject("privatekey", candidate.ptr)
+		return fmt.Errorf("invalid JWK: public key does not match the private key")
+	}
+	self.ptr = candidate.ptr
+	return nil
+}
+
+// Equal reports whether both keys are the same key of the same algorithm.
+func (self PrivateKey) Equal(other PrivateKey) bool {
+	mine, err := self.ToString()
+	if err != nil {
+		return false
+	}
+	theirs, err := other.ToString()
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(mine), []byte(theirs)) == 1
+}
+
+// ToBytes returns the raw public key.
+func (self PublicKey) ToBytes() ([]byte, error) {
+	text, err := self.ToString()
+	if err != nil {
+		return nil, err
+	}
+	// publickey_toBytes only takes 32 byte arrays, and traps copying a 33 byte secp256r1 key into
+	// one: those keys are decoded from their string form.
+	if prefix, encoded, _ := strings.Cut(text, "/"); prefix != Ed25519.String() {
+		return hex.DecodeString(encoded)
+	}
+	return keyToBytes(self.env, "publickey_toBytes", self.ptr, ed25519.PublicKeySize)
+}
+
+// FromBytes loads a raw public key of algorithm.
+func (self *PublicKey) FromBytes(algorithm SignatureAlgorithm, data []byte) error {
+	if _, err := parseAlgorithm(algorithm.String()); err != nil {
+		return err
+	}
+	if size := publicKeySize(algorithm); len(data) != size {
+		return fmt.Errorf("invalid %s public key: %d bytes, want %d", algorithm, len(data), size)
+	}
+	ptr, err := keyFromBytes(self.env, "publickey_fromBytes", algorithm, data)
+	if err != nil {
+		return err
+	}
+	self.ptr = ptr
+	return nil
+}
+
+// publicKeySize returns the length of the raw public keys of algorithm.
+func publicKeySize(algorithm SignatureAlgorithm) int {
+	if algorithm == Secp256r1 {
+		return 33
+	}
+	return ed25519.PublicKeySize
+}
+
+// keyToBytes calls the toBytes export function of the key at ptr, which writes the size bytes of
+// the raw key into the Uint8Array it is given.
+func keyToBytes(env wasm.WasmEnv, function string, ptr uint64, size int) ([]byte, error) {
+	out := make([]byte, size)
+	err := env.WithScope(func(s *wasm.Scope) error {
+		outPtr, outLen, err := s.WriteBytes(out)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(outPtr)
+		return env.CallFallibleVoid(function, ptr, outPtr, outLen, s.NewUint8Array(out))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// keyFromBytes calls the fromBytes export function of a key type with a raw key of algorithm and
+// returns the pointer of the key.
+func keyFromBytes(env wasm.WasmEnv, function string, algorithm SignatureAlgorithm, data []byte) (uint64, error) {
+	var ptr uint64
+	err := env.WithScope(func(s *wasm.Scope) error {
+		dataPtr, dataLen, err := s.WriteBytes(data)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(dataPtr)
+		ptr, err = env.CallFallible(function, dataPtr, dataLen, uint64(algorithm))
+		return err
+	})
+	return ptr, err
+}
+
+// ToHex returns the raw public key in hex.
+func (self PublicKey) ToHex() (string, error) {
+	data, err := self.ToBytes()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// FromHex loads a raw public key of algorithm from hex.
+func (self *PublicKey) FromHex(algorithm SignatureAlgorithm, encoded string) error {
+	data, err := hex.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid public key hex: %w", err)
+	}
+	return self.FromBytes(algorithm, data)
+}
+
+// ToPEM returns the key as a PKIX `PUBLIC KEY` PEM block.
+func (self PublicKey) ToPEM() (string, error) {
+	algorithm, err := self.Algorithm()
+	if err != nil {
+		return "", err
+	}
+	data, err := self.ToBytes()
+	if err != nil {
+		return "", err
+	}
+
+	var key any = ed25519.PublicKey(data)
+	if algorithm == Secp256r1 {
+		uncompressed, err := decompressP256(data)
+		if err != nil {
+			return "", err
+		}
+		if key, err = ecdh.P256().NewPublicKey(uncompressed); err != nil {
+			return "", err
+		}
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// FromPEM loads an ed25519 or P-256 key from a PKIX `PUBLIC KEY` PEM block.
+func (self *PublicKey) FromPEM(data string) error {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return fmt.Errorf("no PUBLIC KEY PEM block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		return self.FromBytes(Ed25519, key)
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+		}
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return err
+		}
+		return self.FromBytes(Secp256r1, compressP256(ecdhKey.Bytes()))
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// ToJWK returns the key as a public JSON Web Key.
+func (self PublicKey) ToJWK() ([]byte, error) {
+	algorithm, err := self.Algorithm()
+	if err != nil {
+		return nil, err
+	}
+	data, err := self.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	key, err := publicJWK(algorithm, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(key)
+}
+
+// FromJWK loads a public JSON Web Key, ignoring its private part if any.
+func (self *PublicKey) FromJWK(data []byte) error {
+	var key jwk
+	if err := json.Unmarshal(data, &key); err != nil {
+		return fmt.Errorf("invalid JWK: %w", err)
+	}
+	algorithm, public, err := parsePublicJWK(key)
+	if err != nil {
+		return err
+	}
+	return self.FromBytes(algorithm, public)
+}
+
+// Equal reports whether both keys are the same key of the same algorithm.
+func (self PublicKey) Equal(other PublicKey) bool {
+	mine, err := self.ToString()
+	if err != nil {
+		return false
+	}
+	theirs, err := other.ToString()
+	return err == nil && mine == theirs
+}
+
+// publicJWK returns the JWK of a raw public key.
+func publicJWK(algorithm SignatureAlgorithm, public []byte) (jwk, error) {
+	switch algorithm {
+	case Ed25519:
+		return jwk{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(public)}, nil
+	case Secp256r1:
+		uncompressed, err := decompressP256(public)
+		if err != nil {
+			return jwk{}, err
+		}
+		return jwk{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(uncompressed[1:33]),
+			Y:   base64.RawURLEncoding.EncodeToString(uncompressed[33:]),
+		}, nil
+	default:
+		return jwk{}, fmt.Errorf("unknown algorithm %s", algorithm)
+	}
+}
+
+// parsePublicJWK returns the algorithm and raw public key of a JWK.
+func parsePublicJWK(key jwk) (SignatureAlgorithm, []byte, error) {
+	x, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid JWK x: %w", err)
+	}
+
+	switch {
+	case key.Kty == "OKP" && key.Crv == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return 0, nil, fmt.Errorf("invalid JWK: %d bytes Ed25519 key", len(x))
+		}
+		return Ed25519, x, nil
+	case key.Kty == "EC" && key.Crv == "P-256":
+		y, err := base64.RawURLEncoding.DecodeString(key.Y)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid JWK y: %w", err)
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return 0, nil, fmt.Errorf("invalid JWK: P-256 coordinates of %d and %d bytes", len(x), len(y))
+		}
+		uncompressed := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(uncompressed); err != nil {
+			return 0, nil, fmt.Errorf("invalid JWK: %w", err)
+		}
+		return Secp256r1, compressP256(uncompressed), nil
+	default:
+		return 0, nil, fmt.Errorf("unsupported JWK key type %q curve %q", key.Kty, key.Crv)
+	}
+}
+
+// compressP256 turns an uncompressed P-256 point into its compressed form.
+func compressP256(uncompressed []byte) []byte {
+	compressed := make([]byte, 33)
+	compressed[0] = 2 | uncompressed[64]&1
+	copy(compressed[1:], uncompressed[1:33])
+	return compressed
+}
+
+// decompressP256 turns a compressed P-256 point into its uncompressed form.
+func decompressP256(compressed []byte) ([]byte, error) {
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), compressed)
+	if x == nil {
+		return nil, fmt.Errorf("invalid compressed P-256 point")
+	}
+	uncompressed := make([]byte, 65)
+	uncompressed[0] = 4
+	x.FillBytes(uncompressed[1:33])
+	y.FillBytes(uncompressed[33:])
+	return uncompressed, nil
+}
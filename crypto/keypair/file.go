@@ -0,0 +1,162 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInsecureKeyFile is returned by LoadFromDir when the private key file can be read by other
+// users than its owner.
+var ErrInsecureKeyFile = errors.New("private key file readable by group or others")
+
+// algorithmHeader starts the first line of key files, e.g. `# algorithm: ed25519`.
+const algorithmHeader = "# algorithm: "
+
+// rename is os.Rename, swapped by tests to simulate a crash before a key file is in place.
+var rename = os.Rename
+
+// KeyFiles returns the paths SaveToFile writes the keys named name to: `<name>.key` for the
+// private key and `<name>.pub` for the public one.
+func KeyFiles(dir, name string) (privatePath, publicPath string) {
+	return filepath.Join(dir, name+".key"), filepath.Join(dir, name+".pub")
+}
+
+// SaveToFile writes the private key of keyPair to `<dir>/<name>.key`, readable by its owner only,
+// and its public key to `<dir>/<name>.pub`. Each file holds an algorithm header line then the
+// prefixed key, and replaces the previous one atomically.
+func SaveToFile(keyPair *KeyPair, dir, name string) error {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		return fmt.Errorf("invalid key name %q", name)
+	}
+
+	publicKey, err := keyPair.GetPublicKey()
+	if err != nil {
+		return err
+	}
+	algorithm, err := publicKey.Algorithm()
+	if err != nil {
+		return err
+	}
+	public, err := publicKey.ToString()
+	if err != nil {
+		return err
+	}
+	privateKey, err := keyPair.GetPrivateKey()
+	if err != nil {
+		return err
+	}
+	private, err := privateKey.Reveal()
+	if err != nil {
+		return err
+	}
+
+	privatePath, publicPath := KeyFiles(dir, name)
+	if err := writeFileAtomic(privatePath, keyFileContent(algorithm, private), 0o600); err != nil {
+		return err
+	}
+	return writeFileAtomic(publicPath, keyFileContent(algorithm, public), 0o644)
+}
+
+// LoadFromDir reads back the keys SaveToFile wrote for name in env. The private key file must not
+// be accessible to group or others, and the public key must match it.
+func LoadFromDir(env wasm.WasmEnv, dir, name string) (*KeyPair, error) {
+	privatePath, publicPath := KeyFiles(dir, name)
+
+	info, err := os.Stat(privatePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("%w: %s has mode %s", ErrInsecureKeyFile, privatePath, info.Mode().Perm())
+	}
+
+	private, err := readKeyFile(privatePath)
+	if err != nil {
+		return nil, err
+	}
+	public, err := readKeyFile(publicPath)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey := InvokePrivateKey(env)
+	if err := privateKey.FromString(private); err != nil {
+		return nil, fmt.Errorf("%s: %w", privatePath, err)
+	}
+	keyPair := Invoke(env)
+	if err := keyPair.FromPrivateKey(privateKey); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := keyPair.GetPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	derived, err := publicKey.ToString()
+	if err != nil {
+		return nil, err
+	}
+	if derived != public {
+		return nil, fmt.Errorf("%s does not hold the public key of %s", publicPath, privatePath)
+	}
+	return keyPair, nil
+}
+
+func keyFileContent(algorithm SignatureAlgorithm, key string) []byte {
+	return []byte(algorithmHeader + algorithm.String() + "\n" + key + "\n")
+}
+
+// readKeyFile returns the key of a file written by SaveToFile, checking it is prefixed with the
+// algorithm of the header.
+func readKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	header, key, _ := strings.Cut(string(data), "\n")
+	algorithm, ok := strings.CutPrefix(header, algorithmHeader)
+	if !ok {
+		return "", fmt.Errorf("%s: missing algorithm header", path)
+	}
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, algorithm+"/") && !strings.HasPrefix(key, algorithm+"-private/") {
+		return "", fmt.Errorf("%s: key is not a %s key", path, algorithm)
+	}
+	return key, nil
+}
+
+// writeFileAtomic writes data to a temporary file of the directory of path, then renames it to
+// path, so readers see either the previous content or the new one, never a truncated file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	temp := file.Name()
+	defer func() { _ = os.Remove(temp) }()
+
+	if err := file.Chmod(perm); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := rename(temp, path); err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyFileRoundTrip(t *testing.T) {
+	env := wasmtest.Env(t)
+	dir := t.TempDir()
+
+	for _, algorithm := range []SignatureAlgorithm{Ed25519, Secp256r1} {
+		pair := Invoke(env)
+		if err := pair.New(algorithm); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveToFile(pair, dir, algorithm.String()); err != nil {
+			t.Fatal(err)
+		}
+
+		privatePath, publicPath := KeyFiles(dir, algorithm.String())
+		for path, want := range map[string]os.FileMode{privatePath: 0o600, publicPath: 0o644} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != want {
+				t.Errorf("%s has mode %s, want %s", path, info.Mode().Perm(), want)
+			}
+		}
+
+		loaded, err := LoadFromDir(env, dir, algorithm.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pair := range []*KeyPair{pair, loaded} {
+			private, err := pair.GetPrivateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := private.Reveal(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		original, err := pair.GetPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		reloaded, err := loaded.GetPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := original.ToString()
+		if got, _ := reloaded.ToString(); got != want {
+			t.Errorf("%s: loaded public key %s, want %s", algorithm, got, want)
+		}
+	}
+
+	if err := SaveToFile(Invoke(env), dir, "../escape"); err == nil {
+		t.Error("key name with a path separator accepted")
+	}
+}
+
+func TestKeyFileInsecurePermissions(t *testing.T) {
+	env := wasmtest.Env(t)
+	dir := t.TempDir()
+
+	pair := Invoke(env)
+	if err := pair.New(Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveToFile(pair, dir, "root"); err != nil {
+		t.Fatal(err)
+	}
+	privatePath, _ := KeyFiles(dir, "root")
+	if err := os.Chmod(privatePath, 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadFromDir(env, dir, "root"); !errors.Is(err, ErrInsecureKeyFile) {
+		t.Errorf("err = %v, want ErrInsecureKeyFile", err)
+	}
+}
+
+func TestKeyFileAtomicWrite(t *testing.T) {
+	env := wasmtest.Env(t)
+	dir := t.TempDir()
+
+	pair := Invoke(env)
+	if err := pair.New(Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveToFile(pair, dir, "root"); err != nil {
+		t.Fatal(err)
+	}
+	privatePath, _ := KeyFiles(dir, "root")
+	before, err := os.ReadFile(privatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crash := errors.New("crash")
+	rename = func(string, string) error { return crash }
+	t.Cleanup(func() { rename = os.Rename })
+
+	other := Invoke(env)
+	if err := other.New(Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveToFile(other, dir, "root"); !errors.Is(err, crash) {
+		t.Fatalf("err = %v, want the simulated crash", err)
+	}
+	if err := SaveToFile(other, dir, "fresh"); !errors.Is(err, crash) {
+		t.Fatalf("err = %v, want the simulated crash", err)
+	}
+
+	after, err := os.ReadFile(privatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Error("failed write changed the existing key")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 2 || names[0] != "root.key" || names[1] != "root.pub" {
+		t.Errorf("directory holds %v after failed writes, want only root.key and root.pub", names)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fresh.key")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial key file left: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// checkFuzzResult fails when err is a guest trap rather than an error returned by the guest or the
+// host side validation.
+func checkFuzzResult(t *testing.T, input string, err error) {
+	t.Helper()
+
+	var guestErr *wasm.GuestError
+	if err != nil && !errors.As(err, &guestErr) && strings.Contains(err.Error(), "wasm error") {
+		t.Fatalf("input %q trapped: %v", input, err)
+	}
+}
+
+func FuzzPrivateKeyFromString(f *testing.F) {
+	env := wasmtest.Env(f)
+	for _, seed := range []string{
+		"ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb",
+		"secp256r1-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb",
+		"ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55ab",
+		"ed25519-private/zz",
+		"ed25519/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb",
+		"secp256r1-private/ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+		"-private/",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data string) {
+		key := InvokePrivateKey(env)
+		err := key.FromString(data)
+		checkFuzzResult(t, data, err)
+		if err == nil {
+			_ = env.FreeObject("privatekey", key.ptr)
+		}
+	})
+}
+
+func FuzzPublicKeyFromString(f *testing.F) {
+	env := wasmtest.Env(f)
+	for _, seed := range []string{
+		"ed25519/412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59",
+		"secp256r1/02412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59",
+		"secp256r1/04412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59",
+		"ed25519/412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea5",
+		"ed25519/",
+		"ed25519",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data string) {
+		key := InvokePublicKey(env)
+		err := key.FromString(data)
+		checkFuzzResult(t, data, err)
+		if err == nil {
+			_ = env.FreeObject("publickey", key.ptr)
+		}
+	})
+}
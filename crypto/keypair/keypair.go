@@ -6,13 +6,26 @@ import (
 	"log/slog"
 )
 
+// SignatureAlgorithm is the algorithm of a key, its value the discriminant of the guest enum.
 type SignatureAlgorithm int
 
 const (
-	Ed25519   SignatureAlgorithm = iota
-	Secp256r1                    = iota
+	Ed25519 SignatureAlgorithm = iota
+	Secp256r1
 )
 
+// String returns the name of the algorithm used as key prefix, e.g. `ed25519`.
+func (self SignatureAlgorithm) String() string {
+	switch self {
+	case Ed25519:
+		return "ed25519"
+	case Secp256r1:
+		return "secp256r1"
+	default:
+		return fmt.Sprintf("SignatureAlgorithm(%d)", int(self))
+	}
+}
+
 type KeyPair struct {
 	env wasm.WasmEnv
 	ptr uint64
@@ -23,13 +36,22 @@ func Invoke(env wasm.WasmEnv) *KeyPair {
 	return KeyPair
 }
 
+// LogValue keeps the private key out of logs.
+func (self *KeyPair) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (self *KeyPair) String() string {
+	return redacted
+}
+
 func (self *KeyPair) New(signatureAlgorithm SignatureAlgorithm) error {
 	function, err := self.env.GetFunction("keypair_new")
 	if err != nil {
 		return err
 	}
 
-	result, err := self.env.Call(function, uint64(signatureAlgorithm))
+	result, err := self.env.WithOperation("keypair.generate").Call(function, uint64(signatureAlgorithm))
 	if err != nil {
 		return fmt.Errorf("keypair_new failed: %w", err)
 	}
@@ -43,23 +65,38 @@ func (self *KeyPair) New(signatureAlgorithm SignatureAlgorithm) error {
 	return nil
 }
 
+// Close frees the keypair in the guest.
+func (self *KeyPair) Close() error {
+	err := self.env.FreeObject("keypair", self.ptr)
+	self.ptr = 0
+	return err
+}
+
+// Algorithm returns the signature algorithm of the keypair, read back from its public key.
+func (self *KeyPair) Algorithm() (SignatureAlgorithm, error) {
+	public, err := self.GetPublicKey()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = self.env.FreeObject("publickey", public.ptr) }()
+
+	return public.Algorithm()
+}
+
 func (self *KeyPair) GetPublicKey() (PublicKey, error) {
 
 	if self.ptr == 0 {
-		slog.Error("keypair not initialized")
 		return PublicKey{}, fmt.Errorf("keypair not initialized")
 	}
 
 	function, err := self.env.GetFunction("keypair_getPublicKey")
-	if function != nil {
-		slog.Error("exported function 'keypair_getPublicKey' not found")
+	if err != nil {
 		return PublicKey{}, err
 	}
 
 	result, err := self.env.Call(function, self.ptr)
 	if err != nil {
-		slog.Error("keypair_getPublicKey failed", slog.Any("err", err))
-		return PublicKey{}, err
+		return PublicKey{}, fmt.Errorf("keypair_getPublicKey failed: %w", err)
 	}
 
 	return PublicKey{
@@ -76,14 +113,12 @@ func (self *KeyPair) GetPrivateKey() (PrivateKey, error) {
 
 	function, err := self.env.GetFunction("keypair_getPrivateKey")
 	if err != nil {
-		slog.Error("exported function 'keypair_getPrivateKey' not found")
 		return PrivateKey{}, err
 	}
 
 	result, err := self.env.Call(function, self.ptr)
 	if err != nil {
-		slog.Error("keypair_getPrivateKey failed", slog.Any("err", err))
-		return PrivateKey{}, err
+		return PrivateKey{}, fmt.Errorf("keypair_getPrivateKey failed: %w", err)
 	}
 
 	return PrivateKey{
@@ -96,15 +131,12 @@ func (self *KeyPair) FromPrivateKey(privateKey PrivateKey) error {
 
 	function, err := self.env.GetFunction("keypair_fromPrivateKey")
 	if err != nil {
-		slog.Error("exported function 'keypair_fromPrivateKey' not found")
 		return err
 	}
 
 	result, err := self.env.Call(function, privateKey.ptr)
-
 	if err != nil {
-		slog.Error("keypair_fromPrivateKey failed", slog.Any("err", err))
-		return err
+		return fmt.Errorf("keypair_fromPrivateKey failed: %w", err)
 	}
 
 	if len(result) == 0 {
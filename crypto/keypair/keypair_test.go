@@ -0,0 +1,78 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecp256r1KeyPair(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	// Typed constants print through String.
+	if got := fmt.Sprint(Ed25519, " ", Secp256r1); got != "ed25519 secp256r1" {
+		t.Errorf("algorithms print as %q", got)
+	}
+
+	for _, algorithm := range []SignatureAlgorithm{Ed25519, Secp256r1} {
+		pair := Invoke(env)
+		if err := pair.New(algorithm); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = pair.Close() }()
+		if got, err := pair.Algorithm(); err != nil || got != algorithm {
+			t.Errorf("%s: Algorithm = %s, %v", algorithm, got, err)
+		}
+
+		private, err := pair.GetPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = env.FreeObject("privatekey", private.Ptr()) }()
+		text, err := private.ToString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(text, algorithm.String()+"-private/") {
+			t.Errorf("%s: private key %q, want the %s-private/ prefix", algorithm, text[:min(len(text), 20)], algorithm)
+		}
+
+		parsed := InvokePrivateKey(env)
+		if err := parsed.FromString(text); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = env.FreeObject("privatekey", parsed.Ptr()) }()
+		if !parsed.Equal(private) {
+			t.Errorf("%s: private key changed through its string form", algorithm)
+		}
+
+		restored := Invoke(env)
+		if err := restored.FromPrivateKey(parsed); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = restored.Close() }()
+		if got, err := restored.Algorithm(); err != nil || got != algorithm {
+			t.Errorf("%s: restored Algorithm = %s, %v", algorithm, got, err)
+		}
+	}
+}
+
+func TestKeyPairCallContext(t *testing.T) {
+	env := wasmtest.Env(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	keyPair := Invoke(env.WithCallContext(ctx))
+	if err := keyPair.New(Ed25519); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+
+	keyPair = Invoke(env.WithCallContext(context.Background()))
+	if err := keyPair.New(Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = keyPair.Close() }()
+}
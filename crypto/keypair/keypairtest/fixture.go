@@ -0,0 +1,29 @@
+package keypairtest
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"testing"
+)
+
+// SeededPrivateKey is the private key of KeyPair. It is fixed, so that what tests sign with it
+// can be compared across runs.
+const SeededPrivateKey = "ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb"
+
+// KeyPair returns the keypair of SeededPrivateKey, loaded in env and closed when the test ends.
+func KeyPair(t testing.TB, env wasm.WasmEnv) *keypair.KeyPair {
+	t.Helper()
+
+	privateKey := keypair.InvokePrivateKey(env)
+	if err := privateKey.FromString(SeededPrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("privatekey", privateKey.Ptr()) }()
+
+	keyPair := keypair.Invoke(env)
+	if err := keyPair.FromPrivateKey(privateKey); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = keyPair.Close() })
+	return keyPair
+}
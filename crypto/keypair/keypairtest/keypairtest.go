@@ -0,0 +1,81 @@
+// Package keypairtest provides testing/quick generators of keys for property tests, and fixed
+// keys for the other tests.
+package keypairtest
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"math/rand"
+	"reflect"
+)
+
+// p256Order is the order of the P-256 group, private scalars are in [1, p256Order-1].
+var p256Order, _ = new(big.Int).SetString("ffffffff00000000ffffffffffffffffbce6faada7179e84f3b9cac2fc632551", 16)
+
+// Seed is a private key of either algorithm, as its raw bytes. One in four generated seeds is an
+// edge case: the lowest or highest valid key of the algorithm.
+type Seed struct {
+	Algorithm keypair.SignatureAlgorithm
+	Bytes     []byte
+}
+
+// Generate implements quick.Generator.
+func (Seed) Generate(rand *rand.Rand, size int) reflect.Value {
+	seed := Seed{Algorithm: keypair.Ed25519}
+	if rand.Intn(2) == 1 {
+		seed.Algorithm = keypair.Secp256r1
+	}
+
+	switch rand.Intn(8) {
+	case 0:
+		seed.Bytes = lowest(seed.Algorithm)
+	case 1:
+		seed.Bytes = highest(seed.Algorithm)
+	default:
+		seed.Bytes = make([]byte, 32)
+		for {
+			rand.Read(seed.Bytes)
+			if valid(seed.Algorithm, seed.Bytes) {
+				break
+			}
+		}
+	}
+	return reflect.ValueOf(seed)
+}
+
+// PrivateKey loads the seed in env.
+func (self Seed) PrivateKey(env wasm.WasmEnv) (keypair.PrivateKey, error) {
+	key := keypair.InvokePrivateKey(env)
+	err := key.FromBytes(self.Algorithm, self.Bytes)
+	return key, err
+}
+
+// String prints the seed the way quick reports failing inputs.
+func (self Seed) String() string {
+	return self.Algorithm.String() + "/" + hex.EncodeToString(self.Bytes)
+}
+
+func lowest(algorithm keypair.SignatureAlgorithm) []byte {
+	if algorithm == keypair.Ed25519 {
+		return make([]byte, 32)
+	}
+	return big.NewInt(1).FillBytes(make([]byte, 32))
+}
+
+func highest(algorithm keypair.SignatureAlgorithm) []byte {
+	if algorithm == keypair.Ed25519 {
+		return bytes.Repeat([]byte{0xff}, 32)
+	}
+	return new(big.Int).Sub(p256Order, big.NewInt(1)).FillBytes(make([]byte, 32))
+}
+
+func valid(algorithm keypair.SignatureAlgorithm, data []byte) bool {
+	if algorithm == keypair.Ed25519 {
+		return true
+	}
+	scalar := new(big.Int).SetBytes(data)
+	return scalar.Sign() > 0 && scalar.Cmp(p256Order) < 0
+}
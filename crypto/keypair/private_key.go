@@ -2,10 +2,10 @@ package keypair
 
 import (
 	"biscuit-wasm-go/wasm"
-	"encoding/binary"
-	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"unicode/utf8"
 )
 
 type PrivateKey struct {
@@ -17,105 +17,70 @@ func InvokePrivateKey(env wasm.WasmEnv) PrivateKey {
 	return PrivateKey{env: env, ptr: 0}
 }
 
-func (self PrivateKey) ToString() (string, error) {
-	if self.ptr == 0 {
-		slog.Error("private key not initialized")
-		return "", fmt.Errorf("private key not initialized")
-	}
-
-	function, err := self.env.GetFunction("privatekey_toString")
-	if err != nil {
-		slog.Error("exported function 'privatekey_toString' not found")
-		return "", err
-	}
-
-	outPtr, err := self.env.Malloc(8)
-	if err != nil {
-		slog.Error("malloc failed", slog.Any("err", err))
-		return "", err
-	}
-
-	_, err = self.env.Call(function, outPtr, self.ptr)
-	if err != nil {
-		slog.Error("privatekey_toString failed", slog.Any("err", err))
-		return "", err
-	}
-
-	return self.env.GetStringValueFromPointer(outPtr)
+// Ptr returns the guest pointer of the key so other bindings can pass it to exports.
+func (self PrivateKey) Ptr() uint64 {
+	return self.ptr
 }
 
-func (self *PrivateKey) FromString(data string) error {
-	// Note: Go strings are UTF-8 already. We must copy bytes into WASM memory
-	// and pass (ptr, len) according to wasm-bindgen ABI.
-
-	function, err := self.env.GetFunction("privatekey_fromString")
-	if err != nil {
-		return err
-	}
+// redacted is how keys render in logs.
+const redacted = "[REDACTED]"
 
-	mem, err := self.env.GetMemory()
-	if err != nil {
-		return fmt.Errorf("exported memory not found")
-	}
+// LogValue keeps the key out of logs, use Reveal when the key material is really needed.
+func (self PrivateKey) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
 
-	size := uint64(16)
+// String keeps the key out of formatted output, use Reveal when the key material is really needed.
+func (self PrivateKey) String() string {
+	return redacted
+}
 
-	// Allocate return area (3 u32 values: value_ptr, error_ptr, is_err)
-	retPtr, err := self.env.Malloc(size)
-	if err != nil {
-		return fmt.Errorf("malloc for return area failed: %w", err)
-	}
+// Reveal returns the textual form of the key, see ToString. It exists so code handing out key
+// material reads as deliberate.
+func (self PrivateKey) Reveal() (string, error) {
+	return self.ToString()
+}
 
-	// Prepare UTF-8 bytes from data
-	bytes := []byte(data)
-	// Allocate buffer for string bytes
-	strPtr, err := self.env.Malloc(uint64(len(bytes)))
-	if err != nil {
-		_ = self.env.Free(retPtr, size)
-		return fmt.Errorf("malloc for string failed: %w", err)
+func (self PrivateKey) ToString() (string, error) {
+	if self.ptr == 0 {
+		return "", fmt.Errorf("private key not initialized")
 	}
 
-	// Write bytes into memory
-	if ok := mem.Write(uint32(strPtr), bytes); !ok {
-
-		_ = self.env.Free(retPtr, size)
-		_ = self.env.Free(strPtr, uint64(len(bytes)))
-
-		return fmt.Errorf("cannot write string bytes to wasm memory")
-	}
+	return self.env.CallString("privatekey_toString", self.ptr)
+}
 
-	// Call: privatekey_fromString(out_ptr, str_ptr, str_len)
-	_, err = self.env.Call(function, retPtr, strPtr, uint64(len(bytes)))
-	if err != nil {
-		_ = self.env.Free(retPtr, size)
-		_ = self.env.Free(strPtr, uint64(len(bytes)))
-		return fmt.Errorf("privatekey_fromString failed: %w", err)
+// FromString parses the `<algorithm>-private/<hex>` form of a private key, the one ToString
+// returns.
+func (self *PrivateKey) FromString(data string) error {
+	prefix, encoded, _ := strings.Cut(data, "/")
+	if name, ok := strings.CutSuffix(prefix, "-private"); ok {
+		if _, err := parseAlgorithm(name); err == nil {
+			if err := keyError("privatekey_fromString", encoded, func(message string) map[string]any {
+				return map[string]any{"InvalidKey": message}
+			}); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Read result triple
-	buf, ok := mem.Read(uint32(retPtr), uint32(size))
-	if !ok {
-		_ = self.env.Free(retPtr, size)
-		_ = self.env.Free(strPtr, uint64(len(bytes)))
-		return fmt.Errorf("cannot read return area")
+	// The guest takes strings as valid UTF-8 and traps on anything else.
+	if !utf8.ValidString(data) {
+		return wasm.ErrInvalidUTF8
 	}
-	valuePtr := binary.LittleEndian.Uint32(buf[0:4])
-	errPtr := binary.LittleEndian.Uint32(buf[4:8])
-	isErr := int32(binary.LittleEndian.Uint32(buf[8:12]))
 
-	// Free the temporary inputs and return area
-	_ = self.env.Free(retPtr, size)
-	_ = self.env.Free(strPtr, uint64(len(bytes)))
-
-	if isErr != 0 {
+	return self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(data)
+		if err != nil {
+			return err
+		}
 
-		serr, err := self.env.GetError(uint64(errPtr))
+		s.Handoff(strPtr)
+		ptr, err := self.env.CallFallible("privatekey_fromString", strPtr, strLen)
 		if err != nil {
-			return fmt.Errorf("cannot get error string: %w", err)
+			return err
 		}
-		return errors.New(serr)
-	}
 
-	self.ptr = uint64(valuePtr)
-	return nil
+		self.ptr = ptr
+		return nil
+	})
 }
@@ -1,11 +1,70 @@
 package keypair
 
-// Placeholder test file previously had incomplete references that broke `go test`.
-// Keeping the package testable without undefined symbols.
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+)
 
-import "testing"
+func TestPrivateKeyFromString(t *testing.T) {
+	env := wasmtest.Env(t).WithAllocationTracking()
 
-func TestPrivateKey_FromString_Placeholder(t *testing.T) {
-	// Intentionally empty: real integration tests should initialize the WASM env
-	// and exercise PrivateKey.FromString against the compiled module.
+	const text = "ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb"
+	key := InvokePrivateKey(env)
+	if err := key.FromString(text); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("privatekey", key.Ptr()) }()
+	if got, err := key.ToString(); err != nil || got != text {
+		t.Errorf("ToString = %q, %v, want %q", got, err, text)
+	}
+
+	var guestErr *wasm.GuestError
+	malformed := InvokePrivateKey(env)
+	if err := malformed.FromString("ed25519-private/zz"); !errors.As(err, &guestErr) {
+		t.Errorf("malformed key = %v, want a *wasm.GuestError", err)
+	}
+	if err := malformed.FromString("\xff"); !errors.Is(err, wasm.ErrInvalidUTF8) {
+		t.Errorf("invalid UTF-8 = %v, want ErrInvalidUTF8", err)
+	}
+	// The guest reclaims the string it parses, successfully or not: nothing is left to free.
+	if allocations := env.Stats().Allocations; allocations != 0 {
+		t.Errorf("%d allocations left", allocations)
+	}
+}
+
+// BenchmarkPrivateKeyToString measures ToString with logging disabled, on success and on the
+// error path which used to build log attributes.
+func BenchmarkPrivateKeyToString(b *testing.B) {
+	env := wasmtest.Env(b)
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1})))
+	b.Cleanup(func() { slog.SetDefault(previous) })
+
+	key := InvokePrivateKey(env)
+	if err := key.FromString("ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("OK", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := key.ToString(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Uninitialized", func(b *testing.B) {
+		b.ReportAllocs()
+		uninitialized := InvokePrivateKey(env)
+		for b.Loop() {
+			if _, err := uninitialized.ToString(); err == nil {
+				b.Fatal("uninitialized key rendered")
+			}
+		}
+	})
 }
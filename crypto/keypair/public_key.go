@@ -2,6 +2,10 @@ package keypair
 
 import (
 	"biscuit-wasm-go/wasm"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
 )
 
 type PublicKey struct {
@@ -9,16 +13,92 @@ type PublicKey struct {
 	ptr uint64
 }
 
-//func (self PublicKey) ToString() (string, error) {
-//	if self.ptr == 0 {
-//		return "", fmt.Errorf("public key not initialized")
-//	}
-//
-//	function, err := self.env.GetFunction("public_key_toString")
-//	if err != nil {
-//		slog.Error("exported function 'public_key_toString' not found")
-//		return "", err
-//	}
-//
-//	return "", nil
-//}
+func InvokePublicKey(env wasm.WasmEnv) PublicKey {
+	return PublicKey{env: env, ptr: 0}
+}
+
+// Ptr returns the guest pointer of the key so other bindings can pass it to exports.
+func (self PublicKey) Ptr() uint64 {
+	return self.ptr
+}
+
+// Env returns the env the key lives in, the one bindings using Ptr must call.
+func (self PublicKey) Env() wasm.WasmEnv {
+	return self.env
+}
+
+// FromString parses the `<algorithm>/<hex>` form of a public key, e.g. `ed25519/412e...`.
+func (self *PublicKey) FromString(data string) error {
+	prefix, encoded, found := strings.Cut(data, "/")
+	if !found {
+		return fmt.Errorf("invalid public key %q: missing algorithm prefix", data)
+	}
+
+	algorithm, err := parseAlgorithm(prefix)
+	if err != nil {
+		return fmt.Errorf("invalid public key %q: %w", data, err)
+	}
+	if err := keyError("publickey_fromString", encoded, func(message string) map[string]any {
+		return map[string]any{"Format": map[string]any{"InvalidKey": "could not deserialize hex encoded key: " + message}}
+	}); err != nil {
+		return err
+	}
+
+	return self.env.WithScope(func(s *wasm.Scope) error {
+		strPtr, strLen, err := s.WriteString(encoded)
+		if err != nil {
+			return err
+		}
+
+		s.Handoff(strPtr)
+		ptr, err := self.env.CallFallible("publickey_fromString", strPtr, strLen, uint64(algorithm))
+		if err != nil {
+			return err
+		}
+
+		self.ptr = ptr
+		return nil
+	})
+}
+
+// ToString returns the `<algorithm>/<hex>` form of the key, the one FromString parses.
+func (self PublicKey) ToString() (string, error) {
+	if self.ptr == 0 {
+		return "", fmt.Errorf("public key not initialized")
+	}
+	return self.env.CallString("publickey_toString", self.ptr)
+}
+
+// Algorithm returns the signature algorithm of the key.
+func (self PublicKey) Algorithm() (SignatureAlgorithm, error) {
+	text, err := self.ToString()
+	if err != nil {
+		return 0, err
+	}
+	prefix, _, _ := strings.Cut(text, "/")
+	algorithm, err := parseAlgorithm(prefix)
+	if err != nil {
+		return 0, fmt.Errorf("public key %q: %w", text, err)
+	}
+	return algorithm, nil
+}
+
+// Fingerprint returns `sha256:<hex>`, the sha256 of the raw bytes of the key.
+func (self PublicKey) Fingerprint() (string, error) {
+	text, err := self.ToString()
+	if err != nil {
+		return "", err
+	}
+	return Fingerprint(text)
+}
+
+// Fingerprint returns the fingerprint of the `<algorithm>/<hex>` form of a public key.
+func Fingerprint(publicKey string) (string, error) {
+	_, encoded, _ := strings.Cut(publicKey, "/")
+	raw, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key %q: %w", publicKey, err)
+	}
+	sum := sha256.Sum256(raw)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,132 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUninitializedPublicKey(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	for name, key := range map[string]PublicKey{"InvokePublicKey": InvokePublicKey(env), "zero value": {}} {
+		if key.Ptr() != 0 {
+			t.Errorf("%s: Ptr = %d, want 0", name, key.Ptr())
+		}
+		if text, err := key.ToString(); err == nil {
+			t.Errorf("%s: ToString = %q, want an error", name, text)
+		}
+		if _, err := key.Algorithm(); err == nil {
+			t.Errorf("%s: Algorithm succeeded", name)
+		}
+		if _, err := key.Fingerprint(); err == nil {
+			t.Errorf("%s: Fingerprint succeeded", name)
+		}
+	}
+}
+
+func TestPublicKeyToString(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	pair := Invoke(env)
+	if err := pair.New(Ed25519); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pair.Close() }()
+	key, err := pair.GetPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", key.Ptr()) }()
+
+	text, err := key.ToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, found := strings.CutPrefix(text, "ed25519/")
+	if !found || len(encoded) != 64 {
+		t.Errorf("ToString = %q, want ed25519/ and 32 bytes of hex", text)
+	}
+
+	data, err := key.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(data) != encoded {
+		t.Errorf("ToBytes = %x, want %s", data, encoded)
+	}
+}
+
+func TestPublicKeyFromString(t *testing.T) {
+	env := wasmtest.Env(t).WithAllocationTracking()
+
+	const text = "ed25519/412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59"
+	key := InvokePublicKey(env)
+	if err := key.FromString(text); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("publickey", key.Ptr()) }()
+	if got, err := key.ToString(); err != nil || got != text {
+		t.Errorf("ToString = %q, %v, want %q", got, err, text)
+	}
+
+	for _, data := range []string{"412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea59", "rsa/00"} {
+		malformed := InvokePublicKey(env)
+		if err := malformed.FromString(data); err == nil {
+			t.Errorf("public key %q parsed", data)
+		}
+	}
+	// Well formed hex of the wrong size is rejected by the guest itself.
+	var guestErr *wasm.GuestError
+	short := InvokePublicKey(env)
+	if err := short.FromString("ed25519/00"); !errors.As(err, &guestErr) {
+		t.Errorf("short key = %v, want a *wasm.GuestError", err)
+	}
+	// The guest reclaims the string it parses, successfully or not: nothing is left to free.
+	if allocations := env.Stats().Allocations; allocations != 0 {
+		t.Errorf("%d allocations left", allocations)
+	}
+}
+
+func TestKeyFromStringRejectsMalformedHex(t *testing.T) {
+	calls := 0
+	env := wasmtest.Env(t).WithCallHook(func(string) { calls++ })
+
+	for _, data := range []string{"ed25519/", "ed25519/412", "ed25519/zz", "ed25519/412ebcdfec9c552a1554d800e382bb70b0c5bde11de8c208fd15184b7bf1ea5g"} {
+		key := InvokePublicKey(env)
+		if err := key.FromString(data); err == nil {
+			t.Errorf("public key %q parsed", data)
+		}
+	}
+	for _, data := range []string{"ed25519-private/", "ed25519-private/zz", "ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55ab"} {
+		key := InvokePrivateKey(env)
+		if err := key.FromString(data); err == nil {
+			t.Errorf("private key %q parsed", data)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("malformed keys made %d guest calls, want none", calls)
+	}
+
+	// The errors are the ones the guest throws.
+	key := InvokePublicKey(env)
+	want := map[string]any{"Format": map[string]any{"InvalidKey": "could not deserialize hex encoded key: Invalid character 'z' at position 0"}}
+	var guestErr *wasm.GuestError
+	if err := key.FromString("ed25519/zz"); !errors.As(err, &guestErr) || !reflect.DeepEqual(guestErr.Details, want) {
+		t.Errorf("err = %v, want the guest error %v", err, want)
+	}
+	private := InvokePrivateKey(env)
+	if err := private.FromString("ed25519-private/412"); !errors.As(err, &guestErr) || !reflect.DeepEqual(guestErr.Details, map[string]any{"InvalidKey": "Odd number of digits"}) {
+		t.Errorf("err = %v, want the guest odd length error", err)
+	}
+
+	key = InvokePublicKey(env)
+	if err := key.FromString("ed25519/412EBCDFEC9C552A1554D800E382BB70B0C5BDE11DE8C208FD15184B7BF1EA59"); err != nil {
+		t.Errorf("upper case key rejected: %v", err)
+	}
+	_ = env.FreeObject("publickey", key.Ptr())
+}
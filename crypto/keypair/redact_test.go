@@ -0,0 +1,43 @@
+package keypair
+
+import (
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestPrivateKeyRedactedInLogs(t *testing.T) {
+	const secret = "eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb"
+
+	key := InvokePrivateKey(wasmtest.Env(t))
+	if err := key.FromString("ed25519-private/" + secret); err != nil {
+		t.Fatal(err)
+	}
+	pair := Invoke(wasmtest.Env(t))
+	if err := pair.FromPrivateKey(key); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, nil))
+	logger.Info("loaded key", slog.Any("key", key), slog.Any("pair", pair))
+	logger.Info("formatted", slog.String("key", fmt.Sprint(key)), slog.String("pair", fmt.Sprintf("%v", pair)))
+
+	if strings.Count(out.String(), "REDACTED") != 4 {
+		t.Errorf("keys not redacted:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), secret) {
+		t.Fatalf("key material leaked into logs:\n%s", out.String())
+	}
+
+	revealed, err := key.Reveal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revealed != "ed25519-private/"+secret {
+		t.Errorf("Reveal() = %s", revealed)
+	}
+}
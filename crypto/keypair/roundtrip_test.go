@@ -0,0 +1,176 @@
+package keypair_test
+
+import (
+	"biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/crypto/keypair/keypairtest"
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"testing"
+	"testing/quick"
+)
+
+// privateForms encodes a private key in every form and reads it back.
+var privateForms = map[string]func(env wasm.WasmEnv, key keypair.PrivateKey) (keypair.PrivateKey, error){
+	"string": func(env wasm.WasmEnv, key keypair.PrivateKey) (keypair.PrivateKey, error) {
+		text, err := key.ToString()
+		if err != nil {
+			return keypair.PrivateKey{}, err
+		}
+		decoded := keypair.InvokePrivateKey(env)
+		return decoded, decoded.FromString(text)
+	},
+	"hex": func(env wasm.WasmEnv, key keypair.PrivateKey) (keypair.PrivateKey, error) {
+		algorithm, err := key.Algorithm()
+		if err != nil {
+			return keypair.PrivateKey{}, err
+		}
+		encoded, err := key.ToHex()
+		if err != nil {
+			return keypair.PrivateKey{}, err
+		}
+		decoded := keypair.InvokePrivateKey(env)
+		return decoded, decoded.FromHex(algorithm, encoded)
+	},
+	"bytes": func(env wasm.WasmEnv, key keypair.PrivateKey) (keypair.PrivateKey, error) {
+		algorithm, err := key.Algorithm()
+		if err != nil {
+			return keypair.PrivateKey{}, err
+		}
+		data, err := key.ToBytes()
+		if err != nil {
+			return keypair.PrivateKey{}, err
+		}
+		decoded := keypair.InvokePrivateKey(env)
+		return decoded, decoded.FromBytes(algorithm, data)
+	},
+	"pem": func(env wasm.WasmEnv, key keypair.PrivateKey) (keypair.PrivateKey, error) {
+		encoded, err := key.ToPEM()
+		if err != nil {
+			return keypair.PrivateKey{}, err
+		}
+		decoded := keypair.InvokePrivateKey(env)
+		return decoded, decoded.FromPEM(encoded)
+	},
+	"jwk": func(env wasm.WasmEnv, key keypair.PrivateKey) (keypair.PrivateKey, error) {
+		encoded, err := key.ToJWK()
+		if err != nil {
+			return keypair.PrivateKey{}, err
+		}
+		decoded := keypair.InvokePrivateKey(env)
+		return decoded, decoded.FromJWK(encoded)
+	},
+}
+
+// publicForms encodes a public key in every form and reads it back.
+var publicForms = map[string]func(env wasm.WasmEnv, key keypair.PublicKey) (keypair.PublicKey, error){
+	"string": func(env wasm.WasmEnv, key keypair.PublicKey) (keypair.PublicKey, error) {
+		text, err := key.ToString()
+		if err != nil {
+			return keypair.PublicKey{}, err
+		}
+		decoded := keypair.InvokePublicKey(env)
+		return decoded, decoded.FromString(text)
+	},
+	"hex": func(env wasm.WasmEnv, key keypair.PublicKey) (keypair.PublicKey, error) {
+		algorithm, err := key.Algorithm()
+		if err != nil {
+			return keypair.PublicKey{}, err
+		}
+		encoded, err := key.ToHex()
+		if err != nil {
+			return keypair.PublicKey{}, err
+		}
+		decoded := keypair.InvokePublicKey(env)
+		return decoded, decoded.FromHex(algorithm, encoded)
+	},
+	"bytes": func(env wasm.WasmEnv, key keypair.PublicKey) (keypair.PublicKey, error) {
+		algorithm, err := key.Algorithm()
+		if err != nil {
+			return keypair.PublicKey{}, err
+		}
+		data, err := key.ToBytes()
+		if err != nil {
+			return keypair.PublicKey{}, err
+		}
+		decoded := keypair.InvokePublicKey(env)
+		return decoded, decoded.FromBytes(algorithm, data)
+	},
+	"pem": func(env wasm.WasmEnv, key keypair.PublicKey) (keypair.PublicKey, error) {
+		encoded, err := key.ToPEM()
+		if err != nil {
+			return keypair.PublicKey{}, err
+		}
+		decoded := keypair.InvokePublicKey(env)
+		return decoded, decoded.FromPEM(encoded)
+	},
+	"jwk": func(env wasm.WasmEnv, key keypair.PublicKey) (keypair.PublicKey, error) {
+		encoded, err := key.ToJWK()
+		if err != nil {
+			return keypair.PublicKey{}, err
+		}
+		decoded := keypair.InvokePublicKey(env)
+		return decoded, decoded.FromJWK(encoded)
+	},
+}
+
+func TestPrivateKeyRoundTrip(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	for form, roundTrip := range privateForms {
+		t.Run(form, func(t *testing.T) {
+			property := func(seed keypairtest.Seed) bool {
+				key, err := seed.PrivateKey(env)
+				if err != nil {
+					t.Logf("%s: %v", seed, err)
+					return false
+				}
+				decoded, err := roundTrip(env, key)
+				if err != nil {
+					t.Logf("%s: %v", seed, err)
+					return false
+				}
+				return decoded.Equal(key)
+			}
+			if err := quick.Check(property, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPublicKeyRoundTrip(t *testing.T) {
+	env := wasmtest.Env(t)
+
+	for form, roundTrip := range publicForms {
+		t.Run(form, func(t *testing.T) {
+			property := func(seed keypairtest.Seed) bool {
+				private, err := seed.PrivateKey(env)
+				if err != nil {
+					t.Logf("%s: %v", seed, err)
+					return false
+				}
+				keyPair := keypair.Invoke(env)
+				if err := keyPair.FromPrivateKey(private); err != nil {
+					t.Logf("%s: %v", seed, err)
+					return false
+				}
+				defer func() { _ = keyPair.Close() }()
+				key, err := keyPair.GetPublicKey()
+				if err != nil {
+					t.Logf("%s: %v", seed, err)
+					return false
+				}
+
+				decoded, err := roundTrip(env, key)
+				if err != nil {
+					t.Logf("%s: %v", seed, err)
+					return false
+				}
+				return decoded.Equal(key)
+			}
+			if err := quick.Check(property, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
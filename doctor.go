@@ -0,0 +1,170 @@
+package main
+
+import (
+	"biscuit-wasm-go/crypto/biscuit"
+	keypairModule "biscuit-wasm-go/crypto/keypair"
+	"biscuit-wasm-go/wasm"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// doctorCheck is one line of the doctor report.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type doctorReport struct {
+	Artifact struct {
+		Path   string `json:"path"`
+		Source string `json:"source"`
+		SHA256 string `json:"sha256,omitempty"`
+	} `json:"artifact"`
+	PassthroughImports []string      `json:"passthrough_imports"`
+	Checks             []doctorCheck `json:"checks"`
+	OK                 bool          `json:"ok"`
+}
+
+func (self *doctorReport) check(name string, err error, detail string) bool {
+	check := doctorCheck{Name: name, OK: err == nil, Detail: detail}
+	if err != nil {
+		check.Detail = err.Error()
+	}
+	self.Checks = append(self.Checks, check)
+	return check.OK
+}
+
+func (self *doctorReport) String() string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "artifact: %s (%s)\n", self.Artifact.Path, self.Artifact.Source)
+	if self.Artifact.SHA256 != "" {
+		fmt.Fprintf(&text, "sha256: %s\n", self.Artifact.SHA256)
+	}
+	for _, check := range self.Checks {
+		status := "ok  "
+		if !check.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&text, "%s %s", status, check.Name)
+		if check.Detail != "" {
+			fmt.Fprintf(&text, ": %s", check.Detail)
+		}
+		text.WriteByte('\n')
+	}
+	for _, name := range self.PassthroughImports {
+		fmt.Fprintf(&text, "passthrough import: %s\n", name)
+	}
+	return strings.TrimRight(text.String(), "\n")
+}
+
+// runDoctor reports whether the guest module can be loaded and used: which file would be loaded,
+// whether it compiles and exports what the bindings call, and a token round trip. It does not
+// need the env runCommand would have loaded, it loads the artifact itself.
+func runDoctor(_ wasm.WasmEnv, args []string, stdin io.Reader, out *output) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	path := flags.String("wasm", "", "wasm file to check instead of the build outputs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var report doctorReport
+	report.PassthroughImports = []string{}
+	report.Artifact.Path, report.Artifact.Source = *path, "flag"
+	if *path == "" {
+		found, err := wasm.FindWasmFile()
+		if !report.check("artifact found", err, "") {
+			return printDoctorReport(out, &report)
+		}
+		report.Artifact.Path, report.Artifact.Source = found, "build output"
+	}
+
+	source, err := os.ReadFile(report.Artifact.Path)
+	if !report.check("artifact readable", err, "") {
+		return printDoctorReport(out, &report)
+	}
+	sum := sha256.Sum256(source)
+	report.Artifact.SHA256 = hex.EncodeToString(sum[:])
+
+	info, err := wasm.InspectArtifact(context.Background(), source)
+	if !report.check("compiles", err, "") {
+		return printDoctorReport(out, &report)
+	}
+	report.PassthroughImports = append(report.PassthroughImports, info.PassthroughImports...)
+
+	var missing error
+	if len(info.MissingExports) > 0 {
+		missing = fmt.Errorf("missing %s", strings.Join(info.MissingExports, ", "))
+	}
+	report.check("required exports", missing, fmt.Sprintf("%d present", len(wasm.RequiredExports)))
+
+	report.check("self-test", doctorSelfTest(report.Artifact.Path), "generated a key, minted and authorized a token")
+	return printDoctorReport(out, &report)
+}
+
+func printDoctorReport(out *output, report *doctorReport) error {
+	report.OK = true
+	for _, check := range report.Checks {
+		report.OK = report.OK && check.OK
+	}
+
+	if err := out.print(report.String(), report); err != nil {
+		return err
+	}
+	if !report.OK {
+		return errReported
+	}
+	return nil
+}
+
+// doctorSelfTest mints a token with a fresh key and authorizes it.
+func doctorSelfTest(path string) error {
+	env, err := wasm.InitWasmFromFile(path)
+	if err != nil {
+		return err
+	}
+
+	root := keypairModule.Invoke(env)
+	if err := root.New(keypairModule.Ed25519); err != nil {
+		return fmt.Errorf("cannot generate a key: %w", err)
+	}
+
+	builder, err := biscuit.NewBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = builder.Close() }()
+	if err := builder.AddCode(`user("doctor");`); err != nil {
+		return err
+	}
+	token, err := builder.Build(root)
+	if err != nil {
+		return fmt.Errorf("cannot mint a token: %w", err)
+	}
+	defer func() { _ = token.Close() }()
+
+	authorizerBuilder, err := biscuit.NewAuthorizerBuilder(env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = authorizerBuilder.Close() }()
+	if err := authorizerBuilder.AddCode(`allow if user("doctor");`); err != nil {
+		return err
+	}
+	authorizer, err := authorizerBuilder.Build(token)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = authorizer.Close() }()
+
+	if _, err := authorizer.Authorize(); err != nil {
+		return fmt.Errorf("cannot authorize a token: %w", err)
+	}
+	return nil
+}
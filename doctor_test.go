@@ -0,0 +1,93 @@
+package main
+
+import (
+	"biscuit-wasm-go/wasm"
+	"biscuit-wasm-go/wasm/wasmtest"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// doctor runs the doctor command on wasmFile and returns its JSON report.
+func doctor(t *testing.T, wasmFile string) (doctorReport, error) {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	err := runDoctor(wasm.WasmEnv{}, []string{"--wasm", wasmFile}, strings.NewReader(""), &output{w: &stdout, json: true})
+
+	var report doctorReport
+	if decodeErr := json.Unmarshal(stdout.Bytes(), &report); decodeErr != nil {
+		t.Fatalf("report is not JSON: %v\n%s", decodeErr, stdout.String())
+	}
+	return report, err
+}
+
+// failedChecks returns the names of the checks of report that failed.
+func failedChecks(report doctorReport) []string {
+	var failed []string
+	for _, check := range report.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+func TestDoctorGoodArtifact(t *testing.T) {
+	wasmtest.Env(t)
+
+	report, err := doctor(t, WasmFile)
+	if err != nil {
+		t.Fatalf("doctor failed: %v, checks %+v", err, report.Checks)
+	}
+	if !report.OK || report.Artifact.Source != "flag" || len(report.Artifact.SHA256) != 64 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if failed := failedChecks(report); len(failed) != 0 {
+		t.Errorf("failed checks %v", failed)
+	}
+
+	var stdout bytes.Buffer
+	if err := runDoctor(wasm.WasmEnv{}, []string{"--wasm", WasmFile}, strings.NewReader(""), &output{w: &stdout}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "ok   self-test") {
+		t.Errorf("human report lacks the self-test:\n%s", stdout.String())
+	}
+}
+
+func TestDoctorBrokenArtifact(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.wasm")
+	empty := filepath.Join(dir, "empty.wasm")
+	if err := os.WriteFile(garbage, []byte("not wasm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, []byte("\x00asm\x01\x00\x00\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		file   string
+		failed []string
+	}{
+		{filepath.Join(dir, "missing.wasm"), []string{"artifact readable"}},
+		{garbage, []string{"compiles"}},
+		{empty, []string{"required exports", "self-test"}},
+	} {
+		report, err := doctor(t, tc.file)
+		if !errors.Is(err, errReported) {
+			t.Errorf("%s: err = %v, want the failure to be reported", tc.file, err)
+		}
+		if report.OK {
+			t.Errorf("%s: report is ok", tc.file)
+		}
+		if failed := failedChecks(report); strings.Join(failed, ",") != strings.Join(tc.failed, ",") {
+			t.Errorf("%s: failed checks %v, want %v", tc.file, failed, tc.failed)
+		}
+	}
+}
@@ -40,7 +40,7 @@ func createkeypair(env wasm.WasmEnv, algorithm keypairModule.SignatureAlgorithm)
 		return nil, err
 	}
 
-	privateKeyString, err := privateKey.ToString()
+	privateKeyString, err := privateKey.Reveal()
 	if err != nil {
 		slog.Error(err.Error())
 		return nil, err
@@ -51,6 +51,9 @@ func createkeypair(env wasm.WasmEnv, algorithm keypairModule.SignatureAlgorithm)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
 
 	opts := &slog.HandlerOptions{
 		AddSource: true,
@@ -111,7 +114,7 @@ func main() {
 		return
 	}
 
-	privateKey3String, err := privateKey3.ToString()
+	privateKey3String, err := privateKey3.Reveal()
 	if err != nil {
 		slog.Error(err.Error())
 		return
@@ -0,0 +1,459 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// ErrInvalidUTF8 is returned when a string handed to the guest is not valid UTF-8.
+var ErrInvalidUTF8 = errors.New("string is not valid UTF-8")
+
+// ErrResultTooLarge is returned when a string or buffer returned by the guest claims a length
+// above the limit of the env, see WithMaxResultSize.
+var ErrResultTooLarge = errors.New("guest result too large")
+
+// DefaultMaxResultSize is the largest string or buffer read back from the guest by default.
+const DefaultMaxResultSize = 16 << 20
+
+// returnAreaSize is large enough for every return area layout used by the biscuit exports:
+//
+//	Result<T, JsValue>:       value (4) | error (4) | is_err (4)
+//	Result<(), JsValue>:      error (4) | is_err (4)
+//	String / Vec<u8>:         ptr (4)   | len (4)
+//	Result<String, JsValue>:  ptr (4)   | len (4)   | error (4) | is_err (4)
+const returnAreaSize = 16
+
+// WriteBytes copies data into a freshly allocated guest buffer and returns its pointer and length.
+//
+// Exports taking a &str or &[u8] parameter reclaim that buffer themselves once the call returns,
+// so a buffer handed to such an export must not be freed again by the caller. On every other
+// path (including errors before the call) the caller owns the allocation.
+func (env WasmEnv) WriteBytes(data []byte) (uint64, uint64, error) {
+	return env.write(uint64(len(data)), func(mem api.Memory, offset uint32) bool {
+		return mem.Write(offset, data)
+	})
+}
+
+// WriteString copies the UTF-8 bytes of data into guest memory, see WriteBytes for ownership rules.
+// The guest takes strings as valid UTF-8 and traps on anything else, so data is rejected with
+// ErrInvalidUTF8 before reaching it.
+func (env WasmEnv) WriteString(data string) (uint64, uint64, error) {
+	if !utf8.ValidString(data) {
+		return 0, 0, ErrInvalidUTF8
+	}
+
+	// Written straight from the string, converting it to []byte would copy it once more.
+	return env.write(uint64(len(data)), func(mem api.Memory, offset uint32) bool {
+		return mem.WriteString(offset, data)
+	})
+}
+
+// write allocates length bytes and fills them with fill, freeing them again when fill fails.
+func (env WasmEnv) write(length uint64, fill func(mem api.Memory, offset uint32) bool) (uint64, uint64, error) {
+	ptr, err := env.Malloc(length)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malloc for %d bytes failed: %w", length, err)
+	}
+
+	if ok := fill(env.Module.Memory(), uint32(ptr)); !ok {
+		_ = env.Free(ptr, length)
+		return 0, 0, fmt.Errorf("cannot write %d bytes to wasm memory at %d", length, ptr)
+	}
+
+	return ptr, length, nil
+}
+
+// WithScratch copies data into a guest buffer and calls fn with its pointer and length, in a scope
+// freeing the buffer once fn returns, whatever it returns, see WithScope. Exports taking a &str or
+// &[u8] reclaim their buffer themselves: fn passing it to one hands it off with s.Handoff right
+// before.
+func (env WasmEnv) WithScratch(data []byte, fn func(s *Scope, ptr, length uint64) error) error {
+	return env.WithScope(func(s *Scope) error {
+		ptr, length, err := s.WriteBytes(data)
+		if err != nil {
+			return err
+		}
+		return fn(s, ptr, length)
+	})
+}
+
+// checkRange rejects a range of guest memory that does not fit in the 32-bit address space of the
+// guest, which truncating it to 32 bits would silently wrap.
+func checkRange(ptr uint64, length uint64) error {
+	if ptr > math.MaxUint32 || length > math.MaxUint32 {
+		return fmt.Errorf("cannot access %d bytes of wasm memory at %d: out of the 32-bit address space", length, ptr)
+	}
+	return nil
+}
+
+// ReadBytes copies length bytes starting at ptr out of guest memory into a new slice the caller
+// owns. The guest buffer is left untouched. Lengths above the result size limit of the env are
+// rejected with ErrResultTooLarge, see WithMaxResultSize, before anything is allocated.
+func (env WasmEnv) ReadBytes(ptr uint64, length uint64) ([]byte, error) {
+	if err := checkRange(ptr, length); err != nil {
+		return nil, err
+	}
+	if err := env.checkResultSize(length); err != nil {
+		return nil, err
+	}
+
+	buf, ok := env.Module.Memory().Read(uint32(ptr), uint32(length))
+	if !ok {
+		return nil, fmt.Errorf("cannot read %d bytes of wasm memory at %d", length, ptr)
+	}
+
+	data := make([]byte, length)
+	copy(data, buf)
+	return data, nil
+}
+
+// WithMaxResultSize returns a copy of env refusing, with ErrResultTooLarge, strings and buffers
+// returned by the guest longer than size bytes. Their length is read from a return area, a
+// corrupted one would otherwise have the host copy gigabytes. 0 restores DefaultMaxResultSize.
+func (env WasmEnv) WithMaxResultSize(size uint64) WasmEnv {
+	env.maxResultSize = size
+	return env
+}
+
+// checkResultSize rejects a returned buffer of length bytes above the limit of env, before
+// anything is read or allocated for it.
+func (env WasmEnv) checkResultSize(length uint64) error {
+	limit := env.maxResultSize
+	if limit == 0 {
+		limit = DefaultMaxResultSize
+	}
+	if length > limit {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrResultTooLarge, length, limit)
+	}
+	return nil
+}
+
+// withMemBytes calls fn with a view of length bytes of guest memory starting at ptr, without
+// copying them. The view is only valid during fn: any later guest call may overwrite or move it,
+// so fn must copy what it keeps. Its capacity is its length, appending to it copies.
+func (env WasmEnv) withMemBytes(ptr uint64, length uint64, fn func([]byte) error) error {
+	if err := checkRange(ptr, length); err != nil {
+		return err
+	}
+	buf, ok := env.Module.Memory().Read(uint32(ptr), uint32(length))
+	if !ok {
+		return fmt.Errorf("cannot read %d bytes of wasm memory at %d", length, ptr)
+	}
+	return fn(buf[:length:length])
+}
+
+// takeBytes reads a guest buffer returned by an export (String or Vec<u8>) and frees it. A buffer
+// above the result size limit is left allocated: its length cannot be trusted to free it.
+func (env WasmEnv) takeBytes(ptr uint64, length uint64) ([]byte, error) {
+	data, err := env.ReadBytes(ptr, length)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := env.Free(ptr, length); err != nil {
+		return nil, fmt.Errorf("cannot free returned buffer of %d bytes at %d: %w", length, ptr, err)
+	}
+
+	return data, nil
+}
+
+// takeString is takeBytes for a String, copied once straight into the Go string.
+func (env WasmEnv) takeString(ptr uint64, length uint64) (string, error) {
+	if err := env.checkResultSize(length); err != nil {
+		return "", err
+	}
+
+	var data string
+	err := env.withMemBytes(ptr, length, func(buf []byte) error {
+		data = string(buf)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := env.Free(ptr, length); err != nil {
+		return "", fmt.Errorf("cannot free returned buffer of %d bytes at %d: %w", length, ptr, err)
+	}
+
+	return data, nil
+}
+
+// ReturnAreaTap receives the raw return area of an export right after the call, before it is
+// decoded and freed. It is meant for diagnosing layout bugs and must not retain raw.
+type ReturnAreaTap func(fnName string, retPtr uint64, raw []byte)
+
+// WithReturnAreaTap returns a copy of env whose return area helpers report to tap. A nil tap
+// disables reporting, which is the default.
+func (env WasmEnv) WithReturnAreaTap(tap ReturnAreaTap) WasmEnv {
+	env.returnAreaTap = tap
+	return env
+}
+
+// returnWords is the return area of an export, decoded into little-endian words.
+type returnWords [returnAreaSize / 4]uint32
+
+// callWithReturnArea calls the export `name` with a freshly allocated return area as its first
+// parameter and returns the words of the return area once the call completes.
+func (env WasmEnv) callWithReturnArea(name string, params ...uint64) (returnWords, error) {
+	var area returnWords
+	function, err := env.GetFunction(name)
+	if err != nil {
+		return area, err
+	}
+
+	// raw is the transient copy of the area, taken while the area is still allocated.
+	raw := getBuffer(returnAreaSize)
+	defer putBuffer(raw, false)
+	err = env.WithScope(func(s *Scope) error {
+		retPtr, err := s.Malloc(returnAreaSize)
+		if err != nil {
+			return fmt.Errorf("malloc for return area failed: %w", err)
+		}
+
+		// The guest does not write every word of the area for every outcome, start from zeroes.
+		clear(*raw)
+		if ok := env.Module.Memory().Write(uint32(retPtr), *raw); !ok {
+			return fmt.Errorf("cannot initialize return area")
+		}
+
+		if _, err := env.Call(function, append([]uint64{retPtr}, params...)...); err != nil {
+			return fmt.Errorf("%s failed: %w", name, err)
+		}
+
+		if err := env.withMemBytes(retPtr, returnAreaSize, func(buf []byte) error {
+			copy(*raw, buf)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if env.returnAreaTap != nil {
+			env.returnAreaTap(name, retPtr, *raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return area, err
+	}
+
+	for i := range area {
+		area[i] = binary.LittleEndian.Uint32((*raw)[i*4:])
+	}
+	return area, nil
+}
+
+// GuestError is an error returned by the biscuit library itself (invalid datalog, bad signature,
+// failed authorization...), as opposed to a host-side failure such as a trap or a missing export.
+type GuestError struct {
+	Function string
+	Message  string
+	// Details is the thrown value as decoded from the externref table: a string, or nested
+	// map[string]any and []any for structured errors such as failed checks.
+	Details any
+}
+
+func (self *GuestError) Error() string {
+	return self.Message
+}
+
+// NewGuestError returns the error the export function would have thrown with details, for inputs
+// the bindings reject before calling the guest. details has the shape of decoded thrown values:
+// a string, or map[string]any and []any holding strings and float64 numbers.
+func NewGuestError(function string, details any) *GuestError {
+	message, err := errorMessage(details)
+	if err != nil {
+		message = fmt.Sprint(details)
+	}
+	return &GuestError{Function: function, Message: message, Details: details}
+}
+
+// guestError turns the JsValue index of a thrown error into a *GuestError and releases the
+// index, the error being owned by the caller like in the JS glue.
+func (env WasmEnv) guestError(name string, idx uint32) error {
+	st := env.host()
+	defer st.dropExternref(idx)
+
+	message, err := env.GetError(uint64(idx))
+	if err != nil {
+		return fmt.Errorf("%s failed: cannot get error: %w", name, err)
+	}
+	return &GuestError{Function: name, Message: message, Details: st.mirror[idx]}
+}
+
+// CallFallible calls an export returning Result<T, JsValue> where T fits in a single word
+// (a struct pointer or an integer) and returns that word.
+func (env WasmEnv) CallFallible(name string, params ...uint64) (uint64, error) {
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		return 0, err
+	}
+
+	value, errIdx, isErr := area[0], area[1], area[2]
+
+	if isErr != 0 {
+		return 0, env.guestError(name, errIdx)
+	}
+	return uint64(value), nil
+}
+
+// CallFallibleVoid calls an export returning Result<(), JsValue>.
+func (env WasmEnv) CallFallibleVoid(name string, params ...uint64) error {
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		return err
+	}
+
+	errIdx, isErr := area[0], area[1]
+
+	if isErr != 0 {
+		return env.guestError(name, errIdx)
+	}
+	return nil
+}
+
+// CallString calls an export returning a String and frees the guest copy.
+func (env WasmEnv) CallString(name string, params ...uint64) (string, error) {
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		return "", err
+	}
+
+	ptr, length := area[0], area[1]
+
+	return env.takeString(uint64(ptr), uint64(length))
+}
+
+// CallFallibleString calls an export returning Result<String, JsValue> and frees the guest copy.
+func (env WasmEnv) CallFallibleString(name string, params ...uint64) (string, error) {
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		return "", err
+	}
+
+	ptr, length, errIdx, isErr := area[0], area[1], area[2], area[3]
+	if isErr != 0 {
+		return "", env.guestError(name, errIdx)
+	}
+	return env.takeString(uint64(ptr), uint64(length))
+}
+
+// CallFallibleBytes calls an export returning Result<Vec<u8>, JsValue> and frees the guest copy.
+func (env WasmEnv) CallFallibleBytes(name string, params ...uint64) ([]byte, error) {
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, length, errIdx, isErr := area[0], area[1], area[2], area[3]
+
+	if isErr != 0 {
+		return nil, env.guestError(name, errIdx)
+	}
+	return env.takeBytes(uint64(ptr), uint64(length))
+}
+
+// FreeObject releases a Rust struct exported through wasm-bindgen (e.g. "biscuit" calls __wbg_biscuit_free).
+func (env WasmEnv) FreeObject(class string, ptr uint64) error {
+	if ptr == 0 {
+		return nil
+	}
+
+	name := "__wbg_" + class + "_free"
+	function, err := env.GetFunction(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := env.Call(function, ptr, 0); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
+
+// CallStrings calls an export returning a Vec<String>, an array of externrefs to JS strings, and
+// frees the guest array.
+func (env WasmEnv) CallStrings(name string, params ...uint64) ([]string, error) {
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, length := area[0], area[1]
+	if err := env.checkResultSize(uint64(length) * 4); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	values := make([]string, length)
+	st := env.host()
+	readErr := env.withMemBytes(uint64(ptr), uint64(length)*4, func(indices []byte) error {
+		for i := range values {
+			idx := binary.LittleEndian.Uint32(indices[i*4:])
+			if int(idx) >= len(st.mirror) {
+				return fmt.Errorf("%s failed: unknown externref %d", name, idx)
+			}
+			value, ok := st.mirror[idx].(string)
+			if !ok {
+				return fmt.Errorf("%s failed: externref %d is not a string", name, idx)
+			}
+			values[i] = value
+			st.dropExternref(idx)
+		}
+		return nil
+	})
+
+	if err := env.Free(uint64(ptr), uint64(length)*4); err != nil {
+		return nil, fmt.Errorf("cannot free returned buffer of %d bytes at %d: %w", length*4, ptr, err)
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return values, nil
+}
+
+// CallFallibleObjects calls an export returning Result<Vec<T>, JsValue> of guest objects, e.g. the
+// facts of a query, and frees the guest array. The caller owns the objects, see GuestObject.
+func (env WasmEnv) CallFallibleObjects(name string, params ...uint64) ([]GuestObject, error) {
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, length, errIdx, isErr := area[0], area[1], area[2], area[3]
+	if isErr != 0 {
+		return nil, env.guestError(name, errIdx)
+	}
+	if err := env.checkResultSize(uint64(length) * 4); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	objects := make([]GuestObject, 0, length)
+	st := env.host()
+	readErr := env.withMemBytes(uint64(ptr), uint64(length)*4, func(indices []byte) error {
+		for i := range int(length) {
+			idx := binary.LittleEndian.Uint32(indices[i*4:])
+			object, ok := st.externref(idx).(GuestObject)
+			if !ok {
+				return fmt.Errorf("%s failed: externref %d is not a guest object", name, idx)
+			}
+			objects = append(objects, object)
+			st.dropExternref(idx)
+		}
+		return nil
+	})
+
+	if err := env.Free(uint64(ptr), uint64(length)*4); err != nil {
+		readErr = errors.Join(readErr, fmt.Errorf("cannot free returned buffer of %d bytes at %d: %w", length*4, ptr, err))
+	}
+	if readErr != nil {
+		for _, object := range objects {
+			_ = env.FreeObject(object.Class, object.Ptr)
+		}
+		return nil, readErr
+	}
+	return objects, nil
+}
@@ -0,0 +1,203 @@
+package wasm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// The tests of this file pin the return area layouts the helpers of abi.go decode, against the
+// real module: an artifact built with another wasm-bindgen or biscuit-wasm that moves a word fails
+// here instead of handing garbage pointers to the bindings. Words the layout does not use must be
+// left as callWithReturnArea initialized them, zero.
+
+// layoutSeed is the private key the layouts are exercised with.
+const layoutSeed = "ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb"
+
+// returnArea calls name and returns the words of its return area.
+func returnArea(t *testing.T, env WasmEnv, name string, params ...uint64) [returnAreaSize / 4]uint32 {
+	t.Helper()
+
+	area, err := env.callWithReturnArea(name, params...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return area
+}
+
+// writeArg copies data to the guest for an export taking a &str, which frees it.
+func writeArg(t *testing.T, env WasmEnv, data string) (uint64, uint64) {
+	t.Helper()
+
+	ptr, length, err := env.WriteString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ptr, length
+}
+
+// assertUnused fails unless the words of area from index on are zero.
+func assertUnused(t *testing.T, name string, area [returnAreaSize / 4]uint32, from int) {
+	t.Helper()
+
+	for i := from; i < len(area); i++ {
+		if area[i] != 0 {
+			t.Errorf("%s wrote %#x to word %d of its return area, which the layout does not use: %v", name, area[i], i, area)
+		}
+	}
+}
+
+// assertGuestError fails unless the error index of area refers to a thrown error, and releases it.
+func assertGuestError(t *testing.T, env WasmEnv, name string, area [returnAreaSize / 4]uint32, errWord int) {
+	t.Helper()
+
+	if area[errWord] == 0 || int(area[errWord]) >= len(env.host().mirror) {
+		t.Fatalf("%s: error index %d is not an externref: %v", name, area[errWord], area)
+	}
+	var guestErr *GuestError
+	if err := env.guestError(name, area[errWord]); !errors.As(err, &guestErr) || guestErr.Message == "" {
+		t.Errorf("%s: err = %v, want a guest error", name, err)
+	}
+}
+
+// layoutKey returns the private key of layoutSeed through the Result<T, JsValue> layout.
+func layoutKey(t *testing.T, env WasmEnv) uint64 {
+	t.Helper()
+
+	ptr, length := writeArg(t, env, layoutSeed)
+	area := returnArea(t, env, "privatekey_fromString", ptr, length)
+	if area[0] == 0 {
+		t.Fatalf("privatekey_fromString: got %v, want value | 0 | is_err 0", area)
+	}
+	assertUnused(t, "privatekey_fromString", area, 1)
+	return uint64(area[0])
+}
+
+func TestLayoutFallibleValue(t *testing.T) {
+	env := testEnv(t)
+
+	key := layoutKey(t, env)
+	defer func() { _ = env.FreeObject("privatekey", key) }()
+
+	ptr, length := writeArg(t, env, "ed25519-private/zz")
+	area := returnArea(t, env, "privatekey_fromString", ptr, length)
+	if area[2] != 1 {
+		t.Fatalf("privatekey_fromString: got %v, want value | error | is_err 1", area)
+	}
+	assertGuestError(t, env, "privatekey_fromString", area, 1)
+	assertUnused(t, "privatekey_fromString", area, 3)
+}
+
+func TestLayoutFallibleVoid(t *testing.T) {
+	env := testEnv(t)
+
+	function, err := env.GetFunction("biscuitbuilder_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := env.Call(function)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := results[0]
+	defer func() { _ = env.FreeObject("biscuitbuilder", builder) }()
+
+	ptr, length := writeArg(t, env, `user("alice");`)
+	area := returnArea(t, env, "biscuitbuilder_addCode", builder, ptr, length)
+	assertUnused(t, "biscuitbuilder_addCode", area, 0)
+
+	ptr, length = writeArg(t, env, `user(`)
+	area = returnArea(t, env, "biscuitbuilder_addCode", builder, ptr, length)
+	if area[1] != 1 {
+		t.Fatalf("biscuitbuilder_addCode: got %v, want error | is_err 1", area)
+	}
+	assertGuestError(t, env, "biscuitbuilder_addCode", area, 0)
+	assertUnused(t, "biscuitbuilder_addCode", area, 2)
+}
+
+func TestLayoutString(t *testing.T) {
+	env := testEnv(t)
+
+	key := layoutKey(t, env)
+	defer func() { _ = env.FreeObject("privatekey", key) }()
+
+	area := returnArea(t, env, "privatekey_toString", key)
+	if area[1] != uint32(len(layoutSeed)) {
+		t.Fatalf("privatekey_toString: got %v, want ptr | len %d", area, len(layoutSeed))
+	}
+	assertUnused(t, "privatekey_toString", area, 2)
+
+	data, err := env.takeBytes(uint64(area[0]), uint64(area[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != layoutSeed {
+		t.Errorf("privatekey_toString returned %q, want %q", data, layoutSeed)
+	}
+}
+
+func TestLayoutFallibleBytes(t *testing.T) {
+	env := testEnv(t)
+
+	key := layoutKey(t, env)
+	defer func() { _ = env.FreeObject("privatekey", key) }()
+
+	function, err := env.GetFunction("biscuitbuilder_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := env.Call(function)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := env.CallFallible("biscuitbuilder_build", results[0], key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("biscuit", token) }()
+
+	area := returnArea(t, env, "biscuit_toBytes", token)
+	if area[0] == 0 || area[1] == 0 {
+		t.Fatalf("biscuit_toBytes: got %v, want ptr | len | error | is_err 0", area)
+	}
+	assertUnused(t, "biscuit_toBytes", area, 2)
+
+	data, err := env.takeBytes(uint64(area[0]), uint64(area[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := env.CallFallibleString("biscuit_toBase64", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("biscuit_toBytes returned %x, want the bytes of biscuit_toBase64 %x", data, want)
+	}
+
+	// Revocation identifiers are a Vec<String>: ptr | len of an array of externrefs.
+	area = returnArea(t, env, "biscuit_getRevocationIdentifiers", token)
+	if area[0] == 0 || area[1] != 1 {
+		t.Fatalf("biscuit_getRevocationIdentifiers: got %v, want ptr | len 1", area)
+	}
+	assertUnused(t, "biscuit_getRevocationIdentifiers", area, 2)
+
+	indices, err := env.takeBytes(uint64(area[0]), uint64(area[1])*4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := binary.LittleEndian.Uint32(indices)
+	st := env.host()
+	if int(idx) >= len(st.mirror) {
+		t.Fatalf("biscuit_getRevocationIdentifiers: %d is not an externref", idx)
+	}
+	if id, ok := st.mirror[idx].(string); !ok || len(id) != 128 {
+		t.Errorf("biscuit_getRevocationIdentifiers: externref %d is %#v, want the hex of a signature", idx, st.mirror[idx])
+	}
+	st.dropExternref(idx)
+}
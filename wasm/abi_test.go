@@ -0,0 +1,498 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+var (
+	testCompileOnce sync.Once
+	testCompiled    *CompiledModule
+	testCompileErr  error
+
+	testEnvsMu sync.Mutex
+	testEnvs   = map[testing.TB]WasmEnv{}
+)
+
+// testEnv returns the instance of the embedded guest of t, the way wasmtest.Env does for the
+// other packages (this one cannot import it): one per test, compiled once, closed when it ends.
+func testEnv(t testing.TB) WasmEnv {
+	t.Helper()
+
+	testCompileOnce.Do(func() { testCompiled, testCompileErr = CompileEmbedded() })
+	if testCompileErr != nil {
+		t.Fatal(testCompileErr)
+	}
+
+	testEnvsMu.Lock()
+	defer testEnvsMu.Unlock()
+	if env, ok := testEnvs[t]; ok {
+		return env
+	}
+	env, err := testCompiled.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnvs[t] = env
+	t.Cleanup(func() {
+		testEnvsMu.Lock()
+		delete(testEnvs, t)
+		testEnvsMu.Unlock()
+		_ = env.Close(context.Background())
+	})
+	return env
+}
+
+func TestReturnAreaTap(t *testing.T) {
+	var calls []string
+	var raw []byte
+	tapped := testEnv(t).WithReturnAreaTap(func(fnName string, retPtr uint64, area []byte) {
+		calls = append(calls, fnName)
+		raw = append([]byte(nil), area...)
+	})
+
+	strPtr, strLen, err := tapped.WriteString("ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ptr, err := tapped.CallFallible("privatekey_fromString", strPtr, strLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = tapped.FreeObject("privatekey", ptr) }()
+
+	if len(calls) != 1 || calls[0] != "privatekey_fromString" {
+		t.Fatalf("tap calls = %v, want [privatekey_fromString]", calls)
+	}
+	if len(raw) != returnAreaSize {
+		t.Fatalf("tap received %d bytes, want %d", len(raw), returnAreaSize)
+	}
+	if got := uint64(binary.LittleEndian.Uint32(raw[0:4])); got != ptr {
+		t.Errorf("tapped value = %d, want %d", got, ptr)
+	}
+	if isErr := binary.LittleEndian.Uint32(raw[8:12]); isErr != 0 {
+		t.Errorf("tapped is_err = %d, want 0", isErr)
+	}
+}
+
+func TestReturnAreaTapUnset(t *testing.T) {
+	plain := testEnv(t).WithReturnAreaTap(nil)
+
+	strPtr, strLen, err := plain.WriteString("not a key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := plain.CallFallible("privatekey_fromString", strPtr, strLen); err == nil {
+		t.Fatal("expected an error for an invalid key")
+	}
+}
+
+func TestCallHook(t *testing.T) {
+	var calls []string
+	hooked := testEnv(t).WithCallHook(func(fnName string) { calls = append(calls, fnName) })
+
+	strPtr, strLen, err := hooked.WriteString("ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptr, err := hooked.CallFallible("privatekey_fromString", strPtr, strLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hooked.FreeObject("privatekey", ptr) }()
+
+	// The string, then the return area are allocated, and the return area freed after the call.
+	want := []string{"__wbindgen_malloc", "__wbindgen_malloc", "privatekey_fromString", "__wbindgen_free"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("hook calls = %v, want %v", calls, want)
+	}
+}
+
+func TestCallCounter(t *testing.T) {
+	var calls []string
+	count := 0
+	counted := testEnv(t).WithCallHook(func(fnName string) { calls = append(calls, fnName) }).WithCallCounter(&count)
+
+	newKeyPair, err := counted.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := counted.Call(newKeyPair, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := counted.FreeObject("keypair", results[0]); err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 || count != len(calls) {
+		t.Errorf("counted %d calls, the hook saw %v", count, calls)
+	}
+}
+
+func TestMemoryHook(t *testing.T) {
+	instance := testEnv(t)
+
+	grown := map[string]uint64{}
+	hooked := instance.WithMemoryHook(func(fnName string, bytes uint64) { grown[fnName] += bytes })
+
+	size := hooked.MemoryStats().Size
+	newKeyPair, err := hooked.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := hooked.Call(newKeyPair, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hooked.FreeObject("keypair", results[0]) }()
+	if _, ok := grown["keypair_new"]; !ok {
+		t.Fatalf("hook reported %v, want keypair_new", grown)
+	}
+	if got := grown["keypair_new"]; got%65536 != 0 || got > 1<<20 {
+		t.Errorf("keypair_new grew memory by %d bytes, want whole pages below 1 MiB", got)
+	}
+
+	// An allocation larger than the whole memory has to grow it by at least its size.
+	ptr, err := hooked.Malloc(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = hooked.Free(ptr, size) }()
+	if got := grown["__wbindgen_malloc"]; got < size {
+		t.Errorf("malloc of %d bytes grew memory by %d bytes", size, got)
+	}
+	if growth := hooked.MemoryStats().Size - size; growth < grown["keypair_new"]+grown["__wbindgen_malloc"] {
+		t.Errorf("hook reported more growth than MemoryStats: %v, %d bytes", grown, growth)
+	}
+}
+
+func TestWriteStringRejectsInvalidUTF8(t *testing.T) {
+	env := testEnv(t)
+
+	if _, _, err := env.WriteString("ed25519/\xff"); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("err = %v, want ErrInvalidUTF8", err)
+	}
+}
+
+func TestWithMemBytes(t *testing.T) {
+	env := testEnv(t)
+
+	ptr, length, err := env.WriteBytes([]byte("revocation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Free(ptr, length) }()
+
+	var view, kept []byte
+	err = env.withMemBytes(ptr, length, func(data []byte) error {
+		view = data
+		kept = append([]byte(nil), data...)
+		if cap(data) != len(data) {
+			t.Errorf("view capacity %d, want its length %d", cap(data), len(data))
+		}
+		_ = append(data, '!')
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, ok := env.Module.Memory().Read(uint32(ptr+length), 1)
+	if !ok || next[0] == '!' {
+		t.Error("appending to the view wrote past it into guest memory")
+	}
+
+	// The view aliases guest memory: what the guest writes afterwards shows through it, the
+	// copy made in the callback is what stays valid.
+	env.Module.Memory().Write(uint32(ptr), []byte("REVOCATION"))
+	if string(view) != "REVOCATION" {
+		t.Errorf("view = %q, want a view of guest memory", view)
+	}
+	if string(kept) != "revocation" {
+		t.Errorf("copy = %q, changed with guest memory", kept)
+	}
+
+	if err := env.withMemBytes(ptr, length, func([]byte) error { return errTest }); err != errTest {
+		t.Errorf("err = %v, want the callback error", err)
+	}
+	size := uint64(env.Module.Memory().Size())
+	if err := env.withMemBytes(size, 1, func([]byte) error { return nil }); err == nil {
+		t.Error("read past guest memory accepted")
+	}
+}
+
+// A return area claiming a huge string is rejected before anything is read or allocated for it.
+func TestResultTooLarge(t *testing.T) {
+	env := testEnv(t)
+
+	data, length, err := env.WriteBytes([]byte("revocation"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Free(data, length) }()
+
+	area := make([]byte, 8)
+	binary.LittleEndian.PutUint32(area[0:], uint32(data))
+	binary.LittleEndian.PutUint32(area[4:], 0xFFFFFFFF)
+	retPtr, _, err := env.WriteBytes(area)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Free(retPtr, 8) }()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = env.GetStringValueFromPointer(retPtr)
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, ErrResultTooLarge) {
+		t.Fatalf("err = %v, want ErrResultTooLarge", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("rejecting the result allocated %d bytes", allocated)
+	}
+
+	// The limit applies to lengths within guest memory too.
+	limited := env.WithMaxResultSize(4)
+	if _, err := limited.takeBytes(data, length); !errors.Is(err, ErrResultTooLarge) {
+		t.Errorf("takeBytes: err = %v, want ErrResultTooLarge", err)
+	}
+	if _, err := limited.takeString(data, length); !errors.Is(err, ErrResultTooLarge) {
+		t.Errorf("takeString: err = %v, want ErrResultTooLarge", err)
+	}
+	if got, err := env.ReadBytes(data, length); err != nil || string(got) != "revocation" {
+		t.Errorf("rejected buffer = %q, %v, want it left allocated", got, err)
+	}
+}
+
+var errTest = errors.New("test")
+
+// BenchmarkHashGuestBytes hashes a revocation identifier sized buffer of guest memory.
+func BenchmarkHashGuestBytes(b *testing.B) {
+	env := testEnv(b)
+	ptr, length, err := env.WriteBytes(make([]byte, 64))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = env.Free(ptr, length) }()
+
+	b.Run("ReadBytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			data, err := env.ReadBytes(ptr, length)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = sha256.Sum256(data)
+		}
+	})
+
+	b.Run("withMemBytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			err := env.withMemBytes(ptr, length, func(data []byte) error {
+				_ = sha256.Sum256(data)
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// Helpers do not log the errors they return, the caller does: the error must say everything the
+// log line used to.
+func TestHelperErrorsCarryContext(t *testing.T) {
+	env := testEnv(t)
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	size := uint64(env.Module.Memory().Size())
+	for _, tc := range []struct {
+		err  error
+		want []string
+	}{
+		{errorOf(env.CallFallible("no_such_export")), []string{"no_such_export", "not found"}},
+		{errorOf(env.ReadBytes(size, 8)), []string{"8 bytes", strconv.FormatUint(size, 10)}},
+		{env.withMemBytes(size, 4, func([]byte) error { return nil }), []string{"4 bytes", strconv.FormatUint(size, 10)}},
+		{env.FreeObject("no_such_class", 8), []string{"__wbg_no_such_class_free"}},
+	} {
+		if tc.err == nil {
+			t.Errorf("no error, want one mentioning %q", tc.want)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(tc.err.Error(), want) {
+				t.Errorf("error %q does not mention %q", tc.err, want)
+			}
+		}
+	}
+	if logs.Len() > 0 {
+		t.Errorf("helpers logged the errors they return:\n%s", logs.String())
+	}
+}
+
+func TestGetErrorOutOfRange(t *testing.T) {
+	env := testEnv(t)
+
+	st := env.host()
+	size := len(st.mirror)
+	for _, idx := range []uint64{uint64(size), uint64(size) + 10, 1 << 20} {
+		_, err := env.GetError(idx)
+		want := fmt.Sprintf("error index %d out of range (mirror size %d)", idx, size)
+		if err == nil || err.Error() != want {
+			t.Errorf("GetError(%d) = %v, want %q", idx, err, want)
+		}
+	}
+
+	// A return area holding a guest pointer in its error word fails the call cleanly.
+	err := env.guestError("privatekey_fromString", 1<<20)
+	if err == nil || !strings.Contains(err.Error(), "privatekey_fromString") || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("err = %v, want the out of range index reported for privatekey_fromString", err)
+	}
+}
+
+func errorOf[T any](_ T, err error) error {
+	return err
+}
+
+func TestReadBytesOutOfRange(t *testing.T) {
+	env := testEnv(t)
+	size := env.MemoryStats().Size
+
+	for _, tc := range []struct {
+		name        string
+		ptr, length uint64
+	}{
+		{"past the end", size - 4, 8},
+		{"pointer above 32 bits", 1 << 32, 1},
+		{"length above 32 bits", 0, math.MaxUint32 + 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if data, err := env.WithMaxResultSize(math.MaxUint64).ReadBytes(tc.ptr, tc.length); err == nil {
+				t.Errorf("read %d bytes", len(data))
+			}
+		})
+	}
+
+	ptr, length, err := env.WriteBytes([]byte("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Free(ptr, length) }()
+	if _, err := env.WithMaxResultSize(8).ReadBytes(ptr, length); !errors.Is(err, ErrResultTooLarge) {
+		t.Errorf("read above the result size limit = %v, want ErrResultTooLarge", err)
+	}
+	if data, err := env.ReadBytes(ptr, length); err != nil || string(data) != "0123456789" {
+		t.Errorf("ReadBytes = %q, %v", data, err)
+	}
+}
+
+// outOfRangeMalloc is a module of one memory page whose __wbindgen_malloc returns the offset
+// 65520, 16 bytes before the end of the memory, whatever the length, and whose __wbindgen_free
+// does nothing.
+const outOfRangeMalloc = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x0d\x02\x60\x02\x7f\x7f\x01\x7f\x60\x03\x7f\x7f\x7f\x00" +
+	"\x03\x03\x02\x00\x01\x05\x03\x01\x00\x01\x07\x30\x03\x06\x6d\x65\x6d\x6f\x72\x79\x02\x00\x11\x5f\x5f\x77\x62" +
+	"\x69\x6e\x64\x67\x65\x6e\x5f\x6d\x61\x6c\x6c\x6f\x63\x00\x00\x0f\x5f\x5f\x77\x62\x69\x6e\x64\x67\x65\x6e\x5f" +
+	"\x66\x72\x65\x65\x00\x01\x0a\x0b\x02\x06\x00\x41\xf0\xff\x03\x0b\x02\x00\x0b"
+
+func TestWriteBytesOutOfRange(t *testing.T) {
+	ctx := context.Background()
+	runtime := wazero.NewRuntime(ctx)
+	defer func() { _ = runtime.Close(ctx) }()
+	module, err := runtime.Instantiate(ctx, []byte(outOfRangeMalloc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := WasmEnv{Ctx: ctx, Module: module, functions: map[string]api.Function{}}.WithAllocationTracking()
+
+	if _, _, err := env.WriteBytes(make([]byte, 32)); err == nil {
+		t.Error("WriteBytes wrote past the end of the memory")
+	}
+	if _, _, err := env.WriteString(strings.Repeat("x", 32)); err == nil {
+		t.Error("WriteString wrote past the end of the memory")
+	}
+	called := false
+	if err := env.WithScratch(make([]byte, 32), func(s *Scope, ptr, length uint64) error {
+		called = true
+		return nil
+	}); err == nil || called {
+		t.Errorf("WithScratch = %v, called fn: %v", err, called)
+	}
+	if allocations := env.Stats().Allocations; allocations != 0 {
+		t.Errorf("%d allocations left by failed writes", allocations)
+	}
+
+	// 16 bytes still fit.
+	ptr, length, err := env.WriteBytes(make([]byte, 16))
+	if err != nil || ptr != 65520 || length != 16 {
+		t.Errorf("WriteBytes = %d, %d, %v", ptr, length, err)
+	}
+}
+
+func TestWithScratch(t *testing.T) {
+	env := testEnv(t).WithAllocationTracking()
+
+	failure := errors.New("failure")
+	err := env.WithScratch([]byte("scratch"), func(s *Scope, ptr, length uint64) error {
+		data, err := env.ReadBytes(ptr, length)
+		if err != nil {
+			return err
+		}
+		if string(data) != "scratch" {
+			t.Errorf("scratch buffer = %q", data)
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("WithScratch = %v, want the error of fn", err)
+	}
+	if allocations := env.Stats().Allocations; allocations != 0 {
+		t.Errorf("%d allocations left after fn failed", allocations)
+	}
+
+	// A buffer handed off to an export is reclaimed by the guest, not freed twice: the next
+	// allocation of the same size reuses it.
+	var handedOff uint64
+	err = env.WithScratch([]byte("ed25519-private/zz"), func(s *Scope, ptr, length uint64) error {
+		handedOff = ptr
+		s.Handoff(ptr)
+		_, err := env.CallFallible("privatekey_fromString", ptr, length)
+		return err
+	})
+	var guestErr *GuestError
+	if !errors.As(err, &guestErr) {
+		t.Errorf("WithScratch = %v, want the guest error of the export", err)
+	}
+	if allocations := env.Stats().Allocations; allocations != 0 {
+		t.Errorf("%d allocations left after handoff", allocations)
+	}
+	ptr, err := env.Malloc(uint64(len("ed25519-private/zz")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Free(ptr, uint64(len("ed25519-private/zz"))) }()
+	if ptr != handedOff {
+		t.Errorf("allocation at %d after handoff, want the reclaimed buffer at %d", ptr, handedOff)
+	}
+}
@@ -0,0 +1,78 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// RequiredExports are the exports the Go bindings call. An artifact missing one of them was built
+// from another version of the crate.
+var RequiredExports = []string{
+	"memory",
+	"__wbindgen_malloc",
+	"__wbindgen_free",
+	"keypair_new",
+	"keypair_fromPrivateKey",
+	"keypair_getPublicKey",
+	"keypair_getPrivateKey",
+	"privatekey_fromString",
+	"privatekey_toString",
+	"publickey_fromString",
+	"publickey_toString",
+	"biscuitbuilder_new",
+	"biscuitbuilder_addCode",
+	"biscuitbuilder_build",
+	"biscuit_fromBase64",
+	"biscuit_toBase64",
+	"blockbuilder_new",
+	"blockbuilder_addCode",
+	"biscuit_appendBlock",
+	"authorizerbuilder_new",
+	"authorizerbuilder_addCode",
+	"authorizerbuilder_buildAuthenticated",
+	"authorizer_authorize",
+}
+
+// ArtifactInfo describes a compiled guest without running it.
+type ArtifactInfo struct {
+	// MissingExports are the RequiredExports the artifact does not export.
+	MissingExports []string
+	// PassthroughImports are the imports, as `module.name`, that no host function implements:
+	// they get a no-op stub returning zeroes.
+	PassthroughImports []string
+}
+
+// InspectArtifact compiles source in a throwaway runtime and reports what it exports and which of
+// its imports the host stubs only pretend to implement.
+func InspectArtifact(ctx context.Context, source []byte) (ArtifactInfo, error) {
+	runtime := wazero.NewRuntime(ctx)
+	defer func() { _ = runtime.Close(ctx) }()
+
+	compiled, err := runtime.CompileModule(ctx, source)
+	if err != nil {
+		return ArtifactInfo{}, fmt.Errorf("cannot compile: %w", err)
+	}
+
+	var info ArtifactInfo
+	functions := compiled.ExportedFunctions()
+	memories := compiled.ExportedMemories()
+	for _, name := range RequiredExports {
+		_, isFunction := functions[name]
+		_, isMemory := memories[name]
+		if !isFunction && !isMemory {
+			info.MissingExports = append(info.MissingExports, name)
+		}
+	}
+
+	err = instantiateImportStubs(ctx, runtime, compiled, func(module, name string) {
+		info.PassthroughImports = append(info.PassthroughImports, module+"."+name)
+	})
+	if err != nil {
+		return info, err
+	}
+	sort.Strings(info.PassthroughImports)
+	return info, nil
+}
@@ -0,0 +1,29 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInspectArtifact(t *testing.T) {
+	info, err := InspectArtifact(context.Background(), embeddedWasm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.MissingExports) != 0 {
+		t.Errorf("missing exports %v in the built guest", info.MissingExports)
+	}
+
+	// A valid module exporting nothing.
+	info, err = InspectArtifact(context.Background(), []byte("\x00asm\x01\x00\x00\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.MissingExports) != len(RequiredExports) {
+		t.Errorf("missing exports = %v, want all of them", info.MissingExports)
+	}
+
+	if _, err := InspectArtifact(context.Background(), []byte("not wasm")); err == nil {
+		t.Error("garbage compiled")
+	}
+}
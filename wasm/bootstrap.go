@@ -2,7 +2,6 @@ package wasm
 
 import (
 	"context"
-	"crypto/rand"
 	"fmt"
 	"math"
 
@@ -10,37 +9,18 @@ import (
 	"github.com/tetratelabs/wazero/api"
 )
 
-// taLen maps a synthesized typed-array handle (we use the byte offset as the handle)
-// to its length. This lets entropy functions and copy helpers know where and how
-// many bytes to read/write in guest memory.
-var taLen = map[uint32]uint32{}
-
-// externrefTableSize tracks the logical size of the wasm-bindgen externref table when hosted in Go.
-var externrefTableSize uint32
-
-// ExternrefTableMirror mirrors the wasm-bindgen externref table so Go code can inspect entries.
-// Index 0 is reserved (undefined), and init seeds [undefined, null, true, false] similar to the JS glue.
-var ExternrefTableMirror []any
-
-// synthetic handles for JS-like singletons and typed arrays
-var (
-		globalObjHandle      uint32
-		cryptoObjHandle      uint32
-		memoryObjHandle      uint32
-		bufferObjHandle      uint32
-		functionNoArgsHandle uint32
-		// Start synthetic typed array handles in a high range to avoid colliding with wasm memory pointers
-		taHandleNext uint32 = 0x80000000
-		// taBuf stores JS-allocated typed array contents (not backed by wasm memory)
-		taBuf = map[uint32][]byte{}
-	)
-
 type JsNull struct{}
 
 // InstantiateImportStubs inspects the compiled module and creates host modules for each imported module,
 // exporting no-op functions that match the imported function signatures. This satisfies imports such as
 // "__wbindgen_placeholder__" without needing to know exact names ahead of time.
 func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazero.CompiledModule) error {
+	return instantiateImportStubs(ctx, runtime, c, nil)
+}
+
+// instantiateImportStubs is InstantiateImportStubs reporting to onPassthrough every import that
+// gets the no-op default implementation.
+func instantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazero.CompiledModule, onPassthrough func(module, name string)) error {
 	imports := c.ImportedFunctions()
 	if len(imports) == 0 {
 		return nil
@@ -71,103 +51,46 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 
 		switch name {
 		case "__wbindgen_init_externref_table":
+			// The heap is seeded with its reserved entries by newHostState.
 			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				if len(ExternrefTableMirror) == 0 {
-					ExternrefTableMirror = append(ExternrefTableMirror, nil)
-				}
-				offset := uint32(len(ExternrefTableMirror))
-				for i := 0; i < 4; i++ {
-					ExternrefTableMirror = append(ExternrefTableMirror, nil)
-				}
-				ExternrefTableMirror[offset+0] = nil
-				ExternrefTableMirror[offset+1] = JsNull{}
-				ExternrefTableMirror[offset+2] = true
-				ExternrefTableMirror[offset+3] = false
-				externrefTableSize = uint32(len(ExternrefTableMirror))
 				_ = stack
 			}), params, results).Export(name)
 
+		case "__wbindgen_throw":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostThrow), params, results).Export(name)
+
 		// Basic externref operations
 		case "__wbindgen_object_clone_ref":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				// Return the same index (we don't enforce refcounts in Go host)
-				stack[0] = stack[0]
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				// Return the same index, stack[0] already holds it, and count the extra reference
+				st.clones[api.DecodeU32(stack[0])]++
 			}), params, results).Export(name)
 		case "__wbindgen_object_drop_ref":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				// No-op drop. In a more complete impl we'd track refcounts.
-				_ = stack
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				st.dropExternref(api.DecodeU32(stack[0]))
 			}), params, results).Export(name)
 		case "__wbindgen_externref_heap_live_count":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				stack[0] = api.EncodeU32(uint32(len(ExternrefTableMirror)))
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				stack[0] = api.EncodeU32(st.externrefLiveCount())
 			}), params, results).Export(name)
 
 		// Randomness helpers seen in wasm-bindgen glue
 		case "__wbg_randomFillSync_ac0988aba3254290", "__wbg_getRandomValues_b8f5dbd5f3995a9e":
-			// Signature in this wasm-bindgen glue: (param i32 i32) -> () where params are (obj_handle, typed_array_handle)
-			// We synthesize typed array handles equal to byte offsets into wasm memory and track their lengths.
-   fn := api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
-				mem := m.Memory()
-				_ = api.DecodeU32(stack[0]) // obj_handle not needed
-				arr := api.DecodeU32(stack[1])
-				ln := taLen[arr]
-				// If this handle refers to a JS-allocated buffer, fill that instead
-				if bufJS, ok := taBuf[arr]; ok {
-					if n, err := rand.Read(bufJS); err == nil {
-						if uint32(n) < uint32(len(bufJS)) {
-							for i := n; i < len(bufJS); i++ {
-								bufJS[i] = 0
-							}
-						}
-					}
-					return
-				}
-				// Otherwise, treat the handle as a wasm memory offset
-				if ln == 0 {
-					return
-				}
-				buf := make([]byte, ln)
-				if n, err := rand.Read(buf); err == nil {
-					if uint32(n) < ln {
-						for i := n; uint32(i) < ln; i++ {
-							buf[i] = 0
-						}
-					}
-					_ = mem.Write(arr, buf)
-				}
-			})
-			builder.NewFunctionBuilder().WithGoModuleFunction(fn, params, results).Export(name)
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostGetRandomValues), params, results).Export(name)
 		case "__wbindgen_copy_to_typed_array":
-			// Signature in WAT shows (param i32 i32 i32): (src_handle, src_len, dst_ptr)
-			// We don't have JS objects, so we ignore src_handle and fill dst_ptr with secure random bytes of length src_len.
-			fn := api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
-				mem := m.Memory()
-				_ = api.DecodeU32(stack[0]) // src_handle ignored
-				srcLen := api.DecodeU32(stack[1])
-				dstPtr := api.DecodeU32(stack[2])
-				if srcLen == 0 {
-					return
-				}
-				buf := make([]byte, srcLen)
-				if n, err := rand.Read(buf); err == nil {
-					if uint32(n) < srcLen {
-						for i := n; uint32(i) < srcLen; i++ {
-							buf[i] = 0
-						}
-					}
-					_ = mem.Write(dstPtr, buf)
-				}
-			})
-			builder.NewFunctionBuilder().WithGoModuleFunction(fn, params, results).Export(name)
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostCopyToTypedArray), params, results).Export(name)
 
 		// Type checks and constructors
 		case "__wbindgen_is_null":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				idx := api.DecodeU32(stack[0])
 				var v any
-				if idx < uint32(len(ExternrefTableMirror)) {
-					v = ExternrefTableMirror[idx]
+				if idx < uint32(len(st.mirror)) {
+					v = st.mirror[idx]
 				}
 				_, isNull := v.(JsNull)
 				if isNull {
@@ -177,11 +100,12 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 				}
 			}), params, results).Export(name)
 		case "__wbindgen_is_undefined":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				idx := api.DecodeU32(stack[0])
 				var v any
-				if idx < uint32(len(ExternrefTableMirror)) {
-					v = ExternrefTableMirror[idx]
+				if idx < uint32(len(st.mirror)) {
+					v = st.mirror[idx]
 				}
 				if v == nil {
 					stack[0] = api.EncodeU32(1)
@@ -190,11 +114,12 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 				}
 			}), params, results).Export(name)
 		case "__wbindgen_is_string":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				idx := api.DecodeU32(stack[0])
-				ok := idx < uint32(len(ExternrefTableMirror))
+				ok := idx < uint32(len(st.mirror))
 				if ok {
-					_, ok = ExternrefTableMirror[idx].(string)
+					_, ok = st.mirror[idx].(string)
 				}
 				if ok {
 					stack[0] = api.EncodeU32(1)
@@ -208,42 +133,29 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 				stack[0] = api.EncodeU32(1)
 			}), params, results).Export(name)
 		case "__wbindgen_number_new":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				// Single f64 param encoded in stack[0]
 				f := api.DecodeF64(stack[0])
-				if len(ExternrefTableMirror) == 0 {
-					ExternrefTableMirror = append(ExternrefTableMirror, nil)
-				}
-				ExternrefTableMirror = append(ExternrefTableMirror, f)
-				stack[0] = api.EncodeU32(uint32(len(ExternrefTableMirror) - 1))
+				stack[0] = api.EncodeU32(st.newExternref(f))
 			}), params, results).Export(name)
 
 		case "__wbindgen_number_get":
-			// Returns Option<f64> encoded as (f64, i32 is_some) in result slots.
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				idx := api.DecodeU32(stack[0])
-				var (
-					f      float64
-					isSome uint32
-				)
-				if int(idx) < len(ExternrefTableMirror) {
-					if v, ok := ExternrefTableMirror[idx].(float64); ok {
-						f = v
-						isSome = 1
-					}
-				}
-				stack[0] = api.EncodeF64(f)
-				stack[1] = api.EncodeU32(isSome)
-			}), params, results).Export(name)
+			// (retptr, idx): writes Option<f64> to retptr, is_some at +0 and the value at +8.
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostNumberGet), params, results).Export(name)
 
 		case "__wbindgen_boolean_get":
-			// Returns 1 if true, else 0
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			// Returns 1 if true, 0 if false and 2 if not a boolean, like the JS glue
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				idx := api.DecodeU32(stack[0])
-				ret := uint32(0)
-				if int(idx) < len(ExternrefTableMirror) {
-					if v, ok := ExternrefTableMirror[idx].(bool); ok && v {
-						ret = 1
+				ret := uint32(2)
+				if int(idx) < len(st.mirror) {
+					if v, ok := st.mirror[idx].(bool); ok {
+						ret = 0
+						if v {
+							ret = 1
+						}
 					}
 				}
 				stack[0] = api.EncodeU32(ret)
@@ -251,12 +163,13 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 
 		case "__wbg_isSafeInteger_343e2beeeece1bb0":
 			// Number.isSafeInteger(x)
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				idx := api.DecodeU32(stack[0])
 				ret := uint32(0)
 				const MaxSafe = 9007199254740991.0 // 2^53 - 1
-				if int(idx) < len(ExternrefTableMirror) {
-					if v, ok := ExternrefTableMirror[idx].(float64); ok {
+				if int(idx) < len(st.mirror) {
+					if v, ok := st.mirror[idx].(float64); ok {
 						if !math.IsNaN(v) {
 							abs := math.Abs(v)
 							if abs <= MaxSafe && math.Trunc(v) == v {
@@ -271,38 +184,29 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 		case "__wbindgen_string_new":
 			// handled above
 			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				mem := m.Memory()
 				ptr := api.DecodeU32(stack[0])
 				ln := api.DecodeU32(stack[1])
-				if ln == 0 {
-					stack[0] = api.EncodeU32(0)
-					return
-				}
+				// An empty string is a string like any other, not undefined: the fields of
+				// thrown errors holding one would otherwise decode as nil.
 				buf, ok := mem.Read(ptr, ln)
 				if !ok {
 					stack[0] = api.EncodeU32(0)
 					return
 				}
-				if len(ExternrefTableMirror) == 0 {
-					ExternrefTableMirror = append(ExternrefTableMirror, nil)
-				}
-				ExternrefTableMirror = append(ExternrefTableMirror, string(buf))
-				stack[0] = api.EncodeU32(uint32(len(ExternrefTableMirror) - 1))
+				stack[0] = api.EncodeU32(st.newExternref(string(buf)))
 			}), params, results).Export(name)
 
 		// Minimal JSON helpers
 		case "__wbindgen_json_parse":
 			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				mem := m.Memory()
 				ptr := api.DecodeU32(stack[0])
 				ln := api.DecodeU32(stack[1])
 				if buf, ok := mem.Read(ptr, ln); ok {
-					if len(ExternrefTableMirror) == 0 {
-						ExternrefTableMirror = append(ExternrefTableMirror, nil)
-					}
-					fmt.Println("was here json_parse")
-					ExternrefTableMirror = append(ExternrefTableMirror, string(buf))
-					stack[0] = api.EncodeU32(uint32(len(ExternrefTableMirror) - 1))
+					stack[0] = api.EncodeU32(st.newExternref(string(buf)))
 				} else {
 					stack[0] = api.EncodeU32(0)
 				}
@@ -310,10 +214,11 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 		case "__wbindgen_json_serialize":
 			// Returns a WasmSlice (ptr,len) according to import signature; we rely on wazero to shape results.
 			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				idx := api.DecodeU32(stack[0])
 				var s string
-				if idx < uint32(len(ExternrefTableMirror)) {
-					if v, ok := ExternrefTableMirror[idx].(string); ok {
+				if idx < uint32(len(st.mirror)) {
+					if v, ok := st.mirror[idx].(string); ok {
 						s = v
 					}
 				}
@@ -328,47 +233,137 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 				stack[1] = api.EncodeU32(0)
 			}), params, results).Export(name)
 
-		// Typed array constructors: record length against byte offset and return that as handle
+		// Typed array constructors: views over guest memory, stored in the mirror
 		case "__wbindgen_uint8_array_new", "__wbindgen_uint8_clamped_array_new", "__wbindgen_uint16_array_new", "__wbindgen_uint32_array_new",
 			"__wbindgen_biguint64_array_new", "__wbindgen_int8_array_new", "__wbindgen_int16_array_new", "__wbindgen_int32_array_new",
 			"__wbindgen_bigint64_array_new", "__wbindgen_float32_array_new", "__wbindgen_float64_array_new":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				ptr := api.DecodeU32(stack[0])
 				ln := api.DecodeU32(stack[1])
-				taLen[ptr] = ln
-				stack[0] = api.EncodeU32(ptr)
+				stack[0] = api.EncodeU32(st.memoryTypedArray(ptr, ln))
 			}), params, results).Export(name)
 
 		case "__wbindgen_array_new":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				if len(ExternrefTableMirror) == 0 {
-					ExternrefTableMirror = append(ExternrefTableMirror, nil)
-				}
-				fmt.Println("was here 1")
-				ExternrefTableMirror = append(ExternrefTableMirror, []any{})
-				stack[0] = api.EncodeU32(uint32(len(ExternrefTableMirror) - 1))
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				stack[0] = api.EncodeU32(st.newExternref([]any{}))
 			}), params, results).Export(name)
 		case "__wbindgen_array_push":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				arrIdx := api.DecodeU32(stack[0])
 				valIdx := api.DecodeU32(stack[1])
-				if int(arrIdx) < len(ExternrefTableMirror) {
-					if s, ok := ExternrefTableMirror[arrIdx].([]any); ok {
+				if int(arrIdx) < len(st.mirror) {
+					if s, ok := st.mirror[arrIdx].([]any); ok {
 						var v any
-						if int(valIdx) < len(ExternrefTableMirror) {
-							v = ExternrefTableMirror[valIdx]
+						if int(valIdx) < len(st.mirror) {
+							v = st.mirror[valIdx]
 						}
-						ExternrefTableMirror[arrIdx] = append(s, v)
+						st.mirror[arrIdx] = append(s, v)
 					}
 				}
 			}), params, results).Export(name)
 
+		// js_sys::Array, used by serde_wasm_bindgen when serializing sequences (e.g. failed checks in errors)
+		case "__wbg_new_78feb108b6472713":
+			// new Array()
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				stack[0] = api.EncodeU32(st.newExternref([]any{}))
+			}), params, results).Export(name)
+		case "__wbg_set_37837023f3d740e8":
+			// Array.prototype[index] = value, growing the array with undefined like JS does
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				arrIdx := api.DecodeU32(stack[0])
+				index := int(api.DecodeU32(stack[1]))
+				valIdx := api.DecodeU32(stack[2])
+				if int(arrIdx) >= len(st.mirror) {
+					return
+				}
+				s, ok := st.mirror[arrIdx].([]any)
+				if !ok {
+					return
+				}
+				for len(s) <= index {
+					s = append(s, nil)
+				}
+				if int(valIdx) < len(st.mirror) {
+					s[index] = st.mirror[valIdx]
+				}
+				st.mirror[arrIdx] = s
+				// The value is moved into the array.
+				st.dropExternref(valIdx)
+			}), params, results).Export(name)
+		case "__wbg_push_737cfc8c1432c2c6":
+			// Array.prototype.push(value) -> new length
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				arrIdx := api.DecodeU32(stack[0])
+				valIdx := api.DecodeU32(stack[1])
+				length := uint32(0)
+				if int(arrIdx) < len(st.mirror) {
+					if s, ok := st.mirror[arrIdx].([]any); ok {
+						var v any
+						if int(valIdx) < len(st.mirror) {
+							v = st.mirror[valIdx]
+						}
+						s = append(s, v)
+						st.mirror[arrIdx] = s
+						length = uint32(len(s))
+					}
+				}
+				stack[0] = api.EncodeU32(length)
+			}), params, results).Export(name)
+		case "__wbg_get_b9b93047fe3cf45b":
+			// Array.prototype[index] -> new reference to the element
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				arrIdx := api.DecodeU32(stack[0])
+				index := int(api.DecodeU32(stack[1]))
+				var v any
+				if int(arrIdx) < len(st.mirror) {
+					if s, ok := st.mirror[arrIdx].([]any); ok && index < len(s) {
+						v = s[index]
+					}
+				}
+				stack[0] = api.EncodeU32(st.newExternref(v))
+			}), params, results).Export(name)
+		case "__wbg_length_e2d2a49132c1b256":
+			// Array.prototype.length
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				arrIdx := api.DecodeU32(stack[0])
+				length := uint32(0)
+				if int(arrIdx) < len(st.mirror) {
+					if s, ok := st.mirror[arrIdx].([]any); ok {
+						length = uint32(len(s))
+					}
+				}
+				stack[0] = api.EncodeU32(length)
+			}), params, results).Export(name)
+		case "__wbg_isArray_a1eab7e0d067391b":
+			// Array.isArray(value)
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				idx := api.DecodeU32(stack[0])
+				ret := uint32(0)
+				if int(idx) < len(st.mirror) {
+					if _, ok := st.mirror[idx].([]any); ok {
+						ret = 1
+					}
+				}
+				stack[0] = api.EncodeU32(ret)
+			}), params, results).Export(name)
+
 		case "__wbindgen_not":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				idx := api.DecodeU32(stack[0])
 				var truthy bool
-				if int(idx) < len(ExternrefTableMirror) {
-					switch v := ExternrefTableMirror[idx].(type) {
+				if int(idx) < len(st.mirror) {
+					switch v := st.mirror[idx].(type) {
 					case bool:
 						truthy = v
 					case string:
@@ -388,25 +383,40 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 
 		// Minimal equality helpers
 		case "__wbindgen_jsval_eq", "__wbindgen_jsval_loose_eq":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				a := api.DecodeU32(stack[0])
 				b := api.DecodeU32(stack[1])
 				var va, vb any
-				if int(a) < len(ExternrefTableMirror) {
-					va = ExternrefTableMirror[a]
+				if int(a) < len(st.mirror) {
+					va = st.mirror[a]
 				}
-				if int(b) < len(ExternrefTableMirror) {
-					vb = ExternrefTableMirror[b]
+				if int(b) < len(st.mirror) {
+					vb = st.mirror[b]
 				}
-				if fmt.Sprintf("%v", va) == fmt.Sprintf("%v", vb) {
+				if jsvalEqual(a, b, va, vb) {
 					stack[0] = api.EncodeU32(1)
 				} else {
 					stack[0] = api.EncodeU32(0)
 				}
 			}), params, results).Export(name)
 
+		case "__wbg_performancenow_fd590e2decc0b71a":
+			// performance.now(), read by the guest to enforce the time limit of authorizations and
+			// queries. The clock is frozen: the limit never fires, evaluations are bounded by the fact
+			// and iteration limits. Left as a passthrough, it returned whatever the stack held and
+			// failed evaluations at random with a Timeout.
+			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+				stack[0] = api.EncodeF64(0)
+			}), params, results).Export(name)
+
 		// Type checks default fallbacks
-		case "__wbindgen_is_function", "__wbindgen_is_array", "__wbindgen_is_symbol", "__wbindgen_is_bigint":
+		case "__wbindgen_is_bigint":
+			// The mirror holds no BigInt, numbers are float64.
+			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+				stack[0] = 0
+			}), params, results).Export(name)
+		case "__wbindgen_is_function", "__wbindgen_is_array", "__wbindgen_is_symbol":
 			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
 				// We don't model these precisely; return 0 (false) to be safe.
 				stack[0] = api.EncodeU32(0)
@@ -414,170 +424,143 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 
 		// Wazero-agnostic typed array slicing helpers present in upstream glue
 		case "__wbg_newwithbyteoffsetandlength_d97e637ebe145a9a":
-			// (param i32 i32 i32) (result i32): returns a synthesized handle equal to byte_offset and records length.
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			// (param i32 i32 i32) (result i32): a view of length bytes of guest memory at byte_offset.
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				byteOffset := api.DecodeU32(stack[1])
 				length := api.DecodeU32(stack[2])
-				taLen[byteOffset] = length
-				stack[0] = api.EncodeU32(byteOffset)
+				stack[0] = api.EncodeU32(st.memoryTypedArray(byteOffset, length))
 			}), params, results).Export(name)
 		case "__wbg_set_65595bdd868b3009":
-			// (param i32 i32 i32) -> copy from src_handle to dst_ptr using recorded length
+			// (param i32 i32 i32) -> copy the src typed array to guest memory at dst_ptr
 			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				mem := m.Memory()
 				// dst_array_handle := api.DecodeU32(stack[0]) // unused
-				srcHandle := api.DecodeU32(stack[1])
 				dstPtr := api.DecodeU32(stack[2])
-				// If source is a JS-allocated buffer, write it directly
-				if jsb, ok := taBuf[srcHandle]; ok {
-					_ = mem.Write(dstPtr, jsb)
-					return
-				}
-				// Otherwise, treat as a wasm memory-backed typed array
-				ln := taLen[srcHandle]
-				if ln == 0 {
-					return
-				}
-				if buf, ok := mem.Read(srcHandle, ln); ok {
-					_ = mem.Write(dstPtr, buf)
+				switch src := st.externref(api.DecodeU32(stack[1])).(type) {
+				case []byte:
+					// A JS-allocated buffer, written directly
+					_ = mem.Write(dstPtr, src)
+				case memoryArray:
+					if buf, ok := mem.Read(src.offset, src.length); ok && src.length > 0 {
+						_ = mem.Write(dstPtr, buf)
+					}
 				}
 			}), params, results).Export(name)
 		case "__wbg_subarray_aa9065fa9dc5df96":
-			// (param i32 i32 i32) (result i32): return a new handle = base+begin and record length = end-begin
-   builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				base := api.DecodeU32(stack[0])
+			// (param i32 i32 i32) (result i32): a new typed array over [begin, end) of the base one
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				base := st.externref(api.DecodeU32(stack[0]))
 				begin := api.DecodeU32(stack[1])
 				end := api.DecodeU32(stack[2])
 				var l uint32
 				if end >= begin {
 					l = end - begin
 				}
-				// If base is a JS-allocated buffer, create a new JS handle for the subarray
-				if buf, ok := taBuf[base]; ok {
-					start := int(begin)
-					stop := int(end)
-					if start < 0 { start = 0 }
-					if stop > len(buf) { stop = len(buf) }
-					if stop < start { stop = start }
-					h := taHandleNext
-					taHandleNext++
-					taBuf[h] = buf[start:stop]
-					stack[0] = api.EncodeU32(h)
-					return
+				switch base := base.(type) {
+				case []byte:
+					// A JS-allocated buffer, its subarray shares its bytes
+					start := min(int(begin), len(base))
+					stop := min(max(int(end), start), len(base))
+					stack[0] = api.EncodeU32(st.newExternref(base[start:stop]))
+				case memoryArray:
+					stack[0] = api.EncodeU32(st.memoryTypedArray(base.offset+begin, l))
+				default:
+					// A view over the whole memory buffer
+					stack[0] = api.EncodeU32(st.memoryTypedArray(begin, l))
 				}
-				// Otherwise, treat base as a wasm memory offset and return adjusted offset
-				newHandle := base + begin
-				taLen[newHandle] = l
-				stack[0] = api.EncodeU32(newHandle)
 			}), params, results).Export(name)
 
 		// Newly added passthroughs required by issue
 		case "__wbg_static_accessor_SELF_37c5d418e4bf5819", "__wbg_static_accessor_WINDOW_5de37043a91a9c40", "__wbg_static_accessor_GLOBAL_THIS_56578be7e9f832b0", "__wbg_static_accessor_GLOBAL_88a902d13a557d07":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				if globalObjHandle == 0 {
-					if len(ExternrefTableMirror) == 0 {
-						ExternrefTableMirror = append(ExternrefTableMirror, nil)
-					}
-					ExternrefTableMirror = append(ExternrefTableMirror, map[string]any{"__kind": "global"})
-					globalObjHandle = uint32(len(ExternrefTableMirror) - 1)
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				if st.globalObj == 0 {
+					st.globalObj = st.newExternref(map[string]any{"__kind": "global"})
 				}
-				stack[0] = api.EncodeU32(globalObjHandle)
+				stack[0] = api.EncodeU32(st.globalObj)
 			}), params, results).Export(name)
 		case "__wbg_crypto_574e78ad8b13b65f":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				_ = api.DecodeU32(stack[0]) // global handle, ignored
-				if cryptoObjHandle == 0 {
-					if len(ExternrefTableMirror) == 0 {
-						ExternrefTableMirror = append(ExternrefTableMirror, nil)
-					}
-					ExternrefTableMirror = append(ExternrefTableMirror, map[string]any{"__kind": "crypto"})
-					cryptoObjHandle = uint32(len(ExternrefTableMirror) - 1)
+				if st.cryptoObj == 0 {
+					st.cryptoObj = st.newExternref(map[string]any{"__kind": "crypto"})
 				}
-				stack[0] = api.EncodeU32(cryptoObjHandle)
+				stack[0] = api.EncodeU32(st.cryptoObj)
 			}), params, results).Export(name)
 		case "__wbg_newwithlength_a381634e90c276d4":
-			// new Uint8Array(length) -> create a JS-allocated buffer and return a synthetic handle
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			// new Uint8Array(length) -> a JS-allocated buffer, stored in the mirror
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				length := api.DecodeU32(stack[0])
-				h := taHandleNext
-				taHandleNext++
-				// allocate a JS-backed buffer and record its length
-				taBuf[h] = make([]byte, length)
-				taLen[h] = length
-				stack[0] = api.EncodeU32(h)
+				stack[0] = api.EncodeU32(st.newExternref(make([]byte, length)))
 			}), params, results).Export(name)
 		case "__wbindgen_memory":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				if memoryObjHandle == 0 {
-					if len(ExternrefTableMirror) == 0 {
-						ExternrefTableMirror = append(ExternrefTableMirror, nil)
-					}
-					ExternrefTableMirror = append(ExternrefTableMirror, map[string]any{"__kind": "memory"})
-					memoryObjHandle = uint32(len(ExternrefTableMirror) - 1)
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				if st.memoryObj == 0 {
+					st.memoryObj = st.newExternref(map[string]any{"__kind": "memory"})
 				}
-				stack[0] = api.EncodeU32(memoryObjHandle)
+				stack[0] = api.EncodeU32(st.memoryObj)
 			}), params, results).Export(name)
 		case "__wbg_buffer_609cc3eee51ed158":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				_ = api.DecodeU32(stack[0]) // memory handle, ignored
-				if bufferObjHandle == 0 {
-					if len(ExternrefTableMirror) == 0 {
-						ExternrefTableMirror = append(ExternrefTableMirror, nil)
-					}
-					ExternrefTableMirror = append(ExternrefTableMirror, map[string]any{"__kind": "buffer"})
-					bufferObjHandle = uint32(len(ExternrefTableMirror) - 1)
+				if st.bufferObj == 0 {
+					st.bufferObj = st.newExternref(map[string]any{"__kind": "buffer"})
 				}
-				stack[0] = api.EncodeU32(bufferObjHandle)
+				stack[0] = api.EncodeU32(st.bufferObj)
 			}), params, results).Export(name)
 		case "__wbg_new_a12002a7f91c75be", "__wbg_new_405e22f390576ce2":
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
-				if len(ExternrefTableMirror) == 0 {
-					ExternrefTableMirror = append(ExternrefTableMirror, nil)
-				}
-				ExternrefTableMirror = append(ExternrefTableMirror, map[string]any{})
-				stack[0] = api.EncodeU32(uint32(len(ExternrefTableMirror) - 1))
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
+				stack[0] = api.EncodeU32(st.newExternref(map[string]any{}))
 			}), params, results).Export(name)
 		case "__wbg_set_3f1d0b984ed272ed":
 			// Reflect.set(target, key, value) -> bool
-			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				target := api.DecodeU32(stack[0])
 				key := api.DecodeU32(stack[1])
 				val := api.DecodeU32(stack[2])
 				ok := uint32(0)
-				if int(target) < len(ExternrefTableMirror) {
-					obj := ExternrefTableMirror[target]
+				if int(target) < len(st.mirror) {
+					obj := st.mirror[target]
 					var k string
-					if int(key) < len(ExternrefTableMirror) {
-						if ks, is := ExternrefTableMirror[key].(string); is {
+					if int(key) < len(st.mirror) {
+						if ks, is := st.mirror[key].(string); is {
 							k = ks
 						}
 					}
 					if m, is := obj.(map[string]any); is && k != "" {
 						var v any
-						if int(val) < len(ExternrefTableMirror) {
-							v = ExternrefTableMirror[val]
+						if int(val) < len(st.mirror) {
+							v = st.mirror[val]
 						}
 						m[k] = v
 						ok = 1
 					}
 				}
+				// The value is moved into the object, the key only borrowed.
+				st.dropExternref(val)
 				stack[0] = api.EncodeU32(ok)
 			}), params, results).Export(name)
 		case "__wbg_newnoargs_105ed471475aaf50":
 			// new Function(code)
 			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(func(ctx context.Context, m api.Module, stack []uint64) {
+				st := hostStateOf(m)
 				mem := m.Memory()
 				ptr := api.DecodeU32(stack[0])
 				ln := api.DecodeU32(stack[1])
 				_, _ = mem.Read(ptr, ln) // ignore code
-				if functionNoArgsHandle == 0 {
-					if len(ExternrefTableMirror) == 0 {
-						ExternrefTableMirror = append(ExternrefTableMirror, nil)
-					}
-					ExternrefTableMirror = append(ExternrefTableMirror, "function() { /* noop */ }")
-					functionNoArgsHandle = uint32(len(ExternrefTableMirror) - 1)
+				if st.functionNoArgs == 0 {
+					st.functionNoArgs = st.newExternref("function() { /* noop */ }")
 				}
-				stack[0] = api.EncodeU32(functionNoArgsHandle)
+				stack[0] = api.EncodeU32(st.functionNoArgs)
 			}), params, results).Export(name)
 		case "__wbg_call_672a4d21634d4a24":
 			// f.call(thisArg, ...)
@@ -586,19 +569,45 @@ func InstantiateImportStubs(ctx context.Context, runtime wazero.Runtime, c wazer
 				_ = stack
 			}), params, results).Export(name)
 
+		// Objects and values read by serde_wasm_bindgen, see objects.go
+		case "__wbg_entries_3265d4158b33e5dc":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostObjectEntries), params, results).Export(name)
+		case "__wbg_instanceof_Uint8Array_17156bcf118086a9", "__wbg_instanceof_ArrayBuffer_e14585432e3737fc", "__wbg_instanceof_Map_f3469ce2244d2430":
+			// The mirror holds no typed array, buffer or Map, values are plain objects
+			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
+				stack[0] = 0
+			}), params, results).Export(name)
+		case "__wbindgen_in":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostIn), params, results).Export(name)
+		case "__wbg_iterator_9a24c88df860dc65":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostSymbolIterator), params, results).Export(name)
+		case "__wbg_get_67b2ba62fc30de12":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostReflectGet), params, results).Export(name)
+		case "__wbg_fact_new":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostFactNew), params, results).Export(name)
+		case "__wbindgen_error_new":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostErrorNew), params, results).Export(name)
+		case "__wbindgen_string_get":
+			builder.NewFunctionBuilder().WithGoModuleFunction(api.GoModuleFunc(hostStringGet), params, results).Export(name)
+
 		default:
 			// Passthrough default: export a function matching the signature that leaves inputs/results unchanged or zeroed.
 			// We avoid special-casing stub names; any unrecognized import gets a no-op implementation.
+			if onPassthrough != nil {
+				onPassthrough(modName, name)
+			}
 			builder.NewFunctionBuilder().WithGoFunction(api.GoFunc(func(ctx context.Context, stack []uint64) {
 				// By default, do nothing. Wazero pre-zeros the stack slots for results, so this acts as a safe passthrough.
-				println("passthrough", name)
 				_ = stack
 			}), params, results).Export(name)
 		}
 	}
 
-	// Instantiate each supported host module.
+	// Instantiate each supported host module, unless an earlier guest instantiated it in the runtime.
 	for modName, b := range builders {
+		if runtime.Module(modName) != nil {
+			continue
+		}
 		if _, err := b.Instantiate(ctx); err != nil {
 			return fmt.Errorf("failed to instantiate host module %q: %w", modName, err)
 		}
@@ -0,0 +1,121 @@
+package wasm
+
+import "testing"
+
+func TestExternrefLiveCount(t *testing.T) {
+	st := testEnv(t).host()
+	before := st.externrefLiveCount()
+
+	var handles []uint32
+	for i := range 5 {
+		handles = append(handles, st.newExternref(float64(i)))
+	}
+	if got := st.externrefLiveCount(); got != before+5 {
+		t.Fatalf("live count = %d after 5 allocations, want %d", got, before+5)
+	}
+
+	for _, handle := range handles[:2] {
+		st.dropExternref(handle)
+	}
+	if got := st.externrefLiveCount(); got != before+3 {
+		t.Errorf("live count = %d after 2 drops, want %d", got, before+3)
+	}
+
+	// A cloned reference keeps the entry alive until both are dropped.
+	st.clones[handles[2]]++
+	st.dropExternref(handles[2])
+	if got := st.externrefLiveCount(); got != before+3 {
+		t.Errorf("live count = %d after dropping a clone, want %d", got, before+3)
+	}
+	for _, handle := range handles[2:] {
+		st.dropExternref(handle)
+	}
+	if got := st.externrefLiveCount(); got != before {
+		t.Errorf("live count = %d after dropping everything, want %d", got, before)
+	}
+
+}
+
+func TestExternrefReuse(t *testing.T) {
+	env := testEnv(t)
+	st := env.host()
+
+	handle := st.newExternref("first")
+	st.dropExternref(handle)
+	st.dropExternref(handle)
+	if again := st.newExternref("second"); again != handle {
+		t.Errorf("released handle %d not reused, got %d", handle, again)
+	} else {
+		st.dropExternref(again)
+	}
+
+	// Guest errors are released once read: failing calls do not grow the mirror.
+	fail := func() {
+		strPtr, strLen, err := env.WriteString("not a key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.CallFallible("privatekey_fromString", strPtr, strLen); err == nil {
+			t.Fatal("invalid key accepted")
+		}
+	}
+	fail()
+	size := len(st.mirror)
+	for range 100 {
+		fail()
+	}
+	if len(st.mirror) != size {
+		t.Errorf("mirror grew from %d to %d entries over 100 errors", size, len(st.mirror))
+	}
+}
+
+func TestTypedArrayHandles(t *testing.T) {
+	env := testEnv(t)
+
+	st := env.host()
+	mem := env.Module.Memory()
+	if _, ok := mem.Grow(1024); !ok {
+		t.Fatal("cannot grow memory")
+	}
+	before := st.externrefLiveCount()
+
+	// Typed arrays are externrefs whatever their offset, up to the end of a large memory.
+	offset := mem.Size() - 8
+	memory := st.memoryTypedArray(offset, 8)
+	buffer := st.newExternref(make([]byte, 4))
+	if array, ok := st.externref(memory).(memoryArray); !ok || array.offset != offset || array.length != 8 {
+		t.Errorf("memory array %#x = %#v", memory, st.externref(memory))
+	}
+	if memory == buffer || len(st.externref(buffer).([]byte)) != 4 {
+		t.Errorf("buffer %#x clobbered by memory array %#x", buffer, memory)
+	}
+
+	// Dropping them releases them.
+	st.dropExternref(memory)
+	st.dropExternref(buffer)
+	if got := st.externrefLiveCount(); got != before {
+		t.Errorf("live count = %d after dropping the typed arrays, want %d", got, before)
+	}
+
+	// Key generation goes through both kinds of typed arrays and releases them. The first one
+	// creates the singletons (global, crypto...) and the buffer the guest keeps for random bytes.
+	keyPairNew, err := env.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Call(keyPairNew, 0); err != nil {
+		t.Fatal(err)
+	}
+	live, table, clones := st.externrefLiveCount(), len(st.mirror), len(st.clones)
+	for range 10 {
+		if _, err := env.Call(keyPairNew, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := st.externrefLiveCount(); got != live {
+		t.Errorf("live count = %d after key generations, want %d", got, live)
+	}
+	if len(st.mirror) != table || len(st.clones) != clones {
+		t.Errorf("externref table of %d entries and %d clones after key generations, want %d and %d", len(st.mirror), len(st.clones), table, clones)
+	}
+}
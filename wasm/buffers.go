@@ -0,0 +1,53 @@
+package wasm
+
+import (
+	"sync"
+)
+
+// bufferClasses are the capacities of the pooled host buffers, each four times the previous one.
+// Larger buffers are allocated and dropped like any other.
+var bufferClasses = [...]int{16, 64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// getBuffer returns a buffer of length bytes for a transient copy between host and guest memory,
+// to be handed back to putBuffer once done with. Its content is whatever the previous user left,
+// callers overwrite it before reading it.
+func getBuffer(length int) *[]byte {
+	class := bufferClass(length)
+	if class < 0 {
+		buf := make([]byte, length)
+		return &buf
+	}
+	if pooled, ok := bufferPools[class].Get().(*[]byte); ok {
+		*pooled = (*pooled)[:length]
+		return pooled
+	}
+	buf := make([]byte, length, bufferClasses[class])
+	return &buf
+}
+
+// putBuffer returns buf to its pool. Nothing may use buf afterwards: the next getBuffer hands it
+// out again. A secret buffer, such as one that held random bytes the guest turns into keys, is
+// zeroed first so that its content does not outlive the copy.
+func putBuffer(buf *[]byte, secret bool) {
+	if secret {
+		clear((*buf)[:cap(*buf)])
+	}
+	for class, capacity := range bufferClasses {
+		if cap(*buf) == capacity {
+			bufferPools[class].Put(buf)
+			return
+		}
+	}
+}
+
+// bufferClass returns the index of the smallest class holding length bytes, -1 when none does.
+func bufferClass(length int) int {
+	for class, capacity := range bufferClasses {
+		if length <= capacity {
+			return class
+		}
+	}
+	return -1
+}
@@ -0,0 +1,97 @@
+package wasm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		length, capacity int
+	}{
+		{0, 16}, {1, 16}, {16, 16}, {17, 64}, {1000, 1 << 10}, {64 << 10, 64 << 10}, {64<<10 + 1, 64<<10 + 1},
+	} {
+		buf := getBuffer(tc.length)
+		if len(*buf) != tc.length || cap(*buf) != tc.capacity {
+			t.Errorf("getBuffer(%d): len %d cap %d, want cap %d", tc.length, len(*buf), cap(*buf), tc.capacity)
+		}
+		putBuffer(buf, false)
+	}
+}
+
+func TestPutBufferZeroesSecrets(t *testing.T) {
+	buf := getBuffer(32)
+	copy(*buf, bytes.Repeat([]byte{0xff}, 32))
+	backing := (*buf)[:cap(*buf)]
+	putBuffer(buf, true)
+
+	if !bytes.Equal(backing, make([]byte, len(backing))) {
+		t.Errorf("secret buffer pooled with %x", backing)
+	}
+
+	buf = getBuffer(32)
+	copy(*buf, bytes.Repeat([]byte{0xff}, 32))
+	backing = *buf
+	putBuffer(buf, false)
+	if backing[0] != 0xff {
+		t.Error("buffer zeroed, want only secrets zeroed")
+	}
+}
+
+// Consecutive calls reuse the pooled return area: what one returned must not change with the next.
+func TestPooledBuffersDoNotAlias(t *testing.T) {
+	env := testEnv(t)
+
+	seeds := []string{
+		"ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb",
+		"ed25519-private/0000000000000000000000000000000000000000000000000000000000000001",
+	}
+	keys := make([]uint64, len(seeds))
+	for i, seed := range seeds {
+		strPtr, strLen, err := env.WriteString(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys[i], err = env.CallFallible("privatekey_fromString", strPtr, strLen); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = env.FreeObject("privatekey", keys[i]) }()
+	}
+	if keys[0] == keys[1] {
+		t.Fatalf("both keys at %d", keys[0])
+	}
+
+	encoded := make([]string, len(keys))
+	for i, key := range keys {
+		var err error
+		if encoded[i], err = env.CallString("privatekey_toString", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, seed := range seeds {
+		if encoded[i] != seed {
+			t.Errorf("key %d encoded as %q, want %q", i, encoded[i], seed)
+		}
+	}
+}
+
+// BenchmarkCallString encodes a private key, a call going through the return area and a string copy.
+func BenchmarkCallString(b *testing.B) {
+	env := testEnv(b)
+	strPtr, strLen, err := env.WriteString("ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb")
+	if err != nil {
+		b.Fatal(err)
+	}
+	key, err := env.CallFallible("privatekey_fromString", strPtr, strLen)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = env.FreeObject("privatekey", key) }()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := env.CallString("privatekey_toString", key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
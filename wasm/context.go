@@ -0,0 +1,17 @@
+package wasm
+
+import "context"
+
+type envKey struct{}
+
+// ContextWithEnv returns a copy of ctx carrying env, for helpers deep in a call chain that
+// would otherwise need the env threaded through every signature.
+func ContextWithEnv(ctx context.Context, env WasmEnv) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// EnvFromContext returns the env stored by ContextWithEnv.
+func EnvFromContext(ctx context.Context) (WasmEnv, bool) {
+	env, ok := ctx.Value(envKey{}).(WasmEnv)
+	return env, ok
+}
@@ -0,0 +1,114 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newKeypair stands for a helper deep in a call chain that only receives a context.
+func newKeypair(ctx context.Context) (uint64, error) {
+	env, ok := EnvFromContext(ctx)
+	if !ok {
+		return 0, fmt.Errorf("no wasm env in context")
+	}
+
+	function, err := env.GetFunction("keypair_new")
+	if err != nil {
+		return 0, err
+	}
+	result, err := env.Call(function, 0)
+	if err != nil {
+		return 0, err
+	}
+	return result[0], nil
+}
+
+func TestEnvFromContext(t *testing.T) {
+	env := testEnv(t)
+
+	if _, err := newKeypair(context.Background()); err == nil {
+		t.Fatal("expected an error without an env in the context")
+	}
+
+	ptr, err := newKeypair(ContextWithEnv(context.Background(), env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ptr == 0 {
+		t.Fatal("keypair_new returned a null pointer")
+	}
+	if err := env.FreeObject("keypair", ptr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCallContext(t *testing.T) {
+	env := testEnv(t)
+	function, err := env.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A done context does not start the call, the instance stays usable.
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := env.WithCallContext(ctx).Call(function, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("cancelled call returned after %v", elapsed)
+	}
+	ptr, err := newKeypair(ContextWithEnv(context.Background(), env))
+	if err != nil {
+		t.Fatalf("instance unusable after a call that did not start: %v", err)
+	}
+	_ = env.FreeObject("keypair", ptr)
+}
+
+func TestCallContextAborted(t *testing.T) {
+	pool, err := NewPool(context.Background(), 1, WithModuleOptions(WithWasmBytes(embeddedWasm)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+
+	env, release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	function, err := env.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The context is cancelled once the call is under way, which closes the instance.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	aborting := env.WithCallHook(func(string) { cancel() })
+	if _, err := aborting.CallContext(ctx, function, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if !env.Module.IsClosed() {
+		t.Fatal("aborted instance left open")
+	}
+
+	// The pool replaces the closed instance.
+	release()
+	again, releaseAgain, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseAgain()
+	if again.Module == env.Module {
+		t.Fatal("pool handed out the closed instance again")
+	}
+	ptr, err := newKeypair(ContextWithEnv(context.Background(), *again))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = again.FreeObject("keypair", ptr)
+}
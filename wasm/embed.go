@@ -0,0 +1,21 @@
+package wasm
+
+import (
+	"context"
+	_ "embed"
+)
+
+// embeddedWasm is the release build of the guest, copied next to this file by the build so that
+// the bindings work outside of a checkout of the repository, where there is no target/ tree.
+//
+//go:generate cp ../target/wasm32-unknown-unknown/release/biscuit_wasm_go.wasm biscuit_wasm_go.wasm
+//go:embed biscuit_wasm_go.wasm
+var embeddedWasm []byte
+
+// embeddedName names the embedded guest in errors.
+const embeddedName = "embedded biscuit_wasm_go.wasm"
+
+// CompileEmbedded compiles the guest embedded in the package and instantiates its host imports.
+func CompileEmbedded() (*CompiledModule, error) {
+	return compileWasm(context.Background(), embeddedWasm, embeddedName)
+}
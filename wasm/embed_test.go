@@ -0,0 +1,33 @@
+package wasm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInitWasmEmbedded(t *testing.T) {
+	// Outside of a checkout there is no build output to find, InitWasm falls back to the embedded
+	// guest.
+	t.Chdir(t.TempDir())
+	if _, err := FindWasmFile(); err == nil {
+		t.Fatal("FindWasmFile found a build output in an empty directory")
+	}
+
+	instance, err := InitWasm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = instance.Close(context.Background()) }()
+
+	newKeyPair, err := instance.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := instance.Call(newKeyPair, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.FreeObject("keypair", results[0]); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,162 @@
+package wasm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrDownload is returned by FetchArtifact when the artifact cannot be downloaded.
+	ErrDownload = errors.New("cannot download artifact")
+	// ErrChecksumMismatch is returned by FetchArtifact when the artifact does not have the
+	// checksum recorded for it, or none is recorded.
+	ErrChecksumMismatch = errors.New("artifact checksum mismatch")
+	// ErrInvalidArtifact is returned by FetchArtifact when the artifact does not compile or misses
+	// some RequiredExports.
+	ErrInvalidArtifact = errors.New("invalid artifact")
+)
+
+// ReleaseURL is the download URL of the artifact of a release, %s being its tag.
+var ReleaseURL = "https://github.com/Akanoa/biscuit-wasm-go/releases/download/%s/biscuit_wasm_go.wasm"
+
+// maxArtifactSize bounds downloads, the artifact is a few MiB.
+const maxArtifactSize = 64 << 20
+
+// FetchOptions describes the artifact FetchArtifact installs.
+type FetchOptions struct {
+	// Source is the URL of the artifact, or the tag of a release, see ReleaseURL.
+	Source string
+	// Checksums lists the expected artifacts in the format of sha256sum: one `<hex sha256>
+	// <source>` line per artifact, `#` starting comments.
+	Checksums []byte
+	// Dest is where the artifact is installed, the release build output by default.
+	Dest string
+	// Client downloads the artifact, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// FetchArtifact downloads the artifact of opts.Source, checks it has the checksum recorded for
+// that source and exports what the bindings call, then installs it to opts.Dest, replacing the
+// previous one atomically. It returns the hex sha256 of the artifact.
+func FetchArtifact(ctx context.Context, opts FetchOptions) (string, error) {
+	expected, err := lookupChecksum(opts.Checksums, opts.Source)
+	if err != nil {
+		return "", err
+	}
+
+	url := opts.Source
+	if !strings.Contains(url, "://") {
+		url = fmt.Sprintf(ReleaseURL, opts.Source)
+	}
+	source, err := download(ctx, opts.Client, url)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(source)
+	actual := hex.EncodeToString(sum[:])
+	if actual != expected {
+		return actual, fmt.Errorf("%w: %s has sha256 %s, want %s", ErrChecksumMismatch, url, actual, expected)
+	}
+
+	info, err := InspectArtifact(ctx, source)
+	if err != nil {
+		return actual, fmt.Errorf("%w: %v", ErrInvalidArtifact, err)
+	}
+	if len(info.MissingExports) > 0 {
+		return actual, fmt.Errorf("%w: missing exports %s", ErrInvalidArtifact, strings.Join(info.MissingExports, ", "))
+	}
+
+	dest := opts.Dest
+	if dest == "" {
+		dest = wasmCandidates[0]
+	}
+	if err := installFile(dest, source); err != nil {
+		return actual, err
+	}
+	return actual, nil
+}
+
+// lookupChecksum returns the checksum recorded for source in checksums.
+func lookupChecksum(checksums []byte, source string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == source {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%w: no checksum recorded for %s", ErrChecksumMismatch, source)
+}
+
+func download(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDownload, err)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDownload, err)
+	}
+	defer func() { _ = response.Body.Close() }()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s: %s", ErrDownload, url, response.Status)
+	}
+	source, err := io.ReadAll(io.LimitReader(response.Body, maxArtifactSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDownload, err)
+	}
+	if len(source) > maxArtifactSize {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrDownload, url, maxArtifactSize)
+	}
+	return source, nil
+}
+
+// installFile writes data to a temporary file next to path then renames it, so a crash never
+// leaves a truncated artifact behind.
+func installFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	temp := file.Name()
+	defer func() { _ = os.Remove(temp) }()
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Chmod(0o644); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
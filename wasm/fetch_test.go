@@ -0,0 +1,105 @@
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// emptyModule compiles but exports nothing.
+var emptyModule = []byte("\x00asm\x01\x00\x00\x00")
+
+// serveArtifacts serves the guest artifact at /guest.wasm and emptyModule at /empty.wasm.
+func serveArtifacts(t *testing.T) (server *httptest.Server, guest []byte) {
+	t.Helper()
+
+	guest = embeddedWasm
+	mux := http.NewServeMux()
+	mux.HandleFunc("/guest.wasm", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(guest) })
+	mux.HandleFunc("/empty.wasm", func(w http.ResponseWriter, _ *http.Request) { _, _ = w.Write(emptyModule) })
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, guest
+}
+
+func checksumLine(data []byte, source string) []byte {
+	sum := sha256.Sum256(data)
+	return []byte("# fixtures\n" + hex.EncodeToString(sum[:]) + "  " + source + "\n")
+}
+
+func TestFetchArtifact(t *testing.T) {
+	server, guest := serveArtifacts(t)
+	url := server.URL + "/guest.wasm"
+	dest := filepath.Join(t.TempDir(), "out", "guest.wasm")
+
+	sum, err := FetchArtifact(context.Background(), FetchOptions{Source: url, Checksums: checksumLine(guest, url), Dest: dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256(guest); sum != hex.EncodeToString(want[:]) {
+		t.Errorf("sha256 = %s", sum)
+	}
+	installed, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(installed) != string(guest) {
+		t.Error("installed artifact differs from the served one")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestFetchArtifactTag(t *testing.T) {
+	server, guest := serveArtifacts(t)
+	previous := ReleaseURL
+	ReleaseURL = server.URL + "/%s.wasm"
+	t.Cleanup(func() { ReleaseURL = previous })
+
+	dest := filepath.Join(t.TempDir(), "guest.wasm")
+	if _, err := FetchArtifact(context.Background(), FetchOptions{Source: "guest", Checksums: checksumLine(guest, "guest"), Dest: dest}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetchArtifactFailures(t *testing.T) {
+	server, guest := serveArtifacts(t)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, tc := range []struct {
+		name      string
+		source    string
+		checksums []byte
+		want      error
+	}{
+		{"unreachable", closed.URL + "/guest.wasm", checksumLine(guest, closed.URL+"/guest.wasm"), ErrDownload},
+		{"not found", server.URL + "/missing.wasm", checksumLine(guest, server.URL+"/missing.wasm"), ErrDownload},
+		{"mismatch", server.URL + "/guest.wasm", checksumLine(emptyModule, server.URL+"/guest.wasm"), ErrChecksumMismatch},
+		{"unlisted", server.URL + "/guest.wasm", checksumLine(guest, "v0.0.0"), ErrChecksumMismatch},
+		{"missing exports", server.URL + "/empty.wasm", checksumLine(emptyModule, server.URL+"/empty.wasm"), ErrInvalidArtifact},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "guest.wasm")
+			_, err := FetchArtifact(context.Background(), FetchOptions{Source: tc.source, Checksums: tc.checksums, Dest: dest})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+			for _, other := range []error{ErrDownload, ErrChecksumMismatch, ErrInvalidArtifact} {
+				if other != tc.want && errors.Is(err, other) {
+					t.Errorf("err = %v also matches %v", err, other)
+				}
+			}
+			if _, err := os.Stat(dest); !os.IsNotExist(err) {
+				t.Errorf("artifact installed despite the failure: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package wasm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// hostState is the JS side of a guest instance: the mirror of its externref table, typed arrays
+// included. Every instance has its own, so that the instances of a Pool
+// run concurrently and do not share indexes. Like the WasmEnv, it is only used by the goroutine
+// calling into its instance.
+type hostState struct {
+	// mirror mirrors the wasm-bindgen externref heap so Go code can inspect entries. Like the JS
+	// glue, it starts with the 128 entries of the stack and [undefined, null, true, false]: the
+	// guest never drops an index below reservedExternrefs.
+	mirror []any
+	// tableSize is the logical size of the externref table once seeded, its entries are reserved.
+	tableSize uint32
+	// clones counts the references handed out by __wbindgen_object_clone_ref on top of the
+	// original one, an entry is only released once all of them are dropped.
+	clones map[uint32]int
+	// free lists the released entries of the mirror, reused before it grows.
+	free []uint32
+	// recording, when set, records the entries newExternref creates, see Scope.NewObject.
+	recording *[]uint32
+	// throwHandler is the handler of SetThrowHandler, nil for the default error.
+	throwHandler func(msg string) error
+
+	// Handles of the JS-like singletons, created on first use.
+	globalObj, cryptoObj, memoryObj, bufferObj, functionNoArgs uint32
+}
+
+// memoryArray is a typed array over length bytes of guest memory at offset, as the mirror holds
+// it. A typed array allocated on the JS side is held as a []byte.
+type memoryArray struct {
+	offset, length uint32
+}
+
+// reservedExternrefs is the first index of the externref heap the guest allocates and drops, the
+// JSIDX_RESERVED of wasm-bindgen.
+const reservedExternrefs = 132
+
+func newHostState() *hostState {
+	mirror := make([]any, reservedExternrefs)
+	mirror[reservedExternrefs-3] = JsNull{}
+	mirror[reservedExternrefs-2] = true
+	mirror[reservedExternrefs-1] = false
+	return &hostState{mirror: mirror, tableSize: reservedExternrefs, clones: map[uint32]int{}}
+}
+
+// hostStates maps the guest modules to their hostState.
+var hostStates sync.Map
+
+// hostStateOf returns the state of the guest module, created by its first host call.
+func hostStateOf(module api.Module) *hostState {
+	if state, ok := hostStates.Load(module); ok {
+		return state.(*hostState)
+	}
+	state, _ := hostStates.LoadOrStore(module, newHostState())
+	return state.(*hostState)
+}
+
+// withHostStateCleanup returns ctx releasing the state of the module instantiated with it once
+// the module is closed, however it is: by the env, its compiled module or a cancelled call.
+func withHostStateCleanup(ctx context.Context, module *api.Module) context.Context {
+	return experimental.WithCloseNotifier(ctx, experimental.CloseNotifyFunc(func(context.Context, uint32) {
+		if *module != nil {
+			hostStates.Delete(*module)
+		}
+	}))
+}
+
+// host returns the state of the instance of env.
+func (env WasmEnv) host() *hostState {
+	return hostStateOf(env.Module)
+}
+
+// externref returns the value at idx of the mirror, nil (undefined) when there is none.
+func (self *hostState) externref(idx uint32) any {
+	if int(idx) < len(self.mirror) {
+		return self.mirror[idx]
+	}
+	return nil
+}
+
+// newExternref stores v in the mirror and returns its index.
+func (self *hostState) newExternref(v any) uint32 {
+	var idx uint32
+	if n := len(self.free); n > 0 {
+		idx = self.free[n-1]
+		self.free = self.free[:n-1]
+		self.mirror[idx] = v
+	} else {
+		self.mirror = append(self.mirror, v)
+		idx = uint32(len(self.mirror) - 1)
+	}
+	if self.recording != nil {
+		*self.recording = append(*self.recording, idx)
+	}
+	return idx
+}
+
+// dropExternref releases a reference to the entry idx of the mirror. The reserved entries and the
+// cached singletons (global, crypto...) are never released, their handles are reused.
+func (self *hostState) dropExternref(idx uint32) {
+	if idx < self.tableSize || int(idx) >= len(self.mirror) {
+		return
+	}
+	switch idx {
+	case self.globalObj, self.cryptoObj, self.memoryObj, self.bufferObj, self.functionNoArgs:
+		return
+	}
+	if clones := self.clones[idx]; clones > 0 {
+		if clones == 1 {
+			delete(self.clones, idx)
+		} else {
+			self.clones[idx] = clones - 1
+		}
+		return
+	}
+	if self.mirror[idx] == nil {
+		return
+	}
+	self.mirror[idx] = nil
+	self.free = append(self.free, idx)
+}
+
+// externrefLiveCount returns the number of entries of the mirror holding a value, the reserved
+// entries aside. An entry holding undefined (nil) is not counted.
+func (self *hostState) externrefLiveCount() uint32 {
+	var live uint32
+	for idx := int(self.tableSize); idx < len(self.mirror); idx++ {
+		if self.mirror[idx] != nil {
+			live++
+		}
+	}
+	return live
+}
+
+// memoryTypedArray stores a typed array over length bytes of guest memory at offset in the
+// mirror and returns its index, released like any other externref once the guest drops it.
+func (self *hostState) memoryTypedArray(offset, length uint32) uint32 {
+	return self.newExternref(memoryArray{offset: offset, length: length})
+}
@@ -0,0 +1,80 @@
+package wasm
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestHostStatePerInstance(t *testing.T) {
+	compiled, err := CompileWasm(WithWasmBytes(embeddedWasm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = compiled.Close() }()
+
+	first, err := compiled.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := compiled.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.host() == second.host() {
+		t.Fatal("instances share their host state")
+	}
+
+	idx := first.host().newExternref("first")
+	if value := second.host().externref(idx); value == "first" {
+		t.Error("an externref of one instance is visible from the other")
+	}
+
+	module := first.Module
+	if err := first.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hostStates.Load(module); ok {
+		t.Error("host state kept after the instance closed")
+	}
+	_ = second.Close(context.Background())
+}
+
+// TestPoolConcurrentInstances drives the instances of a pool from concurrent goroutines, through
+// host functions creating and dropping externrefs. Run with -race.
+func TestPoolConcurrentInstances(t *testing.T) {
+	pool, err := NewPool(context.Background(), 4, WithModuleOptions(WithWasmBytes(embeddedWasm)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				env, release, err := pool.Acquire(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ptr, err := newKeypair(ContextWithEnv(context.Background(), *env))
+				if err != nil {
+					t.Error(err)
+				} else {
+					_ = env.FreeObject("keypair", ptr)
+				}
+				strPtr, strLen, err := env.WriteString("not a key")
+				if err == nil {
+					if _, err := env.CallFallible("privatekey_fromString", strPtr, strLen); err == nil {
+						t.Error("invalid key accepted")
+					}
+				}
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+}
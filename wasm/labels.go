@@ -0,0 +1,48 @@
+package wasm
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// Profile labels of the guest calls of an env WithProfileLabels enabled.
+const (
+	// FunctionLabel is the export called, e.g. "authorizer_authorize".
+	FunctionLabel = "wasm.function"
+	// OperationLabel is the operation of the bindings the call is part of, e.g.
+	// "authorizer.authorize", as set by WithOperation.
+	OperationLabel = "biscuit.operation"
+)
+
+// WithProfileLabels returns a copy of env running every guest call under pprof labels, so CPU
+// profiles attribute the time spent in the guest to the export and the operation it served
+// instead of one opaque wazero frame. Labelling costs a context and a label set per call, it is
+// off by default.
+func (env WasmEnv) WithProfileLabels() WasmEnv {
+	env.profileLabels = true
+	return env
+}
+
+// WithOperation returns a copy of env whose guest calls carry operation as their OperationLabel,
+// through env.Ctx. The bindings set it at their entry points, e.g. Authorizer.Authorize calls
+// through self.env.WithOperation("authorizer.authorize"); calls made outside any operation carry
+// only their FunctionLabel. Without WithProfileLabels, env is returned as is.
+func (env WasmEnv) WithOperation(operation string) WasmEnv {
+	if !env.profileLabels {
+		return env
+	}
+	env.Ctx = pprof.WithLabels(env.Ctx, pprof.Labels(OperationLabel, operation))
+	return env
+}
+
+// callLabelled calls function under the FunctionLabel of name, on top of the labels of ctx.
+func callLabelled(ctx context.Context, function api.Function, name string, params []uint64) ([]uint64, error) {
+	var results []uint64
+	var err error
+	pprof.Do(ctx, pprof.Labels(FunctionLabel, name), func(labelled context.Context) {
+		results, err = function.Call(labelled, params...)
+	})
+	return results, err
+}
@@ -0,0 +1,143 @@
+package wasm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestProfileLabels(t *testing.T) {
+	if testing.Short() {
+		t.Skip("profiles the guest for a second")
+	}
+	env := testEnv(t).WithProfileLabels().WithOperation("test.generate")
+
+	var profile bytes.Buffer
+	if err := pprof.StartCPUProfile(&profile); err != nil {
+		t.Skipf("cannot profile: %v", err)
+	}
+	function, err := env.GetFunction("keypair_new")
+	if err != nil {
+		pprof.StopCPUProfile()
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		results, err := env.Call(function, 0)
+		if err != nil {
+			pprof.StopCPUProfile()
+			t.Fatal(err)
+		}
+		if err := env.FreeObject("keypair", results[0]); err != nil {
+			pprof.StopCPUProfile()
+			t.Fatal(err)
+		}
+	}
+	pprof.StopCPUProfile()
+
+	labels, err := sampleLabels(profile.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels[FunctionLabel]["keypair_new"] == 0 || labels[OperationLabel]["test.generate"] == 0 {
+		t.Errorf("sample labels = %v, want %s=keypair_new and %s=test.generate", labels, FunctionLabel, OperationLabel)
+	}
+}
+
+func TestWithOperationWithoutProfileLabels(t *testing.T) {
+	env := testEnv(t)
+	if labelled := env.WithOperation("test.generate"); labelled.Ctx != env.Ctx {
+		t.Error("operation set on an env without profile labels")
+	}
+}
+
+// sampleLabels counts the samples of a CPU profile by label key and value.
+func sampleLabels(data []byte) (map[string]map[string]int, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if data, err = io.ReadAll(reader); err != nil {
+		return nil, err
+	}
+
+	// Profile: sample = 2, string_table = 6. Sample: label = 3. Label: key = 1, str = 2, both
+	// indexes in the string table, which comes after the samples.
+	var table []string
+	var labels [][2]uint64
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		value := data
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data, value = data[n:], value[:n]
+
+		switch {
+		case num == 6 && typ == protowire.BytesType:
+			str, _ := protowire.ConsumeBytes(value)
+			table = append(table, string(str))
+		case num == 2 && typ == protowire.BytesType:
+			sample, _ := protowire.ConsumeBytes(value)
+			for len(sample) > 0 {
+				num, typ, n := protowire.ConsumeTag(sample)
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+				sample = sample[n:]
+				field := sample
+				n = protowire.ConsumeFieldValue(num, typ, sample)
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+				sample, field = sample[n:], field[:n]
+				if num != 3 || typ != protowire.BytesType {
+					continue
+				}
+
+				label, _ := protowire.ConsumeBytes(field)
+				var key, str uint64
+				for len(label) > 0 {
+					num, typ, n := protowire.ConsumeTag(label)
+					if n < 0 || typ != protowire.VarintType {
+						break
+					}
+					value, m := protowire.ConsumeVarint(label[n:])
+					if m < 0 {
+						break
+					}
+					switch num {
+					case 1:
+						key = value
+					case 2:
+						str = value
+					}
+					label = label[n+m:]
+				}
+				labels = append(labels, [2]uint64{key, str})
+			}
+		}
+	}
+
+	counts := map[string]map[string]int{}
+	for _, label := range labels {
+		if label[0] >= uint64(len(table)) || label[1] >= uint64(len(table)) {
+			continue
+		}
+		key, value := table[label[0]], table[label[1]]
+		if counts[key] == nil {
+			counts[key] = map[string]int{}
+		}
+		counts[key][value]++
+	}
+	return counts, nil
+}
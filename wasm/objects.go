@@ -0,0 +1,240 @@
+package wasm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// The host functions below model the JS values serde_wasm_bindgen reads when an export takes a
+// plain object, such as the parameters of addCodeWithParameters: objects, walked with
+// Object.entries, strings, numbers and booleans. In the externref mirror an object is a
+// map[string]any and an array a []any.
+
+// HexBytes is a byte string the guest reads as the string of its hex encoding. The encoding is
+// written straight into the guest allocation, HexChunkSize bytes at a time, so it never exists
+// as a whole on the host.
+type HexBytes []byte
+
+// HexChunkSize is the number of bytes of a HexBytes encoded per write into guest memory.
+const HexChunkSize = 32 << 10
+
+// GuestObject is an object the guest hands to the host by value, e.g. a fact returned by a query.
+// The host owns it and frees it with FreeObject(Class, Ptr).
+type GuestObject struct {
+	Class string
+	Ptr   uint64
+}
+
+// jsIteratorSymbol is Symbol.iterator.
+type jsIteratorSymbol struct{}
+
+// hostObjectEntries implements Object.entries(obj): the [key, value] pairs of obj, sorted by key.
+func hostObjectEntries(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	object, _ := st.externref(api.DecodeU32(stack[0])).(map[string]any)
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	entries := make([]any, len(keys))
+	for i, key := range keys {
+		entries[i] = []any{key, object[key]}
+	}
+	stack[0] = api.EncodeU32(st.newExternref(entries))
+}
+
+// hostFactNew wraps the fact the guest returns by value, see GuestObject.
+func hostFactNew(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	fact := GuestObject{Class: "fact", Ptr: uint64(api.DecodeU32(stack[0]))}
+	stack[0] = api.EncodeU32(st.newExternref(fact))
+}
+
+// hostSymbolIterator implements Symbol.iterator.
+func hostSymbolIterator(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	stack[0] = api.EncodeU32(st.newExternref(jsIteratorSymbol{}))
+}
+
+// hostReflectGet implements Reflect.get(target, key) for the string keys of objects. The guest
+// asks objects for Symbol.iterator, which they do not have: they are read with Object.entries.
+func hostReflectGet(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	object, _ := st.externref(api.DecodeU32(stack[0])).(map[string]any)
+	var value any
+	if key, ok := st.externref(api.DecodeU32(stack[1])).(string); ok {
+		value = object[key]
+	}
+	stack[0] = api.EncodeU32(st.newExternref(value))
+}
+
+// jsvalEqual compares the values va and vb at the indexes a and b of the mirror: by value for
+// primitives, by reference for objects, whose rendering could be as large as a parameter.
+func jsvalEqual(a, b uint32, va, vb any) bool {
+	if a == b {
+		return true
+	}
+	switch va.(type) {
+	case map[string]any, []any, HexBytes, []byte:
+		return false
+	}
+	switch vb.(type) {
+	case map[string]any, []any, HexBytes, []byte:
+		return false
+	}
+	return fmt.Sprintf("%v", va) == fmt.Sprintf("%v", vb)
+}
+
+// hostIn implements key in object for the string keys of objects.
+func hostIn(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	key, _ := st.externref(api.DecodeU32(stack[0])).(string)
+	object, _ := st.externref(api.DecodeU32(stack[1])).(map[string]any)
+	if _, ok := object[key]; ok {
+		stack[0] = 1
+		return
+	}
+	stack[0] = 0
+}
+
+// hostErrorNew implements new Error(message), stored as the message: the guest only throws it.
+func hostErrorNew(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	ptr, length := api.DecodeU32(stack[0]), api.DecodeU32(stack[1])
+	message, ok := module.Memory().Read(ptr, length)
+	if !ok {
+		panic(fmt.Errorf("error message out of memory bounds at %d", ptr))
+	}
+	stack[0] = api.EncodeU32(st.newExternref(string(message)))
+}
+
+// hostNumberGet implements __wbindgen_number_get(retptr, idx): it writes to retptr the number at
+// idx as an Option<f64>, None when it is not a number.
+func hostNumberGet(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	retPtr := api.DecodeU32(stack[0])
+	var option [16]byte
+	if value, ok := st.externref(api.DecodeU32(stack[1])).(float64); ok {
+		binary.LittleEndian.PutUint32(option[0:], 1)
+		binary.LittleEndian.PutUint64(option[8:], math.Float64bits(value))
+	}
+	if !module.Memory().Write(retPtr, option[:]) {
+		panic(fmt.Errorf("cannot write the number to wasm memory at %d", retPtr))
+	}
+}
+
+// hostStringGet implements __wbindgen_string_get(retptr, idx): it writes to retptr a guest copy
+// of the string at idx, allocated with __wbindgen_malloc, or a null pointer when it is not a
+// string. HexBytes are strings too, copied as their hex encoding.
+func hostStringGet(ctx context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	retPtr := api.DecodeU32(stack[0])
+	var ptr, length uint32
+	switch value := st.externref(api.DecodeU32(stack[1])).(type) {
+	case string:
+		length = uint32(len(value))
+		ptr = guestMalloc(ctx, module, length)
+		if !module.Memory().WriteString(ptr, value) {
+			panic(fmt.Errorf("cannot write %d bytes to wasm memory at %d", length, ptr))
+		}
+	case HexBytes:
+		length = uint32(hex.EncodedLen(len(value)))
+		ptr = guestMalloc(ctx, module, length)
+		if !writeHex(module.Memory(), ptr, value) {
+			panic(fmt.Errorf("cannot write %d bytes to wasm memory at %d", length, ptr))
+		}
+	}
+
+	var slice [8]byte
+	binary.LittleEndian.PutUint32(slice[0:], ptr)
+	binary.LittleEndian.PutUint32(slice[4:], length)
+	if !module.Memory().Write(retPtr, slice[:]) {
+		panic(fmt.Errorf("cannot write the string slice to wasm memory at %d", retPtr))
+	}
+}
+
+// guestMalloc allocates length bytes with __wbindgen_malloc from within a host function, for a
+// buffer the guest takes ownership of.
+func guestMalloc(ctx context.Context, module api.Module, length uint32) uint32 {
+	results, err := module.ExportedFunction("__wbindgen_malloc").Call(ctx, uint64(length), 1)
+	if err != nil {
+		panic(fmt.Errorf("__wbindgen_malloc of %d bytes failed: %w", length, err))
+	}
+	return api.DecodeU32(results[0])
+}
+
+// writeHex writes the hex encoding of data to guest memory at offset, through a pooled buffer
+// encoding HexChunkSize bytes at a time.
+func writeHex(memory api.Memory, offset uint32, data []byte) bool {
+	buf := getBuffer(hex.EncodedLen(min(len(data), HexChunkSize)))
+	defer putBuffer(buf, false)
+	for len(data) > 0 {
+		chunk := data[:min(len(data), HexChunkSize)]
+		n := hex.Encode(*buf, chunk)
+		if !memory.Write(offset, (*buf)[:n]) {
+			return false
+		}
+		offset += uint32(n)
+		data = data[len(chunk):]
+	}
+	return true
+}
+
+// hostCopyToTypedArray implements __wbindgen_copy_to_typed_array(ptr, len, idx): it copies the
+// guest buffer an export taking a &mut [u8] wrote to back into the Uint8Array at idx, a []byte
+// stored by Scope.NewUint8Array.
+func hostCopyToTypedArray(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	ptr, length := api.DecodeU32(stack[0]), api.DecodeU32(stack[1])
+	array, _ := st.externref(api.DecodeU32(stack[2])).([]byte)
+	data, ok := module.Memory().Read(ptr, length)
+	if !ok {
+		panic(fmt.Errorf("typed array out of memory bounds at %d", ptr))
+	}
+	copy(array, data)
+}
+
+// ErrUnknownTypedArray is wrapped by the errors of calls aborted because the guest asked for
+// random bytes in a typed array whose length the host cannot tell.
+var ErrUnknownTypedArray = errors.New("unknown typed array")
+
+// hostGetRandomValues implements crypto.getRandomValues(array) and randomFillSync(array): it fills
+// the typed array at stack[1] with random bytes. The array is a JS-allocated buffer, including a
+// []byte stored by Scope.NewUint8Array, or guest memory recorded by a typed array constructor. Any
+// other handle aborts the call, since the guest would otherwise take the zeros it left as key
+// material.
+func hostGetRandomValues(_ context.Context, module api.Module, stack []uint64) {
+	st := hostStateOf(module)
+	handle := api.DecodeU32(stack[1])
+	switch array := st.externref(handle).(type) {
+	case []byte:
+		fillRandom(array)
+	case memoryArray:
+		// The random bytes become key material: the pooled copy is zeroed once written.
+		buf := getBuffer(int(array.length))
+		defer putBuffer(buf, true)
+		fillRandom(*buf)
+		if !module.Memory().Write(array.offset, *buf) {
+			panic(fmt.Errorf("typed array out of memory bounds at %d", array.offset))
+		}
+	default:
+		panic(fmt.Errorf("%w: getRandomValues on handle %#x", ErrUnknownTypedArray, handle))
+	}
+}
+
+// fillRandom fills buf with random bytes, aborting the guest call when they are not available.
+func fillRandom(buf []byte) {
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Errorf("cannot read random bytes: %w", err))
+	}
+}
@@ -0,0 +1,130 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+func TestNewObjectParameters(t *testing.T) {
+	env := testEnv(t)
+	function, err := env.GetFunction("biscuitbuilder_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := env.Call(function)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := results[0]
+	defer func() { _ = env.FreeObject("biscuitbuilder", builder) }()
+
+	live := env.Stats().Externrefs
+	err = env.WithScope(func(s *Scope) error {
+		strPtr, strLen, err := s.WriteString(`data({s}, {n}, {b}, {h});`)
+		if err != nil {
+			return err
+		}
+		parameters := s.NewObject(map[string]any{
+			"s": "hello",
+			"n": float64(42),
+			"b": true,
+			"h": map[string]any{"bytes": HexBytes{0x01, 0xab, 0xff}},
+		})
+		s.Handoff(strPtr)
+		return env.CallFallibleVoid("biscuitbuilder_addCodeWithParameters", builder, strPtr, strLen, parameters, s.NewObject(map[string]any{}))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := env.CallString("biscuitbuilder_toString", builder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "// no root key id set\ndata(\"hello\", 42, true, hex:01abff);\n"; code != want {
+		t.Errorf("code = %q, want %q", code, want)
+	}
+	if got := env.Stats().Externrefs; got != live {
+		t.Errorf("%d externrefs live after the scope, want %d", got, live)
+	}
+}
+
+func TestWriteHexChunks(t *testing.T) {
+	env := testEnv(t)
+	data := make([]byte, 2*HexChunkSize+3)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	ptr, err := env.Malloc(uint64(2 * len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Free(ptr, uint64(2*len(data))) }()
+
+	if !writeHex(env.Module.Memory(), uint32(ptr), data) {
+		t.Fatal("writeHex failed")
+	}
+	written, err := env.ReadBytes(ptr, uint64(2*len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != hex.EncodeToString(data) {
+		t.Error("hex written in chunks differs from the encoding of the data")
+	}
+}
+
+func TestGetRandomValuesUnknownHandle(t *testing.T) {
+	env := testEnv(t)
+	st := env.host()
+
+	ptr, length, err := env.WriteBytes(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = env.Free(ptr, length) }()
+
+	getRandomValues := func(handle uint32) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err, _ = recovered.(error)
+			}
+		}()
+		hostGetRandomValues(context.Background(), env.Module, []uint64{0, api.EncodeU32(handle)})
+		return nil
+	}
+
+	// A handle the host never recorded aborts the call rather than leave the buffer zeroed.
+	unknown := st.newExternref(map[string]any{})
+	defer st.dropExternref(unknown)
+	if err := getRandomValues(unknown); !errors.Is(err, ErrUnknownTypedArray) {
+		t.Fatalf("err = %v, want ErrUnknownTypedArray", err)
+	}
+
+	handle := st.memoryTypedArray(uint32(ptr), uint32(length))
+	defer st.dropExternref(handle)
+	if err := getRandomValues(handle); err != nil {
+		t.Fatal(err)
+	}
+	data, err := env.ReadBytes(ptr, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(data, make([]byte, 32)) {
+		t.Error("getRandomValues left the typed array zero-filled")
+	}
+
+	array := make([]byte, 16)
+	idx := st.newExternref(array)
+	defer st.dropExternref(idx)
+	if err := getRandomValues(idx); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(array, make([]byte, 16)) {
+		t.Error("getRandomValues left the Uint8Array zero-filled")
+	}
+}
@@ -0,0 +1,138 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+)
+
+// ErrInvalidOption is returned by InitWasm for options that are invalid or conflict.
+var ErrInvalidOption = errors.New("invalid option")
+
+// Option configures InitWasm.
+type Option func(*initOptions)
+
+type initOptions struct {
+	path     string
+	source   []byte
+	ctx      context.Context
+	logger   *slog.Logger
+	cacheDir string
+	runtime  wazero.Runtime
+	// invalid records the options that cannot be applied, reported by validate.
+	invalid []string
+}
+
+// WithWasmPath makes InitWasm load the guest compiled at path instead of looking for a build
+// output or using the embedded guest.
+func WithWasmPath(path string) Option {
+	return func(options *initOptions) {
+		if path == "" {
+			options.invalid = append(options.invalid, "WithWasmPath of an empty path")
+		}
+		options.path = path
+	}
+}
+
+// WithWasmBytes makes InitWasm compile source, the content of a wasm file, instead of looking
+// for a build output or using the embedded guest.
+func WithWasmBytes(source []byte) Option {
+	return func(options *initOptions) {
+		if len(source) == 0 {
+			options.invalid = append(options.invalid, "WithWasmBytes of no bytes")
+		}
+		options.source = source
+	}
+}
+
+// WithContext sets the context the runtime is created with, and the Ctx of the env, instead of
+// context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(options *initOptions) {
+		if ctx == nil {
+			options.invalid = append(options.invalid, "WithContext of a nil context")
+		}
+		options.ctx = ctx
+	}
+}
+
+// WithLogger sets the logger of the env, which reports the errors it cannot return, such as
+// failures to free scope allocations, instead of slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(options *initOptions) {
+		if logger == nil {
+			options.invalid = append(options.invalid, "WithLogger of a nil logger")
+		}
+		options.logger = logger
+	}
+}
+
+// WithCompilationCache makes InitWasm keep the machine code of the guest in dir, created if
+// missing, so that the processes after the first one skip compiling it. The cache of a dir is
+// opened once and kept for the life of the process.
+func WithCompilationCache(dir string) Option {
+	return func(options *initOptions) {
+		if dir == "" {
+			options.invalid = append(options.invalid, "WithCompilationCache of an empty dir")
+		}
+		options.cacheDir = dir
+	}
+}
+
+// WithSharedRuntime makes InitWasm compile and instantiate the guest in runtime, which the env
+// does not own: closing the env closes its module only, the caller closes runtime. The host
+// modules of the guest are instantiated in runtime once, by the first InitWasm using it, and the
+// guest compiled by every InitWasm stays in runtime until it is closed.
+func WithSharedRuntime(runtime wazero.Runtime) Option {
+	return func(options *initOptions) {
+		if runtime == nil {
+			options.invalid = append(options.invalid, "WithSharedRuntime of a nil runtime")
+		}
+		options.runtime = runtime
+	}
+}
+
+// compilationCaches maps the dirs of WithCompilationCache to their open cache.
+var compilationCaches sync.Map
+
+// compilationCache returns the cache kept in dir, created if missing.
+func compilationCache(dir string) (wazero.CompilationCache, error) {
+	if cache, ok := compilationCaches.Load(dir); ok {
+		return cache.(wazero.CompilationCache), nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cannot create compilation cache: %w", err)
+	}
+	cache, err := wazero.NewCompilationCacheWithDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open compilation cache: %w", err)
+	}
+	if loaded, ok := compilationCaches.LoadOrStore(dir, cache); ok {
+		_ = cache.Close(context.Background())
+		return loaded.(wazero.CompilationCache), nil
+	}
+	return cache, nil
+}
+
+// newInitOptions applies options over the defaults and validates the result.
+func newInitOptions(options []Option) (initOptions, error) {
+	result := initOptions{ctx: context.Background(), logger: slog.Default()}
+	for _, option := range options {
+		option(&result)
+	}
+	if result.path != "" && result.source != nil {
+		result.invalid = append(result.invalid, "WithWasmPath and WithWasmBytes are exclusive")
+	}
+	if result.cacheDir != "" && result.runtime != nil {
+		result.invalid = append(result.invalid, "WithCompilationCache and WithSharedRuntime are exclusive")
+	}
+	if len(result.invalid) > 0 {
+		return initOptions{}, fmt.Errorf("%w: %s", ErrInvalidOption, result.invalid[0])
+	}
+	return result, nil
+}
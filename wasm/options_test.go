@@ -0,0 +1,152 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+)
+
+func TestInitWasmFromBytes(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "app")
+
+	instance, err := InitWasm(WithWasmBytes(embeddedWasm), WithContext(ctx), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = instance.Close(context.Background()) }()
+
+	if instance.Ctx.Value(key{}) != "app" {
+		t.Error("the env does not carry the context of WithContext")
+	}
+	if instance.log() != logger {
+		t.Error("the env does not log with the logger of WithLogger")
+	}
+	if !strings.Contains(logs.String(), "source=\"wasm bytes\"") {
+		t.Errorf("logs = %q, want the guest loaded from bytes", logs.String())
+	}
+
+	newKeyPair, err := instance.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := instance.Call(newKeyPair, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.FreeObject("keypair", results[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitWasmInvalidOptions(t *testing.T) {
+	for name, options := range map[string][]Option{
+		"path and bytes": {WithWasmPath("guest.wasm"), WithWasmBytes(embeddedWasm)},
+		"empty path":     {WithWasmPath("")},
+		"empty bytes":    {WithWasmBytes(nil)},
+		"nil context":    {WithContext(nil)},
+		"nil logger":     {WithLogger(nil)},
+	} {
+		if instance, err := InitWasm(options...); !errors.Is(err, ErrInvalidOption) {
+			if err == nil {
+				_ = instance.Close(context.Background())
+			}
+			t.Errorf("%s: err = %v, want ErrInvalidOption", name, err)
+		}
+	}
+
+	if _, err := InitWasm(WithWasmPath("missing.wasm")); err == nil || errors.Is(err, ErrInvalidOption) {
+		t.Errorf("missing file: err = %v, want a read error", err)
+	}
+}
+
+func TestInitWasmCompilationCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache", "biscuit")
+	instance, err := InitWasm(WithWasmBytes(embeddedWasm), WithCompilationCache(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = instance.Close(context.Background())
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) == 0 {
+		t.Errorf("cache dir holds %d entries, %v, want the compiled guest", len(entries), err)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := InitWasm(WithWasmBytes(embeddedWasm), WithCompilationCache(filepath.Join(file, "cache"))); err == nil {
+		t.Error("InitWasm succeeded with a cache dir under a file")
+	}
+
+	runtime := wazero.NewRuntime(context.Background())
+	defer func() { _ = runtime.Close(context.Background()) }()
+	if _, err := InitWasm(WithCompilationCache(dir), WithSharedRuntime(runtime)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("cache and shared runtime: err = %v, want ErrInvalidOption", err)
+	}
+}
+
+func TestInitWasmSharedRuntime(t *testing.T) {
+	ctx := context.Background()
+	runtime := wazero.NewRuntime(ctx)
+	defer func() { _ = runtime.Close(ctx) }()
+
+	first, err := InitWasm(WithWasmBytes(embeddedWasm), WithSharedRuntime(runtime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := InitWasm(WithWasmBytes(embeddedWasm), WithSharedRuntime(runtime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = second.Close(context.Background()) }()
+
+	// Closing an env leaves the runtime, and the other env, usable.
+	if err := first.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	newKeyPair, err := second.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := second.Call(newKeyPair, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.FreeObject("keypair", results[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkInitWasm(b *testing.B) {
+	dir := b.TempDir()
+	for name, options := range map[string][]Option{
+		"uncached": {WithWasmBytes(embeddedWasm)},
+		"cached":   {WithWasmBytes(embeddedWasm), WithCompilationCache(dir)},
+	} {
+		b.Run(name, func(b *testing.B) {
+			// The first init fills the cache, the benchmark measures the ones after it.
+			warm, err := InitWasm(options...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = warm.Close(context.Background())
+			for b.Loop() {
+				instance, err := InitWasm(options...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_ = instance.Close(context.Background())
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// ErrMemoryBudgetExceeded is returned by Pool.Acquire when a new instance would take the guest
+// memory of the pool over its WithTotalMemoryLimit budget.
+var ErrMemoryBudgetExceeded = errors.New("pool memory budget exceeded")
+
+// Pool hands out module instances to concurrent callers. A WasmEnv is not safe for concurrent
+// use, each caller gets exclusive use of an instance between Acquire and the call of the release
+// function it returned.
+type Pool struct {
+	newEnv      func() (WasmEnv, error)
+	memoryLimit uint64
+	slots       chan struct{}
+	// options compile the guest shared by the instances, unless they come from WithCompiledModule.
+	options []Option
+
+	// compileMu guards owned, compiled by the first Acquire without holding mu.
+	compileMu sync.Mutex
+	owned     *CompiledModule
+
+	mu   sync.Mutex
+	idle []WasmEnv
+	// sizes holds the guest memory of every instance of the pool, idle or in use, as of its
+	// creation or last release: the memory of an instance in use is never read.
+	sizes  map[api.Module]uint64
+	closed bool
+	// checkedOut counts the instances handed out and not released yet, which Close waits for.
+	checkedOut sync.WaitGroup
+}
+
+type PoolOption func(*Pool)
+
+// WithTotalMemoryLimit caps the guest memory of all the instances of the pool, in bytes. An
+// instance that grew the pool over the limit is dropped when it is released. Zero means no limit.
+func WithTotalMemoryLimit(bytes uint64) PoolOption {
+	return func(pool *Pool) {
+		pool.memoryLimit = bytes
+	}
+}
+
+// WithModuleOptions sets the options of CompileWasm for the guest the pool compiles.
+func WithModuleOptions(options ...Option) PoolOption {
+	return func(pool *Pool) {
+		pool.options = options
+	}
+}
+
+// WithCompiledModule makes the pool instantiate compiled, which outlives the pool, rather than
+// compile the guest itself.
+func WithCompiledModule(compiled *CompiledModule) PoolOption {
+	return func(pool *Pool) {
+		pool.newEnv = compiled.Instantiate
+	}
+}
+
+// NewPool creates a pool of at most size instances. Instances are created on demand, from a guest
+// compiled with ctx once by the first Acquire and torn down with the instances by Close.
+func NewPool(ctx context.Context, size int, opts ...PoolOption) (*Pool, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("nil context")
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid pool size %d", size)
+	}
+
+	pool := &Pool{
+		slots: make(chan struct{}, size),
+		sizes: map[api.Module]uint64{},
+	}
+	pool.newEnv = pool.instantiate
+	for _, opt := range opts {
+		opt(pool)
+	}
+	pool.options = append([]Option{WithContext(ctx)}, pool.options...)
+	return pool, nil
+}
+
+// instantiate creates an instance of the guest compiled by the pool, compiling it first if needed.
+func (self *Pool) instantiate() (WasmEnv, error) {
+	self.compileMu.Lock()
+	defer self.compileMu.Unlock()
+
+	if self.owned == nil {
+		compiled, err := CompileWasm(self.options...)
+		if err != nil {
+			return WasmEnv{}, err
+		}
+		self.owned = compiled
+	}
+	return self.owned.Instantiate()
+}
+
+// Acquire returns an instance for the exclusive use of the caller, waiting for one to be released
+// when all of them are in use, and the function giving it back. Calling release more than once
+// gives it back once; the env must not be used afterwards.
+func (self *Pool) Acquire(ctx context.Context) (*WasmEnv, func(), error) {
+	select {
+	case self.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	env, err := self.take()
+	if err != nil {
+		<-self.slots
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	return &env, func() { once.Do(func() { self.release(env) }) }, nil
+}
+
+// take returns an idle instance or a new one, checked out of the pool.
+func (self *Pool) take() (WasmEnv, error) {
+	self.mu.Lock()
+	if self.closed {
+		self.mu.Unlock()
+		return WasmEnv{}, fmt.Errorf("pool closed")
+	}
+	if n := len(self.idle); n > 0 {
+		env := self.idle[n-1]
+		self.idle = self.idle[:n-1]
+		self.checkedOut.Add(1)
+		self.mu.Unlock()
+		return env, nil
+	}
+	if self.memoryLimit > 0 && self.memoryUsed() >= self.memoryLimit {
+		self.mu.Unlock()
+		return WasmEnv{}, ErrMemoryBudgetExceeded
+	}
+	// Close waits for the instance being created like for those in use.
+	self.checkedOut.Add(1)
+	self.mu.Unlock()
+
+	env, err := self.newEnv()
+	if err != nil {
+		self.checkedOut.Done()
+		return WasmEnv{}, err
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	size := env.MemoryStats().Size
+	if self.memoryLimit > 0 && self.memoryUsed()+size > self.memoryLimit {
+		if err := env.release(); err != nil {
+			env.log().Error("cannot release instance over budget", slog.Any("err", err))
+		}
+		self.checkedOut.Done()
+		return WasmEnv{}, ErrMemoryBudgetExceeded
+	}
+	self.sizes[env.Module] = size
+	return env, nil
+}
+
+// release gives back an instance obtained from Acquire.
+func (self *Pool) release(env WasmEnv) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	defer func() { <-self.slots }()
+	defer self.checkedOut.Done()
+
+	// An instance whose call was aborted by its context is closed, see WasmEnv.CallContext.
+	if !env.Module.IsClosed() {
+		self.sizes[env.Module] = env.MemoryStats().Size
+	}
+	if self.closed || env.Module.IsClosed() || self.memoryLimit > 0 && self.memoryUsed() > self.memoryLimit {
+		self.drop(env)
+		return
+	}
+	self.idle = append(self.idle, env)
+}
+
+// Size returns the maximum number of instances of the pool.
+func (self *Pool) Size() int {
+	return cap(self.slots)
+}
+
+// MemoryStats returns the guest memory of all the instances of the pool, idle or in use. The
+// memory of an instance in use is counted as of when it was handed out.
+func (self *Pool) MemoryStats() MemoryStats {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	return MemoryStats{Size: self.memoryUsed()}
+}
+
+// Close refuses new Acquire calls, waits for the instances in use to be released, then tears down
+// every instance along with the guest compiled by the pool.
+func (self *Pool) Close() error {
+	self.mu.Lock()
+	self.closed = true
+	self.mu.Unlock()
+
+	self.checkedOut.Wait()
+
+	self.mu.Lock()
+	var errs []error
+	for _, env := range self.idle {
+		errs = append(errs, self.forget(env))
+	}
+	self.idle = nil
+	self.mu.Unlock()
+
+	self.compileMu.Lock()
+	defer self.compileMu.Unlock()
+	if self.owned != nil {
+		errs = append(errs, self.owned.Close())
+		self.owned = nil
+	}
+	return errors.Join(errs...)
+}
+
+// memoryUsed returns the sum of the sizes of the instances, see sizes.
+func (self *Pool) memoryUsed() uint64 {
+	var total uint64
+	for _, size := range self.sizes {
+		total += size
+	}
+	return total
+}
+
+// drop tears down env, which is no longer accounted for by the pool.
+func (self *Pool) drop(env WasmEnv) {
+	if err := self.forget(env); err != nil {
+		env.log().Error("cannot release instance", slog.Any("err", err))
+	}
+}
+
+func (self *Pool) forget(env WasmEnv) error {
+	delete(self.sizes, env.Module)
+	return env.release()
+}
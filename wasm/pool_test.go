@@ -0,0 +1,202 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPoolTotalMemoryLimit(t *testing.T) {
+	budget := testEnv(t).MemoryStats().Size
+
+	pool, err := NewPool(context.Background(), 4, WithTotalMemoryLimit(budget))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+
+	first, releaseFirst, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first instance refused: %v", err)
+	}
+	if got := pool.MemoryStats().Size; got == 0 || got > budget {
+		t.Fatalf("pool memory = %d, want within (0, %d]", got, budget)
+	}
+
+	if _, _, err := pool.Acquire(context.Background()); !errors.Is(err, ErrMemoryBudgetExceeded) {
+		t.Fatalf("err = %v, want ErrMemoryBudgetExceeded", err)
+	}
+
+	releaseFirst()
+	again, releaseAgain, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("released instance not reused: %v", err)
+	}
+	if again.Module != first.Module {
+		t.Error("pool created a new instance instead of reusing the idle one")
+	}
+	releaseAgain()
+}
+
+func TestCompiledModuleInstances(t *testing.T) {
+	compiled, err := CompileEmbedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = compiled.Close() }()
+
+	first, err := compiled.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := NewPool(context.Background(), 1, WithCompiledModule(compiled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+	second, release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ptr, length, err := first.WriteString("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := second.ReadBytes(ptr, length); err == nil && string(data) == "first" {
+		t.Fatal("instances of a compiled module share their memory")
+	}
+
+	// Closing an instance leaves the compiled module and its other instances usable.
+	if err := first.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ptr, length, err = second.WriteString(layoutSeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := second.CallFallible("privatekey_fromString", ptr, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = second.FreeObject("privatekey", key)
+}
+
+func TestPoolCompilesOnce(t *testing.T) {
+	pool, err := NewPool(context.Background(), 2, WithModuleOptions(WithWasmBytes(embeddedWasm)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+
+	first, releaseFirst, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled := pool.owned
+	second, releaseSecond, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compiled == nil || pool.owned != compiled {
+		t.Fatal("instances of the pool do not share one compiled guest")
+	}
+	if first.Module == second.Module {
+		t.Fatal("pool handed out the same instance twice")
+	}
+
+	// Waiting for an instance gives up with the context.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := pool.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	releaseFirst()
+	// Releasing twice gives the instance back once.
+	releaseFirst()
+	if len(pool.idle) != 1 {
+		t.Fatalf("%d idle instances, want 1", len(pool.idle))
+	}
+	releaseSecond()
+}
+
+func TestPoolCloseDrains(t *testing.T) {
+	pool, err := NewPool(context.Background(), 2, WithModuleOptions(WithWasmBytes(embeddedWasm)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan error)
+	go func() { closed <- pool.Close() }()
+
+	// Close waits for the instance in use, which stays usable, and refuses new callers.
+	for {
+		pool.mu.Lock()
+		refusing := pool.closed
+		pool.mu.Unlock()
+		if refusing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, err := pool.Acquire(context.Background()); err == nil {
+		t.Fatal("instance acquired from a closing pool")
+	}
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v with an instance in use", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	ptr, length, err := env.WriteString(layoutSeed)
+	if err != nil {
+		t.Fatalf("instance in use torn down by Close: %v", err)
+	}
+	key, err := env.CallFallible("privatekey_fromString", ptr, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = env.FreeObject("privatekey", key)
+
+	release()
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	if !env.Module.IsClosed() || pool.owned != nil {
+		t.Error("instance or compiled guest kept after Close")
+	}
+}
+
+func TestPoolMemoryStatsOfReleasedInstances(t *testing.T) {
+	pool, err := NewPool(context.Background(), 1, WithModuleOptions(WithWasmBytes(embeddedWasm)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pool.Close() }()
+
+	env, release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := pool.MemoryStats().Size
+	if before != env.MemoryStats().Size {
+		t.Fatalf("pool memory = %d, want the %d bytes of its instance", before, env.MemoryStats().Size)
+	}
+
+	// The memory of the instance in use is not read, its growth is counted once it is released.
+	if _, ok := env.Module.Memory().Grow(16); !ok {
+		t.Fatal("cannot grow memory")
+	}
+	if got := pool.MemoryStats().Size; got != before {
+		t.Errorf("pool memory = %d while the instance is in use, want %d", got, before)
+	}
+	release()
+	if got, want := pool.MemoryStats().Size, before+16*65536; got != want {
+		t.Errorf("pool memory = %d after release, want %d", got, want)
+	}
+}
@@ -0,0 +1,161 @@
+package wasm
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// Scope records the guest allocations made during one operation and frees them when the
+// operation ends, see WasmEnv.WithScope.
+type Scope struct {
+	env         WasmEnv
+	allocations []allocation
+	// externrefs records the entries of the externref mirror created since the first NewObject,
+	// outer the recording of an enclosing scope, restored when the scope ends.
+	externrefs *[]uint32
+	outer      *[]uint32
+}
+
+type allocation struct {
+	ptr, length uint64
+}
+
+// WithScope calls fn with a scope whose allocations are all freed, in reverse order, once fn
+// returns, whether it succeeded or not. Errors freeing them are logged, fn's error is returned.
+func (env WasmEnv) WithScope(fn func(s *Scope) error) error {
+	scope := &Scope{env: env}
+	defer scope.free()
+	return fn(scope)
+}
+
+// Env returns the instance the scope allocates in.
+func (self *Scope) Env() WasmEnv {
+	return self.env
+}
+
+// Malloc allocates length bytes freed when the scope ends.
+func (self *Scope) Malloc(length uint64) (uint64, error) {
+	ptr, err := self.env.Malloc(length)
+	if err != nil {
+		return 0, err
+	}
+	self.allocations = append(self.allocations, allocation{ptr, length})
+	return ptr, nil
+}
+
+// WriteBytes is WasmEnv.WriteBytes with the buffer freed when the scope ends, unless it is handed
+// off to an export with Handoff.
+func (self *Scope) WriteBytes(data []byte) (uint64, uint64, error) {
+	return self.record(self.env.WriteBytes(data))
+}
+
+// WriteString is WasmEnv.WriteString with the buffer freed when the scope ends, unless it is
+// handed off to an export with Handoff.
+func (self *Scope) WriteString(data string) (uint64, uint64, error) {
+	return self.record(self.env.WriteString(data))
+}
+
+// record adds the buffer a write returned to the allocations of the scope.
+func (self *Scope) record(ptr, length uint64, err error) (uint64, uint64, error) {
+	if err != nil {
+		return 0, 0, err
+	}
+	self.allocations = append(self.allocations, allocation{ptr, length})
+	return ptr, length, nil
+}
+
+// NewObject stores values in the externref mirror as a JS object and returns its index, to pass
+// to an export taking a JsValue such as addCodeWithParameters. Values are strings, HexBytes,
+// float64, bools or nested map[string]any objects, and must not change until the scope ends.
+// The guest releases neither the object nor the references it reads it through, the scope
+// releases every externref created from the first NewObject on when it ends.
+func (self *Scope) NewObject(values map[string]any) uint64 {
+	st := self.env.host()
+	if self.externrefs == nil {
+		self.externrefs, self.outer = &[]uint32{}, st.recording
+		st.recording = self.externrefs
+	}
+	return uint64(st.newExternref(values))
+}
+
+// NewUint8Array stores out in the externref mirror as a JS Uint8Array and returns its index, to
+// pass along with a guest copy of out to an export taking a &mut [u8]: the guest copies its buffer
+// back into out before returning, and releases the index itself.
+func (self *Scope) NewUint8Array(out []byte) uint64 {
+	st := self.env.host()
+	outer := st.recording
+	st.recording = nil
+	defer func() { st.recording = outer }()
+	return uint64(st.newExternref(out))
+}
+
+// ReadBytes copies length bytes starting at ptr out of guest memory.
+func (self *Scope) ReadBytes(ptr uint64, length uint64) ([]byte, error) {
+	return self.env.ReadBytes(ptr, length)
+}
+
+// Handoff stops tracking the allocation at ptr, for buffers passed to an export taking a &str or
+// &[u8], which reclaims them itself. Call it right before calling the export.
+func (self *Scope) Handoff(ptr uint64) {
+	for i, allocation := range self.allocations {
+		if allocation.ptr == ptr {
+			self.allocations = append(self.allocations[:i], self.allocations[i+1:]...)
+			self.env.allocations.forget(ptr)
+			return
+		}
+	}
+}
+
+func (self *Scope) free() {
+	var errs []error
+	for i := len(self.allocations) - 1; i >= 0; i-- {
+		allocation := self.allocations[i]
+		errs = append(errs, self.env.Free(allocation.ptr, allocation.length))
+	}
+	self.allocations = nil
+	if self.externrefs != nil {
+		st := self.env.host()
+		st.recording = self.outer
+		for _, idx := range *self.externrefs {
+			st.dropExternref(idx)
+		}
+		self.externrefs, self.outer = nil, nil
+	}
+	if err := errors.Join(errs...); err != nil {
+		self.env.log().Error("cannot free scope allocations", slog.Any("err", err))
+	}
+}
+
+// allocationTracker records the buffers allocated from the host and not freed yet, for leak tests.
+type allocationTracker struct {
+	live map[uint64]uint64
+}
+
+func (self *allocationTracker) record(ptr, length uint64) {
+	if self != nil {
+		self.live[ptr] = length
+	}
+}
+
+func (self *allocationTracker) forget(ptr uint64) {
+	if self != nil {
+		delete(self.live, ptr)
+	}
+}
+
+// WithAllocationTracking returns a copy of env recording the buffers it allocates until they are
+// freed or handed off to an export, see Stats. Tracking costs a map update per allocation, it is
+// meant for leak tests.
+func (env WasmEnv) WithAllocationTracking() WasmEnv {
+	env.allocations = &allocationTracker{live: map[uint64]uint64{}}
+	return env
+}
+
+// outstanding returns the number of buffers env allocated and did not free, or that were not
+// handed off to an export.
+func (env WasmEnv) outstanding() int {
+	if env.allocations == nil {
+		return 0
+	}
+	return len(env.allocations.live)
+}
@@ -0,0 +1,80 @@
+package wasm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScopeFreesOnError(t *testing.T) {
+	env := testEnv(t).WithAllocationTracking()
+
+	failure := errors.New("midway")
+	err := env.WithScope(func(s *Scope) error {
+		if _, err := s.Malloc(64); err != nil {
+			return err
+		}
+		if _, _, err := s.WriteString("user(\"alice\")"); err != nil {
+			return err
+		}
+		if env.outstanding() != 2 {
+			t.Errorf("outstanding = %d inside the scope, want 2", env.outstanding())
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want the closure error", err)
+	}
+	if n := env.outstanding(); n != 0 {
+		t.Errorf("%d allocations outstanding after the scope", n)
+	}
+}
+
+func TestScopeHandoff(t *testing.T) {
+	env := testEnv(t).WithAllocationTracking()
+
+	fromString := func(key string) error {
+		return env.WithScope(func(s *Scope) error {
+			strPtr, strLen, err := s.WriteString(key)
+			if err != nil {
+				return err
+			}
+			s.Handoff(strPtr)
+			ptr, err := env.CallFallible("privatekey_fromString", strPtr, strLen)
+			if err != nil {
+				return err
+			}
+			return env.FreeObject("privatekey", ptr)
+		})
+	}
+
+	if err := fromString("ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb"); err != nil {
+		t.Fatal(err)
+	}
+	var guestErr *GuestError
+	if err := fromString("ed25519-private/00"); !errors.As(err, &guestErr) {
+		t.Fatalf("err = %v, want a GuestError", err)
+	}
+	if n := env.outstanding(); n != 0 {
+		t.Errorf("%d allocations outstanding after the calls", n)
+	}
+}
+
+func TestScopeWriteInvalidUTF8(t *testing.T) {
+	env := testEnv(t).WithAllocationTracking()
+
+	err := env.WithScope(func(s *Scope) error {
+		if _, _, err := s.WriteString("\xff"); !errors.Is(err, ErrInvalidUTF8) {
+			t.Errorf("err = %v, want ErrInvalidUTF8", err)
+		}
+		if n := len(s.allocations); n != 0 {
+			t.Errorf("scope recorded %d allocations for a rejected string", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := env.outstanding(); n != 0 {
+		t.Errorf("%d allocations outstanding after the scope", n)
+	}
+}
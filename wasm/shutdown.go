@@ -0,0 +1,91 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrClosed is returned by the calls made on an env once it is being closed.
+var ErrClosed = errors.New("wasm env closed")
+
+// ErrBusy is returned by Close when calls are still in flight once ctx is done. The env is left
+// open, refusing new calls: closing it again waits anew.
+var ErrBusy = errors.New("wasm env busy")
+
+// callGate counts the calls in flight on an instance, shared by the copies of its env, so that
+// closing it waits for them instead of trapping them.
+type callGate struct {
+	mu      sync.Mutex
+	calls   int
+	closing bool
+	// idle is closed once closing with no call in flight.
+	idle chan struct{}
+}
+
+func newCallGate() *callGate {
+	return &callGate{idle: make(chan struct{})}
+}
+
+// enter records a call, unless the instance is being closed.
+func (self *callGate) enter() error {
+	if self == nil {
+		return nil
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.closing {
+		return ErrClosed
+	}
+	self.calls++
+	return nil
+}
+
+// leave records the end of a call entered.
+func (self *callGate) leave() {
+	if self == nil {
+		return
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.calls--
+	if self.closing && self.calls == 0 {
+		close(self.idle)
+	}
+}
+
+// close refuses new calls and waits for those in flight, until ctx is done.
+func (self *callGate) close(ctx context.Context) error {
+	if self == nil {
+		return nil
+	}
+	self.mu.Lock()
+	if !self.closing {
+		self.closing = true
+		if self.calls == 0 {
+			close(self.idle)
+		}
+	}
+	calls := self.calls
+	self.mu.Unlock()
+
+	select {
+	case <-self.idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %d calls in flight: %w", ErrBusy, calls, ctx.Err())
+	}
+}
+
+// Close tears down the instance, its module and its runtime when it was created by InitWasm, once
+// the calls in flight on it, from other goroutines, completed: calls starting meanwhile fail with
+// ErrClosed. When ctx is done first, Close returns ErrBusy and leaves the instance open. Closing
+// again does nothing. It must not be called from a call in flight, such as a CallHook, which it
+// would wait for forever.
+func (env WasmEnv) Close(ctx context.Context) error {
+	if err := env.calls.close(ctx); err != nil {
+		return err
+	}
+	return env.release()
+}
@@ -0,0 +1,144 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowCall starts a keypair_new call on a new instance of the guest, held in flight until the
+// returned release is called. done receives the outcome of the call.
+func slowCall(t *testing.T) (instance WasmEnv, release func(), done <-chan error) {
+	t.Helper()
+
+	compiled, err := CompileEmbedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = compiled.Close() })
+	if instance, err = compiled.Instantiate(); err != nil {
+		t.Fatal(err)
+	}
+	function, err := instance.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var once sync.Once
+	entered, proceed := make(chan struct{}), make(chan struct{})
+	slow := instance.WithCallHook(func(string) {
+		once.Do(func() { close(entered) })
+		<-proceed
+	})
+	result := make(chan error, 1)
+	go func() {
+		_, err := slow.Call(function, 0)
+		result <- err
+	}()
+	<-entered
+	return instance, sync.OnceFunc(func() { close(proceed) }), result
+}
+
+func TestCloseWaitsForCallsInFlight(t *testing.T) {
+	instance, release, called := slowCall(t)
+	defer release()
+
+	closed := make(chan error, 1)
+	go func() { closed <- instance.Close(context.Background()) }()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v with a call in flight", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release()
+	if err := <-called; err != nil {
+		t.Errorf("call in flight failed: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+
+	function, err := instance.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instance.Call(function, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("call after Close: err = %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseBusy(t *testing.T) {
+	instance, release, called := slowCall(t)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := instance.Close(ctx); !errors.Is(err, ErrBusy) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want ErrBusy", err)
+	}
+
+	// Still open for the call in flight, closed to new ones.
+	function, err := instance.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := instance.Call(function, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("call while closing: err = %v, want ErrClosed", err)
+	}
+
+	release()
+	if err := <-called; err != nil {
+		t.Errorf("call in flight failed: %v", err)
+	}
+	if err := instance.Close(context.Background()); err != nil {
+		t.Errorf("Close once idle failed: %v", err)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	instance, err := InitWasm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	function, err := instance.GetFunction("keypair_new")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := instance.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := instance.Close(context.Background()); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+	if _, err := instance.Call(function, 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("keypair_new after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestLockerSharedByCopies(t *testing.T) {
+	compiled, err := CompileEmbedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = compiled.Close() })
+	first, err := compiled.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := compiled.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Locker() != first.WithCallContext(context.Background()).Locker() {
+		t.Error("copies of an env have different locks")
+	}
+	if first.Locker() == second.Locker() {
+		t.Error("instances share a lock")
+	}
+}
@@ -0,0 +1,43 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/wazero/api"
+)
+
+// ErrThrown is wrapped by the errors of calls aborted by the guest throwing, e.g. when a null
+// pointer is passed to an export, unless a throw handler replaced them.
+var ErrThrown = errors.New("guest threw")
+
+// SetThrowHandler makes the calls of env aborted by a guest throw fail with the error handler
+// returns for the thrown message, instead of an error wrapping ErrThrown. A handler returning nil
+// keeps that default error for the message, a nil handler restores it for every message. The
+// handler runs inside the guest call, on the goroutine of the caller, and is released with the
+// instance.
+func (env WasmEnv) SetThrowHandler(handler func(msg string) error) {
+	env.host().throwHandler = handler
+}
+
+// throwError returns the error a throw of msg by module aborts the call with.
+func throwError(module api.Module, msg string) error {
+	if handler := hostStateOf(module).throwHandler; handler != nil {
+		if err := handler(msg); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrThrown, msg)
+}
+
+// hostThrow implements __wbindgen_throw(ptr, len): it aborts the guest call with the error of
+// the thrown message, as the JS exception would have.
+func hostThrow(_ context.Context, module api.Module, stack []uint64) {
+	ptr, length := api.DecodeU32(stack[0]), api.DecodeU32(stack[1])
+	msg, ok := module.Memory().Read(ptr, length)
+	if !ok {
+		panic(fmt.Errorf("%w a message out of memory bounds", ErrThrown))
+	}
+	panic(throwError(module, string(msg)))
+}
@@ -0,0 +1,72 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errInvalidHandle = errors.New("invalid handle")
+
+func TestThrowHandler(t *testing.T) {
+	env := testEnv(t)
+
+	// A null object pointer makes the guest throw before touching its memory.
+	_, err := env.CallString("publickey_toString", 0)
+	if !errors.Is(err, ErrThrown) || !strings.Contains(err.Error(), "null pointer passed to rust") {
+		t.Fatalf("err = %v, want the thrown message wrapping ErrThrown", err)
+	}
+
+	env.SetThrowHandler(func(msg string) error {
+		if msg == "null pointer passed to rust" {
+			return errInvalidHandle
+		}
+		return nil
+	})
+	t.Cleanup(func() { env.SetThrowHandler(nil) })
+
+	_, err = env.CallString("publickey_toString", 0)
+	if !errors.Is(err, errInvalidHandle) || errors.Is(err, ErrThrown) {
+		t.Errorf("err = %v, want the handler error", err)
+	}
+
+	// The env still works after an aborted call.
+	strPtr, strLen, err := env.WriteString("ed25519-private/eacbce4ed1a4132e1c667ebe5f730f493197fd3def32027a87ea2233d5b55abb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptr, err := env.CallFallible("privatekey_fromString", strPtr, strLen)
+	if err != nil {
+		t.Errorf("call after a throw failed: %v", err)
+	}
+	_ = env.FreeObject("privatekey", ptr)
+
+	env.SetThrowHandler(nil)
+	if _, err := env.CallString("publickey_toString", 0); !errors.Is(err, ErrThrown) {
+		t.Errorf("err = %v after removing the handler, want ErrThrown", err)
+	}
+}
+
+func TestThrowHandlerReleased(t *testing.T) {
+	compiled, err := CompileWasm(WithWasmBytes(embeddedWasm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = compiled.Close() }()
+
+	env, err := compiled.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.SetThrowHandler(func(string) error { return errInvalidHandle })
+	module := env.Module
+	if err := env.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The handler lives in the host state of the instance, released once it closed.
+	if _, ok := hostStates.Load(module); ok {
+		t.Error("throw handler kept after the instance closed")
+	}
+}
@@ -2,10 +2,13 @@ package wasm
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"sync"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
@@ -19,14 +22,69 @@ var wasmCandidates = []string{
 type WasmEnv struct {
 	Ctx    context.Context
 	Module api.Module
+
+	runtime       wazero.Runtime
+	returnAreaTap ReturnAreaTap
+	callHook      CallHook
+	memoryHook    MemoryHook
+	profileLabels bool
+	entropy       io.Reader
+	allocations   *allocationTracker
+	maxResultSize uint64
+	logger        *slog.Logger
+	calls         *callGate
+	// lock serializes the callers sharing the instance, see Locker.
+	lock *sync.Mutex
+	// functions caches the exports GetFunction looked up, wazero allocates a call engine for
+	// every lookup. Like the env, it is not safe for concurrent use.
+	functions map[string]api.Function
+}
+
+// Locker returns the lock of the instance of env, shared by the copies of env. Code sharing an env
+// between goroutines, like the middlewares of biscuithttp and the interceptors of biscuitgrpc,
+// holds it around its calls so that they do not interleave. An env that was not instantiated by
+// this package has no lock of its own, every call then returns a new one.
+func (env WasmEnv) Locker() sync.Locker {
+	if env.lock == nil {
+		return &sync.Mutex{}
+	}
+	return env.lock
+}
+
+// log returns the logger of env, see WithLogger.
+func (env WasmEnv) log() *slog.Logger {
+	if env.logger == nil {
+		return slog.Default()
+	}
+	return env.logger
+}
+
+// WithEntropy returns a copy of env drawing host-side random values (nonces...) from source
+// instead of crypto/rand.
+func (env WasmEnv) WithEntropy(source io.Reader) WasmEnv {
+	env.entropy = source
+	return env
+}
+
+// Entropy returns the random source host-side helpers must use.
+func (env WasmEnv) Entropy() io.Reader {
+	if env.entropy == nil {
+		return rand.Reader
+	}
+	return env.entropy
 }
 
 func (env WasmEnv) GetFunction(name string) (api.Function, error) {
+	if function, ok := env.functions[name]; ok {
+		return function, nil
+	}
 	function := env.Module.ExportedFunction(name)
 	if function == nil {
-		slog.Error("exported function not found", slog.String("name", name))
 		return nil, fmt.Errorf("exported function '%s' not found", name)
 	}
+	if env.functions != nil {
+		env.functions[name] = function
+	}
 	return function, nil
 }
 
@@ -38,8 +96,87 @@ func (env WasmEnv) GetMemory() (api.Memory, error) {
 	return memory, nil
 }
 
+// CallHook is told the export name of every guest function called through Call, before the call.
+type CallHook func(fnName string)
+
+// WithCallHook returns a copy of env reporting its calls to hook, e.g. to count the calls an
+// operation costs. A nil hook disables reporting, which is the default.
+func (env WasmEnv) WithCallHook(hook CallHook) WasmEnv {
+	env.callHook = hook
+	return env
+}
+
+// WithCallCounter returns a copy of env adding its calls to *count, e.g. to record the calls of an
+// operation on its span, and still reporting them to its call hook if it has one.
+func (env WasmEnv) WithCallCounter(count *int) WasmEnv {
+	hook := env.callHook
+	env.callHook = func(fnName string) {
+		*count++
+		if hook != nil {
+			hook(fnName)
+		}
+	}
+	return env
+}
+
+// MemoryHook is told, after every call made through Call, how many bytes the guest memory grew
+// during the call. Guest memory never shrinks, a call served from free memory reports 0.
+type MemoryHook func(fnName string, grown uint64)
+
+// WithMemoryHook returns a copy of env reporting the memory growth of its calls to hook, to find
+// the operations driving it, see MemoryStats for the total. Each call then costs two samples of the
+// memory size. A nil hook disables reporting, which is the default.
+func (env WasmEnv) WithMemoryHook(hook MemoryHook) WasmEnv {
+	env.memoryHook = hook
+	return env
+}
+
+// WithCallContext returns a copy of env making its guest calls under ctx instead of the context it
+// was created with, e.g. to bound them by the deadline of a request. The bindings call through the
+// env they were given, so keypair.Invoke(env.WithCallContext(ctx)) bounds every call of the keypair
+// and of the keys it hands out. See CallContext for what cancellation does to the instance.
+func (env WasmEnv) WithCallContext(ctx context.Context) WasmEnv {
+	env.Ctx = ctx
+	return env
+}
+
+// Call calls function under env.Ctx, see CallContext.
 func (env WasmEnv) Call(function api.Function, params ...uint64) ([]uint64, error) {
-	return function.Call(env.Ctx, params...)
+	return env.CallContext(env.Ctx, function, params...)
+}
+
+// CallContext calls function under ctx. A call is not started once ctx is done, and a call running
+// when ctx is done is aborted, its error matching ctx.Err() with errors.Is. An aborted call leaves
+// the guest in an unknown state, so wazero closes the instance: every later call fails and the env
+// must be replaced, which Pool.Release does.
+func (env WasmEnv) CallContext(ctx context.Context, function api.Function, params ...uint64) ([]uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("call not started: %w", err)
+	}
+	if err := env.calls.enter(); err != nil {
+		return nil, err
+	}
+	defer env.calls.leave()
+
+	if env.callHook == nil && env.memoryHook == nil && !env.profileLabels {
+		return function.Call(ctx, params...)
+	}
+
+	name := ""
+	if names := function.Definition().ExportNames(); len(names) > 0 {
+		name = names[0]
+	}
+	if env.callHook != nil {
+		env.callHook(name)
+	}
+	if env.memoryHook != nil {
+		before := env.memoryPages()
+		defer func() { env.memoryHook(name, uint64(env.memoryPages()-before)*65536) }()
+	}
+	if env.profileLabels {
+		return callLabelled(ctx, function, name, params)
+	}
+	return function.Call(ctx, params...)
 }
 
 func CloseRuntime(runtime wazero.Runtime, ctx context.Context) {
@@ -55,82 +192,268 @@ func CloseWasmModule(module api.Module, goContext context.Context) {
 	}
 }
 
-func InitWasm() (WasmEnv, error) {
-	ctx := context.Background()
-	// Create a new runtime
-	runtime := wazero.NewRuntime(ctx)
-
-	var sourceWasm []byte
-	var chosen string
+// FindWasmFile returns the first of the build outputs of the guest that exists.
+func FindWasmFile() (string, error) {
 	var err error
 	for _, candidate := range wasmCandidates {
-		sourceWasm, err = os.ReadFile(candidate)
-		if err == nil {
-			chosen = candidate
-			break
+		if _, err = os.Stat(candidate); err == nil {
+			return candidate, nil
 		}
 	}
-	if chosen == "" {
-		slog.Error("Unable to read wasm file from candidates", slog.Any("candidates", wasmCandidates), slog.Any("lastErr", err))
-		panic(nil)
+	return "", fmt.Errorf("no wasm file found among %v: %w", wasmCandidates, err)
+}
+
+// InitWasm instantiates the guest. Without WithWasmPath or WithWasmBytes, it loads the first of
+// the build outputs of the guest that exists, which overrides the guest embedded in the package,
+// or the embedded guest when there is none.
+func InitWasm(options ...Option) (WasmEnv, error) {
+	return instantiateOwned(CompileWasm(options...))
+}
+
+// CompileWasm compiles the guest InitWasm would instantiate, for any number of instances.
+func CompileWasm(options ...Option) (*CompiledModule, error) {
+	opts, err := newInitOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	source, name := opts.source, "wasm bytes"
+	switch {
+	case source != nil:
+	case opts.path != "":
+		if source, err = os.ReadFile(opts.path); err != nil {
+			return nil, fmt.Errorf("cannot read wasm file: %w", err)
+		}
+		name = opts.path
+	default:
+		source, name = embeddedWasm, embeddedName
+		if path, err := FindWasmFile(); err == nil {
+			if source, err = os.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("cannot read wasm file: %w", err)
+			}
+			name = path
+		}
+	}
+	opts.logger.Debug("loading guest", slog.String("source", name))
+
+	runtime, shared := opts.runtime, opts.runtime != nil
+	if !shared {
+		config := newRuntimeConfig()
+		if opts.cacheDir != "" {
+			cache, err := compilationCache(opts.cacheDir)
+			if err != nil {
+				return nil, err
+			}
+			config = config.WithCompilationCache(cache)
+		}
+		runtime = wazero.NewRuntimeWithConfig(opts.ctx, config)
+	}
+
+	compiled, err := compileWasmIn(opts.ctx, runtime, shared, source, name)
+	if compiled != nil {
+		compiled.logger = opts.logger
+	}
+	return compiled, err
+}
+
+// InitWasmFromFile instantiates the guest compiled at path.
+func InitWasmFromFile(path string) (WasmEnv, error) {
+	return instantiateOwned(CompileWasmFile(path))
+}
+
+// instantiateOwned creates the only instance of compiled, which owns its runtime unless it is
+// shared.
+func instantiateOwned(compiled *CompiledModule, err error) (WasmEnv, error) {
+	if err != nil {
+		return WasmEnv{}, err
+	}
+
+	env, err := compiled.Instantiate()
+	if err != nil {
+		_ = compiled.Close()
+		return WasmEnv{}, err
+	}
+	// The env is the only instance of the runtime, releasing it tears the runtime down.
+	if !compiled.shared {
+		env.runtime = compiled.runtime
+	}
+	return env, nil
+}
+
+// CompiledModule is the guest compiled once, to create any number of instances cheaply. Instances
+// do not share memory, each one is a WasmEnv of its own.
+type CompiledModule struct {
+	ctx      context.Context
+	path     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	logger   *slog.Logger
+	// shared is set for a runtime of WithSharedRuntime, which the module does not own.
+	shared bool
+}
+
+// CompileWasmFile compiles the guest at path and instantiates its host imports.
+func CompileWasmFile(path string) (*CompiledModule, error) {
+	sourceWasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read wasm file: %w", err)
+	}
+	return compileWasm(context.Background(), sourceWasm, path)
+}
+
+// compileWasm compiles the guest sourceWasm, named path in errors, and instantiates its host
+// imports.
+func compileWasm(ctx context.Context, sourceWasm []byte, path string) (*CompiledModule, error) {
+	return compileWasmIn(ctx, wazero.NewRuntimeWithConfig(ctx, newRuntimeConfig()), false, sourceWasm, path)
+}
+
+// newRuntimeConfig returns the configuration of the runtimes the package creates, which abort the
+// calls whose context is done, see CallContext.
+func newRuntimeConfig() wazero.RuntimeConfig {
+	return wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+}
+
+// compileWasmIn is compileWasm in runtime, closed on error unless it is shared.
+func compileWasmIn(ctx context.Context, runtime wazero.Runtime, shared bool, sourceWasm []byte, path string) (*CompiledModule, error) {
+	fail := func(err error) (*CompiledModule, error) {
+		if !shared {
+			_ = runtime.Close(ctx)
+		}
+		return nil, err
 	}
 
 	// Compile module
 	compiled, err := runtime.CompileModule(ctx, sourceWasm)
 	if err != nil {
-		slog.Error("Unable to compile wasm file", slog.String("file", chosen), slog.Any("err", err))
-		panic(nil)
+		return fail(fmt.Errorf("cannot compile %s: %w", path, err))
 	}
 
 	// Auto-instantiate host stubs for any imported functions (e.g., from "__wbindgen_placeholder__").
 	if err := InstantiateImportStubs(ctx, runtime, compiled); err != nil {
-		slog.Error("Unable to instantiate import stubs", slog.Any("err", err))
-		panic(nil)
+		_ = compiled.Close(ctx)
+		return fail(fmt.Errorf("cannot instantiate import stubs of %s: %w", path, err))
 	}
 
-	// Use default module config so the module's start function (if any) runs.
-	wasmConfig := wazero.NewModuleConfig()
+	return &CompiledModule{ctx: ctx, path: path, runtime: runtime, compiled: compiled, shared: shared}, nil
+}
 
-	module, err := runtime.InstantiateModule(ctx, compiled, wasmConfig)
+// Instantiate creates a new instance of the guest. It must be released with Close, which leaves
+// the compiled module and its other instances untouched.
+func (self *CompiledModule) Instantiate() (WasmEnv, error) {
+	// Use default module config so the module's start function (if any) runs. Anonymous modules
+	// can be instantiated any number of times.
+	wasmConfig := wazero.NewModuleConfig().WithName("")
 
+	// The host functions keep the JS side of the instance until the module is closed.
+	var module api.Module
+	ctx := withHostStateCleanup(self.ctx, &module)
+	module, err := self.runtime.InstantiateModule(ctx, self.compiled, wasmConfig)
 	if err != nil {
-		slog.Error("Unable to instantiate module", slog.Any("err", err))
-		panic(nil)
+		return WasmEnv{}, fmt.Errorf("cannot instantiate %s: %w", self.path, err)
 	}
 
 	return WasmEnv{
-		Ctx:    ctx,
-		Module: module,
+		Ctx:       self.ctx,
+		Module:    module,
+		logger:    self.logger,
+		calls:     newCallGate(),
+		lock:      &sync.Mutex{},
+		functions: map[string]api.Function{},
 	}, nil
 }
 
+// Close tears down the runtime of the compiled module, along with every instance created from it.
+// In a shared runtime, it only releases the compiled module.
+func (self *CompiledModule) Close() error {
+	if self.shared {
+		return self.compiled.Close(self.ctx)
+	}
+	return self.runtime.Close(self.ctx)
+}
+
+// release tears down the runtime owning the module, the env must not be used afterwards.
+func (env WasmEnv) release() error {
+	if env.runtime == nil {
+		return env.Module.Close(env.Ctx)
+	}
+	return env.runtime.Close(env.Ctx)
+}
+
+// MemoryStats describes the linear memory of a guest instance.
+type MemoryStats struct {
+	// Size is the current size of the guest memory in bytes. It only grows over the life of the
+	// instance.
+	Size uint64
+}
+
+func (env WasmEnv) MemoryStats() MemoryStats {
+	return MemoryStats{Size: uint64(env.memoryPages()) * 65536}
+}
+
+// memoryPages returns the number of 64 KiB pages of the guest memory, 0 without one.
+func (env WasmEnv) memoryPages() uint32 {
+	memory := env.Module.Memory()
+	if memory == nil {
+		return 0
+	}
+
+	// Size() overflows at the maximum of 65536 pages, Grow(0) reports the page count instead.
+	pages, _ := memory.Grow(0)
+	return pages
+}
+
+// Stats is a sample of the resources held by a guest instance, for leak detection: sampled
+// between operations, none of them should trend upward.
+type Stats struct {
+	// MemoryPages is the number of 64 KiB pages of the guest memory.
+	MemoryPages uint32
+	// Allocations is the number of buffers allocated from the host and neither freed nor handed
+	// off to an export. It is only counted by envs returned by WithAllocationTracking.
+	Allocations int
+	// Externrefs is the number of live entries of the externref mirror of the instance.
+	Externrefs uint32
+	// ExternrefTable is the number of entries of the externref mirror, reserved and released ones
+	// included: it only grows when more values are live at once, typed arrays included.
+	ExternrefTable uint32
+}
+
+// Stats samples the resources env holds.
+func (env WasmEnv) Stats() Stats {
+	return Stats{
+		MemoryPages:    uint32(env.MemoryStats().Size / 65536),
+		Allocations:    env.outstanding(),
+		Externrefs:     env.host().externrefLiveCount(),
+		ExternrefTable: uint32(len(env.host().mirror)),
+	}
+}
+
 func (env WasmEnv) Free(ptr uint64, length uint64) error {
 	free, err := env.GetFunction("__wbindgen_free")
 	if err != nil {
-		slog.Error("exported function not found", slog.String("name", "__wbindgen_free"))
 		return err
 	}
-	_, err = env.Call(free, ptr, length, 1)
-	return err
+	if _, err := env.Call(free, ptr, length, 1); err != nil {
+		return fmt.Errorf("__wbindgen_free failed: %w", err)
+	}
+	env.allocations.forget(ptr)
+	return nil
 }
 
 func (env WasmEnv) Malloc(length uint64) (uint64, error) {
 	malloc, err := env.GetFunction("__wbindgen_malloc")
 	if err != nil {
-		slog.Error("exported function not found", slog.String("name", "__wbindgen_malloc"))
 		return 0, err
 	}
 	results, err := env.Call(malloc, length, 1)
 	if err != nil {
-		slog.Error("malloc failed", slog.Any("err", err))
-		return 0, err
+		return 0, fmt.Errorf("__wbindgen_malloc of %d bytes failed: %w", length, err)
 	}
 
 	if len(results) != 1 {
-		slog.Error("malloc failed: unexpected return value")
 		return 0, fmt.Errorf("malloc failed: unexpected return value")
 	}
 
+	env.allocations.record(results[0], length)
 	return results[0], nil
 }
 
@@ -139,7 +462,8 @@ func (env WasmEnv) Malloc(length uint64) (uint64, error) {
 // 0: 4 bytes: string pointer
 // 4: 4 bytes: string length
 // This second pointer is the actual string data, we read the length and decode the string from memory
-// and free the return area.
+// and free the return area. A length above the result size limit of the env is rejected with
+// ErrResultTooLarge, see WithMaxResultSize.
 //
 // Memory Layout Diagram:
 // +----------------+     +-------------------+
@@ -159,30 +483,38 @@ func (env WasmEnv) GetStringValueFromPointer(ptr uint64) (string, error) {
 	mem := env.Module.Memory()
 	buf, ok := mem.Read(uint32(ptr), 8)
 	if !ok {
-		slog.Error("cannot read return area")
 		return "", fmt.Errorf("cannot read return area")
 	}
 	strPtr := binary.LittleEndian.Uint32(buf[0:4])
 	strLen := binary.LittleEndian.Uint32(buf[4:8])
 
 	// decode string from memory
-	strBytes, ok := mem.Read(strPtr, strLen)
-	if !ok {
-		panic("cannot read string")
-	}
-	stringData := string(strBytes)
-
-	err := env.Free(uint64(strPtr), uint64(strLen))
+	str, err := env.takeString(uint64(strPtr), uint64(strLen))
 	if err != nil {
-		slog.Error("cannot free string", slog.Uint64("ptr", uint64(strPtr)), slog.Uint64("len", uint64(strLen)))
 		return "", err
 	}
 
-	return stringData, nil
+	if err := env.Free(ptr, 8); err != nil {
+		return "", fmt.Errorf("cannot free return area at %d: %w", ptr, err)
+	}
+
+	return str, nil
 }
 
+// GetError returns the message of the error the guest threw as the externref idx. An index that
+// is not in the mirror, such as a guest pointer decoded from the wrong word of a return area, is
+// reported as an error rather than a panic.
 func (env WasmEnv) GetError(idx uint64) (string, error) {
-	switch data := ExternrefTableMirror[idx].(type) {
+	mirror := env.host().mirror
+	if idx >= uint64(len(mirror)) {
+		return "", fmt.Errorf("error index %d out of range (mirror size %d)", idx, len(mirror))
+	}
+	return errorMessage(mirror[idx])
+}
+
+// errorMessage renders a thrown value: a string as is, an object as its keys and values.
+func errorMessage(thrown any) (string, error) {
+	switch data := thrown.(type) {
 	default:
 		return "", fmt.Errorf("unknown error type")
 	case string:
@@ -0,0 +1,96 @@
+// Package wasmtest provides the guest module to tests of other packages.
+package wasmtest
+
+import (
+	"biscuit-wasm-go/wasm"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// wasmFile is the build output of the guest, relative to the repository root.
+const wasmFile = "target/wasm32-unknown-unknown/release/biscuit_wasm_go.wasm"
+
+var (
+	compileOnce sync.Once
+	compiled    *wasm.CompiledModule
+	compileErr  error
+
+	mu   sync.Mutex
+	envs = map[testing.TB]wasm.WasmEnv{}
+)
+
+// Compile compiles the guest once per process, looking for it from the working directory up to
+// the repository root. TestMain can call it to pay the compilation upfront; Env calls it anyway.
+func Compile() (*wasm.CompiledModule, error) {
+	compileOnce.Do(func() {
+		var path string
+		if path, compileErr = findWasmFile(); compileErr == nil {
+			compiled, compileErr = wasm.CompileWasmFile(path)
+		}
+	})
+	return compiled, compileErr
+}
+
+// Module returns the guest compiled by Compile, skipping the test when the guest was not built.
+func Module(t testing.TB) *wasm.CompiledModule {
+	t.Helper()
+
+	if _, err := findWasmFile(); err != nil {
+		t.Skip("biscuit_wasm_go.wasm not built")
+	}
+	module, err := Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return module
+}
+
+// Env returns the guest instance of t, skipping the test when the guest was not built. Every test
+// gets an isolated instance of the module compiled once per process, the same one however many
+// times it calls Env, closed when the test ends. Subtests get instances of their own.
+func Env(t testing.TB) wasm.WasmEnv {
+	t.Helper()
+
+	module := Module(t)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if env, ok := envs[t]; ok {
+		return env
+	}
+	env, err := module.Instantiate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	envs[t] = env
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(envs, t)
+		mu.Unlock()
+		_ = env.Close(context.Background())
+	})
+	return env
+}
+
+// findWasmFile returns the path of the guest from the working directory.
+func findWasmFile() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, wasmFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%s not found", wasmFile)
+		}
+		dir = parent
+	}
+}